@@ -0,0 +1,47 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+// Access modes checked by access, with the values of R_OK, W_OK, and X_OK.
+const (
+	accessRead  = 4
+	accessWrite = 2
+	accessExec  = 1
+)
+
+// IsReadable returns true if the current process may read the file at
+// path, or list it if it is a directory.
+//
+// On Unix systems, this is answered by the system with faccessat and the
+// effective user and group IDs, so that ACLs and the privileges of root are
+// taken into account. On Windows, the file is opened for reading. On other
+// systems, the permission bits are checked. In all cases, the answer may be
+// out of date by the time the file is used, so that errors from actually
+// using it must still be handled; an error is returned if path cannot be
+// checked at all, for example because it does not exist.
+func IsReadable(path string) (bool, error) {
+	return access(path, accessRead)
+}
+
+// IsWritable returns true if the current process may write to the file at
+// path, or create files in it if it is a directory. Files on read-only file
+// systems are not writable.
+//
+// On Windows, files are opened for writing without changing them, and
+// directories are always considered writable. See IsReadable for the other
+// systems.
+func IsWritable(path string) (bool, error) {
+	return access(path, accessWrite)
+}
+
+// IsExecutable returns true if the current process may execute the file at
+// path, or search it if it is a directory.
+//
+// On Windows, files are executable if their extensions are listed in
+// PATHEXT, and directories are always considered searchable. See
+// IsReadable for the other systems.
+func IsExecutable(path string) (bool, error) {
+	return access(path, accessExec)
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package osutil
+
+import "os"
+
+// access checks mode against the permission bits of path. As the owner of
+// the file is not known here, the mode is granted if any of the owner,
+// group, or others have it.
+func access(path string, mode uint32) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return uint32(fi.Mode().Perm())&(mode*0111) != 0, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccess(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	assert.Nil(ioutil.WriteFile(file, nil, 0600))
+	for _, tc := range []struct {
+		name string
+		fn   func(string) (bool, error)
+	}{
+		{"IsReadable", IsReadable},
+		{"IsWritable", IsWritable},
+	} {
+		ok, err := tc.fn(file)
+		assert.Nil(err, tc.name)
+		assert.True(ok, tc.name)
+		ok, err = tc.fn(dir)
+		assert.Nil(err, tc.name)
+		assert.True(ok, tc.name)
+	}
+
+	// Even root may not execute files without any execute bits.
+	ok, err := IsExecutable(file)
+	assert.Nil(err)
+	assert.False(ok)
+	assert.Nil(os.Chmod(file, 0700))
+	ok, err = IsExecutable(file)
+	assert.Nil(err)
+	assert.True(ok)
+	ok, err = IsExecutable(dir)
+	assert.Nil(err)
+	assert.True(ok)
+
+	// Root may read and write anything, so this can only be checked as
+	// other users.
+	if os.Geteuid() != 0 {
+		assert.Nil(os.Chmod(file, 0))
+		ok, err = IsReadable(file)
+		assert.Nil(err)
+		assert.False(ok)
+		ok, err = IsWritable(file)
+		assert.Nil(err)
+		assert.False(ok)
+	}
+
+	_, err = IsReadable(filepath.Join(dir, "missing"))
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package osutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// access checks mode for path with faccessat and the effective IDs.
+func access(path string, mode uint32) (bool, error) {
+	err := unix.Faccessat(unix.AT_FDCWD, path, mode, unix.AT_EACCESS)
+	switch err {
+	case nil:
+		return true, nil
+	case unix.EACCES, unix.EPERM, unix.EROFS, unix.ETXTBSY:
+		return false, nil
+	}
+	return false, &os.PathError{Op: "faccessat", Path: path, Err: err}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// access checks mode for path by opening it or looking at its extension.
+func access(path string, mode uint32) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case mode == accessRead:
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsPermission(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		f.Close()
+	case fi.IsDir():
+	case mode == accessWrite:
+		f, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			if os.IsPermission(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		f.Close()
+	case mode == accessExec:
+		exts := os.Getenv("PATHEXT")
+		if exts == "" {
+			exts = ".com;.exe;.bat;.cmd"
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		for _, e := range strings.Split(strings.ToLower(exts), ";") {
+			if ext != "" && e == ext {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
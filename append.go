@@ -0,0 +1,49 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import "os"
+
+// AppendToFile appends data to the file at path, creating it with perm,
+// before the umask, if it does not exist. With ExclusiveLock, the file is
+// locked while data is written, and with Fsync, it is synced to disk
+// before AppendToFile returns, as is needed for journals that must survive
+// a crash.
+//
+// To be locked on Windows, the file must be opened for reading as well, so
+// that appending with ExclusiveLock fails if it may not be read.
+func AppendToFile(path string, data []byte, perm os.FileMode, opts ...AppendOption) (err error) {
+	var o appendOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	flag := os.O_WRONLY | os.O_APPEND | os.O_CREATE
+	if o.lock {
+		flag = os.O_RDWR | os.O_APPEND | os.O_CREATE
+	}
+	f, err := os.OpenFile(path, flag, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if o.lock {
+		if err := lockFile(f, true, true); err != nil {
+			return &os.PathError{Op: "lock", Path: path, Err: err}
+		}
+		defer unlockFile(f)
+	}
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if o.fsync {
+		return f.Sync()
+	}
+	return nil
+}
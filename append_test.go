@@ -0,0 +1,54 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppendToFile(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "journal")
+
+	assert.Nil(AppendToFile(file, []byte("one\n"), 0600))
+	assert.Nil(AppendToFile(file, []byte("two\n"), 0644, Fsync()))
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(err)
+	assert.Equal("one\ntwo\n", string(data))
+	fi, err := os.Stat(file)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), fi.Mode().Perm())
+
+	// Locked appends from several goroutines are not interleaved, as they
+	// each open the file themselves.
+	assert.Nil(os.Remove(file))
+	record := bytes.Repeat([]byte("x"), 1<<16)
+	record[len(record)-1] = '\n'
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(AppendToFile(file, record, 0644, ExclusiveLock()))
+		}()
+	}
+	wg.Wait()
+	data, err = ioutil.ReadFile(file)
+	assert.Nil(err)
+	assert.Equal(bytes.Repeat(record, 8), data)
+
+	assert.NotNil(AppendToFile(filepath.Join(dir, "missing/file"), nil, 0644))
+}
@@ -0,0 +1,202 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrArHeader is returned by ArReader when it encounters a header that is
+// invalid.
+var ErrArHeader = errors.New("invalid ar header")
+
+const (
+	arMagic     = "!<arch>\n"
+	arHeaderLen = 60
+
+	// arMaxNames is the largest long-name table or long name that is read,
+	// as their sizes are taken from the untrusted header.
+	arMaxNames = 1 << 20
+)
+
+// ArReader provides sequential access to the contents of a Unix ar archive,
+// such as a Debian package or a static library. Both the GNU and the BSD
+// variants of long file names are supported; symbol tables are skipped.
+//
+// It is used like CpioReader: Next advances to the next entry, which is
+// described by a tar header, and the contents of the entry can then be read
+// from the ArReader itself. Since ar archives are flat, all entries are
+// regular files.
+type ArReader struct {
+	r   io.Reader
+	err error
+
+	// names is the GNU long-name table, if the archive has one.
+	names []byte
+
+	// remaining is the number of bytes of the current entry that have not
+	// been read, and pad the number of padding bytes following them.
+	remaining int64
+	pad       int64
+	started   bool
+}
+
+// NewArReader creates a new ArReader reading from r.
+func NewArReader(r io.Reader) *ArReader {
+	return &ArReader{r: r}
+}
+
+// Next advances to the next entry in the archive. At the end of the archive,
+// io.EOF is returned.
+func (ar *ArReader) Next() (*tar.Header, error) {
+	if ar.err != nil {
+		return nil, ar.err
+	}
+	hdr, err := ar.next()
+	if err != nil {
+		ar.err = err
+	}
+	return hdr, err
+}
+
+func (ar *ArReader) next() (*tar.Header, error) {
+	if !ar.started {
+		ar.started = true
+		var magic [len(arMagic)]byte
+		if _, err := io.ReadFull(ar.r, magic[:]); err != nil {
+			return nil, ErrArHeader
+		}
+		if string(magic[:]) != arMagic {
+			return nil, ErrArHeader
+		}
+	}
+
+	for {
+		// Skip the rest of the previous entry.
+		if _, err := io.CopyN(ioutil.Discard, ar.r, ar.remaining+ar.pad); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		ar.remaining, ar.pad = 0, 0
+
+		var buf [arHeaderLen]byte
+		if _, err := io.ReadFull(ar.r, buf[:]); err == io.EOF {
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if string(buf[58:60]) != "`\n" {
+			return nil, ErrArHeader
+		}
+
+		field := func(start, end int) string {
+			return strings.TrimRight(string(buf[start:end]), " ")
+		}
+		number := func(start, end, base int) (int64, error) {
+			s := field(start, end)
+			if s == "" {
+				return 0, nil
+			}
+			n, err := strconv.ParseInt(s, base, 64)
+			if err != nil || n < 0 {
+				return 0, ErrArHeader
+			}
+			return n, nil
+		}
+		var nums [5]int64
+		for i, f := range []struct{ start, end, base int }{
+			{16, 28, 10}, {28, 34, 10}, {34, 40, 10}, {40, 48, 8}, {48, 58, 10},
+		} {
+			var err error
+			if nums[i], err = number(f.start, f.end, f.base); err != nil {
+				return nil, err
+			}
+		}
+		mtime, uid, gid, mode, size := nums[0], nums[1], nums[2], nums[3], nums[4]
+		ar.remaining, ar.pad = size, size%2
+
+		name := field(0, 16)
+		switch {
+		case name == "//":
+			// The GNU long-name table.
+			if size > arMaxNames {
+				return nil, ErrArHeader
+			}
+			ar.names = make([]byte, size)
+			if _, err := io.ReadFull(ar, ar.names); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			continue
+		case name == "/" || name == "/SYM64/" || strings.HasPrefix(name, "__.SYMDEF"):
+			// Symbol tables.
+			continue
+		case strings.HasPrefix(name, "#1/"):
+			// BSD long names precede the contents.
+			n, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || n < 0 || n > size || n > arMaxNames {
+				return nil, ErrArHeader
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(ar, b); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			name = strings.TrimRight(string(b), "\x00")
+			size -= n
+		case strings.HasPrefix(name, "/"):
+			// GNU long names are offsets into the long-name table.
+			off, err := strconv.Atoi(name[1:])
+			if err != nil || off < 0 || off >= len(ar.names) {
+				return nil, ErrArHeader
+			}
+			b := ar.names[off:]
+			if i := bytes.IndexByte(b, '\n'); i >= 0 {
+				b = b[:i]
+			}
+			name = strings.TrimSuffix(string(b), "/")
+		default:
+			// GNU terminates short names with a slash.
+			name = strings.TrimSuffix(name, "/")
+		}
+
+		return &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     mode & 07777,
+			Uid:      int(uid),
+			Gid:      int(gid),
+			Size:     size,
+			ModTime:  time.Unix(mtime, 0),
+		}, nil
+	}
+}
+
+// Read reads from the contents of the current entry. It returns io.EOF at
+// the end of the entry, until Next is called.
+func (ar *ArReader) Read(p []byte) (int, error) {
+	if ar.err != nil {
+		return 0, ar.err
+	}
+	if ar.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > ar.remaining {
+		p = p[:ar.remaining]
+	}
+	n, err := ar.r.Read(p)
+	ar.remaining -= int64(n)
+	if err == io.EOF && ar.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		ar.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// arEntry returns an ar entry with the given raw name field.
+func arEntry(name, data string) []byte {
+	entry := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n%s", name, 0, 0, 0, 0644, len(data), data)
+	if len(data)%2 != 0 {
+		entry += "\n"
+	}
+	return []byte(entry)
+}
+
+func TestArReader(z *testing.T) {
+	assert := assert.New(z)
+
+	archive := []byte(arMagic)
+	archive = append(archive, arEntry("/", "\x00\x00\x00\x00")...)
+	archive = append(archive, arEntry("//", "a_very_long_file_name.o/\n")...)
+	archive = append(archive, arEntry("short.o/", "short")...)
+	archive = append(archive, arEntry("/0", "long")...)
+	archive = append(archive, arEntry("#1/12", "bsd_name.txtbsd")...)
+
+	ar := NewArReader(bytes.NewReader(archive))
+	var names, contents []string
+	for {
+		hdr, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(err) {
+			return
+		}
+		assert.Equal(byte(tar.TypeReg), hdr.Typeflag)
+		assert.Equal(int64(0644), hdr.Mode)
+		data, err := ioutil.ReadAll(ar)
+		assert.Nil(err)
+		assert.Equal(hdr.Size, int64(len(data)))
+		names = append(names, hdr.Name)
+		contents = append(contents, string(data))
+	}
+	assert.Equal([]string{"short.o", "a_very_long_file_name.o", "bsd_name.txt"}, names)
+	assert.Equal([]string{"short", "long", "bsd"}, contents)
+
+	_, err := NewArReader(bytes.NewReader([]byte("!<arch>\nshort"))).Next()
+	assert.Equal(io.ErrUnexpectedEOF, err)
+	_, err = NewArReader(bytes.NewReader([]byte("not an ar archive"))).Next()
+	assert.Equal(ErrArHeader, err)
+
+	// Huge declared sizes of long names are not allocated.
+	for _, name := range []string{"//", "#1/9999999999"} {
+		hdr := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, 0644, int64(9999999999))
+		_, err = NewArReader(strings.NewReader(arMagic + hdr)).Next()
+		assert.Equal(ErrArHeader, err, name)
+	}
+}
+
+func TestDebPackage(z *testing.T) {
+	assert := assert.New(z)
+
+	const deb = "testdata/hello.deb"
+	entries, err := ListArchive(deb)
+	assert.Nil(err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	assert.Equal([]string{"debian-binary", "control.tar.gz", "data.tar.gz"}, names)
+
+	data, err := ReadFileFromArchive(deb, "debian-binary")
+	assert.Nil(err)
+	assert.Equal("2.0\n", string(data))
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(ExtractArchive(deb, dir))
+	data, err = ReadFileFromArchive(filepath.Join(dir, "data.tar.gz"), "./usr/share/doc/hello/README")
+	assert.Nil(err)
+	assert.Equal("Hello, world!\n", string(data))
+}
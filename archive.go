@@ -0,0 +1,885 @@
+// Copyright (c) 2014, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// Decompressor is a universal decompressor that, given a filepath,
+// chooses the appropriate decompression algorithm.
+//
+// At the moment, only the gzip, bzip2, xz, zstd, and lz4 formats are
+// supported. The decompressor needs to be closed after usage.
+//
+// Files that consist of several concatenated gzip members, bzip2 or xz
+// streams, or zstd or lz4 frames, such as those written by pigz or by
+// concatenating compressed files, are decompressed as a whole, like gunzip
+// and the other command-line tools do. Files are read through a buffer, so
+// that the small reads of the decompressors remain cheap.
+type Decompressor struct {
+	file   io.Closer
+	src    io.Reader
+	reader io.Reader
+
+	// xzHeader is the parsed stream header of an xz file.
+	xzHeader *XZHeader
+
+	// limit is the maximum number of bytes that may be read, if positive.
+	limit int64
+	n     int64
+}
+
+// NewDecompressor creates a new decompressor based on the file extension
+// of the given file. If the extension is not recognized, the format is
+// detected from the first few bytes of the file. If filepath is the first
+// volume of a split file, ending in .001, all its volumes are read in turn.
+// If filepath is "-", standard input is read, which is not closed by Close,
+// so that command-line tools can read from a pipe.
+// The returned Decompressor can be Read and Closed.
+//
+// Options supported are MaxTotalBytes, which protects against decompression
+// bombs, and ParallelGzip.
+func NewDecompressor(filepath string, opts ...Option) (*Decompressor, error) {
+	return newDecompressor(filepath, newArchiveOptions(opts))
+}
+
+// NewDecompressorWithFormat is the same as NewDecompressor, except that
+// the file is decompressed in the given format, regardless of its extension.
+// This is useful for files whose names do not reveal their format. If
+// format is FormatUnknown, the format is detected from the contents of
+// the file.
+func NewDecompressorWithFormat(filepath string, format Format, opts ...Option) (*Decompressor, error) {
+	return openDecompressor(filepath, format, newArchiveOptions(opts))
+}
+
+// newDecompressor does the hard work for NewDecompressor.
+func newDecompressor(filepath string, o *archiveOptions) (*Decompressor, error) {
+	return openDecompressor(filepath, formatFromExt(filepath), o)
+}
+
+// stdinName is the file name that refers to standard input.
+const stdinName = "-"
+
+// openDecompressor opens filepath and decompresses it in the format, which
+// is detected from the contents of the file if it is FormatUnknown.
+func openDecompressor(filepath string, format Format, o *archiveOptions) (*Decompressor, error) {
+	if filepath == stdinName {
+		// Standard input is left open, since it is not ours to close.
+		return openStreamDecompressor(filepath, os.Stdin, nil, format, o)
+	}
+	if _, ok := volumeBase(filepath); ok {
+		vr, err := OpenVolumes(filepath)
+		if err != nil {
+			return nil, err
+		}
+		return openStreamDecompressor(filepath, vr, vr, format, o)
+	}
+
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatUnknown {
+		format, err = DetectFormat(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	// Decompressors read in small pieces, which are expensive to read
+	// from the file directly.
+	d, err := newDecompressorReader(bufio.NewReaderSize(f, bufferSize), format, o)
+	if err != nil {
+		f.Close()
+		if _, ok := err.(FormatError); ok {
+			err = FormatError{filepath}
+		}
+		return nil, err
+	}
+	d.file = f
+	return d, nil
+}
+
+// openStreamDecompressor is the same as openDecompressor, except that the
+// data named filepath is read from r, which cannot seek, such as the
+// sequence of volumes starting with the volume filepath. If c is not nil,
+// it is closed together with the Decompressor.
+func openStreamDecompressor(filepath string, r io.Reader, c io.Closer, format Format, o *archiveOptions) (*Decompressor, error) {
+	closeSource := func() {
+		if c != nil {
+			c.Close()
+		}
+	}
+
+	br := bufio.NewReaderSize(r, bufferSize)
+	if format == FormatUnknown {
+		buf, err := br.Peek(magicLen)
+		if err != nil && err != io.EOF {
+			closeSource()
+			return nil, err
+		}
+		format = detectFormat(buf)
+	}
+
+	d, err := newDecompressorReader(br, format, o)
+	if err != nil {
+		closeSource()
+		if _, ok := err.(FormatError); ok {
+			err = FormatError{filepath}
+		}
+		return nil, err
+	}
+	if c != nil {
+		d.file = c
+	}
+	return d, nil
+}
+
+// NewDecompressorReader creates a new decompressor that decompresses the
+// data read from r, which is in the given format. This allows decompressing
+// data that does not come from a file, such as the body of an HTTP response
+// or standard input. Closing the Decompressor does not close r.
+//
+// Options supported are the same as for NewDecompressor.
+func NewDecompressorReader(r io.Reader, format Format, opts ...Option) (*Decompressor, error) {
+	return newDecompressorReader(r, format, newArchiveOptions(opts))
+}
+
+// NewDecompressorReaderDetect is the same as NewDecompressorReader, except
+// that the format is detected from the first few bytes read from r.
+func NewDecompressorReaderDetect(r io.Reader, opts ...Option) (*Decompressor, error) {
+	br := bufio.NewReaderSize(r, magicLen)
+	buf, err := br.Peek(magicLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return newDecompressorReader(br, detectFormat(buf), newArchiveOptions(opts))
+}
+
+// newDecompressorReader does the hard work for NewDecompressorReader.
+func newDecompressorReader(src io.Reader, format Format, o *archiveOptions) (*Decompressor, error) {
+	var r io.Reader
+	var xzHeader *XZHeader
+	var err error
+	switch format {
+	case FormatTar, FormatCpio, FormatAr:
+		r = src
+	case FormatGzip:
+		r, err = newGzipReader(src, o)
+	case FormatBzip2:
+		r = bzip2.NewReader(src)
+	case FormatXZ:
+		var buf [xzHeaderLen]byte
+		var n int
+		n, err = io.ReadFull(src, buf[:])
+		xzHeader = parseXZHeader(buf[:n])
+		if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+			r, err = xz.NewReader(io.MultiReader(bytes.NewReader(buf[:n]), src))
+		}
+	case FormatZstd:
+		r, err = newZstdReader(src)
+	case FormatLZ4:
+		r = newLZ4Reader(src)
+	default:
+		err = FormatError{"stream"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decompressor{
+		src:      src,
+		reader:   r,
+		xzHeader: xzHeader,
+		limit:    o.maxTotalBytes,
+	}, nil
+}
+
+// Read reads the decompressed data into p.
+func (d *Decompressor) Read(p []byte) (n int, err error) {
+	n, err = d.reader.Read(p)
+	d.n += int64(n)
+	if d.limit > 0 && d.n > d.limit {
+		return n, LimitError{"MaxTotalBytes", d.limit}
+	}
+	return n, err
+}
+
+// Close closes the underlying file, if the Decompressor was created with
+// NewDecompressor, and releases any resources held by the decompression
+// algorithm.
+func (d *Decompressor) Close() error {
+	if c, ok := d.reader.(io.Closer); ok && d.reader != d.src {
+		c.Close()
+	}
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
+
+// newGzipReader returns a gzip reader for r, which decompresses ahead of
+// the caller in its own goroutine if requested by ParallelGzip.
+func newGzipReader(r io.Reader, o *archiveOptions) (io.Reader, error) {
+	if !o.parallelGzip {
+		return gzip.NewReader(r)
+	}
+	return pgzip.NewReaderN(r, o.gzipBlockSize, o.gzipBlocks)
+}
+
+// lz4Reader is an lz4 reader that continues with the next frame once a
+// frame ends, as the lz4 reader stops after the first one.
+type lz4Reader struct {
+	br *bufio.Reader
+	zr *lz4.Reader
+}
+
+func newLZ4Reader(r io.Reader) *lz4Reader {
+	br := bufio.NewReader(r)
+	return &lz4Reader{br: br, zr: lz4.NewReader(br)}
+}
+
+func (lr *lz4Reader) Read(p []byte) (int, error) {
+	for {
+		n, err := lr.zr.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if _, perr := lr.br.Peek(1); perr != nil {
+			// There is no further frame.
+			return n, err
+		}
+		lr.zr.Reset(lr.br)
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// newZstdReader returns a zstd decoder reading from r. The decoder
+// runs in the calling goroutine, so it can be discarded after Close.
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// ReadFileFromArchive tries to read the file specified from the (compressed)
+// archive. Archive formats supported are: .tar, .tar.gz, .tar.bz2, .tar.xz,
+// .tar.zst, .tar.lz4, .zip, and .7z, as well as the shorthands .tgz, .tbz,
+// .tbz2, .txz, and .tzst. Cpio archives, such as .cpio and .cpio.gz, are
+// supported as well, as are ar archives, such as .deb packages. The
+// members of a .deb package are archives themselves, which can be read
+// after extracting them. SquashFS images, such as .sqsh and .snap, and
+// ISO9660 images, with Rock Ridge and Joliet extensions, can be read but
+// not created. If archive is "-", it is read from standard input, in which
+// case only the formats that do not need random access can be read, which
+// excludes zip, 7z, SquashFS, and ISO9660.
+//
+// Options supported are ReportProgress, ParallelGzip, Password, the limits
+// MaxEntries, MaxEntryBytes, and MaxTotalBytes, IgnoreCase and
+// IgnoreDotSlash, which make the lookup more lenient, and Tolerant. With
+// Tolerant, a file that is found in a damaged archive is returned together
+// with a DamagedError.
+func ReadFileFromArchive(archive, file string, opts ...Option) ([]byte, error) {
+	return ReadFileFromArchiveContext(context.Background(), archive, file, opts...)
+}
+
+// ReadFileFromArchiveContext is the same as ReadFileFromArchive, except that
+// it stops with the error of ctx once ctx is done.
+func ReadFileFromArchiveContext(ctx context.Context, archive, file string, opts ...Option) ([]byte, error) {
+	o := newArchiveOptions(opts)
+	progress := newProgressTracker(o)
+	progress.count(archive)
+	limits := newLimiter(o)
+
+	var data []byte
+	found := false
+	err := walkArchiveContext(ctx, archive, o, func(hdr *tar.Header, r io.Reader) error {
+		progress.entry(hdr.Name)
+		if err := limits.entry(); err != nil {
+			return err
+		}
+		if !o.matchName(hdr.Name, file) {
+			return nil
+		}
+
+		var err error
+		if data, err = readEntry(limits.reader(hdr, progress.reader(r)), hdr.Size); err != nil {
+			return err
+		}
+		found = true
+		return StopWalk
+	})
+	if _, ok := err.(DamagedError); ok && found {
+		return data, err
+	} else if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, NotFoundError{file}
+	}
+	return data, nil
+}
+
+// ReadFilesFromArchive is the same as ReadFileFromArchive, except that all
+// of the requested files are read in a single pass through the archive.
+// The returned map contains the contents of each file found, indexed by name.
+//
+// If some of the files cannot be found, the files that were found are
+// returned together with a MissingFilesError listing the others.
+func ReadFilesFromArchive(archive string, files ...string) (map[string][]byte, error) {
+	wanted := make(map[string]bool, len(files))
+	for _, f := range files {
+		wanted[f] = true
+	}
+
+	found := make(map[string][]byte, len(files))
+	err := WalkArchive(archive, func(hdr *tar.Header, r io.Reader) error {
+		if !wanted[hdr.Name] {
+			return nil
+		}
+		data, err := readEntry(r, hdr.Size)
+		if err != nil {
+			return err
+		}
+		found[hdr.Name] = data
+		delete(wanted, hdr.Name)
+		if len(wanted) == 0 {
+			return StopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wanted) != 0 {
+		var missing []string
+		for _, f := range files {
+			if wanted[f] {
+				missing = append(missing, f)
+				delete(wanted, f)
+			}
+		}
+		return found, MissingFilesError{missing}
+	}
+	return found, nil
+}
+
+// ReadFileFromArchiveGlob is the same as ReadFileFromArchive, except that
+// the first regular file whose name matches pattern is read.
+// The pattern syntax is that of path.Match, so that * does not match /.
+// The same options are supported as by ReadFileFromArchive.
+func ReadFileFromArchiveGlob(archive, pattern string, opts ...Option) ([]byte, error) {
+	// Make sure the pattern is valid before reading the archive.
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	o := newArchiveOptions(opts)
+	progress := newProgressTracker(o)
+	progress.count(archive)
+	limits := newLimiter(o)
+
+	var data []byte
+	found := false
+	err := walkArchive(archive, o, func(hdr *tar.Header, r io.Reader) error {
+		progress.entry(hdr.Name)
+		if err := limits.entry(); err != nil {
+			return err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			return nil
+		}
+		if ok, _ := path.Match(pattern, hdr.Name); !ok {
+			return nil
+		}
+
+		var err error
+		data, err = readEntry(limits.reader(hdr, progress.reader(r)), hdr.Size)
+		if err != nil {
+			return err
+		}
+		found = true
+		return StopWalk
+	})
+	if _, ok := err.(DamagedError); ok && found {
+		return data, err
+	} else if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, NotFoundError{pattern}
+	}
+	return data, nil
+}
+
+// archiveFormat returns the format of the archive, as identified by its
+// extension or else by its magic bytes.
+func archiveFormat(archive string) (Format, error) {
+	if archive == stdinName {
+		// The format is detected when reading.
+		return FormatUnknown, nil
+	}
+	if format := formatFromExt(archive); format != FormatUnknown {
+		return format, nil
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return FormatUnknown, err
+	}
+	defer f.Close()
+	return DetectFormat(f)
+}
+
+// ReadFileFromTar tries to read the file specified from an opened tar file.
+// This is useful when the tar file does not come from ReadFileFromArchive.
+//
+// Options supported are IgnoreCase and IgnoreDotSlash.
+func ReadFileFromTar(tr *tar.Reader, file string, opts ...Option) ([]byte, error) {
+	o := newArchiveOptions(opts)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil, NotFoundError{file}
+			}
+			return nil, err
+		}
+
+		if o.matchName(hdr.Name, file) {
+			return readEntry(tr, hdr.Size)
+		}
+	}
+}
+
+// DirReader returns a reader that streams the contents of all regular files
+// under the directory dir in the opened tar file, one after another.
+// Files in subdirectories are included, and files are read in archive
+// order, which is usually depth-first. Other entries, such as directories
+// and symlinks, are skipped. If dir is empty or ".", all regular files
+// in the archive are read.
+//
+// The tar reader is read lazily, so it must not be used otherwise while
+// reading from the returned reader.
+func DirReader(tr *tar.Reader, dir string) io.Reader {
+	return &dirReader{tr: tr, dir: dir}
+}
+
+// dirReader is the reader returned by DirReader.
+type dirReader struct {
+	tr  *tar.Reader
+	dir string
+
+	// inFile is true while the contents of a matching file are being read.
+	inFile bool
+	err    error
+}
+
+func (dr *dirReader) Read(p []byte) (int, error) {
+	for dr.err == nil {
+		if !dr.inFile {
+			hdr, err := dr.tr.Next()
+			if err != nil {
+				dr.err = err
+				break
+			}
+			dr.inFile = hdr.FileInfo().Mode().IsRegular() && inDir(hdr.Name, dr.dir)
+			continue
+		}
+
+		n, err := dr.tr.Read(p)
+		if err == io.EOF {
+			dr.inFile = false
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+	return 0, dr.err
+}
+
+// DirEntries returns an iterator over all entries under the directory dir
+// in the opened tar file, at any depth and in archive order. Unlike
+// DirReader, it keeps files apart and includes entries of every type.
+// If dir is empty or ".", all entries in the archive are returned.
+//
+// It is used like bufio.Scanner:
+//
+//	it := DirEntries(tr, "usr/share")
+//	for it.Next() {
+//		hdr, r := it.Header(), it.Reader()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+func DirEntries(tr *tar.Reader, dir string) *DirIterator {
+	return &DirIterator{tr: tr, dir: dir}
+}
+
+// DirIterator iterates over the entries of a directory in a tar file.
+// It is returned by DirEntries.
+type DirIterator struct {
+	tr  *tar.Reader
+	dir string
+	hdr *tar.Header
+	err error
+}
+
+// Next advances to the next entry under the directory, which is then
+// available through Header and Reader. It returns false once there are no
+// more entries or an error occurred.
+func (it *DirIterator) Next() bool {
+	it.hdr = nil
+	if it.err != nil {
+		return false
+	}
+	for {
+		hdr, err := it.tr.Next()
+		if err != nil {
+			if err != io.EOF {
+				it.err = err
+			}
+			return false
+		}
+		if inDir(hdr.Name, it.dir) {
+			it.hdr = hdr
+			return true
+		}
+	}
+}
+
+// Header returns the header of the current entry.
+func (it *DirIterator) Header() *tar.Header {
+	return it.hdr
+}
+
+// Reader returns a reader for the contents of the current entry, which is
+// only valid until the next call to Next.
+func (it *DirIterator) Reader() io.Reader {
+	return it.tr
+}
+
+// Err returns the first error that occurred while iterating, if any.
+func (it *DirIterator) Err() error {
+	return it.err
+}
+
+// inDir returns true if the entry name lies within the directory dir of
+// the archive, at any depth. An empty dir or "." contains every entry.
+func inDir(name, dir string) bool {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if dir == "" {
+		return name != ""
+	}
+	return strings.HasPrefix(name, dir+"/")
+}
+
+// ArchiveEntry describes a single entry in an archive.
+type ArchiveEntry struct {
+	Name     string
+	Linkname string
+	Size     int64
+	Mode     os.FileMode
+	ModTime  time.Time
+
+	// Type is one of the tar.Type* constants, also for zip archives.
+	Type byte
+}
+
+// ListArchive returns the entries of the (compressed) archive, in archive
+// order, without extracting them.
+// Archive formats supported are the same as for ReadFileFromArchive.
+//
+// The only option supported is Tolerant, with which the entries that could
+// be recovered from a damaged archive are returned together with a
+// DamagedError.
+func ListArchive(archive string, opts ...Option) ([]ArchiveEntry, error) {
+	var entries []ArchiveEntry
+	err := walkArchive(archive, newArchiveOptions(opts), func(hdr *tar.Header, r io.Reader) error {
+		entries = append(entries, ArchiveEntry{
+			Name:     hdr.Name,
+			Linkname: hdr.Linkname,
+			Size:     hdr.Size,
+			Mode:     hdr.FileInfo().Mode(),
+			ModTime:  hdr.ModTime,
+			Type:     hdr.Typeflag,
+		})
+		return nil
+	})
+	if _, ok := err.(DamagedError); ok {
+		return entries, err
+	} else if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// StopWalk can be returned by the function passed to WalkArchive to stop
+// walking the archive without WalkArchive returning an error.
+var StopWalk = errors.New("stop walking archive")
+
+// WalkArchive calls fn for each entry in the (compressed) archive, in a
+// single pass and in archive order, so that the contents of each entry can
+// be streamed from r. Entries of zip archives are described by a tar header
+// as well. The reader passed to fn is only valid until fn returns.
+//
+// If fn returns an error, walking stops and the error is returned,
+// unless it is StopWalk, in which case nil is returned.
+// Archive formats supported are the same as for ReadFileFromArchive.
+func WalkArchive(archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	return walkArchive(archive, newArchiveOptions(nil), fn)
+}
+
+// WalkArchiveContext is the same as WalkArchive, except that it stops with
+// the error of ctx once ctx is done. This is checked before each entry and
+// whenever fn reads from r.
+func WalkArchiveContext(ctx context.Context, archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	return walkArchiveContext(ctx, archive, newArchiveOptions(nil), fn)
+}
+
+// walkArchiveContext is the same as WalkArchiveContext, except that the
+// archive is decompressed according to the options o.
+func walkArchiveContext(ctx context.Context, archive string, o *archiveOptions, fn func(hdr *tar.Header, r io.Reader) error) error {
+	return walkArchive(archive, o, func(hdr *tar.Header, r io.Reader) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(hdr, &ctxReader{ctx, r})
+	})
+}
+
+// ctxReader is a reader that fails once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// walkArchive is the same as WalkArchive, except that the archive is
+// decompressed according to the options o.
+func walkArchive(archive string, o *archiveOptions, fn func(hdr *tar.Header, r io.Reader) error) error {
+	err := walkEntries(archive, o, fn)
+	if err == StopWalk {
+		return nil
+	}
+	return err
+}
+
+// walkEntries does the hard work for walkArchive.
+func walkEntries(archive string, o *archiveOptions, fn func(hdr *tar.Header, r io.Reader) error) error {
+	format, err := archiveFormat(archive)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case FormatZip, Format7z, FormatSquashFS, FormatISO9660:
+		if _, ok := volumeBase(archive); ok {
+			// These formats need random access to the archive.
+			return FormatError{archive}
+		}
+		switch format {
+		case FormatZip:
+			return walkZip(archive, o.password, fn)
+		case FormatSquashFS:
+			return walkSquashFS(archive, fn)
+		case FormatISO9660:
+			return walkISO9660(archive, fn)
+		}
+		return walk7z(archive, o.password, fn)
+	}
+
+	d, err := newDecompressor(archive, o)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	// For archive operations, MaxTotalBytes applies to the contents of the
+	// entries and is enforced by a limiter, not to the tar stream itself.
+	d.limit = 0
+
+	// Compressed archives may contain a tar, a cpio, or an ar archive.
+	br := bufio.NewReader(d)
+	var tr entryReader
+	sig, _ := br.Peek(len(arMagic))
+	switch detectFormat(sig) {
+	case FormatCpio:
+		tr = NewCpioReader(br)
+	case FormatAr:
+		tr = NewArReader(br)
+	default:
+		if o.tolerant {
+			return walkTarTolerant(archive, br, fn)
+		}
+		tr = tar.NewReader(br)
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// entryReader is implemented by tar.Reader, CpioReader, and ArReader.
+type entryReader interface {
+	io.Reader
+	Next() (*tar.Header, error)
+}
+
+// walkZip is the same as walkEntries, but only for zip archives.
+// Encrypted files are decrypted with password.
+func walkZip(archive, password string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(file, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if err := walkZipFile(file, f, password, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkZipFile calls fn with a tar header describing the zip file f,
+// which is contained in the archive ra.
+func walkZipFile(ra io.ReaderAt, f *zip.File, password string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	var rc io.ReadCloser
+	var err error
+	if f.Flags&zipFlagEncrypted != 0 {
+		rc, err = openEncryptedZipFile(ra, f, password)
+		if _, ok := err.(PasswordError); ok {
+			// The entry can still be listed without the password.
+			rc, err = ioutil.NopCloser(errReader{err}), nil
+		}
+	} else {
+		rc, err = f.Open()
+	}
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	uid, gid, ok := zipOwner(f.Extra)
+	return walkFile(f.Name, f.FileInfo(), f.Modified, rc, func(hdr *tar.Header, r io.Reader) error {
+		if ok {
+			hdr.Uid, hdr.Gid = uid, gid
+		}
+		return fn(hdr, r)
+	})
+}
+
+// walk7z is the same as walkEntries, but only for 7z archives.
+// Encrypted archives are decrypted with password.
+func walk7z(archive, password string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	zr, err := sevenzip.OpenReaderWithPassword(archive, password)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if err := walk7zFile(f, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk7zFile calls fn with a tar header describing the 7z file f.
+func walk7zFile(f *sevenzip.File, fn func(hdr *tar.Header, r io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	// Unlike tar and zip archives, 7z archives do not mark directory names
+	// with a trailing slash.
+	fi := f.FileInfo()
+	name := f.Name
+	if fi.IsDir() && !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	return walkFile(name, fi, f.Modified, rc, fn)
+}
+
+// walkFile calls fn with a tar header describing the file of a zip or 7z
+// archive named name, whose contents are read from r.
+func walkFile(name string, fi os.FileInfo, modified time.Time, r io.Reader, fn func(hdr *tar.Header, r io.Reader) error) error {
+	// Zip and 7z archives store the target of a symlink as its contents,
+	// which may be much longer than any path in a malicious archive.
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		data, err := ioutil.ReadAll(io.LimitReader(r, cpioMaxPath+1))
+		if err != nil {
+			return err
+		}
+		if len(data) > cpioMaxPath {
+			return fmt.Errorf("%s: symlink target is longer than %d bytes", name, cpioMaxPath)
+		}
+		link = string(data)
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	hdr.ModTime = modified
+	return fn(hdr, r)
+}
@@ -0,0 +1,416 @@
+// Copyright (c) 2014, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testarchives = []string{
+	"testdata/dir_reader_data.tar",
+	"testdata/dir_reader_data.tar.gz",
+	"testdata/dir_reader_data.tar.bz2",
+	"testdata/dir_reader_data.tar.xz",
+	"testdata/dir_reader_data.tar.zst",
+	"testdata/dir_reader_data.tar.lz4",
+	"testdata/dir_reader_data.zip",
+	"testdata/dir_reader_data.7z",
+	"testdata/dir_reader_data.cpio",
+	"testdata/dir_reader_data.cpio.gz",
+	"testdata/dir_reader_data.sqsh",
+	"testdata/dir_reader_data.iso",
+}
+
+func TestReadFileFromArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		data, err := ReadFileFromArchive(archive, "dir1/file1")
+		assert.Nil(err, archive)
+		assert.Equal("dir1/file1 content\n", string(data), archive)
+
+		_, err = ReadFileFromArchive(archive, "dir1/file3")
+		assert.Equal(NotFoundError{"dir1/file3"}, err, archive)
+	}
+
+	_, err := ReadFileFromArchive(testfile, "dir1/file1")
+	assert.Equal(FormatError{testfile}, err)
+}
+
+func TestListArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		entries, err := ListArchive(archive)
+		assert.Nil(err, archive)
+		assert.Len(entries, 7, archive)
+
+		sizes := make(map[string]int64)
+		for _, e := range entries {
+			sizes[e.Name] = e.Size
+			if e.Name == "dir1/" {
+				assert.Equal(byte(tar.TypeDir), e.Type, archive)
+				assert.True(e.Mode.IsDir(), archive)
+			}
+		}
+		assert.Equal(int64(19), sizes["dir1/file1"], archive)
+		assert.Equal(int64(50), sizes["dir2/file3"], archive)
+	}
+}
+
+func TestWalkArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		var names []string
+		contents := make(map[string]string)
+		err := WalkArchive(archive, func(hdr *tar.Header, r io.Reader) error {
+			names = append(names, hdr.Name)
+			data, err := ioutil.ReadAll(r)
+			contents[hdr.Name] = string(data)
+			return err
+		})
+		assert.Nil(err, archive)
+		assert.Len(names, 7, archive)
+		assert.Equal("dir1/file2 content\n", contents["dir1/file2"], archive)
+
+		count := 0
+		err = WalkArchive(archive, func(hdr *tar.Header, r io.Reader) error {
+			count++
+			return StopWalk
+		})
+		assert.Nil(err, archive)
+		assert.Equal(1, count, "walk should stop", archive)
+	}
+}
+
+func TestReadFilesFromArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		files, err := ReadFilesFromArchive(archive, "dir1/file1", "dir2/file3")
+		assert.Nil(err, archive)
+		assert.Len(files, 2, archive)
+		assert.Equal("dir1/file1 content\n", string(files["dir1/file1"]), archive)
+
+		files, err = ReadFilesFromArchive(archive, "dir1/file2", "missing", "dir1/file2", "other")
+		assert.Equal(MissingFilesError{[]string{"missing", "other"}}, err, archive)
+		assert.Len(files, 1, archive)
+	}
+}
+
+func TestReadFileFromArchiveGlob(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		data, err := ReadFileFromArchiveGlob(archive, "*/file3")
+		assert.Nil(err, archive)
+		assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data), archive)
+
+		_, err = ReadFileFromArchiveGlob(archive, "file3")
+		assert.Equal(NotFoundError{"file3"}, err, archive)
+
+		_, err = ReadFileFromArchiveGlob(archive, "dir*")
+		assert.Equal(NotFoundError{"dir*"}, err, "directories should not match", archive)
+	}
+
+	_, err := ReadFileFromArchiveGlob(testarchives[0], "[")
+	assert.Equal(path.ErrBadPattern, err)
+}
+
+func TestArchiveContext(z *testing.T) {
+	assert := assert.New(z)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, archive := range testarchives {
+		data, err := ReadFileFromArchiveContext(ctx, archive, "dir2/file3")
+		assert.Nil(err, archive)
+		assert.NotEmpty(data, archive)
+	}
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	cancel()
+	for _, archive := range testarchives {
+		_, err := ReadFileFromArchiveContext(ctx, archive, "dir2/file3")
+		assert.Equal(context.Canceled, err, archive)
+
+		err = ExtractArchiveContext(ctx, archive, dir)
+		assert.Equal(context.Canceled, err, archive)
+	}
+
+	err = CreateArchiveContext(ctx, testdest+".tar", "testdata")
+	assert.Equal(context.Canceled, err)
+	ex, _ := FileExists(testdest + ".tar")
+	assert.False(ex, "canceled archive should be removed")
+}
+
+func TestParallelGzip(z *testing.T) {
+	assert := assert.New(z)
+
+	archive := "testdata/dir_reader_data.tar.gz"
+	for _, opt := range []Option{ParallelGzip(0, 0), ParallelGzip(4096, 2)} {
+		data, err := ReadFileFromArchive(archive, "dir2/file3", opt)
+		assert.Nil(err)
+		assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data))
+
+		d, err := NewDecompressor(archive, opt)
+		if assert.Nil(err) {
+			tr := tar.NewReader(d)
+			data, err = ReadFileFromTar(tr, "dir1/file1")
+			assert.Nil(err)
+			assert.Equal("dir1/file1 content\n", string(data))
+			assert.Nil(d.Close())
+		}
+	}
+}
+
+func TestNewDecompressorReader(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives[:6] {
+		var want []byte
+		d, err := NewDecompressor(archive)
+		if assert.Nil(err, archive) {
+			want, err = ioutil.ReadAll(d)
+			assert.Nil(err, archive)
+			assert.Nil(d.Close())
+		}
+
+		f, err := os.Open(archive)
+		assert.Nil(err)
+		d, err = NewDecompressorReader(f, formatFromExt(archive))
+		if assert.Nil(err, archive) {
+			got, err := ioutil.ReadAll(d)
+			assert.Nil(err, archive)
+			assert.Equal(want, got, archive)
+			assert.Nil(d.Close())
+		}
+
+		// The reader is not closed, so it can be read from again.
+		_, err = f.Seek(0, io.SeekStart)
+		assert.Nil(err, archive)
+		d, err = NewDecompressorReaderDetect(ioutil.NopCloser(f))
+		if assert.Nil(err, archive) {
+			got, err := ioutil.ReadAll(d)
+			assert.Nil(err, archive)
+			assert.Equal(want, got, archive)
+			assert.Nil(d.Close())
+		}
+		f.Close()
+	}
+
+	_, err := NewDecompressorReader(strings.NewReader(""), FormatZip)
+	assert.IsType(FormatError{}, err)
+}
+
+func TestNewDecompressorStdin(z *testing.T) {
+	assert := assert.New(z)
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+
+	f, err := os.Open("testdata/dir_reader_data.tar.zst")
+	assert.Nil(err)
+	defer f.Close()
+	os.Stdin = f
+	data, err := ReadFileFromArchive("-", "dir1/file1")
+	assert.Nil(err)
+	assert.Equal("dir1/file1 content\n", string(data))
+
+	// Zip archives cannot be read from a pipe.
+	f, err = os.Open("testdata/dir_reader_data.zip")
+	assert.Nil(err)
+	defer f.Close()
+	os.Stdin = f
+	_, err = NewDecompressor("-")
+	assert.Equal(FormatError{"-"}, err)
+	_, err = f.Seek(0, io.SeekStart)
+	assert.Nil(err)
+	_, err = ReadFileFromArchive("-", "dir1/file1")
+	assert.Equal(FormatError{"-"}, err)
+}
+
+func TestNewDecompressorWithFormat(z *testing.T) {
+	assert := assert.New(z)
+
+	data, err := ioutil.ReadFile("testdata/dir_reader_data.tar.xz")
+	assert.Nil(err)
+	dest := testdest + ".bin"
+	assert.Nil(ioutil.WriteFile(dest, data, 0644))
+	defer os.Remove(dest)
+
+	for _, format := range []Format{FormatXZ, FormatUnknown} {
+		d, err := NewDecompressorWithFormat(dest, format)
+		if assert.Nil(err, format.String()) {
+			got, err := ReadFileFromTar(tar.NewReader(d), "dir1/file1")
+			assert.Nil(err)
+			assert.Equal("dir1/file1 content\n", string(got))
+			assert.Nil(d.Close())
+		}
+	}
+
+	_, err = NewDecompressorWithFormat(dest, FormatGzip)
+	assert.NotNil(err)
+	_, err = NewDecompressorWithFormat(dest, FormatZip)
+	assert.Equal(FormatError{dest}, err)
+}
+
+func TestReadFileLenientNames(z *testing.T) {
+	assert := assert.New(z)
+
+	ab, err := NewArchiveBuilder(FormatGzip)
+	assert.Nil(err)
+	assert.Nil(ab.AddFile("./control", []byte("control"), 0644))
+	assert.Nil(ab.AddFile("Data/README", []byte("readme"), 0644))
+	data, err := ab.Bytes()
+	assert.Nil(err)
+	archive := testdest + ".tar.gz"
+	assert.Nil(ioutil.WriteFile(archive, data, 0644))
+	defer os.Remove(archive)
+
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"control", nil, ""},
+		{"control", []Option{IgnoreDotSlash()}, "control"},
+		{"./Control", []Option{IgnoreCase()}, "control"},
+		{"Control", []Option{IgnoreCase()}, ""},
+		{"Control", []Option{IgnoreCase(), IgnoreDotSlash()}, "control"},
+		{"data/readme", []Option{IgnoreCase()}, "readme"},
+		{"./Data/README", []Option{IgnoreDotSlash()}, "readme"},
+	} {
+		got, err := ReadFileFromArchive(archive, tc.name, tc.opts...)
+		if tc.want == "" {
+			assert.Equal(NotFoundError{tc.name}, err, tc.name)
+		} else {
+			assert.Nil(err, tc.name)
+			assert.Equal(tc.want, string(got), tc.name)
+		}
+
+		d, err := NewDecompressor(archive)
+		assert.Nil(err)
+		got, err = ReadFileFromTar(tar.NewReader(d), tc.name, tc.opts...)
+		assert.Nil(d.Close())
+		if tc.want == "" {
+			assert.Equal(NotFoundError{tc.name}, err, tc.name)
+		} else {
+			assert.Nil(err, tc.name)
+			assert.Equal(tc.want, string(got), tc.name)
+		}
+	}
+}
+
+func TestDirReader(z *testing.T) {
+	assert := assert.New(z)
+
+	f, err := os.Open("testdata/dir_reader_data.tar")
+	assert.Nil(err)
+	defer f.Close()
+	data, err := ioutil.ReadAll(DirReader(tar.NewReader(f), "dir1"))
+	assert.Nil(err)
+	assert.Equal("dir1/file2 content\ndir1/file1 content\n", string(data))
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	archive := path.Join(dir, "nested.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "a/1", Typeflag: tar.TypeReg, Mode: 0644}, "one "},
+		{tar.Header{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "a/b/2", Typeflag: tar.TypeReg, Mode: 0644}, "two "},
+		{tar.Header{Name: "a/b/link", Typeflag: tar.TypeSymlink, Linkname: "2"}, ""},
+		{tar.Header{Name: "a/b/c/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "a/b/c/empty", Typeflag: tar.TypeReg, Mode: 0644}, ""},
+		{tar.Header{Name: "a/b/c/3", Typeflag: tar.TypeReg, Mode: 0644}, "three "},
+		{tar.Header{Name: "ab/4", Typeflag: tar.TypeReg, Mode: 0644}, "four "},
+		{tar.Header{Name: "./a/5", Typeflag: tar.TypeReg, Mode: 0644}, "five"},
+	})
+	assert.Nil(err)
+
+	for dir, expected := range map[string]string{
+		"a":     "one two three five",
+		"a/":    "one two three five",
+		"./a/b": "two three ",
+		"a/b/c": "three ",
+		"":      "one two three four five",
+		"x":     "",
+	} {
+		f, err := os.Open(archive)
+		assert.Nil(err)
+		data, err := ioutil.ReadAll(DirReader(tar.NewReader(f), dir))
+		f.Close()
+		assert.Nil(err, dir)
+		assert.Equal(expected, string(data), dir)
+	}
+}
+
+func TestDirEntries(z *testing.T) {
+	assert := assert.New(z)
+
+	f, err := os.Open("testdata/dir_reader_data.tar")
+	assert.Nil(err)
+	defer f.Close()
+
+	contents := make(map[string]string)
+	var names []string
+	it := DirEntries(tar.NewReader(f), "dir2/")
+	for it.Next() {
+		names = append(names, it.Header().Name)
+		data, err := ioutil.ReadAll(it.Reader())
+		assert.Nil(err)
+		contents[it.Header().Name] = string(data)
+	}
+	assert.Nil(it.Err())
+	assert.Nil(it.Header())
+	assert.Equal([]string{"dir2/file3", "dir2/file2", "dir2/file1"}, names)
+	assert.Equal("dir2/file3\nthis sentence should span three files.\n", contents["dir2/file3"])
+
+	it = DirEntries(tar.NewReader(strings.NewReader("definitely not a tar file")), "")
+	assert.False(it.Next())
+	assert.NotNil(it.Err())
+}
+
+func BenchmarkReadFileFromArchive(b *testing.B) {
+	for _, archive := range testarchives[:6] {
+		b.Run(path.Base(archive), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ReadFileFromArchive(archive, "dir2/file3"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadFileFromTar(b *testing.B) {
+	data, err := ioutil.ReadFile(testarchives[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tr := tar.NewReader(bytes.NewReader(data))
+		if _, err := ReadFileFromTar(tr, "dir2/file3"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// errAtomicClosed is returned when an AtomicFile is used after Close or
+// Abort.
+var errAtomicClosed = errors.New("atomic file already closed")
+
+// AtomicFile is a file that is written to a temporary file in the same
+// directory as its path and only replaces the file at its path when Close
+// is called, so that readers never see a partially written file. It is
+// created with CreateAtomic.
+type AtomicFile struct {
+	f    *os.File
+	path string
+	perm os.FileMode
+	o    *fileOptions
+	done bool
+}
+
+// CreateAtomic returns an AtomicFile for path, whose data replaces any file
+// at path once Close is called. If path is a symlink, it is replaced itself,
+// not its target. With Backup, the file at path is backed up by Close
+// before it is replaced.
+func CreateAtomic(path string, perm os.FileMode, opts ...FileOption) (*AtomicFile, error) {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{f: f, path: path, perm: perm, o: newFileOptions(opts)}, nil
+}
+
+// Name returns the path that the file is written to by Close.
+func (a *AtomicFile) Name() string {
+	return a.path
+}
+
+// Write writes p to the temporary file.
+func (a *AtomicFile) Write(p []byte) (int, error) {
+	if a.done {
+		return 0, &os.PathError{Op: "write", Path: a.path, Err: errAtomicClosed}
+	}
+	return a.f.Write(p)
+}
+
+// Close commits the write: the temporary file gets the permissions perm,
+// which are not subject to the umask, and is synced to disk and renamed to
+// the path of a, after which its directory is synced as well. If any of
+// this fails, the temporary file is removed and the file at the path is
+// left as it was.
+func (a *AtomicFile) Close() error {
+	if a.done {
+		return &os.PathError{Op: "close", Path: a.path, Err: errAtomicClosed}
+	}
+	a.done = true
+	if err := a.finish(); err != nil {
+		os.Remove(a.f.Name())
+		return err
+	}
+	// The old file is linked to its backup name, if possible, so that
+	// there is always a file at the path.
+	_, err := backupFile(a.path, a.o, true)
+	if err == nil {
+		err = os.Rename(a.f.Name(), a.path)
+	}
+	if err != nil {
+		os.Remove(a.f.Name())
+		return err
+	}
+	return syncDir(filepath.Dir(a.path))
+}
+
+// finish gives the temporary file its permissions, syncs it, and closes it,
+// so that it only needs to be renamed.
+func (a *AtomicFile) finish() error {
+	err := a.f.Chmod(a.perm)
+	if err == nil {
+		err = a.f.Sync()
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Abort discards everything written to a and removes the temporary file.
+// Calling Abort after Close has no effect, so that it can be deferred.
+func (a *AtomicFile) Abort() error {
+	if a.done {
+		return nil
+	}
+	a.done = true
+	a.f.Close()
+	return os.Remove(a.f.Name())
+}
+
+// WriteFileAtomic writes data to the file at path like ioutil.WriteFile,
+// except that the file is replaced atomically as with CreateAtomic, so that
+// it either has its old contents or all of data, even after a crash. The
+// options are those of CreateAtomic.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode, opts ...FileOption) error {
+	a, err := CreateAtomic(path, perm, opts...)
+	if err != nil {
+		return err
+	}
+	if _, err := a.Write(data); err != nil {
+		a.Abort()
+		return err
+	}
+	return a.Close()
+}
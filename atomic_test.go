@@ -0,0 +1,83 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	assert.Nil(WriteFileAtomic(path, []byte("first"), 0600))
+	assert.Nil(WriteFileAtomic(path, []byte("second"), 0640))
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal("second", string(data))
+	fi, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0640), fi.Mode())
+
+	names, err := readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"config"}, names)
+
+	assert.NotNil(WriteFileAtomic(filepath.Join(dir, "missing/config"), nil, 0644))
+}
+
+func TestCreateAtomic(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data")
+	assert.Nil(ioutil.WriteFile(path, []byte("old"), 0644))
+
+	// Until Close, the old file remains visible.
+	a, err := CreateAtomic(path, 0644)
+	assert.Nil(err)
+	assert.Equal(path, a.Name())
+	_, err = a.Write([]byte("new "))
+	assert.Nil(err)
+	_, err = a.Write([]byte("data"))
+	assert.Nil(err)
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal("old", string(data))
+	assert.Nil(a.Close())
+	assert.Nil(a.Abort())
+	assert.NotNil(a.Close())
+	_, err = a.Write([]byte("more"))
+	assert.NotNil(err)
+	data, err = ioutil.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal("new data", string(data))
+
+	// Abort leaves the old file as it was.
+	a, err = CreateAtomic(path, 0644)
+	assert.Nil(err)
+	_, err = a.Write([]byte("discarded"))
+	assert.Nil(err)
+	assert.Nil(a.Abort())
+	data, err = ioutil.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal("new data", string(data))
+
+	names, err := readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"data"}, names)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultBackupSuffix is the suffix of simple backups, as used by GNU cp.
+const defaultBackupSuffix = "~"
+
+// backupFile backs up the file at path as requested by o, if it exists.
+// The file is moved to its backup name, unless link is true, in which case
+// it is hard-linked there where possible, so that path does not go missing
+// before it is replaced. If the file was moved, its backup name is
+// returned, so that it can be moved back with restoreBackup if replacing
+// it fails.
+func backupFile(path string, o *fileOptions, link bool) (string, error) {
+	if o.backup == BackupNone {
+		return "", nil
+	}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	name, err := backupName(path, o)
+	if err != nil {
+		return "", err
+	}
+	if link {
+		os.Remove(name)
+		if os.Link(path, name) == nil {
+			return "", nil
+		}
+	}
+	return name, os.Rename(path, name)
+}
+
+// restoreBackup moves the backup that backupFile moved path to back to
+// path, replacing whatever was written there since. It does nothing if
+// backup is empty.
+func restoreBackup(path, backup string) {
+	if backup != "" {
+		os.Rename(backup, path)
+	}
+}
+
+// backupName returns the name that path is backed up to according to o.
+func backupName(path string, o *fileOptions) (string, error) {
+	simple := path + o.backupSuffix
+	if o.backupSuffix == "" {
+		simple = path + defaultBackupSuffix
+	}
+	if o.backup == BackupSimple {
+		return simple, nil
+	}
+
+	names, err := readDirNames(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	prefix := filepath.Base(path) + ".~"
+	highest := 0
+	for _, name := range names {
+		if len(name) <= len(prefix) || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, "~") {
+			continue
+		}
+		n, err := strconv.Atoi(name[len(prefix) : len(name)-1])
+		if err == nil && n > highest {
+			highest = n
+		}
+	}
+	if highest == 0 && o.backup == BackupExisting {
+		return simple, nil
+	}
+	return path + ".~" + strconv.Itoa(highest+1) + "~", nil
+}
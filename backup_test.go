@@ -0,0 +1,80 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+
+	// Nothing is backed up if the file does not exist yet.
+	assert.Nil(WriteFileAtomic(path, []byte("1"), 0644, Backup(BackupSimple)))
+	assert.Nil(WriteFileAtomic(path, []byte("2"), 0644, Backup(BackupSimple)))
+	assert.Nil(WriteFileAtomic(path, []byte("3"), 0644, Backup(BackupSimple), BackupSuffix(".bak")))
+	assert.Nil(WriteFileAtomic(path, []byte("4"), 0644, Backup(BackupExisting)))
+	assert.Equal("4", read("config"))
+	assert.Equal("3", read("config~"))
+	assert.Equal("2", read("config.bak"))
+
+	assert.Nil(WriteFileAtomic(path, []byte("5"), 0644, Backup(BackupNumbered)))
+	assert.Nil(CopyFile(testfile, path, Backup(BackupExisting)))
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "new"), []byte("7"), 0644))
+	assert.Nil(MoveFile(filepath.Join(dir, "new"), path, Backup(BackupNumbered)))
+	assert.Nil(WriteFileAtomic(path, []byte("8"), 0644))
+	assert.Equal("8", read("config"))
+	assert.Equal("4", read("config.~1~"))
+	assert.Equal("5", read("config.~2~"))
+	same, err := SameContents(testfile, filepath.Join(dir, "config.~3~"))
+	assert.Nil(err)
+	assert.True(same)
+
+	names, err := readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"config", "config.bak", "config.~1~", "config.~2~", "config.~3~", "config~"}, names)
+}
+
+func TestBackupRestore(z *testing.T) {
+	if runtime.GOOS != "linux" {
+		z.Skip("a file that cannot be read is only available on Linux")
+	}
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Reading /proc/self/mem at offset 0 fails, so the backup is moved
+	// back and dst is left as it was.
+	path := filepath.Join(dir, "config")
+	assert.Nil(ioutil.WriteFile(path, []byte("1"), 0644))
+	assert.NotNil(CopyFile("/proc/self/mem", path, Backup(BackupSimple), Reflink(ReflinkNever)))
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(err)
+	assert.Equal("1", string(data))
+	names, err := readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"config"}, names)
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package osutil
+
+import "os"
+
+// allocatedSize returns the size of the file described by fi, as the space
+// allocated for it on disk is not known on this platform.
+func allocatedSize(fi os.FileInfo) int64 {
+	return fi.Size()
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// bufferSize is the size of the buffers used to read files and to copy data.
+const bufferSize = 64 << 10
+
+// maxPrealloc limits how much memory is allocated up front for the contents
+// of an entry, since its recorded size cannot be trusted.
+const maxPrealloc = 16 << 20
+
+// bufferPool contains scratch buffers of bufferSize bytes.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, bufferSize)
+		return &b
+	},
+}
+
+// copyBuffer is the same as io.Copy, except that a buffer from bufferPool
+// is used. Copies from files to writers with a ReadFrom method, such as
+// other files, are left to io.Copy, which lets the kernel copy the data
+// where possible.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	if f, ok := src.(*os.File); ok {
+		if _, ok := dst.(io.ReaderFrom); ok {
+			return io.Copy(dst, src)
+		}
+		// Hide the WriteTo method of the file, which would allocate
+		// a buffer of its own for other writers, such as hashes.
+		src = readerOnly{f}
+	}
+	bp := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(bp)
+	// Hide any ReadFrom method of dst, such as that of *os.File, which
+	// would allocate a buffer of its own.
+	return io.CopyBuffer(writerOnly{dst}, src, *bp)
+}
+
+// writerOnly hides all methods of an io.Writer except Write.
+type writerOnly struct {
+	io.Writer
+}
+
+// readerOnly hides all methods of an io.Reader except Read.
+type readerOnly struct {
+	io.Reader
+}
+
+// readEntry reads all of r, which contains an entry whose recorded size is
+// size, into a buffer that is allocated at once if size is reasonable.
+func readEntry(r io.Reader, size int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if size > 0 && size <= maxPrealloc {
+		buf.Grow(int(size) + bytes.MinRead)
+	}
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
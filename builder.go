@@ -0,0 +1,149 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// errBuilderClosed is returned when adding to an ArchiveBuilder whose
+// archive has already been completed.
+var errBuilderClosed = errors.New("archive builder is already closed")
+
+// ArchiveBuilder constructs a tar archive in memory, which is useful for
+// tests and services that need small archives without touching the file
+// system. Entries are added with AddFile, AddDir, and AddSymlink, and the
+// archive is completed by Bytes or WriteTo, after which no more entries can
+// be added.
+type ArchiveBuilder struct {
+	// ModTime is the modification time of the entries that are added,
+	// which is the time the builder was created by default.
+	ModTime time.Time
+
+	buf bytes.Buffer
+	cw  io.WriteCloser
+	tw  *tar.Writer
+	err error
+}
+
+// NewArchiveBuilder returns a new ArchiveBuilder for an archive compressed
+// in the format, which can be FormatTar for an uncompressed archive or any
+// compression format supported by NewCompressor. Options supported are the
+// same as for NewCompressor, except VolumeSize.
+func NewArchiveBuilder(format Format, opts ...Option) (*ArchiveBuilder, error) {
+	ab := &ArchiveBuilder{ModTime: time.Now()}
+	cw, err := newCompressWriter(&ab.buf, format, newArchiveOptions(opts))
+	if err == errFormat {
+		err = FormatError{format.String()}
+	}
+	if err != nil {
+		return nil, err
+	}
+	ab.cw = cw
+	if cw != nil {
+		ab.tw = tar.NewWriter(cw)
+	} else {
+		ab.tw = tar.NewWriter(&ab.buf)
+	}
+	return ab, nil
+}
+
+// AddFile adds a regular file with the contents data.
+func (ab *ArchiveBuilder) AddFile(name string, data []byte, mode os.FileMode) error {
+	err := ab.add(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     int64(len(data)),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := ab.tw.Write(data); err != nil {
+		ab.err = err
+	}
+	return ab.err
+}
+
+// AddDir adds a directory. Directories do not need to be added before the
+// files they contain, but doing so sets their mode.
+func (ab *ArchiveBuilder) AddDir(name string, mode os.FileMode) error {
+	if !strings.HasSuffix(name, "/") {
+		name += "/"
+	}
+	return ab.add(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+	})
+}
+
+// AddSymlink adds a symlink pointing to target.
+func (ab *ArchiveBuilder) AddSymlink(name, target string) error {
+	return ab.add(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: target,
+		Mode:     0777,
+	})
+}
+
+// add writes hdr to the archive.
+func (ab *ArchiveBuilder) add(hdr *tar.Header) error {
+	if ab.err != nil {
+		return ab.err
+	}
+	hdr.ModTime = ab.ModTime
+	if err := ab.tw.WriteHeader(hdr); err != nil {
+		ab.err = err
+	}
+	return ab.err
+}
+
+// close completes the archive.
+func (ab *ArchiveBuilder) close() error {
+	if ab.err != nil {
+		if ab.err == errBuilderClosed {
+			return nil
+		}
+		return ab.err
+	}
+	err := ab.tw.Close()
+	if ab.cw != nil {
+		if cerr := ab.cw.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		ab.err = err
+		return err
+	}
+	ab.err = errBuilderClosed
+	return nil
+}
+
+// Bytes completes the archive and returns its contents.
+func (ab *ArchiveBuilder) Bytes() ([]byte, error) {
+	if err := ab.close(); err != nil {
+		return nil, err
+	}
+	return ab.buf.Bytes(), nil
+}
+
+// WriteTo completes the archive and writes it to w.
+func (ab *ArchiveBuilder) WriteTo(w io.Writer) (int64, error) {
+	data, err := ab.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveBuilder(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, ext := range []string{".tar", ".tar.gz", ".tar.zst"} {
+		ab, err := NewArchiveBuilder(formatFromExt(ext))
+		if !assert.Nil(err, ext) {
+			continue
+		}
+		ab.ModTime = time.Unix(1500000000, 0)
+		assert.Nil(ab.AddDir("etc", 0755))
+		assert.Nil(ab.AddFile("etc/motd", []byte("hello\n"), 0644))
+		assert.Nil(ab.AddSymlink("motd", "etc/motd"))
+
+		var buf bytes.Buffer
+		_, err = ab.WriteTo(&buf)
+		assert.Nil(err, ext)
+		assert.Equal(errBuilderClosed, ab.AddFile("late", nil, 0644))
+		data, err := ab.Bytes()
+		assert.Nil(err, ext)
+		assert.Equal(buf.Bytes(), data, ext)
+
+		dest := testdest + ext
+		assert.Nil(ioutil.WriteFile(dest, data, 0644))
+		got, err := ReadFileFromArchive(dest, "etc/motd")
+		assert.Nil(err, ext)
+		assert.Equal("hello\n", string(got), ext)
+		entries, err := ListArchive(dest)
+		assert.Nil(err, ext)
+		if assert.Len(entries, 3, ext) {
+			assert.Equal("etc/", entries[0].Name)
+			assert.Equal(byte(tar.TypeDir), entries[0].Type)
+			assert.Equal(os.FileMode(0644), entries[1].Mode.Perm())
+			assert.Equal("etc/motd", entries[2].Linkname)
+			assert.Equal(int64(1500000000), entries[2].ModTime.Unix())
+		}
+		os.Remove(dest)
+	}
+
+	_, err := NewArchiveBuilder(FormatZip)
+	assert.Equal(FormatError{"zip"}, err)
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumHashes are the hashes supported by WriteChecksumFile, indexed by
+// the length of their hex digests, which identifies them when verifying.
+var checksumHashes = map[int]crypto.Hash{
+	hex.EncodedLen(md5.Size):    crypto.MD5,
+	hex.EncodedLen(sha1.Size):   crypto.SHA1,
+	hex.EncodedLen(sha256.Size): crypto.SHA256,
+	hex.EncodedLen(sha512.Size): crypto.SHA512,
+}
+
+// WriteChecksumFile writes the checksums of the files to sumfile, in the
+// format of sha256sum, or of md5sum, sha1sum, or sha512sum, depending on h,
+// which must be crypto.MD5, crypto.SHA1, crypto.SHA256, or crypto.SHA512.
+// Directories are walked, and all regular files in them are included, in
+// lexical order. Names are written relative to the directory of sumfile,
+// so that the files can be checked with `sha256sum -c` in that directory,
+// and with VerifyChecksumFile anywhere. Names containing a backslash or
+// a newline are escaped as sha256sum does it.
+func WriteChecksumFile(sumfile string, h crypto.Hash, files ...string) error {
+	supported := false
+	for _, c := range checksumHashes {
+		supported = supported || c == h
+	}
+	if !supported {
+		return fmt.Errorf("unsupported checksum hash %v", h)
+	}
+	absSum, err := filepath.Abs(sumfile)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	add := func(path string) error {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if abs == absSum {
+			return nil
+		}
+		sum, err := hashFile(path, h.New())
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Dir(absSum), abs)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(formatChecksumLine(sum, filepath.ToSlash(rel)))
+		return nil
+	}
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			if err := add(file); err != nil {
+				return err
+			}
+			continue
+		}
+		err = filepath.Walk(file, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.Mode()&os.ModeSymlink != 0 {
+				// Like sha256sum, symlinks to files are followed.
+				if fi, err = os.Stat(path); err != nil {
+					return err
+				}
+				if fi.IsDir() {
+					return nil
+				}
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			return add(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(sumfile, buf.Bytes(), 0644)
+}
+
+// VerifyChecksumFile checks the files listed in sumfile, which is in the
+// format written by WriteChecksumFile and sha256sum. The hash is chosen by
+// the length of the checksums. Names are relative to the directory of
+// sumfile. If files are missing or their checksums do not match, a
+// VerifyError is returned.
+func VerifyChecksumFile(sumfile string) error {
+	f, err := os.Open(sumfile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var verr VerifyError
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		want, name, err := parseChecksumLine(line)
+		if err != nil {
+			return err
+		}
+		h, ok := checksumHashes[len(want)]
+		if !ok {
+			return ManifestError{"invalid checksum line: " + line}
+		}
+
+		path := filepath.Join(filepath.Dir(sumfile), filepath.FromSlash(name))
+		sum, err := hashFile(path, h.New())
+		if os.IsNotExist(err) {
+			verr.Missing = append(verr.Missing, name)
+		} else if err != nil {
+			return err
+		} else if !strings.EqualFold(want, hex.EncodeToString(sum)) {
+			verr.Mismatched = append(verr.Mismatched, name)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if len(verr.Missing) == 0 && len(verr.Mismatched) == 0 {
+		return nil
+	}
+	sort.Strings(verr.Missing)
+	sort.Strings(verr.Mismatched)
+	return verr
+}
+
+// HashFile returns the checksum of the contents of the file at path as
+// computed by h, whose implementation must be linked into the binary, for
+// example by importing crypto/sha256.
+func HashFile(path string, h crypto.Hash) ([]byte, error) {
+	if !h.Available() {
+		return nil, fmt.Errorf("hash function %d is not available", h)
+	}
+	return hashFile(path, h.New())
+}
+
+// Sha256File returns the SHA-256 checksum of the file at path as a hex
+// string, as printed by sha256sum.
+func Sha256File(path string) (string, error) {
+	sum, err := hashFile(path, sha256.New())
+	return hex.EncodeToString(sum), err
+}
+
+// Md5File returns the MD5 checksum of the file at path as a hex string, as
+// printed by md5sum.
+func Md5File(path string) (string, error) {
+	sum, err := hashFile(path, md5.New())
+	return hex.EncodeToString(sum), err
+}
+
+// hashFile returns the sum of the contents of the file computed by h.
+func hashFile(path string, h hash.Hash) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := copyBuffer(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// checksumEscaper escapes names in checksum lines like sha256sum does.
+var checksumEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+
+// formatChecksumLine returns the line of a checksum file for the file name
+// with the checksum sum. Lines with escaped names start with a backslash.
+func formatChecksumLine(sum []byte, name string) string {
+	line := hex.EncodeToString(sum) + "  " + checksumEscaper.Replace(name) + "\n"
+	if strings.ContainsAny(name, "\\\n\r") {
+		line = "\\" + line
+	}
+	return line
+}
+
+// parseChecksumLine parses a line of a checksum file, which consists of
+// a hex checksum, a space, a space or an asterisk, and the name, and
+// starts with a backslash if the name is escaped.
+func parseChecksumLine(line string) (sum, name string, err error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+	i := strings.IndexByte(line, ' ')
+	if i <= 0 || len(line) < i+3 || (line[i+1] != ' ' && line[i+1] != '*') {
+		return "", "", ManifestError{"invalid checksum line: " + line}
+	}
+	if _, err := hex.DecodeString(line[:i]); err != nil {
+		return "", "", ManifestError{"invalid checksum line: " + line}
+	}
+	sum, name = line[:i], line[i+2:]
+	if escaped {
+		if name, err = unescapeChecksumName(name); err != nil {
+			return "", "", err
+		}
+	}
+	return sum, name, nil
+}
+
+// unescapeChecksumName reverses the escaping of checksumEscaper.
+func unescapeChecksumName(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i++; i == len(s) {
+			return "", ManifestError{"invalid escape in checksum name: " + s}
+		}
+		switch s[i] {
+		case '\\':
+			b.WriteByte('\\')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			return "", ManifestError{"invalid escape in checksum name: " + s}
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksumFile(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(ExtractArchive("testdata/dir_reader_data.tar", dir))
+	odd := filepath.Join(dir, "dir1", "back\\slash\nnewline")
+	assert.Nil(ioutil.WriteFile(odd, []byte("odd\n"), 0644))
+
+	sumfile := filepath.Join(dir, "SHA256SUMS")
+	err = WriteChecksumFile(sumfile, crypto.SHA256, filepath.Join(dir, "dir1"), filepath.Join(dir, "dir2/file1"))
+	assert.Nil(err)
+	data, err := ioutil.ReadFile(sumfile)
+	assert.Nil(err)
+	lines := strings.Split(string(data), "\n")
+	if assert.Len(lines, 5) {
+		assert.Equal("\\"+sha256hex("odd\n")+"  dir1/back\\\\slash\\nnewline", lines[0])
+		assert.Equal(sha256hex("dir1/file1 content\n")+"  dir1/file1", lines[1])
+		assert.Equal("dir2/file1", lines[3][66:])
+	}
+	assert.Nil(VerifyChecksumFile(sumfile))
+
+	assert.Nil(ioutil.WriteFile(odd, []byte("changed\n"), 0644))
+	assert.Nil(os.Remove(filepath.Join(dir, "dir2/file1")))
+	err = VerifyChecksumFile(sumfile)
+	assert.Equal(VerifyError{
+		Mismatched: []string{"dir1/back\\slash\nnewline"},
+		Missing:    []string{"dir2/file1"},
+	}, err)
+
+	err = WriteChecksumFile(sumfile, crypto.SHA224, dir)
+	assert.NotNil(err)
+}
+
+func TestVerifyChecksumFileAlgorithms(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a\n"), 0644))
+	for _, h := range []crypto.Hash{crypto.MD5, crypto.SHA1, crypto.SHA256, crypto.SHA512} {
+		sumfile := filepath.Join(dir, "sums")
+		assert.Nil(WriteChecksumFile(sumfile, h, dir), h.String())
+		assert.Nil(VerifyChecksumFile(sumfile), h.String())
+	}
+
+	// Lines as written by md5sum.
+	sumfile := filepath.Join(dir, "MD5SUMS")
+	assert.Nil(ioutil.WriteFile(sumfile, []byte("60b725f10c9c85c70d97880dfe8191b3 *a\n"), 0644))
+	assert.Nil(VerifyChecksumFile(sumfile))
+	assert.Nil(ioutil.WriteFile(sumfile, []byte("60b725f10c9c85c70d97880dfe8191b3\n"), 0644))
+	assert.IsType(ManifestError{}, VerifyChecksumFile(sumfile))
+}
+
+func TestHashFile(z *testing.T) {
+	assert := assert.New(z)
+
+	data, err := ioutil.ReadFile(testfile)
+	assert.Nil(err)
+	sum, err := HashFile(testfile, crypto.SHA512)
+	assert.Nil(err)
+	want := sha512.Sum512(data)
+	assert.Equal(want[:], sum)
+
+	hexsum, err := Sha256File(testfile)
+	assert.Nil(err)
+	assert.Equal(sha256hex(string(data)), hexsum)
+	hexsum, err = Md5File(testfile)
+	assert.Nil(err)
+	md5sum := md5.Sum(data)
+	assert.Equal(hex.EncodeToString(md5sum[:]), hexsum)
+
+	_, err = HashFile(testfile, crypto.MD4)
+	assert.NotNil(err)
+	_, err = Sha256File("testdata/missing.dat")
+	assert.True(os.IsNotExist(err))
+}
+
+func BenchmarkHashFile(b *testing.B) {
+	fi, err := os.Stat(testfile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(fi.Size())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Sha256File(testfile); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// Compressor is a universal compressor that, given a filepath,
+// chooses the appropriate compression algorithm. It is the counterpart
+// to Decompressor and supports the same formats.
+//
+// The compressor needs to be closed after usage, otherwise the
+// compressed data may be incomplete.
+type Compressor struct {
+	file   io.WriteCloser
+	writer io.WriteCloser
+}
+
+// NewCompressor creates a new compressor based on the file extension
+// of the given file. If the file already exists, it is truncated.
+// The returned Compressor can be Written to and Closed.
+//
+// Options supported are Threads, CompressionLevel, ZstdWindowSize,
+// GzipRsyncable, SeekableZstd, and VolumeSize.
+func NewCompressor(filepath string, opts ...Option) (*Compressor, error) {
+	return newCompressor(filepath, newArchiveOptions(opts))
+}
+
+// newCompressor does the hard work for NewCompressor.
+func newCompressor(filepath string, o *archiveOptions) (*Compressor, error) {
+	var f io.WriteCloser
+	var err error
+	if o.volumeSize > 0 {
+		f, err = NewVolumeWriter(filepath, o.volumeSize)
+	} else {
+		f, err = os.Create(filepath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := newCompressWriter(f, formatFromExt(filepath), o)
+	if err == errFormat {
+		err = FormatError{filepath}
+	}
+	if err != nil {
+		f.Close()
+		removeOutput(filepath, o)
+		return nil, err
+	}
+
+	return &Compressor{
+		file:   f,
+		writer: w,
+	}, nil
+}
+
+// removeOutput removes the file written by newCompressor to filepath, or
+// all of its volumes with VolumeSize.
+func removeOutput(filepath string, o *archiveOptions) {
+	if o.volumeSize > 0 {
+		removeVolumes(filepath)
+	} else {
+		os.Remove(filepath)
+	}
+}
+
+// errFormat is returned by newCompressWriter for unsupported formats.
+var errFormat = errors.New("unsupported format")
+
+// xzPresets contains the dictionary sizes of the xz presets 0 to 9.
+var xzPresets = [...]int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// newCompressWriter returns a writer that compresses to w in the format,
+// according to the options o. For FormatTar, it returns nil.
+func newCompressWriter(w io.Writer, format Format, o *archiveOptions) (io.WriteCloser, error) {
+	threads := o.threads
+	if threads < 0 {
+		threads = runtime.NumCPU()
+	}
+
+	switch format {
+	case FormatTar:
+		// Data is written as is.
+		return nil, nil
+	case FormatGzip:
+		level := gzip.DefaultCompression
+		if o.hasLevel {
+			level = o.level
+		}
+		if o.rsyncable {
+			zw, err := gzip.NewWriterLevel(w, level)
+			if err != nil {
+				return nil, err
+			}
+			return &rsyncableWriter{zw: zw}, nil
+		}
+		if threads > 1 {
+			zw, err := pgzip.NewWriterLevel(w, level)
+			if err != nil {
+				return nil, err
+			}
+			return zw, zw.SetConcurrency(1<<20, threads)
+		}
+		return gzip.NewWriterLevel(w, level)
+	case FormatBzip2:
+		var conf *bzip2.WriterConfig
+		if o.hasLevel {
+			conf = &bzip2.WriterConfig{Level: o.level}
+		}
+		return bzip2.NewWriter(w, conf)
+	case FormatXZ:
+		var conf xz.WriterConfig
+		if o.hasLevel {
+			if o.level < 0 || o.level >= len(xzPresets) {
+				return nil, fmt.Errorf("invalid xz preset %d", o.level)
+			}
+			conf.DictCap = xzPresets[o.level]
+		}
+		if threads > 1 {
+			return newParallelXZWriter(w, conf, threads), nil
+		}
+		return conf.NewWriter(w)
+	case FormatZstd:
+		var zopts []zstd.EOption
+		if threads > 0 {
+			zopts = append(zopts, zstd.WithEncoderConcurrency(threads))
+		}
+		if o.hasLevel {
+			zopts = append(zopts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(o.level)))
+		}
+		if o.windowSize > 0 {
+			zopts = append(zopts, zstd.WithWindowSize(o.windowSize))
+		}
+		if o.seekFrame > 0 {
+			return newSeekableZstdWriter(w, o.seekFrame, zopts...)
+		}
+		return zstd.NewWriter(w, zopts...)
+	case FormatLZ4:
+		zw := lz4.NewWriter(w)
+		var zopts []lz4.Option
+		if threads > 1 {
+			zopts = append(zopts, lz4.ConcurrencyOption(threads))
+		}
+		if o.hasLevel && o.level > 0 {
+			zopts = append(zopts, lz4.CompressionLevelOption(lz4.CompressionLevel(1<<(8+o.level))))
+		}
+		return zw, zw.Apply(zopts...)
+	default:
+		return nil, errFormat
+	}
+}
+
+// rsyncWindow is the size of the window that rsyncableWriter looks at.
+const rsyncWindow = 4096
+
+// rsyncableWriter flushes the gzip writer whenever the sum of the last
+// rsyncWindow bytes is a multiple of rsyncWindow, like gzip --rsyncable.
+// Since these points only depend on the data around them, a local change
+// of the data only changes the compressed data locally, which lets rsync
+// transfer the differences efficiently.
+type rsyncableWriter struct {
+	zw     *gzip.Writer
+	window [rsyncWindow]byte
+	pos    int
+	sum    uint32
+	n      int64
+}
+
+func (rw *rsyncableWriter) Write(p []byte) (n int, err error) {
+	start := 0
+	for i, b := range p {
+		rw.sum += uint32(b) - uint32(rw.window[rw.pos])
+		rw.window[rw.pos] = b
+		rw.pos = (rw.pos + 1) % rsyncWindow
+		rw.n++
+		if rw.n >= rsyncWindow && rw.sum%rsyncWindow == 0 {
+			m, err := rw.zw.Write(p[start : i+1])
+			n += m
+			if err != nil {
+				return n, err
+			}
+			if err := rw.zw.Flush(); err != nil {
+				return n, err
+			}
+			start = i + 1
+		}
+	}
+	m, err := rw.zw.Write(p[start:])
+	return n + m, err
+}
+
+func (rw *rsyncableWriter) Close() error {
+	return rw.zw.Close()
+}
+
+// Write compresses p and writes it to the underlying file.
+func (c *Compressor) Write(p []byte) (n int, err error) {
+	if c.writer == nil {
+		return c.file.Write(p)
+	}
+	return c.writer.Write(p)
+}
+
+// Close flushes any pending compressed data and closes the underlying file.
+func (c *Compressor) Close() error {
+	var err error
+	if c.writer != nil {
+		err = c.writer.Close()
+	}
+	if cerr := c.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// RecompressArchive streams the compressed file src into dst, which is
+// compressed according to its extension, without writing the decompressed
+// data to disk. This is useful for converting a .tar.gz into a .tar.zst,
+// for example. Options are passed on to NewDecompressor and NewCompressor.
+//
+// The file dst is only replaced once it has been written completely, so
+// src and dst may be the same file.
+func RecompressArchive(src, dst string, opts ...Option) (err error) {
+	o := newArchiveOptions(opts)
+	d, err := newDecompressor(src, o)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// The temporary file keeps the extension of dst, which determines
+	// the format.
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".*-"+filepath.Base(dst))
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(dst); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	c, err := newCompressor(tmp.Name(), o)
+	if err != nil {
+		if _, ok := err.(FormatError); ok {
+			err = FormatError{dst}
+		}
+		return err
+	}
+	if _, err := copyBuffer(c, d); err != nil {
+		c.Close()
+		return err
+	}
+	if err := c.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// compressExt contains the extension that CompressFile appends for each
+// compression format.
+var compressExt = map[Format]string{
+	FormatGzip:  ".gz",
+	FormatBzip2: ".bz2",
+	FormatXZ:    ".xz",
+	FormatZstd:  ".zst",
+	FormatLZ4:   ".lz4",
+}
+
+// decompressExt maps the extensions that DecompressFile removes to the
+// extensions that replace them, for the shorthands of compressed tar
+// archives.
+var decompressExt = map[string]string{
+	".gz": "", ".bz2": "", ".xz": "", ".zst": "", ".lz4": "",
+	".tgz": ".tar", ".tbz": ".tar", ".tbz2": ".tar", ".txz": ".tar", ".tzst": ".tar",
+}
+
+// CompressFile compresses the file at path in the format, like gzip does:
+// the compressed file is named after path with the extension of the format
+// appended, such as .gz, it gets the permissions of the original, and the
+// original is removed, unless KeepOriginal is given. With PreserveTimes,
+// the compressed file gets the modification time of the original. The name
+// of the compressed file is returned. If it already exists, an error is
+// returned, and nothing is changed.
+//
+// Formats supported are gzip, bzip2, xz, zstd, and lz4. Other options
+// supported are those of NewCompressor, except VolumeSize.
+func CompressFile(path string, format Format, opts ...Option) (string, error) {
+	ext, ok := compressExt[format]
+	if !ok {
+		return "", fmt.Errorf("cannot compress file as %v", format)
+	}
+	o := newArchiveOptions(opts)
+	o.volumeSize = 0
+	return convertFile(path, path+ext, o, func(dst string, src io.Reader) error {
+		c, err := newCompressor(dst, o)
+		if err != nil {
+			return err
+		}
+		if _, err := copyBuffer(c, src); err != nil {
+			c.Close()
+			return err
+		}
+		return c.Close()
+	})
+}
+
+// DecompressFile decompresses the file at path, like gunzip does: the
+// decompressed file is named after path without its extension, which must
+// be that of a format supported by NewDecompressor, such as .gz, whereas
+// shorthands such as .tgz are replaced with .tar. Otherwise, a FormatError
+// is returned. The name of the decompressed file is returned, and the
+// options KeepOriginal and PreserveTimes are the same as for CompressFile.
+// Other options supported are those of NewDecompressor.
+func DecompressFile(path string, opts ...Option) (string, error) {
+	ext := filepath.Ext(path)
+	repl, ok := decompressExt[ext]
+	if !ok || len(path) == len(ext) {
+		return "", FormatError{path}
+	}
+	o := newArchiveOptions(opts)
+	return convertFile(path, strings.TrimSuffix(path, ext)+repl, o, func(dst string, src io.Reader) error {
+		d, err := newDecompressorReader(src, formatFromExt(path), o)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		f, err := os.Create(dst)
+		if err != nil {
+			return err
+		}
+		if _, err := copyBuffer(f, d); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// convertFile does the work common to CompressFile and DecompressFile:
+// it lets write create dst from the contents of src and then carries over
+// the permissions and, optionally, the modification time, and removes src,
+// unless it is kept.
+func convertFile(src, dst string, o *archiveOptions, write func(dst string, src io.Reader) error) (string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", FileTypeError{src}
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return "", &os.PathError{Op: "create", Path: dst, Err: os.ErrExist}
+	}
+
+	if err := write(dst, bufio.NewReaderSize(f, bufferSize)); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	if err := os.Chmod(dst, fi.Mode().Perm()); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	if o.times {
+		if err := os.Chtimes(dst, fi.ModTime(), fi.ModTime()); err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+	}
+	if !o.keep {
+		f.Close()
+		if err := os.Remove(src); err != nil {
+			return "", err
+		}
+	}
+	return dst, nil
+}
+
+// xzBlockSize is the amount of data that a parallelXZWriter compresses
+// into each of its streams.
+const xzBlockSize = 8 << 20
+
+// parallelXZWriter compresses blocks of data into separate xz streams in
+// parallel. Concatenated streams are valid xz data, which is also how
+// `xz -T` achieves parallelism.
+type parallelXZWriter struct {
+	w       io.Writer
+	conf    xz.WriterConfig
+	buf     []byte
+	pending []chan xzResult
+	threads int
+	written bool
+	err     error
+}
+
+// xzResult is the outcome of compressing a single block.
+type xzResult struct {
+	data []byte
+	err  error
+}
+
+func newParallelXZWriter(w io.Writer, conf xz.WriterConfig, threads int) *parallelXZWriter {
+	return &parallelXZWriter{
+		w:       w,
+		conf:    conf,
+		buf:     make([]byte, 0, xzBlockSize),
+		threads: threads,
+	}
+}
+
+func (pw *parallelXZWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if pw.err != nil {
+			return n, pw.err
+		}
+		m := copy(pw.buf[len(pw.buf):cap(pw.buf)], p)
+		pw.buf = pw.buf[:len(pw.buf)+m]
+		n += m
+		p = p[m:]
+		if len(pw.buf) == cap(pw.buf) {
+			pw.submit()
+		}
+	}
+	return n, pw.err
+}
+
+// submit starts compressing the buffered data. If as many blocks as there
+// are threads are being compressed, it waits for the oldest one to finish.
+func (pw *parallelXZWriter) submit() {
+	block := pw.buf
+	pw.buf = make([]byte, 0, xzBlockSize)
+	pw.written = true
+
+	ch := make(chan xzResult, 1)
+	go func() {
+		var buf bytes.Buffer
+		zw, err := pw.conf.NewWriter(&buf)
+		if err == nil {
+			_, err = zw.Write(block)
+		}
+		if err == nil {
+			err = zw.Close()
+		}
+		ch <- xzResult{buf.Bytes(), err}
+	}()
+	pw.pending = append(pw.pending, ch)
+	if len(pw.pending) >= pw.threads {
+		pw.flushOldest()
+	}
+}
+
+// flushOldest waits for the oldest pending block and writes it to w.
+func (pw *parallelXZWriter) flushOldest() {
+	res := <-pw.pending[0]
+	pw.pending = pw.pending[1:]
+	if pw.err != nil {
+		return
+	}
+	if pw.err = res.err; pw.err == nil {
+		_, pw.err = pw.w.Write(res.data)
+	}
+}
+
+// Close compresses any remaining data and waits for all blocks to be written.
+func (pw *parallelXZWriter) Close() error {
+	// Even if nothing has been written, the result must be a valid stream.
+	if len(pw.buf) > 0 || !pw.written {
+		pw.submit()
+	}
+	for len(pw.pending) > 0 {
+		pw.flushOldest()
+	}
+	return pw.err
+}
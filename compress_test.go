@@ -0,0 +1,303 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressor(z *testing.T) {
+	assert := assert.New(z)
+
+	data, err := ioutil.ReadFile(testfile)
+	assert.Nil(err)
+
+	for _, ext := range []string{".tar", ".gz", ".bz2", ".xz", ".zst", ".lz4"} {
+		dest := testdest + ext
+		c, err := NewCompressor(dest)
+		assert.Nil(err, ext)
+		_, err = c.Write(data)
+		assert.Nil(err, ext)
+		assert.Nil(c.Close(), ext)
+
+		d, err := NewDecompressor(dest)
+		assert.Nil(err, ext)
+		got, err := ioutil.ReadAll(d)
+		assert.Nil(err, ext)
+		assert.Nil(d.Close(), ext)
+		assert.Equal(data, got, "round trip should preserve data", ext)
+		os.Remove(dest)
+	}
+
+	_, err = NewCompressor(testdest)
+	assert.Equal(FormatError{testdest}, err)
+	ex, err := FileExists(testdest)
+	assert.Nil(err)
+	assert.False(ex, "file should be removed on error", testdest)
+}
+
+func TestCompressorThreads(z *testing.T) {
+	assert := assert.New(z)
+
+	// Make sure the data spans several xz blocks.
+	data := bytes.Repeat([]byte("some moderately compressible data\n"), 2*xzBlockSize/32)
+	for _, ext := range []string{".gz", ".xz", ".zst", ".lz4"} {
+		dest := testdest + ext
+		c, err := NewCompressor(dest, Threads(4))
+		assert.Nil(err, ext)
+		_, err = c.Write(data)
+		assert.Nil(err, ext)
+		assert.Nil(c.Close(), ext)
+
+		d, err := NewDecompressor(dest)
+		assert.Nil(err, ext)
+		got, err := ioutil.ReadAll(d)
+		assert.Nil(err, ext)
+		assert.Nil(d.Close(), ext)
+		assert.True(bytes.Equal(data, got), "round trip should preserve data", ext)
+		os.Remove(dest)
+	}
+
+	// An empty stream must still be valid.
+	dest := testdest + ".xz"
+	c, err := NewCompressor(dest, Threads(2))
+	assert.Nil(err)
+	assert.Nil(c.Close())
+	d, err := NewDecompressor(dest)
+	assert.Nil(err)
+	got, err := ioutil.ReadAll(d)
+	assert.Nil(err)
+	assert.Len(got, 0)
+	assert.Nil(d.Close())
+	os.Remove(dest)
+}
+
+// compressBytes compresses data into dest with the options and returns the
+// compressed data, after checking that it decompresses to data again.
+func compressBytes(assert *assert.Assertions, dest string, data []byte, opts ...Option) []byte {
+	defer os.Remove(dest)
+	c, err := NewCompressor(dest, opts...)
+	if !assert.Nil(err, dest) {
+		return nil
+	}
+	_, err = c.Write(data)
+	assert.Nil(err, dest)
+	assert.Nil(c.Close(), dest)
+
+	d, err := NewDecompressor(dest)
+	assert.Nil(err, dest)
+	got, err := ioutil.ReadAll(d)
+	assert.Nil(err, dest)
+	assert.Nil(d.Close(), dest)
+	assert.True(bytes.Equal(data, got), "round trip should preserve data", dest)
+
+	compressed, err := ioutil.ReadFile(dest)
+	assert.Nil(err, dest)
+	return compressed
+}
+
+func TestCompressionOptions(z *testing.T) {
+	assert := assert.New(z)
+
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta"}
+	var buf bytes.Buffer
+	for buf.Len() < 1<<20 {
+		buf.WriteString(words[rnd.Intn(len(words))])
+		buf.WriteByte(" \n"[rnd.Intn(2)])
+	}
+	data := buf.Bytes()
+
+	for _, ext := range []string{".gz", ".bz2", ".xz", ".zst", ".lz4"} {
+		fast := compressBytes(assert, testdest+ext, data, CompressionLevel(1))
+		best := compressBytes(assert, testdest+ext, data, CompressionLevel(9))
+		assert.True(len(best) <= len(fast), "higher level should not compress worse", ext)
+	}
+	_, err := NewCompressor(testdest+".xz", CompressionLevel(10))
+	assert.NotNil(err)
+	os.Remove(testdest + ".xz")
+
+	compressBytes(assert, testdest+".zst", data, ZstdWindowSize(1<<16))
+	compressBytes(assert, testdest+".xz", data, CompressionLevel(6), Threads(2))
+
+	// A change at the start of the data should only change the start of
+	// the rsyncable output.
+	a := compressBytes(assert, testdest+".gz", data, GzipRsyncable())
+	changed := append([]byte("omega"), data...)
+	b := compressBytes(assert, testdest+".gz", changed, GzipRsyncable(), Threads(4))
+	common := 0
+	for common < len(a)-8 && common < len(b)-8 && a[len(a)-9-common] == b[len(b)-9-common] {
+		common++
+	}
+	assert.True(common > len(a)/2, "rsyncable output should mostly be unchanged")
+}
+
+func TestDecompressorMultistream(z *testing.T) {
+	assert := assert.New(z)
+
+	parts := []string{"hello ", "concatenated ", "world\n"}
+	for _, ext := range []string{".gz", ".bz2", ".xz", ".zst", ".lz4"} {
+		var buf bytes.Buffer
+		for _, part := range parts {
+			w, err := newCompressWriter(&buf, formatFromExt(ext), newArchiveOptions(nil))
+			assert.Nil(err, ext)
+			_, err = w.Write([]byte(part))
+			assert.Nil(err, ext)
+			assert.Nil(w.Close(), ext)
+		}
+		dest := testdest + ext
+		assert.Nil(ioutil.WriteFile(dest, buf.Bytes(), 0644), ext)
+
+		for _, opts := range [][]Option{nil, {ParallelGzip(0, 0)}} {
+			d, err := NewDecompressor(dest, opts...)
+			assert.Nil(err, ext)
+			got, err := ioutil.ReadAll(d)
+			assert.Nil(err, ext)
+			assert.Nil(d.Close(), ext)
+			assert.Equal(strings.Join(parts, ""), string(got), ext)
+		}
+		os.Remove(dest)
+	}
+}
+
+func TestRecompressArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	zst := filepath.Join(dir, "data.tar.zst")
+	assert.Nil(RecompressArchive("testdata/dir_reader_data.tar.gz", zst))
+	format, err := archiveFormat(zst)
+	assert.Nil(err)
+	assert.Equal(FormatZstd, format)
+	d, err := DiffArchives("testdata/dir_reader_data.tar", zst)
+	assert.Nil(err)
+	assert.True(d.Empty())
+
+	// Recompressing in place works as well.
+	assert.Nil(RecompressArchive(zst, zst, Threads(2)))
+	data, err := ReadFileFromArchive(zst, "dir1/file1")
+	assert.Nil(err)
+	assert.Equal("dir1/file1 content\n", string(data))
+
+	bad := filepath.Join(dir, "data.unknown")
+	assert.Equal(FormatError{bad}, RecompressArchive(zst, bad))
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(err)
+	assert.Len(files, 1, "temporary files should be removed")
+}
+
+func BenchmarkDecompressor(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 4<<20)
+	for i := range data {
+		// Text-like data that compresses moderately well.
+		data[i] = byte('a' + rnd.Intn(16))
+	}
+
+	for _, ext := range []string{".gz", ".bz2", ".xz", ".zst", ".lz4"} {
+		dest := testdest + ext
+		c, err := NewCompressor(dest)
+		if err != nil {
+			b.Fatal(err)
+		}
+		c.Write(data)
+		if err := c.Close(); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(ext[1:], func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				d, err := NewDecompressor(dest)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := copyBuffer(ioutil.Discard, d); err != nil {
+					b.Fatal(err)
+				}
+				d.Close()
+			}
+		})
+		os.Remove(dest)
+	}
+}
+
+func TestCompressFile(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile(testfile)
+	assert.Nil(err)
+	path := filepath.Join(dir, "data")
+	mtime := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	for _, format := range []Format{FormatGzip, FormatBzip2, FormatXZ, FormatZstd, FormatLZ4} {
+		assert.Nil(ioutil.WriteFile(path, data, 0600))
+		assert.Nil(os.Chtimes(path, mtime, mtime))
+
+		dst, err := CompressFile(path, format, PreserveTimes())
+		assert.Nil(err, format.String())
+		assert.Equal(path+compressExt[format], dst)
+		ex, _ := FileExists(path)
+		assert.False(ex, "the original should be removed")
+		fi, err := os.Stat(dst)
+		if assert.Nil(err) {
+			assert.Equal(os.FileMode(0600), fi.Mode().Perm(), format.String())
+			assert.True(mtime.Equal(fi.ModTime()), format.String())
+		}
+
+		got, err := DecompressFile(dst, KeepOriginal())
+		assert.Nil(err, format.String())
+		assert.Equal(path, got)
+		ex, _ = FileExists(dst)
+		assert.True(ex, "the original should be kept")
+		out, err := ioutil.ReadFile(path)
+		assert.Nil(err)
+		assert.Equal(data, out, format.String())
+
+		// Existing files are not overwritten.
+		_, err = DecompressFile(dst)
+		assert.True(os.IsExist(err), format.String())
+		assert.Nil(os.Remove(dst))
+	}
+
+	_, err = CompressFile(path, FormatZip)
+	assert.NotNil(err)
+	_, err = DecompressFile(path)
+	assert.Equal(FormatError{path}, err)
+}
+
+func TestDecompressFileShorthand(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "data.tgz")
+	assert.Nil(CopyFile("testdata/dir_reader_data.tar.gz", path))
+	dst, err := DecompressFile(path)
+	assert.Nil(err)
+	assert.Equal(filepath.Join(dir, "data.tar"), dst)
+	data, err := ReadFileFromArchive(dst, "dir1/file1")
+	assert.Nil(err)
+	assert.Equal("dir1/file1 content\n", string(data))
+}
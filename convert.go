@@ -0,0 +1,221 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+)
+
+// ConvertArchive converts the (compressed) archive src into the archive dst,
+// in a single pass and without extracting it. The format of dst is chosen
+// by its extension: it can be a zip archive or a tar archive compressed in
+// any format supported by NewCompressor. Archive formats supported for src
+// are the same as for ReadFileFromArchive.
+//
+// As much metadata is preserved as both formats support. Zip archives
+// store the names, modes, modification times, symlinks, and, in an Info-ZIP
+// extra field, the owners of the entries. When converting to zip,
+// hardlinks are stored as copies of the files they link to, and devices
+// and fifos are skipped. The Zip64 extensions are used where the limits of
+// classic zip archives, 4 GiB and 65535 entries, are exceeded.
+//
+// Options supported are Password, for reading encrypted zip archives, and
+// the options of NewCompressor except VolumeSize, for writing compressed
+// tar archives. If an error occurs, dst is removed.
+func ConvertArchive(src, dst string, opts ...Option) (err error) {
+	o := newArchiveOptions(opts)
+	if formatFromExt(dst) == FormatZip {
+		return convertToZip(src, dst, o)
+	}
+
+	c, err := newCompressor(dst, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			removeOutput(dst, o)
+		}
+	}()
+
+	tw := tar.NewWriter(c)
+	err = walkArchive(src, o, func(hdr *tar.Header, r io.Reader) error {
+		if err := tw.WriteHeader(convertHeader(hdr)); err != nil {
+			return err
+		}
+		_, err := copyBuffer(tw, r)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// convertHeader returns a copy of hdr with only the fields that describe
+// the entry itself, so that it can be written by a tar.Writer.
+func convertHeader(hdr *tar.Header) *tar.Header {
+	h := &tar.Header{
+		Typeflag: hdr.Typeflag,
+		Name:     hdr.Name,
+		Linkname: hdr.Linkname,
+		Size:     hdr.Size,
+		Mode:     hdr.Mode,
+		Uid:      hdr.Uid,
+		Gid:      hdr.Gid,
+		Uname:    hdr.Uname,
+		Gname:    hdr.Gname,
+		ModTime:  hdr.ModTime,
+		Devmajor: hdr.Devmajor,
+		Devminor: hdr.Devminor,
+	}
+	// Sparse files are read with their holes filled in.
+	if h.Typeflag == tar.TypeGNUSparse || h.Typeflag == tar.TypeRegA {
+		h.Typeflag = tar.TypeReg
+	}
+	if xattrs := xattrsFromPAX(hdr.PAXRecords); xattrs != nil {
+		h.PAXRecords = make(map[string]string, len(xattrs))
+		for k, v := range xattrs {
+			h.PAXRecords[paxXattrPrefix+k] = v
+		}
+	}
+	return h
+}
+
+// convertToZip does the hard work for ConvertArchive for zip archives.
+func convertToZip(src, dst string, o *archiveOptions) (err error) {
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dst)
+		}
+	}()
+
+	zw := zip.NewWriter(f)
+	err = walkArchive(src, o, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Typeflag == tar.TypeLink {
+			// Zip archives cannot store hardlinks, so the file linked to
+			// is read again.
+			data, err := ReadFileFromArchive(src, hdr.Linkname, Password(o.password))
+			if err != nil {
+				return err
+			}
+			h := *hdr
+			h.Typeflag, h.Linkname, h.Size = tar.TypeReg, "", int64(len(data))
+			return writeZipEntry(zw, &h, bytes.NewReader(data))
+		}
+		return writeZipEntry(zw, hdr, r)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeZipEntry writes the entry described by hdr to zw, with the contents
+// read from r. Entries that zip archives cannot store are skipped.
+func writeZipEntry(zw *zip.Writer, hdr *tar.Header, r io.Reader) error {
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse, tar.TypeDir, tar.TypeSymlink:
+	default:
+		return nil
+	}
+
+	fh, err := zip.FileInfoHeader(hdr.FileInfo())
+	if err != nil {
+		return err
+	}
+	fh.Name = hdr.Name
+	fh.Modified = hdr.ModTime
+	fh.Extra = zipOwnerExtra(hdr.Uid, hdr.Gid)
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if !strings.HasSuffix(fh.Name, "/") {
+			fh.Name += "/"
+		}
+		fh.Method = zip.Store
+	case tar.TypeSymlink:
+		// The target of a symlink is stored as its contents.
+		fh.Method = zip.Store
+		r = strings.NewReader(hdr.Linkname)
+	default:
+		fh.Method = zip.Deflate
+	}
+
+	w, err := zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	if hdr.Typeflag == tar.TypeDir {
+		return nil
+	}
+	_, err = copyBuffer(w, r)
+	return err
+}
+
+// zipUnixExtraID identifies the Info-ZIP extra field containing the owner
+// and group of a file.
+const zipUnixExtraID = 0x7875
+
+// zipOwnerExtra returns the Info-ZIP extra field storing uid and gid.
+func zipOwnerExtra(uid, gid int) []byte {
+	b := make([]byte, 15)
+	binary.LittleEndian.PutUint16(b, zipUnixExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 11)
+	b[4], b[5] = 1, 4
+	binary.LittleEndian.PutUint32(b[6:], uint32(uid))
+	b[10] = 4
+	binary.LittleEndian.PutUint32(b[11:], uint32(gid))
+	return b
+}
+
+// zipOwner returns the owner and group stored in the Info-ZIP extra field
+// of the extra data of a zip file, if there is one.
+func zipOwner(extra []byte) (uid, gid int, ok bool) {
+	for len(extra) >= 4 {
+		id, n := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+n > len(extra) {
+			return 0, 0, false
+		}
+		field := extra[4 : 4+n]
+		extra = extra[4+n:]
+		if id != zipUnixExtraID || len(field) < 2 || field[0] != 1 {
+			continue
+		}
+
+		// The field contains the sizes and values of the uid and gid.
+		var ids [2]int
+		field = field[1:]
+		for i := range ids {
+			if len(field) < 1 || len(field) < 1+int(field[0]) || field[0] > 8 {
+				return 0, 0, false
+			}
+			size := int(field[0])
+			var v uint64
+			for j := size; j > 0; j-- {
+				v = v<<8 | uint64(field[j])
+			}
+			ids[i] = int(v)
+			field = field[1+size:]
+		}
+		return ids[0], ids[1], true
+	}
+	return 0, 0, false
+}
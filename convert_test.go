@@ -0,0 +1,95 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	zipfile := filepath.Join(dir, "data.zip")
+	err = ConvertArchive("testdata/dir_reader_data.tar.gz", zipfile)
+	assert.Nil(err)
+	xzfile := filepath.Join(dir, "data.tar.xz")
+	err = ConvertArchive(zipfile, xzfile)
+	assert.Nil(err)
+
+	for _, name := range []string{"dir1/file1", "dir1/file2", "dir2/file1", "dir2/file2", "dir2/file3"} {
+		want, err := ReadFileFromArchive("testdata/dir_reader_data.tar", name)
+		assert.Nil(err)
+		for _, archive := range []string{zipfile, xzfile} {
+			got, err := ReadFileFromArchive(archive, name)
+			assert.Nil(err, archive)
+			assert.Equal(want, got, archive+": "+name)
+		}
+	}
+}
+
+func TestConvertArchiveMetadata(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "links.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 0755, Uid: 1000, Gid: 100}, "#!/bin/sh\n"},
+		{tar.Header{Name: "bin/alias", Typeflag: tar.TypeSymlink, Linkname: "tool"}, ""},
+		{tar.Header{Name: "bin/copy", Typeflag: tar.TypeLink, Linkname: "bin/tool"}, ""},
+		{tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0644}, ""},
+	})
+	assert.Nil(err)
+
+	zipfile := filepath.Join(dir, "links.zip")
+	err = ConvertArchive(archive, zipfile)
+	assert.Nil(err)
+	tarfile := filepath.Join(dir, "links.tar.gz")
+	err = ConvertArchive(zipfile, tarfile)
+	assert.Nil(err)
+
+	var hdrs []*tar.Header
+	err = walkArchive(tarfile, newArchiveOptions(nil), func(hdr *tar.Header, r io.Reader) error {
+		hdrs = append(hdrs, hdr)
+		return nil
+	})
+	assert.Nil(err)
+	if assert.Len(hdrs, 4, "the fifo should be skipped") {
+		assert.Equal(byte(tar.TypeDir), hdrs[0].Typeflag)
+		assert.Equal(os.FileMode(0755), hdrs[1].FileInfo().Mode())
+		assert.Equal(1000, hdrs[1].Uid)
+		assert.Equal(100, hdrs[1].Gid)
+		assert.Equal(byte(tar.TypeSymlink), hdrs[2].Typeflag)
+		assert.Equal("tool", hdrs[2].Linkname)
+		assert.Equal(byte(tar.TypeReg), hdrs[3].Typeflag, "hardlinks should become copies")
+	}
+	data, err := ReadFileFromArchive(tarfile, "bin/copy")
+	assert.Nil(err)
+	assert.Equal("#!/bin/sh\n", string(data))
+}
+
+func TestConvertArchiveFormat(z *testing.T) {
+	assert := assert.New(z)
+
+	dest := testdest + ".7z"
+	err := ConvertArchive("testdata/dir_reader_data.tar", dest)
+	assert.Equal(FormatError{dest}, err)
+	ex, _ := FileExists(dest)
+	assert.False(ex, "output should be removed")
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxKernelCopy is the most that is copied by a single system call.
+const maxKernelCopy = 1 << 30
+
+// copyFileData copies the contents of in to out, from their current
+// offsets, without passing the data through user space: copy_file_range
+// lets the file system copy the data, which on NFS and some other file
+// systems does not even transfer it, and sendfile is used by older kernels.
+// If neither works for the files, the data is copied with copyBuffer.
+func copyFileData(out, in *os.File) (int64, error) {
+	n, ok, err := kernelCopy(out, in, func(outfd, infd int) (int, error) {
+		return unix.CopyFileRange(infd, nil, outfd, nil, maxKernelCopy, 0)
+	})
+	if !ok {
+		n, ok, err = kernelCopy(out, in, func(outfd, infd int) (int, error) {
+			return unix.Sendfile(outfd, infd, nil, maxKernelCopy)
+		})
+	}
+	if !ok {
+		return copyBuffer(out, in)
+	}
+	return n, err
+}
+
+// kernelCopy copies from in to out by calling copy until it copies no more.
+// If copy cannot copy anything at all, ok is false; this is also the case
+// for files like those in /proc, which report no data to the kernel.
+func kernelCopy(out, in *os.File, copy func(outfd, infd int) (int, error)) (n int64, ok bool, err error) {
+	outfd, infd := int(out.Fd()), int(in.Fd())
+	for {
+		m, err := copy(outfd, infd)
+		if err == unix.EINTR {
+			continue
+		}
+		if n == 0 && (m <= 0 || err != nil) {
+			switch err {
+			case nil, unix.ENOSYS, unix.EXDEV, unix.EINVAL, unix.EOPNOTSUPP, unix.EPERM, unix.EBADF, unix.EIO:
+				return 0, false, nil
+			}
+		}
+		if err != nil {
+			return n, true, &os.PathError{Op: "copy", Path: out.Name(), Err: err}
+		}
+		if m == 0 {
+			return n, true, nil
+		}
+		n += int64(m)
+	}
+}
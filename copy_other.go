@@ -0,0 +1,17 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package osutil
+
+import "os"
+
+// copyFileData copies the contents of in to out with copyBuffer, which
+// leaves it to io.Copy, since the kernel cannot be asked directly on this
+// platform.
+func copyFileData(out, in *os.File) (int64, error) {
+	return copyBuffer(out, in)
+}
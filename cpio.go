@@ -0,0 +1,194 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCpioHeader is returned by CpioReader when it encounters a header
+// that is invalid or in an unsupported format.
+var ErrCpioHeader = errors.New("invalid cpio header")
+
+const (
+	cpioHeaderLen = 110
+	cpioTrailer   = "TRAILER!!!"
+
+	// cpioMaxPath is the longest name or symlink target that is read, as
+	// their sizes are taken from the untrusted header; it is PATH_MAX on
+	// Linux.
+	cpioMaxPath = 4096
+)
+
+// CpioReader provides sequential access to the contents of a cpio archive
+// in the "newc" format, which is used by initramfs images and RPM payloads,
+// or in its "crc" variant, whose checksums are not verified.
+//
+// It is used much like tar.Reader: Next advances to the next entry, which
+// is described by a tar header, and the contents of the entry can then be
+// read from the CpioReader itself. Directory names end with a slash, as
+// they do in tar archives. Hardlinked files are returned as they are
+// stored, which means that only the last of them has any contents.
+// Sockets, which cannot be described by a tar header, are skipped.
+type CpioReader struct {
+	r   io.Reader
+	err error
+
+	// remaining is the number of bytes of the current entry that have not
+	// been read, and pad the number of padding bytes following them.
+	remaining int64
+	pad       int64
+}
+
+// NewCpioReader creates a new CpioReader reading from r.
+func NewCpioReader(r io.Reader) *CpioReader {
+	return &CpioReader{r: r}
+}
+
+// Next advances to the next entry in the archive. At the end of the archive,
+// io.EOF is returned.
+func (cr *CpioReader) Next() (*tar.Header, error) {
+	if cr.err != nil {
+		return nil, cr.err
+	}
+	hdr, err := cr.next()
+	if err != nil {
+		cr.err = err
+	}
+	return hdr, err
+}
+
+func (cr *CpioReader) next() (*tar.Header, error) {
+	for {
+		// Skip the rest of the previous entry.
+		if _, err := io.CopyN(ioutil.Discard, cr.r, cr.remaining+cr.pad); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		cr.remaining, cr.pad = 0, 0
+
+		var buf [cpioHeaderLen]byte
+		if _, err := io.ReadFull(cr.r, buf[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		magic := string(buf[:6])
+		if magic != "070701" && magic != "070702" {
+			return nil, ErrCpioHeader
+		}
+		var fields [13]int64
+		for i := range fields {
+			v, err := strconv.ParseUint(string(buf[6+8*i:14+8*i]), 16, 32)
+			if err != nil {
+				return nil, ErrCpioHeader
+			}
+			fields[i] = int64(v)
+		}
+		mode, uid, gid := fields[1], fields[2], fields[3]
+		mtime, size, namesize := fields[5], fields[6], fields[11]
+		if namesize == 0 || namesize > cpioMaxPath {
+			return nil, ErrCpioHeader
+		}
+
+		// The header and name, as well as the contents, are padded to
+		// a multiple of four bytes.
+		name := make([]byte, namesize+pad4(cpioHeaderLen+namesize))
+		if _, err := io.ReadFull(cr.r, name); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		hdr := &tar.Header{
+			Name:     strings.TrimRight(string(name[:namesize]), "\x00"),
+			Mode:     mode & 07777,
+			Uid:      int(uid),
+			Gid:      int(gid),
+			Size:     size,
+			ModTime:  time.Unix(mtime, 0),
+			Devmajor: fields[9],
+			Devminor: fields[10],
+			Format:   tar.FormatPAX,
+		}
+		if hdr.Name == cpioTrailer {
+			return nil, io.EOF
+		}
+		cr.remaining, cr.pad = size, pad4(size)
+
+		switch mode & 0170000 {
+		case 0100000:
+			hdr.Typeflag = tar.TypeReg
+		case 0040000:
+			hdr.Typeflag = tar.TypeDir
+			if !strings.HasSuffix(hdr.Name, "/") {
+				hdr.Name += "/"
+			}
+		case 0120000:
+			// The target of a symlink is stored as its contents.
+			if size > cpioMaxPath {
+				return nil, ErrCpioHeader
+			}
+			link := make([]byte, size)
+			if _, err := io.ReadFull(cr, link); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = string(link)
+			hdr.Size = 0
+		case 0020000:
+			hdr.Typeflag = tar.TypeChar
+		case 0060000:
+			hdr.Typeflag = tar.TypeBlock
+		case 0010000:
+			hdr.Typeflag = tar.TypeFifo
+		case 0140000:
+			continue
+		default:
+			return nil, ErrCpioHeader
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeSymlink {
+			hdr.Size = 0
+		}
+		return hdr, nil
+	}
+}
+
+// Read reads from the contents of the current entry. It returns io.EOF at
+// the end of the entry, until Next is called.
+func (cr *CpioReader) Read(p []byte) (int, error) {
+	if cr.err != nil {
+		return 0, cr.err
+	}
+	if cr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.r.Read(p)
+	cr.remaining -= int64(n)
+	if err == io.EOF && cr.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF {
+		cr.err = err
+	}
+	return n, err
+}
+
+// pad4 returns the number of bytes needed to pad n to a multiple of four.
+func pad4(n int64) int64 {
+	return (4 - n%4) % 4
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF, since a cpio archive
+// must end with a trailer entry.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
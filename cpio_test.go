@@ -0,0 +1,107 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// cpioEntry returns a cpio entry in the newc format.
+func cpioEntry(name string, mode int64, data string) []byte {
+	var buf bytes.Buffer
+	name += "\x00"
+	fmt.Fprintf(&buf, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		1, mode, 0, 0, 1, 0, len(data), 0, 0, 0, 0, len(name), 0)
+	buf.WriteString(name)
+	buf.Write(make([]byte, pad4(int64(buf.Len()))))
+	buf.WriteString(data)
+	buf.Write(make([]byte, pad4(int64(len(data)))))
+	return buf.Bytes()
+}
+
+func TestCpioReader(z *testing.T) {
+	assert := assert.New(z)
+
+	var archive []byte
+	archive = append(archive, cpioEntry(".", 040755, "")...)
+	archive = append(archive, cpioEntry("bin", 040755, "")...)
+	archive = append(archive, cpioEntry("bin/sh", 0100755, "#!/bin/busybox\n")...)
+	archive = append(archive, cpioEntry("init", 0120777, "bin/sh")...)
+	archive = append(archive, cpioEntry("console", 0140666, "")...)
+	archive = append(archive, cpioEntry("etc/fstab", 0100644, "none\n")...)
+	archive = append(archive, cpioEntry(cpioTrailer, 0, "")...)
+
+	cr := NewCpioReader(bytes.NewReader(archive))
+	var names []string
+	for {
+		hdr, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(err) {
+			return
+		}
+		names = append(names, hdr.Name)
+
+		switch hdr.Name {
+		case "bin/":
+			assert.Equal(byte(tar.TypeDir), hdr.Typeflag)
+			assert.Equal(int64(0755), hdr.Mode)
+		case "init":
+			assert.Equal(byte(tar.TypeSymlink), hdr.Typeflag)
+			assert.Equal("bin/sh", hdr.Linkname)
+		case "etc/fstab":
+			// bin/sh is not read, so it must be skipped correctly.
+			data, err := ioutil.ReadAll(cr)
+			assert.Nil(err)
+			assert.Equal("none\n", string(data))
+			assert.Equal(int64(5), hdr.Size)
+		}
+	}
+	assert.Equal([]string{"./", "bin/", "bin/sh", "init", "etc/fstab"}, names)
+
+	// The trailer is required.
+	cr = NewCpioReader(bytes.NewReader(cpioEntry("init", 0100755, "")))
+	_, err := cr.Next()
+	assert.Nil(err)
+	_, err = cr.Next()
+	assert.Equal(io.ErrUnexpectedEOF, err)
+
+	// The old binary format is not supported.
+	cr = NewCpioReader(bytes.NewReader(append([]byte{0xc7, 0x71}, make([]byte, 200)...)))
+	_, err = cr.Next()
+	assert.Equal(ErrCpioHeader, err)
+
+	// Huge declared sizes of names and symlink targets are not allocated.
+	hdr := fmt.Sprintf("070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		1, 0100644, 0, 0, 1, 0, 0, 0, 0, 0, 0, uint32(0xffffffff), 0)
+	_, err = NewCpioReader(bytes.NewReader([]byte(hdr))).Next()
+	assert.Equal(ErrCpioHeader, err)
+	link := cpioEntry("init", 0120777, "")
+	copy(link[54:62], fmt.Sprintf("%08X", uint32(0xffffffff)))
+	_, err = NewCpioReader(bytes.NewReader(link)).Next()
+	assert.Equal(ErrCpioHeader, err)
+}
+
+func TestExtractCpio(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(ExtractArchive("testdata/dir_reader_data.cpio.gz", dir))
+	data, err := ioutil.ReadFile(dir + "/dir2/file3")
+	assert.Nil(err)
+	assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data))
+}
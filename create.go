@@ -0,0 +1,424 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CreateArchive writes the directory tree at srcDir to a tar archive at
+// destPath, which is compressed according to its extension, as with
+// NewCompressor. Entry names are relative to srcDir; symlinks are stored
+// as links, not followed, unless FollowSymlinks is given. A file with
+// several hard links within srcDir is stored once, and its other names are
+// stored as hardlinks, like tar does. With PreserveXattrs, extended
+// attributes are stored as PAX records, and with Sparse, files with holes
+// are stored as sparse files. With Threads, the archive is compressed in
+// parallel, and CompressionLevel, ZstdWindowSize, GzipRsyncable, and
+// SeekableZstd tune the compression. To archive only some of the files,
+// use Include, Exclude, or Filter, and for reproducible archives, use
+// Deterministic.
+func CreateArchive(destPath, srcDir string, opts ...Option) error {
+	return CreateArchiveContext(context.Background(), destPath, srcDir, opts...)
+}
+
+// CreateArchiveContext is the same as CreateArchive, except that it stops
+// with the error of ctx once ctx is done. In that case, the incomplete
+// archive is removed.
+func CreateArchiveContext(ctx context.Context, destPath, srcDir string, opts ...Option) (err error) {
+	o := newArchiveOptions(opts)
+	if err := o.checkPatterns(); err != nil {
+		return err
+	}
+
+	absDest, err := filepath.Abs(destPath)
+	if err != nil {
+		return err
+	}
+
+	c, err := newCompressor(destPath, o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := c.Close()
+		if err == nil {
+			err = cerr
+		}
+		if err != nil {
+			removeOutput(destPath, o)
+		}
+	}()
+
+	a := &archiver{
+		ctx:      ctx,
+		w:        c,
+		tw:       tar.NewWriter(c),
+		opts:     o,
+		progress: newProgressTracker(o),
+		epoch:    sourceDateEpoch(),
+		dest:     absDest,
+	}
+	if err := a.walk(srcDir, ""); err != nil {
+		return err
+	}
+	return a.tw.Close()
+}
+
+// AppendToArchive appends the files to the uncompressed tar archive, which
+// is created if it does not exist, like `tar -r`. Directories are added
+// together with their contents. Entry names are the paths as given, with
+// forward slashes and without any leading slash.
+//
+// Compressed archives cannot be appended to; for these, a FormatError is
+// returned. If an error occurs while appending, the archive is restored
+// to its previous contents.
+func AppendToArchive(archive string, files ...string) (err error) {
+	if format := formatFromExt(archive); format != FormatTar && format != FormatUnknown {
+		return FormatError{archive}
+	}
+
+	f, err := os.OpenFile(archive, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	end, err := tarEnd(f, archive)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			// Writing a new trailer at the old end restores the archive.
+			if terr := f.Truncate(end); terr == nil {
+				f.WriteAt(make([]byte, 2*512), end)
+			}
+		}
+	}()
+
+	a := &archiver{
+		ctx:  context.Background(),
+		w:    f,
+		tw:   tar.NewWriter(f),
+		opts: newArchiveOptions(nil),
+	}
+	for _, file := range files {
+		err := filepath.Walk(file, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := strings.TrimLeft(filepath.ToSlash(filepath.Clean(path)), "/")
+			return a.add(path, name, fi)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+
+	// Anything beyond the new trailer belongs to the old one.
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return f.Truncate(pos)
+}
+
+// walk adds the tree at root to the archive. Entries are named relative to
+// root and below prefix; if prefix is empty, root itself is not added.
+func (a *archiver) walk(root, prefix string) error {
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := a.ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := prefix
+		if rel != "." {
+			name = strings.TrimPrefix(prefix+"/"+filepath.ToSlash(rel), "/")
+		}
+		if name == "" {
+			return nil
+		}
+		// Make sure we don't try to archive the archive itself.
+		if abs, err := filepath.Abs(path); err == nil && (abs == a.dest || a.opts.volumeSize > 0 && isVolumeOf(abs, a.dest)) {
+			return nil
+		}
+
+		if a.opts.follow && fi.Mode()&os.ModeSymlink != 0 {
+			return a.addTarget(path, name)
+		}
+		return a.add(path, name, fi)
+	})
+}
+
+// addTarget adds the file that the symlink at path points to, as with
+// FollowSymlinks. Directories are added together with their contents,
+// unless this would lead to a loop, in which case the symlink is added.
+func (a *archiver) addTarget(path, name string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return a.add(path, name, fi)
+	}
+	if isAncestor(path, fi) {
+		lfi, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		return a.add(path, name, lfi)
+	}
+
+	// filepath.Walk does not descend into symlinks, so the contents of the
+	// directory are walked one by one.
+	if err := a.add(path, name, fi); err == filepath.SkipDir {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	names, err := readDirNames(path)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if err := a.walk(filepath.Join(path, n), name+"/"+n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isAncestor returns true if the directory dir contains path.
+func isAncestor(path string, dir os.FileInfo) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for p := filepath.Dir(path); ; p = filepath.Dir(p) {
+		if fi, err := os.Stat(p); err == nil && os.SameFile(fi, dir) {
+			return true
+		}
+		if p == filepath.Dir(p) {
+			return false
+		}
+	}
+}
+
+// readDirNames returns the sorted names of the entries of the directory.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// tarEnd returns the offset in the tar archive f at which its trailer,
+// which consists of two zero blocks, starts. For an empty file, this is 0.
+func tarEnd(f *os.File, archive string) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() == 0 {
+		return 0, err
+	}
+	if format, err := DetectFormat(f); err != nil {
+		return 0, err
+	} else if format != FormatTar {
+		return 0, FormatError{archive}
+	}
+
+	// The tar reader reads exactly the blocks it needs, so that after the
+	// last entry, it has just read the trailer.
+	tr := tar.NewReader(f)
+	for {
+		if _, err := tr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	trailer := make([]byte, 2*512)
+	if pos < int64(len(trailer)) {
+		return pos, nil
+	}
+	if _, err := f.ReadAt(trailer, pos-int64(len(trailer))); err != nil {
+		return 0, err
+	}
+	if !isZero(trailer) {
+		// The archive ends without a trailer.
+		return pos, nil
+	}
+	return pos - int64(len(trailer)), nil
+}
+
+// archiver writes files to a tar archive.
+type archiver struct {
+	ctx      context.Context
+	w        io.Writer
+	tw       *tar.Writer
+	opts     *archiveOptions
+	progress *progressTracker
+
+	// epoch is the latest modification time of entries with Deterministic.
+	epoch time.Time
+
+	// dest is the absolute path of the archive, which is not added to
+	// itself.
+	dest string
+
+	// links maps files with several hard links to the name of the entry
+	// they were first written as.
+	links map[fileID]string
+}
+
+// fileID identifies a file on the system by its device and inode.
+type fileID struct {
+	dev, ino uint64
+}
+
+// add writes the header and, for regular files, the contents of the file
+// at path to the archive, using name as the entry name.
+func (a *archiver) add(path, name string, fi os.FileInfo) error {
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	if ok, skipDir := a.opts.selected(hdr); skipDir {
+		return filepath.SkipDir
+	} else if !ok {
+		return nil
+	}
+	a.progress.entry(name)
+	if a.opts.determ {
+		normalizeHeader(hdr, a.epoch)
+	}
+
+	if a.opts.xattrs {
+		xattrs, err := readXattrs(path)
+		if err != nil {
+			return err
+		}
+		for k, v := range xattrs {
+			if hdr.PAXRecords == nil {
+				hdr.PAXRecords = make(map[string]string)
+			}
+			hdr.PAXRecords[paxXattrPrefix+k] = v
+		}
+	}
+	if !fi.Mode().IsRegular() {
+		return a.tw.WriteHeader(hdr)
+	}
+	if id, ok := hardlinkID(fi); ok {
+		if first, ok := a.links[id]; ok {
+			hdr.Typeflag = tar.TypeLink
+			hdr.Linkname = first
+			hdr.Size = 0
+			return a.tw.WriteHeader(hdr)
+		}
+		if a.links == nil {
+			a.links = make(map[fileID]string)
+		}
+		a.links[id] = hdr.Name
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if a.opts.sparse && hdr.Size > 0 {
+		regions, err := dataRegions(f, hdr.Size)
+		if err == nil && !dataOnly(regions, hdr.Size) {
+			if err := a.tw.Flush(); err != nil {
+				return err
+			}
+			if err := writeSparseTarEntry(a.w, hdr, f, regions); err != nil {
+				return err
+			}
+			for _, sr := range regions {
+				a.progress.add(sr.length)
+			}
+			return nil
+		}
+	}
+
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = copyBuffer(a.tw, &ctxReader{a.ctx, a.progress.reader(f)})
+	return err
+}
+
+// sourceDateEpoch returns the time given by the SOURCE_DATE_EPOCH environment
+// variable, as defined by reproducible-builds.org, or the Unix epoch if it is
+// not set or invalid.
+func sourceDateEpoch() time.Time {
+	sec, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64)
+	if err != nil {
+		return time.Unix(0, 0)
+	}
+	return time.Unix(sec, 0)
+}
+
+// normalizeHeader removes everything from hdr that depends on the system the
+// archive is created on, and clamps the modification time to epoch.
+func normalizeHeader(hdr *tar.Header, epoch time.Time) {
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	if hdr.ModTime.After(epoch) {
+		hdr.ModTime = epoch
+	}
+	// Fractional seconds would require PAX records.
+	hdr.ModTime = hdr.ModTime.Truncate(time.Second)
+}
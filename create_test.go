@@ -0,0 +1,222 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = ExtractArchive("testdata/dir_reader_data.tar", src)
+	assert.Nil(err)
+	err = os.Symlink("file1", filepath.Join(src, "dir1/link"))
+	assert.Nil(err)
+
+	for _, ext := range []string{".tar", ".tar.gz", ".tar.xz", ".tar.zst"} {
+		archive := filepath.Join(dir, "out"+ext)
+		err = CreateArchive(archive, src)
+		assert.Nil(err, ext)
+
+		data, err := ReadFileFromArchive(archive, "dir2/file1")
+		assert.Nil(err, ext)
+		assert.Equal("dir2/file1\nApart from the header which is written in each file,\n", string(data), ext)
+
+		dest := filepath.Join(dir, "dest"+ext)
+		err = ExtractArchive(archive, dest)
+		assert.Nil(err, ext)
+		target, err := os.Readlink(filepath.Join(dest, "dir1/link"))
+		assert.Nil(err, ext)
+		assert.Equal("file1", target, ext)
+	}
+}
+
+func TestCreateArchiveFollowSymlinks(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// The targets of the symlinks lie outside of the tree being archived.
+	src, ext := filepath.Join(dir, "src"), filepath.Join(dir, "ext")
+	assert.Nil(os.MkdirAll(filepath.Join(ext, "lib"), 0755))
+	assert.Nil(ioutil.WriteFile(filepath.Join(ext, "lib/libfoo.so"), []byte("foo"), 0644))
+	assert.Nil(os.Mkdir(src, 0755))
+	assert.Nil(os.Symlink(filepath.Join(ext, "lib/libfoo.so"), filepath.Join(src, "libfoo.so")))
+	assert.Nil(os.Symlink(filepath.Join(ext, "lib"), filepath.Join(src, "lib")))
+	assert.Nil(os.Symlink("..", filepath.Join(src, "loop")))
+
+	archive := filepath.Join(dir, "out.tar")
+	err = CreateArchive(archive, src, FollowSymlinks())
+	assert.Nil(err)
+
+	entries, err := ListArchive(archive)
+	assert.Nil(err)
+	types := make(map[string]byte)
+	for _, e := range entries {
+		types[e.Name] = e.Type
+	}
+	assert.Equal(map[string]byte{
+		"lib/":          tar.TypeDir,
+		"lib/libfoo.so": tar.TypeReg,
+		"libfoo.so":     tar.TypeReg,
+		"loop":          tar.TypeSymlink,
+	}, types)
+	data, err := ReadFileFromArchive(archive, "lib/libfoo.so")
+	assert.Nil(err)
+	assert.Equal("foo", string(data))
+
+	assert.Nil(os.Symlink("missing", filepath.Join(src, "broken")))
+	err = CreateArchive(archive, src, FollowSymlinks())
+	assert.True(os.IsNotExist(err), "broken symlinks should be an error")
+}
+
+func TestCreateArchiveFilter(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = ExtractArchive("testdata/dir_reader_data.tar", src)
+	assert.Nil(err)
+
+	names := func(archive string) []string {
+		entries, err := ListArchive(archive)
+		assert.Nil(err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name)
+		}
+		return names
+	}
+
+	archive := filepath.Join(dir, "out.tar")
+	err = CreateArchive(archive, src, Exclude("dir2"))
+	assert.Nil(err)
+	assert.Equal([]string{"dir1/", "dir1/file1", "dir1/file2"}, names(archive))
+
+	err = CreateArchive(archive, src, Include("*/file1"), Filter(func(hdr *tar.Header) bool {
+		return !strings.HasPrefix(hdr.Name, "dir1/")
+	}))
+	assert.Nil(err)
+	assert.Equal([]string{"dir2/file1"}, names(archive))
+
+	err = CreateArchive(archive, src, Include("["))
+	assert.Equal(path.ErrBadPattern, err)
+}
+
+func TestCreateArchiveDeterministic(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = ExtractArchive("testdata/dir_reader_data.tar", src)
+	assert.Nil(err)
+
+	create := func(name string, mtime time.Time) []byte {
+		err := filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(path, mtime, mtime)
+		})
+		assert.Nil(err)
+		archive := filepath.Join(dir, name)
+		assert.Nil(CreateArchive(archive, src, Deterministic()))
+		data, err := ioutil.ReadFile(archive)
+		assert.Nil(err)
+		return data
+	}
+
+	a := create("a.tar.gz", time.Now())
+	b := create("b.tar.gz", time.Now().Add(time.Hour+time.Millisecond))
+	assert.Equal(a, b, "archives should be identical")
+
+	os.Setenv("SOURCE_DATE_EPOCH", "1500000000")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	create("c.tar", time.Unix(1400000000, 500))
+	entries, err := ListArchive(filepath.Join(dir, "c.tar"))
+	assert.Nil(err)
+	for _, e := range entries {
+		assert.Equal(int64(1400000000), e.ModTime.Unix(), e.Name)
+	}
+	create("d.tar", time.Unix(1600000000, 0))
+	entries, err = ListArchive(filepath.Join(dir, "d.tar"))
+	assert.Nil(err)
+	for _, e := range entries {
+		assert.Equal(int64(1500000000), e.ModTime.Unix(), e.Name)
+	}
+}
+
+func TestAppendToArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "out.tar")
+	assert.Nil(CopyFile("testdata/dir_reader_data.tar", archive))
+
+	wd, err := os.Getwd()
+	assert.Nil(err)
+	defer os.Chdir(wd)
+	assert.Nil(os.Chdir(dir))
+	assert.Nil(os.MkdirAll("new/sub", 0755))
+	assert.Nil(ioutil.WriteFile("new/sub/file", []byte("appended\n"), 0644))
+	assert.Nil(ioutil.WriteFile("other", []byte("other\n"), 0644))
+
+	assert.Nil(AppendToArchive(archive, "new"))
+	assert.Nil(AppendToArchive(archive, "./other"))
+
+	entries, err := ListArchive(archive)
+	assert.Nil(err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	assert.Equal([]string{
+		"dir1/", "dir1/file2", "dir1/file1", "dir2/", "dir2/file3", "dir2/file2", "dir2/file1",
+		"new/", "new/sub/", "new/sub/file", "other",
+	}, names)
+	data, err := ReadFileFromArchive(archive, "new/sub/file")
+	assert.Nil(err)
+	assert.Equal("appended\n", string(data))
+
+	// A new archive is created if necessary.
+	assert.Nil(AppendToArchive("created.tar", "other"))
+	data, err = ReadFileFromArchive("created.tar", "other")
+	assert.Nil(err)
+	assert.Equal("other\n", string(data))
+
+	// Compressed archives are not supported, and the archive is restored
+	// after an error.
+	assert.Equal(FormatError{"out.tar.gz"}, AppendToArchive("out.tar.gz", "other"))
+	assert.NotNil(AppendToArchive(archive, "does-not-exist"))
+	entries, err = ListArchive(archive)
+	assert.Nil(err)
+	assert.Len(entries, 11)
+}
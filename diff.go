@@ -0,0 +1,120 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"sort"
+)
+
+// ArchiveDiff describes the differences between two archives.
+// All names are sorted.
+type ArchiveDiff struct {
+	// Added contains the entries only found in the second archive.
+	Added []string
+
+	// Removed contains the entries only found in the first archive.
+	Removed []string
+
+	// Changed contains the entries found in both archives that differ
+	// in type, size, mode, link target, or contents.
+	Changed []string
+}
+
+// Empty returns true if there are no differences.
+func (d *ArchiveDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffArchives compares the entries of the (compressed) archives a and b
+// without extracting them. Contents are compared by their SHA-256 hash,
+// so each archive is read only once. Modification times and owners are
+// not compared. Archive formats supported are the same as for
+// ReadFileFromArchive, and the archives need not be in the same format.
+func DiffArchives(a, b string) (*ArchiveDiff, error) {
+	sa, _, err := summarizeArchive(a, nil)
+	if err != nil {
+		return nil, err
+	}
+	sb, _, err := summarizeArchive(b, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &ArchiveDiff{}
+	for name, ea := range sa {
+		if eb, ok := sb[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		} else if ea != eb {
+			d.Changed = append(d.Changed, name)
+		}
+	}
+	for name := range sb {
+		if _, ok := sa[name]; !ok {
+			d.Added = append(d.Added, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d, nil
+}
+
+// entrySummary contains what DiffArchives compares of an entry.
+type entrySummary struct {
+	typ      byte
+	size     int64
+	mode     os.FileMode
+	linkname string
+	sum      [sha256.Size]byte
+}
+
+// summarizeArchive returns a summary of each entry in the archive.
+// The contents of the regular files for which keep returns true are
+// returned as well; keep may be nil.
+func summarizeArchive(archive string, keep func(name string) bool) (map[string]entrySummary, map[string][]byte, error) {
+	entries := make(map[string]entrySummary)
+	kept := make(map[string][]byte)
+	err := WalkArchive(archive, func(hdr *tar.Header, r io.Reader) error {
+		mode := hdr.FileInfo().Mode()
+		s := entrySummary{
+			typ:      hdr.Typeflag,
+			size:     hdr.Size,
+			mode:     mode,
+			linkname: hdr.Linkname,
+		}
+		if hdr.Typeflag == tar.TypeLink {
+			// Hardlinks are summarized like the files they link to.
+			if target, ok := entries[hdr.Linkname]; ok {
+				entries[hdr.Name] = target
+				return nil
+			}
+		}
+		if mode.IsRegular() {
+			// Tar archives have two type flags for regular files.
+			s.typ = tar.TypeReg
+			h := sha256.New()
+			if keep != nil && keep(hdr.Name) {
+				var buf bytes.Buffer
+				r = io.TeeReader(r, &buf)
+				defer func() { kept[hdr.Name] = buf.Bytes() }()
+			}
+			if _, err := io.Copy(h, r); err != nil {
+				return err
+			}
+			copy(s.sum[:], h.Sum(nil))
+		}
+		entries[hdr.Name] = s
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, kept, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffArchives(z *testing.T) {
+	assert := assert.New(z)
+
+	// The same contents in different formats do not differ.
+	d, err := DiffArchives("testdata/dir_reader_data.tar", "testdata/dir_reader_data.tar.xz")
+	assert.Nil(err)
+	assert.True(d.Empty())
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.tar")
+	err = writeTestTar(a, []testEntry{
+		{tar.Header{Name: "same", Typeflag: tar.TypeReg, Mode: 0644}, "same"},
+		{tar.Header{Name: "content", Typeflag: tar.TypeReg, Mode: 0644}, "abc"},
+		{tar.Header{Name: "mode", Typeflag: tar.TypeReg, Mode: 0644}, "x"},
+		{tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "same"}, ""},
+		{tar.Header{Name: "removed", Typeflag: tar.TypeReg, Mode: 0644}, ""},
+	})
+	assert.Nil(err)
+	b := filepath.Join(dir, "b.tar")
+	err = writeTestTar(b, []testEntry{
+		{tar.Header{Name: "added", Typeflag: tar.TypeReg, Mode: 0644}, ""},
+		{tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "content"}, ""},
+		{tar.Header{Name: "mode", Typeflag: tar.TypeReg, Mode: 0755}, "x"},
+		{tar.Header{Name: "content", Typeflag: tar.TypeReg, Mode: 0644}, "abd"},
+		{tar.Header{Name: "same", Typeflag: tar.TypeReg, Mode: 0644}, "same"},
+	})
+	assert.Nil(err)
+
+	d, err = DiffArchives(a, b)
+	assert.Nil(err)
+	assert.Equal(&ArchiveDiff{
+		Added:   []string{"added"},
+		Removed: []string{"removed"},
+		Changed: []string{"content", "link", "mode"},
+	}, d)
+	assert.False(d.Empty())
+
+	_, err = DiffArchives(a, testfile)
+	assert.Equal(FormatError{testfile}, err)
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// EnsureDir makes sure that path is a directory, creating it and any
+// missing parents with perm, before the umask, if it does not exist.
+// If path exists but is not a directory, FileTypeError is returned.
+// Symlinks to directories are accepted as directories.
+//
+// With RestrictPermissions, the permission bits of an existing directory
+// that are not in perm are removed, so that a directory that should be
+// private is private even if it was created by someone else.
+func EnsureDir(path string, perm os.FileMode, opts ...DirOption) error {
+	var o dirOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return os.MkdirAll(path, perm)
+	} else if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return FileTypeError{path}
+	}
+	if o.restrict && fi.Mode().Perm()&^perm != 0 {
+		special := fi.Mode() & (os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		return os.Chmod(path, special|fi.Mode().Perm()&perm)
+	}
+	return nil
+}
+
+// EnsureParentDir makes sure that the directory that contains path exists,
+// as with EnsureDir, so that the file at path can be created.
+func EnsureParentDir(path string) error {
+	return EnsureDir(filepath.Dir(path), 0777)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnsureDir(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "a/b/c")
+	assert.Nil(EnsureDir(sub, 0755))
+	ex, err := DirExists(sub)
+	assert.Nil(err)
+	assert.True(ex)
+	assert.Nil(EnsureDir(sub, 0755))
+
+	// Permissions are only changed when asked for, and only restricted.
+	assert.Nil(os.Chmod(sub, 0755|os.ModeSetgid))
+	assert.Nil(EnsureDir(sub, 0700))
+	fi, err := os.Stat(sub)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0755), fi.Mode().Perm())
+	assert.Nil(EnsureDir(sub, 0770, RestrictPermissions()))
+	fi, err = os.Stat(sub)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0750), fi.Mode().Perm())
+	assert.True(fi.Mode()&os.ModeSetgid != 0)
+
+	file := filepath.Join(dir, "file")
+	assert.Nil(ioutil.WriteFile(file, nil, 0644))
+	assert.Equal(FileTypeError{file}, EnsureDir(file, 0755))
+	assert.NotNil(EnsureDir(filepath.Join(file, "sub"), 0755))
+
+	assert.Nil(os.Symlink("a", filepath.Join(dir, "link")))
+	assert.Nil(EnsureDir(filepath.Join(dir, "link"), 0755))
+
+	assert.Nil(EnsureParentDir(filepath.Join(dir, "x/y/file")))
+	ex, err = DirExists(filepath.Join(dir, "x/y"))
+	assert.Nil(err)
+	assert.True(ex)
+	ex, err = Exists(filepath.Join(dir, "x/y/file"))
+	assert.Nil(err)
+	assert.False(ex)
+}
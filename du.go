@@ -0,0 +1,141 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Usage is the disk usage of a tree of files, as returned by DiskUsage.
+type Usage struct {
+	// Size is the apparent size of all files and directories in bytes,
+	// as reported by du --apparent-size.
+	Size int64
+
+	// Allocated is the space allocated on disk for the files and
+	// directories in bytes, which is less than Size for sparse and
+	// compressed files, and usually more otherwise. Where this is not
+	// known, as on Windows, it is the same as Size.
+	Allocated int64
+
+	// Files is the number of files other than directories, including
+	// symlinks, and Dirs the number of directories, including the root.
+	Files int
+	Dirs  int
+}
+
+// DiskUsage returns the disk usage of the tree of files at path, like du.
+// Files with several hardlinks in the tree are only counted once, which is
+// only possible on Unix systems, and symlinks are not followed.
+// Directories are read by several goroutines, as many as there are CPUs,
+// or n with Workers(n).
+//
+// Errors do not stop the walk: if some files cannot be read, a TreeError
+// is returned together with the usage of the others.
+func DiskUsage(path string, opts ...UsageOption) (Usage, error) {
+	var o usageOptions
+	for _, opt := range opts {
+		opt.applyUsage(&o)
+	}
+	n := o.workers
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	w := &duWalker{
+		sem:  make(chan struct{}, n-1),
+		seen: make(map[fileID]bool),
+	}
+	w.add(fi)
+	if fi.IsDir() {
+		w.walk(path)
+	}
+	w.wg.Wait()
+	if len(w.errs) > 0 {
+		return w.usage, TreeError{w.errs}
+	}
+	return w.usage, nil
+}
+
+// duWalker walks a tree concurrently for DiskUsage.
+type duWalker struct {
+	// sem limits the number of goroutines that walk the tree besides the
+	// first one.
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu    sync.Mutex
+	usage Usage
+	seen  map[fileID]bool
+	errs  []error
+}
+
+// walk adds the contents of the directory dir to the usage. Subdirectories
+// are walked by new goroutines while there are fewer than allowed, and by
+// the current one otherwise, so that the walk cannot deadlock.
+func (w *duWalker) walk(dir string) {
+	f, err := os.Open(dir)
+	if err != nil {
+		w.fail(err)
+		return
+	}
+	fis, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		w.fail(err)
+	}
+	for _, fi := range fis {
+		w.add(fi)
+		if !fi.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, fi.Name())
+		select {
+		case w.sem <- struct{}{}:
+			w.wg.Add(1)
+			go func() {
+				defer w.wg.Done()
+				w.walk(path)
+				<-w.sem
+			}()
+		default:
+			w.walk(path)
+		}
+	}
+}
+
+// add adds the file described by fi to the usage, unless it is a hardlink
+// of a file that was added before.
+func (w *duWalker) add(fi os.FileInfo) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if id, linked := hardlinkID(fi); linked && !fi.IsDir() {
+		if w.seen[id] {
+			return
+		}
+		w.seen[id] = true
+	}
+	w.usage.Size += fi.Size()
+	w.usage.Allocated += allocatedSize(fi)
+	if fi.IsDir() {
+		w.usage.Dirs++
+	} else {
+		w.usage.Files++
+	}
+}
+
+// fail records the error err.
+func (w *duWalker) fail(err error) {
+	w.mu.Lock()
+	w.errs = append(w.errs, err)
+	w.mu.Unlock()
+}
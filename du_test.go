@@ -0,0 +1,59 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskUsage(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// A tree that is wide and deep enough to be walked concurrently.
+	var size int64
+	for i := 0; i < 10; i++ {
+		sub := filepath.Join(dir, fmt.Sprintf("dir%d/sub", i))
+		assert.Nil(os.MkdirAll(sub, 0755))
+		data := make([]byte, 1000*i)
+		assert.Nil(ioutil.WriteFile(filepath.Join(sub, "file"), data, 0644))
+		size += int64(len(data))
+	}
+	assert.Nil(os.Symlink("dir1", filepath.Join(dir, "link")))
+	size += int64(len("dir1"))
+
+	var dirSize int64
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if fi.IsDir() {
+			dirSize += fi.Size()
+		}
+		return err
+	})
+	assert.Nil(err)
+
+	for _, opts := range [][]UsageOption{nil, {Workers(1)}, {Workers(3)}} {
+		usage, err := DiskUsage(dir, opts...)
+		assert.Nil(err)
+		assert.Equal(size+dirSize, usage.Size)
+		assert.Equal(11, usage.Files)
+		assert.Equal(21, usage.Dirs)
+		assert.True(usage.Allocated > 0)
+	}
+
+	usage, err := DiskUsage(filepath.Join(dir, "dir3/sub/file"))
+	assert.Nil(err)
+	assert.Equal(Usage{Size: 3000, Allocated: usage.Allocated, Files: 1}, usage)
+	_, err = DiskUsage(filepath.Join(dir, "missing"))
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskUsageHardlinks(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "file")
+	assert.Nil(ioutil.WriteFile(file, make([]byte, 5000), 0644))
+	assert.Nil(os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	assert.Nil(os.Link(file, filepath.Join(dir, "link")))
+	assert.Nil(os.Link(file, filepath.Join(dir, "sub/link")))
+
+	fi, err := os.Stat(dir)
+	assert.Nil(err)
+	sub, err := os.Stat(filepath.Join(dir, "sub"))
+	assert.Nil(err)
+
+	for _, opts := range [][]UsageOption{nil, {Workers(1)}, {Workers(3)}} {
+		usage, err := DiskUsage(dir, opts...)
+		assert.Nil(err)
+		assert.Equal(5000+fi.Size()+sub.Size(), usage.Size)
+		assert.Equal(1, usage.Files)
+		assert.Equal(2, usage.Dirs)
+	}
+}
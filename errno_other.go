@@ -0,0 +1,24 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !plan9 && !windows
+// +build !plan9,!windows
+
+package osutil
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isCrossDevice returns true if err is the error of a rename between file
+// systems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// isLoop returns true if err is the error of following too many symlinks.
+func isLoop(err error) bool {
+	return errors.Is(err, syscall.ELOOP)
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+// isCrossDevice returns true for all errors, as Plan 9 cannot rename files
+// to other directories at all, and its errors cannot be told apart.
+func isCrossDevice(err error) bool {
+	return err != nil
+}
+
+// isLoop returns false, as there are no symlinks on Plan 9.
+func isLoop(err error) bool {
+	return false
+}
@@ -0,0 +1,22 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isCrossDevice returns true if err is the error of a rename between
+// volumes.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
+
+// isLoop returns true if err is the error of following too many symlinks.
+func isLoop(err error) bool {
+	return errors.Is(err, windows.ERROR_CANT_RESOLVE_FILENAME)
+}
@@ -6,6 +6,7 @@ package osutil
 
 import (
 	"fmt"
+	"strings"
 )
 
 type FileTypeError struct {
@@ -15,3 +16,198 @@ type FileTypeError struct {
 func (e FileTypeError) Error() string {
 	return fmt.Sprintf("unexpected file type at %q", e.Filepath)
 }
+
+// FormatError is returned when the format of a file, such as an archive,
+// cannot be determined or is not supported.
+type FormatError struct {
+	Filepath string
+}
+
+func (e FormatError) Error() string {
+	return fmt.Sprintf("unknown file format of %q", e.Filepath)
+}
+
+// NotFoundError is returned when a file cannot be found in an archive.
+type NotFoundError struct {
+	Name string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("file %q not found in archive", e.Name)
+}
+
+// MissingFilesError is returned when some of several requested files
+// cannot be found in an archive.
+type MissingFilesError struct {
+	Names []string
+}
+
+func (e MissingFilesError) Error() string {
+	return fmt.Sprintf("files not found in archive: %s", strings.Join(e.Names, ", "))
+}
+
+// UnsafePathError is returned when the name of an archive entry is absolute
+// or would escape the destination directory.
+type UnsafePathError struct {
+	Name string
+}
+
+func (e UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe path %q in archive", e.Name)
+}
+
+// UnsafeLinkError is returned when the target of a link in an archive
+// would be outside the destination directory.
+type UnsafeLinkError struct {
+	Name     string
+	Linkname string
+}
+
+func (e UnsafeLinkError) Error() string {
+	return fmt.Sprintf("unsafe link %q -> %q in archive", e.Name, e.Linkname)
+}
+
+// LimitError is returned when an archive exceeds a limit, such as the one
+// set by MaxEntryBytes.
+type LimitError struct {
+	Limit string
+	Max   int64
+}
+
+func (e LimitError) Error() string {
+	return fmt.Sprintf("archive exceeds %s limit of %d", e.Limit, e.Max)
+}
+
+// DamagedError is returned together with the entries that could be
+// recovered when a damaged or truncated archive is read with Tolerant.
+type DamagedError struct {
+	Archive string
+
+	// Offset is the position in the uncompressed archive at which the
+	// first damage was found.
+	Offset int64
+	Err    error
+}
+
+func (e DamagedError) Error() string {
+	return fmt.Sprintf("archive %q is damaged at offset %d: %v", e.Archive, e.Offset, e.Err)
+}
+
+func (e DamagedError) Unwrap() error {
+	return e.Err
+}
+
+// VerifyError is returned when the entries of an archive do not match
+// a checksum manifest.
+type VerifyError struct {
+	// Mismatched contains the entries that differ from the manifest.
+	Mismatched []string
+
+	// Missing contains the entries in the manifest missing from the archive.
+	Missing []string
+}
+
+func (e VerifyError) Error() string {
+	var parts []string
+	if len(e.Mismatched) != 0 {
+		parts = append(parts, "mismatched: "+strings.Join(e.Mismatched, ", "))
+	}
+	if len(e.Missing) != 0 {
+		parts = append(parts, "missing: "+strings.Join(e.Missing, ", "))
+	}
+	return "archive does not match manifest; " + strings.Join(parts, "; ")
+}
+
+// ManifestError is returned when a checksum manifest cannot be parsed.
+type ManifestError struct {
+	Reason string
+}
+
+func (e ManifestError) Error() string {
+	return "malformed manifest: " + e.Reason
+}
+
+// PasswordError is returned when an encrypted entry of an archive cannot
+// be decrypted, because the password is missing or wrong.
+type PasswordError struct {
+	Name string
+}
+
+func (e PasswordError) Error() string {
+	return fmt.Sprintf("missing or wrong password for %q in archive", e.Name)
+}
+
+// CopyError is returned by CopyDir with CollectErrors when some of the files
+// could not be copied.
+type CopyError struct {
+	// Errors contains the error for each file that could not be copied.
+	Errors []error
+}
+
+func (e CopyError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d files could not be copied: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// PidFileError is returned by WritePidFile when the pidfile belongs to
+// another process that is still running.
+type PidFileError struct {
+	Filepath string
+	Pid      int
+}
+
+func (e PidFileError) Error() string {
+	return fmt.Sprintf("pidfile %q belongs to running process %d", e.Filepath, e.Pid)
+}
+
+// TreeError is returned by functions that continue processing a tree of
+// files after errors, such as ChownRecursive, when some of the files could
+// not be processed.
+type TreeError struct {
+	// Errors contains the error for each file that could not be processed.
+	Errors []error
+}
+
+func (e TreeError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d files could not be processed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// SpaceError is returned by CheckFreeSpace when a file system does not have
+// enough space available.
+type SpaceError struct {
+	Filepath  string
+	Needed    uint64
+	Available uint64
+}
+
+func (e SpaceError) Error() string {
+	return fmt.Sprintf("not enough space for %q: need %d bytes, but only %d are available", e.Filepath, e.Needed, e.Available)
+}
+
+// EnvError is returned by ExpandPath with StrictEnv when a path refers to
+// environment variables that are not set.
+type EnvError struct {
+	Names []string
+}
+
+func (e EnvError) Error() string {
+	return fmt.Sprintf("environment variables not set: %s", strings.Join(e.Names, ", "))
+}
+
+// UnsafeRemoveError is returned by SafeRemoveAll when it refuses to remove
+// a path, for the given reason.
+type UnsafeRemoveError struct {
+	Filepath string
+	Reason   string
+}
+
+func (e UnsafeRemoveError) Error() string {
+	return fmt.Sprintf("refusing to remove %q: %s", e.Filepath, e.Reason)
+}
@@ -0,0 +1,449 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractArchive unpacks the entire (compressed) archive into destDir,
+// which is created if it does not exist. Directories, regular files,
+// symlinks, and hardlinks are created with the modes recorded in the archive;
+// other entry types are skipped. Existing files are overwritten.
+//
+// Entries with absolute names or names escaping destDir are rejected with
+// an UnsafePathError, unless AllowUnsafePaths is given. On Windows, names
+// that are invalid there are mapped with WindowsSafeName. Likewise, links
+// whose targets escape destDir are rejected with an UnsafeLinkError,
+// unless AllowUnsafeLinks is given. Symlinks extracted earlier are taken
+// into account, and entries are never written through symlinks that lead
+// out of destDir, unless AllowUnsafePaths is given.
+//
+// To get the same behavior as `tar -xp`, use PreservePermissions,
+// PreserveOwner, and PreserveTimes. When extracting untrusted archives,
+// consider using MaxEntries, MaxEntryBytes, and MaxTotalBytes. Large gzip
+// archives are extracted faster with ParallelGzip, and slow file systems
+// are written faster with Workers. To remove a top-level directory from
+// the entry names, use StripComponents, and to extract only some of them,
+// use Include, Exclude, or Filter. To salvage what can be
+// recovered from a damaged or truncated archive, use Tolerant.
+// Archive formats supported are the same as for ReadFileFromArchive.
+func ExtractArchive(archive, destDir string, opts ...Option) error {
+	return ExtractArchiveContext(context.Background(), archive, destDir, opts...)
+}
+
+// ExtractArchiveContext is the same as ExtractArchive, except that it stops
+// with the error of ctx once ctx is done. Entries that have already been
+// extracted are not removed.
+func ExtractArchiveContext(ctx context.Context, archive, destDir string, opts ...Option) error {
+	o := newArchiveOptions(opts)
+	if err := o.checkPatterns(); err != nil {
+		return err
+	}
+	x := &extractor{
+		dest:     destDir,
+		opts:     o,
+		progress: newProgressTracker(o),
+		limits:   newLimiter(o),
+	}
+	x.progress.count(archive)
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	x.pool = newWriterPool(x, o.workers)
+	err := walkArchiveContext(ctx, archive, o, x.extract)
+	if perr := x.pool.close(); perr != nil {
+		err = perr
+	}
+	if _, ok := err.(DamagedError); !ok && err != nil {
+		return err
+	}
+	// The entries recovered from a damaged archive are kept.
+	if ferr := x.finish(); ferr != nil {
+		return ferr
+	}
+	return err
+}
+
+// extractor extracts archive entries into a destination directory.
+type extractor struct {
+	dest     string
+	opts     *archiveOptions
+	progress *progressTracker
+	limits   *limiter
+	pool     *writerPool
+
+	// dirs contains the directories whose metadata is restored by finish.
+	dirs []extractedDir
+}
+
+// extractedDir is a directory that has been extracted to path.
+type extractedDir struct {
+	path string
+	hdr  *tar.Header
+}
+
+// extract creates the file described by hdr in the destination directory,
+// reading its contents from r.
+func (x *extractor) extract(hdr *tar.Header, r io.Reader) error {
+	if err := x.pool.error(); err != nil {
+		return err
+	}
+	x.progress.entry(hdr.Name)
+	if err := x.limits.entry(); err != nil {
+		return err
+	}
+	r = x.limits.reader(hdr, x.progress.reader(r))
+
+	if ok, _ := x.opts.selected(hdr); !ok {
+		return nil
+	}
+	name, ok := stripComponents(hdr.Name, x.opts.strip)
+	if !ok {
+		return nil
+	}
+	if !x.opts.unsafePaths {
+		var err error
+		if name, err = SanitizeEntryName(name); err != nil {
+			return err
+		}
+	}
+
+	target, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	mode := hdr.FileInfo().Mode().Perm()
+	// Any earlier file at target must be complete before it is replaced.
+	x.pool.wait(target)
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		// Directories must be writable by us so that their contents can be
+		// extracted; PreservePermissions restores the exact mode afterwards.
+		if err := os.MkdirAll(target, mode|0700); err != nil {
+			return err
+		}
+		// Restoring the metadata of a directory is postponed until all its
+		// contents have been extracted, since the mode may not allow
+		// writing and every write changes the modification time.
+		x.dirs = append(x.dirs, extractedDir{target, hdr})
+		return nil
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse:
+		if x.pool.accepts(hdr.Size) {
+			data, err := readEntry(r, hdr.Size)
+			if err != nil {
+				return err
+			}
+			x.pool.submit(target, mode, data, hdr)
+			return nil
+		}
+		if err := prepareTarget(target); err != nil {
+			return err
+		}
+		if err := writeFile(target, mode, r, isSparseEntry(hdr)); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if !x.opts.unsafeLinks && !x.symlinkWithin(target, hdr.Linkname) {
+			return UnsafeLinkError{hdr.Name, hdr.Linkname}
+		}
+		if err := prepareTarget(target); err != nil {
+			return err
+		}
+		if err := os.Symlink(hdr.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		link, ok := stripComponents(hdr.Linkname, x.opts.strip)
+		if !ok {
+			// The file linked to has not been extracted.
+			return nil
+		}
+		if !x.opts.unsafeLinks {
+			var err error
+			if link, err = SanitizeEntryName(link); err != nil {
+				return UnsafeLinkError{hdr.Name, hdr.Linkname}
+			}
+		}
+		// Unless unsafe links are allowed, the target must not be reached
+		// through symlinks leading out of the destination either.
+		linkTarget := x.join(link)
+		if !x.opts.unsafeLinks {
+			if linkTarget, err = x.target(link); err != nil {
+				if _, ok := err.(UnsafePathError); ok {
+					return UnsafeLinkError{hdr.Name, hdr.Linkname}
+				}
+				return err
+			}
+		}
+		x.pool.wait(linkTarget)
+		if err := prepareTarget(target); err != nil {
+			return err
+		}
+		// The metadata belongs to the file linked to, so there is nothing
+		// to restore.
+		return os.Link(linkTarget, target)
+	default:
+		return nil
+	}
+	return x.restore(target, hdr)
+}
+
+// target returns the path to which the entry name is extracted. Unless
+// AllowUnsafePaths is given, the directories leading to it are resolved
+// with ResolveWithin, so that entries are not written through symlinks
+// extracted earlier that lead out of the destination directory, and an
+// UnsafePathError is returned if they do.
+func (x *extractor) target(name string) (string, error) {
+	if x.opts.unsafePaths {
+		return x.join(name), nil
+	}
+	if windowsPaths || x.opts.winNames {
+		name = WindowsSafeName(name)
+	}
+	rel := filepath.FromSlash(name)
+	dir, err := ResolveWithin(x.dest, filepath.Dir(rel))
+	if errors.Is(err, errOutsideRoot) {
+		return "", UnsafePathError{name}
+	} else if err != nil {
+		return "", err
+	}
+	return longPath(filepath.Join(dir, filepath.Base(rel))), nil
+}
+
+// join returns the path to which the entry name is extracted when the
+// symlinks in the destination directory are not resolved.
+func (x *extractor) join(name string) string {
+	if windowsPaths || x.opts.winNames {
+		name = WindowsSafeName(name)
+	}
+	return longPath(filepath.Join(x.dest, filepath.FromSlash(name)))
+}
+
+// stripComponents removes the first n components from the entry name. If
+// the name does not have more than n components, ok is false.
+func stripComponents(name string, n int) (stripped string, ok bool) {
+	if n <= 0 {
+		return name, true
+	}
+	var components []string
+	for _, c := range strings.Split(name, "/") {
+		if c != "" {
+			components = append(components, c)
+		}
+	}
+	if len(components) <= n {
+		return "", false
+	}
+	return strings.Join(components[n:], "/"), true
+}
+
+// prepareTarget makes sure that a file can be created at target, by creating
+// the parent directories and removing any existing file. Removing the file
+// also makes sure that we don't write through an existing symlink.
+func prepareTarget(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// symlinkWithin returns true if a symlink at target pointing to linkname
+// resolves to a path within the directory the archive is extracted to,
+// taking the symlinks that have already been extracted into account.
+func (x *extractor) symlinkWithin(target, linkname string) bool {
+	if path.IsAbs(linkname) || filepath.IsAbs(linkname) {
+		return false
+	}
+	root, err := filepath.EvalSymlinks(x.dest)
+	if err != nil {
+		return false
+	}
+	dir, err := filepath.Rel(root, filepath.Dir(target))
+	if err != nil {
+		return false
+	}
+	// The link is not joined with dir, as cleaning the path would remove
+	// ".." after symlinks, which ResolveWithin must follow first.
+	_, err = ResolveWithin(x.dest, dir+string(filepath.Separator)+filepath.FromSlash(linkname))
+	return err == nil
+}
+
+// paxXattrPrefix is the prefix of PAX records that contain extended attributes.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// xattrsFromPAX returns the extended attributes contained in the PAX records.
+func xattrsFromPAX(records map[string]string) map[string]string {
+	var xattrs map[string]string
+	for k, v := range records {
+		if !strings.HasPrefix(k, paxXattrPrefix) {
+			continue
+		}
+		if xattrs == nil {
+			xattrs = make(map[string]string)
+		}
+		xattrs[strings.TrimPrefix(k, paxXattrPrefix)] = v
+	}
+	return xattrs
+}
+
+// finish restores the metadata of the extracted directories, deepest first.
+func (x *extractor) finish() error {
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		if err := x.restore(x.dirs[i].path, x.dirs[i].hdr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore sets the owner, mode, and times of the file at path as recorded
+// in hdr, in so far as requested by the options.
+func (x *extractor) restore(path string, hdr *tar.Header) error {
+	if x.opts.owner && os.Geteuid() == 0 {
+		if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+	// The mode and times of a symlink cannot be portably changed.
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+	// Extended attributes must be set after changing the owner, since that
+	// clears file capabilities.
+	if x.opts.xattrs {
+		if err := writeXattrs(path, xattrsFromPAX(hdr.PAXRecords)); err != nil {
+			return err
+		}
+	}
+	if x.opts.perms {
+		mode := hdr.FileInfo().Mode()
+		mode &= os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+	}
+	if x.opts.times {
+		atime := hdr.AccessTime
+		if atime.IsZero() {
+			atime = hdr.ModTime
+		}
+		if err := os.Chtimes(path, atime, hdr.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SanitizeEntryName returns the cleaned name of an archive entry, as it
+// can be safely joined to a destination directory. If the name is absolute
+// or contains ".." components that escape the directory, an UnsafePathError
+// is returned.
+func SanitizeEntryName(name string) (string, error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) {
+		return "", UnsafePathError{name}
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", UnsafePathError{name}
+	}
+	return clean, nil
+}
+
+// SanitizeHeader normalizes the header of an archive entry, so that it can
+// be safely extracted or passed on: backslashes in the name are replaced by
+// forward slashes, a leading "/" or "./" is removed, the name is cleaned,
+// and the setuid and setgid bits are cleared from the mode. The size of
+// entries without contents, such as directories, is set to 0. If the name
+// or the target of a hardlink escapes the archive through "..", an
+// UnsafePathError or an UnsafeLinkError is returned, and hdr is left as
+// it is. Entries with contents whose size is negative or larger than
+// 1 PiB are rejected with an UnsafePathError as well.
+//
+// With PreservePermissions, the setuid and setgid bits are kept. With
+// MaxEntryBytes, entries with contents larger than the limit are rejected
+// with a LimitError.
+func SanitizeHeader(hdr *tar.Header, opts ...Option) error {
+	o := newArchiveOptions(opts)
+	name, err := sanitizeHeaderName(hdr.Name)
+	if err != nil {
+		return UnsafePathError{hdr.Name}
+	}
+	contents := false
+	switch hdr.Typeflag {
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse, tar.TypeCont:
+		contents = true
+	}
+	if hdr.Size < 0 || contents && hdr.Size > maxHeaderSize {
+		return UnsafePathError{hdr.Name}
+	}
+	if max := o.maxEntryBytes; contents && max > 0 && hdr.Size > max {
+		return LimitError{"MaxEntryBytes", max}
+	}
+	link := hdr.Linkname
+	if hdr.Typeflag == tar.TypeLink {
+		if link, err = sanitizeHeaderName(link); err != nil {
+			return UnsafeLinkError{hdr.Name, hdr.Linkname}
+		}
+	}
+
+	if hdr.Typeflag == tar.TypeDir && name != "." {
+		name += "/"
+	}
+	hdr.Name, hdr.Linkname = name, link
+	if !contents {
+		hdr.Size = 0
+	}
+	hdr.Mode &= 07777
+	if !o.perms {
+		hdr.Mode &^= 06000
+	}
+	return nil
+}
+
+// maxHeaderSize is the largest size of an entry that SanitizeHeader
+// accepts, which is far larger than any legitimate archive entry.
+const maxHeaderSize = 1 << 50
+
+// sanitizeHeaderName normalizes the entry name for SanitizeHeader.
+func sanitizeHeaderName(name string) (string, error) {
+	name = strings.TrimLeft(strings.ReplaceAll(name, "\\", "/"), "/")
+	return SanitizeEntryName(name)
+}
+
+// writeFile creates or truncates the file at path and copies r into it.
+// If sparse is true, blocks of zeros are not written, so that they become
+// holes in the file.
+func writeFile(path string, mode os.FileMode, r io.Reader, sparse bool) (err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cerr := f.Close()
+		if err == nil {
+			err = cerr
+		}
+	}()
+	if sparse {
+		_, err = WriteSparse(f, r)
+	} else {
+		_, err = copyBuffer(f, r)
+	}
+	return err
+}
@@ -0,0 +1,448 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	err = ExtractArchive("testdata/dir_reader_data.tar.gz", dir)
+	assert.Nil(err)
+
+	for _, name := range []string{"dir1/file1", "dir1/file2", "dir2/file1", "dir2/file2", "dir2/file3"} {
+		want, err := ReadFileFromArchive("testdata/dir_reader_data.tar", name)
+		assert.Nil(err)
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(err, name)
+		assert.Equal(want, got, name)
+	}
+
+	ex, err := DirExists(filepath.Join(dir, "dir2"))
+	assert.Nil(err)
+	assert.True(ex, "directories should be created")
+}
+
+// testEntry describes an entry written by writeTestTar.
+type testEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+// writeTestTar writes an uncompressed tar archive containing entries to path.
+func writeTestTar(path string, entries []testEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func TestExtractArchiveSymlink(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "links.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 0755}, "#!/bin/sh\n"},
+		{tar.Header{Name: "bin/alias", Typeflag: tar.TypeSymlink, Linkname: "tool"}, ""},
+	})
+	assert.Nil(err)
+
+	dest := filepath.Join(dir, "out")
+	err = ExtractArchive(archive, dest)
+	assert.Nil(err)
+
+	target, err := os.Readlink(filepath.Join(dest, "bin/alias"))
+	assert.Nil(err)
+	assert.Equal("tool", target)
+
+	fi, err := os.Stat(filepath.Join(dest, "bin/tool"))
+	assert.Nil(err)
+	assert.True(fi.Mode()&0100 != 0, "executable bit should be kept")
+}
+
+func TestSanitizeEntryName(z *testing.T) {
+	assert := assert.New(z)
+
+	for name, want := range map[string]string{
+		"a/b":       "a/b",
+		"./a/b/":    "a/b",
+		"a/../b":    "b",
+		"a/b/../..": ".",
+	} {
+		got, err := SanitizeEntryName(name)
+		assert.Nil(err, name)
+		assert.Equal(want, got, name)
+	}
+
+	for _, name := range []string{"/etc/passwd", "../a", "a/../../b", ".."} {
+		_, err := SanitizeEntryName(name)
+		assert.Equal(UnsafePathError{name}, err, name)
+	}
+}
+
+func TestExtractArchiveUnsafe(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "evil.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}, "evil"},
+	})
+	assert.Nil(err)
+
+	dest := filepath.Join(dir, "a", "b")
+	err = ExtractArchive(archive, dest)
+	assert.Equal(UnsafePathError{"../evil"}, err)
+	ex, _ := FileExists(filepath.Join(dir, "a", "evil"))
+	assert.False(ex, "entry should not escape destination")
+
+	err = ExtractArchive(archive, dest, AllowUnsafePaths())
+	assert.Nil(err)
+	ex, _ = FileExists(filepath.Join(dir, "a", "evil"))
+	assert.True(ex, "unsafe paths should be allowed when asked to")
+}
+
+func TestExtractArchiveChainedLinks(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "evil.tar")
+	dest := filepath.Join(dir, "out")
+	assert.Nil(os.MkdirAll(dest, 0755))
+
+	// Each link is within dest when looked at on its own, but x/y is
+	// created at y, so that it points to the parent of dest.
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "."}, ""},
+		{tar.Header{Name: "x/y", Typeflag: tar.TypeSymlink, Linkname: ".."}, ""},
+		{tar.Header{Name: "y/evil", Typeflag: tar.TypeReg, Mode: 0644}, "evil"},
+	})
+	assert.Nil(err)
+	err = ExtractArchive(archive, dest)
+	assert.Equal(UnsafeLinkError{"x/y", ".."}, err)
+	ex, _ := FileExists(filepath.Join(dir, "evil"))
+	assert.False(ex, "entry should not escape destination")
+
+	// Symlinks leading out of dest are not written through, even if they
+	// are allowed.
+	assert.Nil(os.RemoveAll(dest))
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "up", Typeflag: tar.TypeSymlink, Linkname: ".."}, ""},
+		{tar.Header{Name: "up/evil", Typeflag: tar.TypeReg, Mode: 0644}, "evil"},
+	})
+	assert.Nil(err)
+	err = ExtractArchive(archive, dest, AllowUnsafeLinks())
+	assert.Equal(UnsafePathError{"up/evil"}, err)
+	ex, _ = FileExists(filepath.Join(dir, "evil"))
+	assert.False(ex, "entry should not escape destination")
+
+	// The same goes for the targets of hard links.
+	assert.Nil(os.RemoveAll(dest))
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600))
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "up", Typeflag: tar.TypeSymlink, Linkname: ".."}, ""},
+		{tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "up/secret"}, ""},
+	})
+	assert.Nil(err)
+	err = ExtractArchive(archive, dest, AllowUnsafeLinks())
+	assert.Nil(err)
+	err = ExtractArchive(archive, dest)
+	assert.Equal(UnsafeLinkError{"up", ".."}, err)
+	assert.Nil(os.RemoveAll(dest))
+	assert.Nil(os.MkdirAll(dest, 0755))
+	assert.Nil(os.Symlink("..", filepath.Join(dest, "up")))
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "up/secret"}, ""},
+	})
+	assert.Nil(err)
+	err = ExtractArchive(archive, dest)
+	assert.Equal(UnsafeLinkError{"hard", "up/secret"}, err)
+	ex, _ = LExists(filepath.Join(dest, "hard"))
+	assert.False(ex, "hard link should not refer to a file outside of destination")
+
+	// Symlinks within dest can still be extracted through.
+	assert.Nil(os.RemoveAll(dest))
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "real/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "alias", Typeflag: tar.TypeSymlink, Linkname: "real"}, ""},
+		{tar.Header{Name: "alias/file", Typeflag: tar.TypeReg, Mode: 0644}, "data"},
+	})
+	assert.Nil(err)
+	assert.Nil(ExtractArchive(archive, dest))
+	data, err := ioutil.ReadFile(filepath.Join(dest, "real/file"))
+	assert.Nil(err)
+	assert.Equal("data", string(data))
+}
+
+func TestExtractArchivePreserve(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	mtime := time.Date(2014, 6, 2, 17, 26, 0, 0, time.UTC)
+	archive := filepath.Join(dir, "perms.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "ro/", Typeflag: tar.TypeDir, Mode: 0555, ModTime: mtime}, ""},
+		{tar.Header{Name: "ro/script", Typeflag: tar.TypeReg, Mode: 0777, ModTime: mtime}, "#!/bin/sh\n"},
+	})
+	assert.Nil(err)
+
+	dest := filepath.Join(dir, "out")
+	err = ExtractArchive(archive, dest, PreservePermissions(), PreserveTimes(), PreserveOwner())
+	assert.Nil(err)
+	defer os.Chmod(filepath.Join(dest, "ro"), 0755)
+
+	fi, err := os.Stat(filepath.Join(dest, "ro/script"))
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0777), fi.Mode().Perm(), "mode should ignore umask")
+	assert.True(mtime.Equal(fi.ModTime()), "mtime should be restored")
+
+	fi, err = os.Stat(filepath.Join(dest, "ro"))
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0555), fi.Mode().Perm(), "directory mode should be restored")
+	assert.True(mtime.Equal(fi.ModTime()), "directory mtime should be restored")
+}
+
+func TestExtractArchiveLinks(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "links.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "a/file", Typeflag: tar.TypeReg, Mode: 0644}, "data"},
+		{tar.Header{Name: "a/hard", Typeflag: tar.TypeLink, Linkname: "a/file"}, ""},
+		{tar.Header{Name: "b/soft", Typeflag: tar.TypeSymlink, Linkname: "../a/file"}, ""},
+	})
+	assert.Nil(err)
+
+	dest := filepath.Join(dir, "out")
+	err = ExtractArchive(archive, dest)
+	assert.Nil(err)
+
+	same, err := SameFile(filepath.Join(dest, "a/file"), filepath.Join(dest, "a/hard"))
+	assert.Nil(err)
+	assert.True(same, "hardlink should refer to the same file")
+	data, err := ioutil.ReadFile(filepath.Join(dest, "b/soft"))
+	assert.Nil(err)
+	assert.Equal("data", string(data))
+
+	for _, e := range []testEntry{
+		{tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}, ""},
+		{tar.Header{Name: "a/evil", Typeflag: tar.TypeSymlink, Linkname: "../../x"}, ""},
+		{tar.Header{Name: "evil", Typeflag: tar.TypeLink, Linkname: "../x"}, ""},
+	} {
+		err = writeTestTar(archive, []testEntry{e})
+		assert.Nil(err)
+		err = ExtractArchive(archive, dest)
+		assert.Equal(UnsafeLinkError{e.hdr.Name, e.hdr.Linkname}, err, e.hdr.Linkname)
+	}
+
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}, ""},
+	})
+	assert.Nil(err)
+	err = ExtractArchive(archive, dest, AllowUnsafeLinks())
+	assert.Nil(err)
+}
+
+func TestExtractArchiveStripComponents(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "strip.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "./pkg-1.0/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "./pkg-1.0/README", Typeflag: tar.TypeReg, Mode: 0644}, "readme"},
+		{tar.Header{Name: "./pkg-1.0/src/main.go", Typeflag: tar.TypeReg, Mode: 0644}, "main"},
+		{tar.Header{Name: "./pkg-1.0/src/link", Typeflag: tar.TypeLink, Linkname: "./pkg-1.0/README"}, ""},
+		{tar.Header{Name: "./top", Typeflag: tar.TypeReg, Mode: 0644}, "top"},
+	})
+	assert.Nil(err)
+
+	dest := filepath.Join(dir, "out")
+	err = ExtractArchive(archive, dest, StripComponents(2))
+	assert.Nil(err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dest, "README"))
+	assert.Nil(err)
+	assert.Equal("readme", string(data))
+	data, err = ioutil.ReadFile(filepath.Join(dest, "src/main.go"))
+	assert.Nil(err)
+	assert.Equal("main", string(data))
+	same, err := SameFile(filepath.Join(dest, "README"), filepath.Join(dest, "src/link"))
+	assert.Nil(err)
+	assert.True(same, "hardlink targets should be stripped as well")
+	for _, name := range []string{"pkg-1.0", "top"} {
+		ex, err := Exists(filepath.Join(dest, name))
+		assert.Nil(err)
+		assert.False(ex, name)
+	}
+
+	for _, tc := range []struct {
+		name, want string
+		n          int
+		ok         bool
+	}{
+		{"a/b/c", "a/b/c", 0, true},
+		{"a/b/c", "b/c", 1, true},
+		{"/a//b/", "b", 1, true},
+		{"a/", "", 1, false},
+		{"a/b", "", 2, false},
+	} {
+		got, ok := stripComponents(tc.name, tc.n)
+		assert.Equal(tc.want, got, tc.name)
+		assert.Equal(tc.ok, ok, tc.name)
+	}
+}
+
+func TestExtractArchiveFilter(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "pkg.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "./etc/pkg.conf", Typeflag: tar.TypeReg, Mode: 0644}, "conf"},
+		{tar.Header{Name: "./usr/bin/pkg", Typeflag: tar.TypeReg, Mode: 0755}, "bin"},
+		{tar.Header{Name: "./usr/share/doc/pkg/README", Typeflag: tar.TypeReg, Mode: 0644}, "readme"},
+		{tar.Header{Name: "./usr/share/man/pkg.1", Typeflag: tar.TypeReg, Mode: 0644}, "man"},
+	})
+	assert.Nil(err)
+
+	exists := func(dest string, want map[string]bool) {
+		for name, ok := range want {
+			ex, err := Exists(filepath.Join(dest, name))
+			assert.Nil(err)
+			assert.Equal(ok, ex, name)
+		}
+	}
+
+	dest := filepath.Join(dir, "include")
+	err = ExtractArchive(archive, dest, Include("etc/", "usr/share"), Exclude("*/*/man"))
+	assert.Nil(err)
+	exists(dest, map[string]bool{
+		"etc/pkg.conf":             true,
+		"usr/bin/pkg":              false,
+		"usr/share/doc/pkg/README": true,
+		"usr/share/man/pkg.1":      false,
+		"share/doc/pkg/README":     false,
+	})
+
+	dest = filepath.Join(dir, "strip")
+	err = ExtractArchive(archive, dest, Include("usr"), StripComponents(2),
+		Filter(func(hdr *tar.Header) bool { return hdr.Mode&0111 == 0 }))
+	assert.Nil(err)
+	exists(dest, map[string]bool{
+		"bin/pkg":              false,
+		"share/doc/pkg/README": true,
+		"share/man/pkg.1":      true,
+		"pkg.conf":             false,
+	})
+
+	err = ExtractArchive(archive, dest, Exclude("[a-"))
+	assert.Equal(path.ErrBadPattern, err)
+}
+
+func TestSanitizeHeader(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, tc := range []struct {
+		in, want tar.Header
+	}{
+		{
+			tar.Header{Typeflag: tar.TypeReg, Name: "/etc//passwd", Mode: 0104755, Size: 10},
+			tar.Header{Typeflag: tar.TypeReg, Name: "etc/passwd", Mode: 0755, Size: 10},
+		},
+		{
+			tar.Header{Typeflag: tar.TypeDir, Name: "./a\\b", Mode: 03775, Size: 512},
+			tar.Header{Typeflag: tar.TypeDir, Name: "a/b/", Mode: 01775},
+		},
+		{
+			tar.Header{Typeflag: tar.TypeLink, Name: "./x/../hard", Linkname: "/a/file"},
+			tar.Header{Typeflag: tar.TypeLink, Name: "hard", Linkname: "a/file"},
+		},
+		{
+			tar.Header{Typeflag: tar.TypeSymlink, Name: "soft", Linkname: "../up"},
+			tar.Header{Typeflag: tar.TypeSymlink, Name: "soft", Linkname: "../up"},
+		},
+	} {
+		hdr := tc.in
+		assert.Nil(SanitizeHeader(&hdr), tc.in.Name)
+		assert.Equal(tc.want, hdr, tc.in.Name)
+	}
+
+	hdr := tar.Header{Typeflag: tar.TypeReg, Name: "bin/su", Mode: 04755}
+	assert.Nil(SanitizeHeader(&hdr, PreservePermissions()))
+	assert.Equal(int64(04755), hdr.Mode)
+
+	for _, hdr := range []tar.Header{
+		{Typeflag: tar.TypeReg, Name: "../evil"},
+		{Typeflag: tar.TypeReg, Name: "a\\..\\..\\evil"},
+		{Typeflag: tar.TypeReg, Name: "file", Size: -1},
+		{Typeflag: tar.TypeReg, Name: "huge", Size: 1 << 62},
+	} {
+		err := SanitizeHeader(&hdr)
+		assert.IsType(UnsafePathError{}, err, hdr.Name)
+	}
+	hdr = tar.Header{Typeflag: tar.TypeReg, Name: "large", Size: 1 << 20}
+	assert.Equal(LimitError{"MaxEntryBytes", 1 << 10}, SanitizeHeader(&hdr, MaxEntryBytes(1<<10)))
+	assert.Nil(SanitizeHeader(&hdr, MaxEntryBytes(1<<20)))
+	hdr = tar.Header{Typeflag: tar.TypeDir, Name: "dir", Size: 1 << 62}
+	assert.Nil(SanitizeHeader(&hdr, MaxEntryBytes(1<<10)))
+	assert.Equal(int64(0), hdr.Size)
+	hdr = tar.Header{Typeflag: tar.TypeLink, Name: "hard", Linkname: "../evil"}
+	assert.Equal(UnsafeLinkError{"hard", "../evil"}, SanitizeHeader(&hdr))
+	assert.Equal("../evil", hdr.Linkname, "header should not be modified")
+}
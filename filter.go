@@ -0,0 +1,78 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"path"
+	"strings"
+)
+
+// checkPatterns returns an error if any Include or Exclude pattern is
+// malformed, so that this is reported before any entry is processed.
+func (o *treeOptions) checkPatterns() error {
+	for _, patterns := range [][]string{o.include, o.exclude} {
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// selected returns true if the entry described by hdr should be processed
+// according to the Include, Exclude, and Filter options. If the entry is a
+// directory whose contents are all excluded, skipDir is true as well.
+func (o *archiveOptions) selected(hdr *tar.Header) (ok, skipDir bool) {
+	if matchAny(o.exclude, hdr.Name) {
+		return false, hdr.Typeflag == tar.TypeDir
+	}
+	if len(o.include) > 0 && !matchAny(o.include, hdr.Name) {
+		return false, false
+	}
+	if o.filter != nil && !o.filter(hdr) {
+		return false, false
+	}
+	return true, false
+}
+
+// matchAny returns true if the entry name, or any of the directories it is
+// contained in, matches one of the patterns.
+func matchAny(patterns []string, name string) bool {
+	name = cleanEntryName(name)
+	for _, p := range patterns {
+		p = cleanEntryName(p)
+		for i := 1; i <= len(name); i++ {
+			if i < len(name) && name[i] != '/' {
+				continue
+			}
+			if ok, _ := path.Match(p, name[:i]); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchName returns true if the entry name is the name looked for,
+// according to the IgnoreCase and IgnoreDotSlash options.
+func (o *archiveOptions) matchName(name, want string) bool {
+	if o.ignoreDot {
+		name, want = trimDotSlash(name), trimDotSlash(want)
+	}
+	if o.ignoreCase {
+		return strings.EqualFold(name, want)
+	}
+	return name == want
+}
+
+// trimDotSlash removes any leading "./" from name.
+func trimDotSlash(name string) string {
+	for strings.HasPrefix(name, "./") {
+		name = strings.TrimLeft(name[2:], "/")
+	}
+	return name
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+)
+
+// Format identifies a compression or archive format.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatTar
+	FormatGzip
+	FormatBzip2
+	FormatXZ
+	FormatZstd
+	FormatLZ4
+	FormatZip
+	Format7z
+	FormatCpio
+	FormatAr
+	FormatSquashFS
+	FormatISO9660
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatTar:
+		return "tar"
+	case FormatGzip:
+		return "gzip"
+	case FormatBzip2:
+		return "bzip2"
+	case FormatXZ:
+		return "xz"
+	case FormatZstd:
+		return "zstd"
+	case FormatLZ4:
+		return "lz4"
+	case FormatZip:
+		return "zip"
+	case Format7z:
+		return "7z"
+	case FormatCpio:
+		return "cpio"
+	case FormatAr:
+		return "ar"
+	case FormatSquashFS:
+		return "squashfs"
+	case FormatISO9660:
+		return "iso9660"
+	default:
+		return "unknown"
+	}
+}
+
+// magic lists the signatures that identify each format, together with
+// the offset in the file at which they are found.
+var magic = []struct {
+	format Format
+	offset int
+	sig    []byte
+}{
+	{FormatGzip, 0, []byte{0x1f, 0x8b}},
+	{FormatXZ, 0, magicXZ},
+	{FormatBzip2, 0, []byte("BZh")},
+	{FormatZstd, 0, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{FormatLZ4, 0, []byte{0x04, 0x22, 0x4d, 0x18}},
+	{FormatZip, 0, []byte("PK\x03\x04")},
+	{FormatZip, 0, []byte("PK\x05\x06")},
+	{Format7z, 0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}},
+	{FormatCpio, 0, []byte("070701")},
+	{FormatCpio, 0, []byte("070702")},
+	{FormatAr, 0, []byte(arMagic)},
+	{FormatSquashFS, 0, []byte(squashfsMagic)},
+	{FormatTar, 257, []byte("ustar")},
+}
+
+// magicXZ is the signature at the start of every xz stream.
+var magicXZ = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+// magicLen is the number of bytes needed to check every signature in magic.
+const magicLen = 262
+
+// DetectFormat determines the format of the data in r by inspecting the
+// magic bytes at the beginning of it. If the format is not recognized,
+// FormatUnknown is returned together with a nil error.
+func DetectFormat(r io.ReaderAt) (Format, error) {
+	buf := make([]byte, magicLen)
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return FormatUnknown, err
+	}
+	if format := detectFormat(buf[:n]); format != FormatUnknown {
+		return format, nil
+	}
+
+	// The signature of ISO9660 images follows the system area, which is
+	// too far into the data to be part of magic.
+	sig := make([]byte, len(isoMagic))
+	if _, err := r.ReadAt(sig, isoMagicOffset); err == nil && string(sig) == isoMagic {
+		return FormatISO9660, nil
+	}
+	return FormatUnknown, nil
+}
+
+// IsCompressed reports whether the file is compressed in one of the formats
+// supported by NewDecompressor, which are gzip, bzip2, xz, zstd, and lz4,
+// by inspecting its magic bytes. The format detected is returned as well;
+// for archives that are not compressed as a whole, such as zip and tar
+// archives, it is returned together with false.
+func IsCompressed(path string) (Format, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FormatUnknown, false, err
+	}
+	defer f.Close()
+
+	format, err := DetectFormat(f)
+	if err != nil {
+		return FormatUnknown, false, err
+	}
+	switch format {
+	case FormatGzip, FormatBzip2, FormatXZ, FormatZstd, FormatLZ4:
+		return format, true, nil
+	default:
+		return format, false, nil
+	}
+}
+
+// detectFormat returns the format whose signature is found in buf.
+func detectFormat(buf []byte) Format {
+	for _, m := range magic {
+		end := m.offset + len(m.sig)
+		if len(buf) >= end && bytes.Equal(buf[m.offset:end], m.sig) {
+			return m.format
+		}
+	}
+	return FormatUnknown
+}
+
+// formatFromExt returns the format as identified by the extension of filepath.
+// Shorthand extensions for compressed tar archives, such as .tgz, identify
+// the compression format, and the suffix .001 of the first volume of a
+// split file is ignored.
+func formatFromExt(filepath string) Format {
+	// The first volume of a split file has the format of the whole file.
+	filepath, _ = volumeBase(filepath)
+	switch path.Ext(filepath) {
+	case ".tar":
+		return FormatTar
+	case ".gz", ".tgz":
+		return FormatGzip
+	case ".bz2", ".tbz", ".tbz2":
+		return FormatBzip2
+	case ".xz", ".txz":
+		return FormatXZ
+	case ".zst", ".tzst":
+		return FormatZstd
+	case ".lz4":
+		return FormatLZ4
+	case ".zip":
+		return FormatZip
+	case ".7z":
+		return Format7z
+	case ".cpio":
+		return FormatCpio
+	case ".a", ".ar", ".deb":
+		return FormatAr
+	case ".sqsh", ".squashfs", ".sqs", ".snap":
+		return FormatSquashFS
+	case ".iso":
+		return FormatISO9660
+	default:
+		return FormatUnknown
+	}
+}
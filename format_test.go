@@ -0,0 +1,94 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFormat(z *testing.T) {
+	assert := assert.New(z)
+
+	formats := []Format{FormatTar, FormatGzip, FormatBzip2, FormatXZ, FormatZstd, FormatLZ4, FormatZip, Format7z, FormatCpio, FormatGzip, FormatSquashFS, FormatISO9660}
+	for i, archive := range testarchives {
+		f, err := os.Open(archive)
+		assert.Nil(err)
+		format, err := DetectFormat(f)
+		f.Close()
+		assert.Nil(err, archive)
+		assert.Equal(formats[i], format, archive)
+	}
+
+	f, err := os.Open(testfile)
+	assert.Nil(err)
+	defer f.Close()
+	format, err := DetectFormat(f)
+	assert.Nil(err)
+	assert.Equal(FormatUnknown, format, testfile)
+}
+
+func TestIsCompressed(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		format, compressed, err := IsCompressed(archive)
+		assert.Nil(err, archive)
+		switch format {
+		case FormatGzip, FormatBzip2, FormatXZ, FormatZstd, FormatLZ4:
+			assert.True(compressed, archive)
+		default:
+			assert.False(compressed, archive)
+			assert.NotEqual(FormatUnknown, format, archive)
+		}
+	}
+
+	format, compressed, err := IsCompressed(testfile)
+	assert.Nil(err)
+	assert.Equal(FormatUnknown, format)
+	assert.False(compressed)
+	_, _, err = IsCompressed("testdata/missing")
+	assert.True(os.IsNotExist(err))
+}
+
+func TestReadFileFromArchiveWithoutExt(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		err := CopyFile(archive, testdest)
+		assert.Nil(err)
+
+		data, err := ReadFileFromArchive(testdest, "dir2/file3")
+		assert.Nil(err, archive)
+		assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data), archive)
+	}
+	os.Remove(testdest)
+}
+
+func TestShorthandExtensions(z *testing.T) {
+	assert := assert.New(z)
+
+	for ext, archive := range map[string]string{
+		".tgz":  "testdata/dir_reader_data.tar.gz",
+		".tbz2": "testdata/dir_reader_data.tar.bz2",
+		".txz":  "testdata/dir_reader_data.tar.xz",
+		".tzst": "testdata/dir_reader_data.tar.zst",
+	} {
+		dest := testdest + ext
+		assert.Nil(CopyFile(archive, dest))
+		data, err := ReadFileFromArchive(dest, "dir2/file3")
+		assert.Nil(err, ext)
+		assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data), ext)
+
+		d, err := NewDecompressor(dest)
+		if assert.Nil(err, ext) {
+			assert.NotEqual(d.reader, d.file, ext)
+			assert.Nil(d.Close())
+		}
+		os.Remove(dest)
+	}
+}
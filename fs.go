@@ -0,0 +1,207 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// TarFS reads the (compressed) tar archive into memory and returns it as
+// a read-only file system, which can be used with fs.WalkDir, fs.ReadFile,
+// http.FS, and so forth. Parent directories missing from the archive are
+// added, and hardlinks are resolved. Symlinks are not followed.
+//
+// Since the archive is held in memory, it does not need to be closed.
+// To bound the memory used, the limits MaxEntries, MaxEntryBytes, and
+// MaxTotalBytes are supported as options, as is ParallelGzip.
+// Archive formats supported are the same as for ReadFileFromArchive.
+func TarFS(archive string, opts ...Option) (fs.FS, error) {
+	o := newArchiveOptions(opts)
+	limits := newLimiter(o)
+	m := newMemFS()
+	err := walkArchive(archive, o, func(hdr *tar.Header, r io.Reader) error {
+		if err := limits.entry(); err != nil {
+			return err
+		}
+		name, ok := fsName(hdr.Name)
+		if !ok {
+			return nil
+		}
+
+		var data []byte
+		if hdr.Typeflag == tar.TypeLink {
+			if target, ok := fsName(hdr.Linkname); ok && m.files[target] != nil {
+				data = m.files[target].data
+			}
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(data))
+		} else {
+			var err error
+			if data, err = readEntry(limits.reader(hdr, r), hdr.Size); err != nil {
+				return err
+			}
+		}
+		m.add(name, hdr.FileInfo(), data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ZipFS reads the zip archive into memory and returns it as a read-only
+// file system. Since the archive is held in memory, it does not need to be
+// closed.
+func ZipFS(archive string) (fs.FS, error) {
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// fsName converts an archive entry name into a name valid for fs.FS.
+func fsName(name string) (string, bool) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	return name, fs.ValidPath(name)
+}
+
+// memFS is an in-memory read-only file system.
+type memFS struct {
+	files map[string]*memFile
+}
+
+// memFile is a file or directory in a memFS.
+type memFile struct {
+	info     fs.FileInfo
+	data     []byte
+	children map[string]*memFile
+}
+
+func newMemFS() *memFS {
+	m := &memFS{files: make(map[string]*memFile)}
+	m.files["."] = m.newDir(".")
+	return m
+}
+
+// newDir returns a directory entry for name, which is not in the archive.
+func (m *memFS) newDir(name string) *memFile {
+	hdr := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+	}
+	return &memFile{
+		info:     hdr.FileInfo(),
+		children: make(map[string]*memFile),
+	}
+}
+
+// add adds the entry to the file system, creating parent directories
+// as necessary. If the entry already exists, it is replaced, as it would
+// be when extracting the archive.
+func (m *memFS) add(name string, info fs.FileInfo, data []byte) {
+	if info.IsDir() {
+		m.dir(name).info = info
+		return
+	}
+	if name == "." {
+		return
+	}
+
+	f := &memFile{info: info, data: data}
+	m.dir(path.Dir(name)).children[path.Base(name)] = f
+	m.files[name] = f
+}
+
+// dir returns the directory name, creating it and its parents if
+// necessary. If name is not a directory, it is replaced by one.
+func (m *memFS) dir(name string) *memFile {
+	if d := m.files[name]; d != nil && d.children != nil {
+		return d
+	}
+	d := m.newDir(name)
+	if name != "." {
+		m.dir(path.Dir(name)).children[path.Base(name)] = d
+	}
+	m.files[name] = d
+	return d
+}
+
+// Open implements fs.FS.
+func (m *memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f := m.files[name]
+	if f == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.children == nil {
+		return &memReader{f, bytes.NewReader(f.data)}, nil
+	}
+
+	entries := make([]fs.DirEntry, 0, len(f.children))
+	for _, c := range f.children {
+		entries = append(entries, fs.FileInfoToDirEntry(c.info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return &memDir{f, name, entries}, nil
+}
+
+// memReader is an opened regular file in a memFS.
+type memReader struct {
+	file *memFile
+	*bytes.Reader
+}
+
+func (r *memReader) Stat() (fs.FileInfo, error) { return r.file.info, nil }
+func (r *memReader) Close() error               { return nil }
+
+// memDir is an opened directory in a memFS.
+type memDir struct {
+	file    *memFile
+	name    string
+	entries []fs.DirEntry
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.file.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarFS(z *testing.T) {
+	assert := assert.New(z)
+
+	names := []string{"dir1/file1", "dir1/file2", "dir2/file1", "dir2/file2", "dir2/file3"}
+	for _, archive := range testarchives {
+		var fsys fs.FS
+		var err error
+		if filepath.Ext(archive) == ".zip" {
+			fsys, err = ZipFS(archive)
+		} else {
+			fsys, err = TarFS(archive)
+		}
+		assert.Nil(err, archive)
+		assert.Nil(fstest.TestFS(fsys, names...), archive)
+
+		data, err := fs.ReadFile(fsys, "dir1/file1")
+		assert.Nil(err, archive)
+		assert.Equal("dir1/file1 content\n", string(data), archive)
+	}
+}
+
+func TestTarFSImplicitDirs(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "implicit.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "./a/b/c.txt", Typeflag: tar.TypeReg, Mode: 0644}, "c"},
+		{tar.Header{Name: "a/d.txt", Typeflag: tar.TypeLink, Linkname: "a/b/c.txt"}, ""},
+	})
+	assert.Nil(err)
+
+	fsys, err := TarFS(archive)
+	assert.Nil(err)
+	assert.Nil(fstest.TestFS(fsys, "a/b/c.txt", "a/d.txt"))
+
+	data, err := fs.ReadFile(fsys, "a/d.txt")
+	assert.Nil(err)
+	assert.Equal("c", string(data), "hardlinks should be resolved")
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Match returns true if the slash-separated name matches the pattern, which
+// uses the syntax of path.Match, extended in two ways:
+//
+//   - A path component "**" matches zero or more components, so that
+//     "src/**/*.go" matches "src/main.go" and "src/a/b/main.go", and
+//     "src/**" matches "src" and everything below it.
+//   - Braces expand to several alternatives, which may be nested, so that
+//     "*.{tar.{gz,xz},zip}" matches "a.tar.gz", "a.tar.xz", and "a.zip".
+//
+// Names are cleaned like archive entry names, so that "./a/b/" is the same
+// as "a/b". The only possible error is path.ErrBadPattern.
+func Match(pattern, name string) (bool, error) {
+	patterns, err := compileGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+	names := strings.Split(cleanEntryName(name), "/")
+	for _, segments := range patterns {
+		if matchSegments(segments, names) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Glob returns the names of all files that match the pattern, which uses
+// the syntax of Match with forward slashes, as does filepath.Glob, sorted
+// and without duplicates. The files are found by reading directories, but
+// "**" does not descend into symlinks to directories. As with
+// filepath.Glob, errors from reading directories are ignored, and the only
+// possible error is path.ErrBadPattern.
+func Glob(pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	vol := filepath.VolumeName(pattern)
+	patterns, err := compileGlob(filepath.ToSlash(pattern[len(vol):]))
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for _, segments := range patterns {
+		// Leading components without wildcards need not be matched.
+		dir := vol + "."
+		if segments[0] == "" {
+			dir, segments = vol+string(filepath.Separator), segments[1:]
+		}
+		for len(segments) > 1 && !hasGlobMeta(segments[0]) {
+			dir, segments = filepath.Join(dir, segments[0]), segments[1:]
+		}
+		if _, err := os.Lstat(dir); err == nil {
+			globDir(dir, segments, found)
+		}
+	}
+
+	matches := make([]string, 0, len(found))
+	for name := range found {
+		matches = append(matches, name)
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// globDir adds the files below dir that match the path components segments
+// to found.
+func globDir(dir string, segments []string, found map[string]bool) {
+	if len(segments) == 0 {
+		found[dir] = true
+		return
+	}
+	seg, rest := segments[0], segments[1:]
+	if seg == "" || seg == "." {
+		globDir(dir, rest, found)
+		return
+	}
+	if !hasGlobMeta(seg) {
+		name := filepath.Join(dir, seg)
+		if _, err := os.Lstat(name); err == nil {
+			globDir(name, rest, found)
+		}
+		return
+	}
+
+	if seg == "**" {
+		globDir(dir, rest, found)
+	}
+	names, err := readDirNames(dir)
+	if err != nil {
+		return
+	}
+	for _, n := range names {
+		name := filepath.Join(dir, n)
+		if seg == "**" {
+			if fi, err := os.Lstat(name); err == nil && fi.IsDir() {
+				globDir(name, segments, found)
+			} else if len(rest) == 0 {
+				found[name] = true
+			}
+			continue
+		}
+		if ok, _ := path.Match(seg, n); ok {
+			globDir(name, rest, found)
+		}
+	}
+}
+
+// compileGlob expands the braces of the pattern and splits the resulting
+// patterns into path components, checking that each of them is valid.
+func compileGlob(pattern string) ([][]string, error) {
+	expanded, err := expandBraces(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns := make([][]string, len(expanded))
+	for i, p := range expanded {
+		patterns[i] = strings.Split(p, "/")
+		for _, seg := range patterns[i] {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return patterns, nil
+}
+
+// expandBraces returns the patterns that the braces in pattern expand to.
+// Braces inside character classes and escaped braces are left as they are.
+func expandBraces(pattern string) ([]string, error) {
+	start, depth := -1, 0
+	var commas []int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			for i++; i < len(pattern) && pattern[i] != ']'; i++ {
+				if pattern[i] == '\\' {
+					i++
+				}
+			}
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		case '}':
+			if depth == 0 {
+				return nil, path.ErrBadPattern
+			}
+			if depth--; depth > 0 {
+				continue
+			}
+			prefix, suffix := pattern[:start], pattern[i+1:]
+			var expanded []string
+			from := start + 1
+			for _, to := range append(commas, i) {
+				alts, err := expandBraces(prefix + pattern[from:to] + suffix)
+				if err != nil {
+					return nil, err
+				}
+				expanded = append(expanded, alts...)
+				from = to + 1
+			}
+			return expanded, nil
+		}
+	}
+	if depth != 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+// matchSegments returns true if the path components names match the
+// pattern components segments.
+func matchSegments(segments, names []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(segments[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(segments[0], names[0]); !ok {
+			return false
+		}
+		segments, names = segments[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// hasGlobMeta returns true if the path component seg must be matched.
+func hasGlobMeta(seg string) bool {
+	return strings.ContainsAny(seg, `*?[\`)
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, tc := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/a/b/main.go", true},
+		{"src/**/*.go", "lib/main.go", false},
+		{"src/**", "src", true},
+		{"src/**", "./src/a/b/", true},
+		{"**", "a/b/c", true},
+		{"**/c", "c", true},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b/**/c", "a/x/y/z/c", false},
+		{"*.{tar.{gz,xz},zip}", "a.tar.xz", true},
+		{"*.{tar.{gz,xz},zip}", "a.zip", true},
+		{"*.{tar.{gz,xz},zip}", "a.tar", false},
+		{"{a,b}/{c,d}", "b/c", true},
+		{"file.[ch]", "file.h", true},
+		{"file[{]", "file{", true},
+		{`\{a,b\}`, "{a,b}", true},
+		{"data-[0-9][^a]", "data-1b", true},
+		{"a{,b}", "a", true},
+	} {
+		ok, err := Match(tc.pattern, tc.name)
+		assert.Nil(err, tc.pattern)
+		assert.Equal(tc.match, ok, tc.pattern+" "+tc.name)
+	}
+
+	for _, pattern := range []string{"{a,b", "a}", "[a", "a/{[,b}"} {
+		_, err := Match(pattern, "a")
+		assert.Equal(path.ErrBadPattern, err, pattern)
+	}
+}
+
+func TestGlob(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.go", "a.txt", "src/b.go", "src/x/c.go", "src/x/y/d.go", "src/x/y/e.c"} {
+		p := filepath.Join(dir, name)
+		assert.Nil(os.MkdirAll(filepath.Dir(p), 0755))
+		assert.Nil(ioutil.WriteFile(p, nil, 0644))
+	}
+	assert.Nil(os.Symlink("..", filepath.Join(dir, "src/x/loop")))
+
+	base := filepath.ToSlash(dir)
+	glob := func(pattern string) []string {
+		matches, err := Glob(base + "/" + pattern)
+		assert.Nil(err, pattern)
+		for i, m := range matches {
+			rel, err := filepath.Rel(dir, m)
+			assert.Nil(err)
+			matches[i] = filepath.ToSlash(rel)
+		}
+		return matches
+	}
+	assert.Equal([]string{"a.go", "src/b.go", "src/x/c.go", "src/x/y/d.go"}, glob("**/*.go"))
+	assert.Equal([]string{"src/x/c.go", "src/x/y/d.go", "src/x/y/e.c"}, glob("src/x/**/*.{go,c}"))
+	assert.Equal([]string{"src", "src/b.go", "src/x", "src/x/c.go", "src/x/loop", "src/x/y", "src/x/y/d.go", "src/x/y/e.c"}, glob("src/**"))
+	assert.Equal([]string{"a.go", "a.txt"}, glob("a.{go,txt,md}"))
+	assert.Equal([]string{"src/x/c.go"}, glob("src/[x]/c.go"))
+	assert.Equal([]string{"src/x/c.go"}, glob("src/x/c.go"))
+	assert.Empty(glob("src/x/missing.go"))
+	assert.Empty(glob("missing/**"))
+
+	_, err = Glob("{a")
+	assert.Equal(path.ErrBadPattern, err)
+	matches, err := Glob("")
+	assert.Nil(err)
+	assert.Empty(matches)
+}
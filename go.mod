@@ -1,5 +1,28 @@
 module github.com/goulash/osutil
 
-go 1.14
+go 1.17
 
-require github.com/stretchr/testify v1.8.0
+require (
+	github.com/bodgit/sevenzip v1.3.0
+	github.com/dsnet/compress v0.0.1
+	github.com/klauspost/compress v1.15.15
+	github.com/klauspost/pgzip v1.2.6
+	github.com/pierrec/lz4/v4 v4.1.21
+	github.com/stretchr/testify v1.8.0
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/sys v0.13.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.4 // indirect
+	github.com/bodgit/plumbing v1.2.0 // indirect
+	github.com/bodgit/windows v1.0.0 // indirect
+	github.com/connesc/cipherio v0.2.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go4.org v0.0.0-20200411211856-f5505b9728dd // indirect
+	golang.org/x/text v0.3.7 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,97 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+
+	"github.com/klauspost/pgzip"
+)
+
+// GzipHeader returns the header of the gzip member that is currently being
+// decompressed, which records the original name, modification time,
+// comment, and operating system of the compressed file, if the producer
+// stored them. If the data is not gzip-compressed, ok is false.
+func (d *Decompressor) GzipHeader() (hdr gzip.Header, ok bool) {
+	switch r := d.reader.(type) {
+	case *gzip.Reader:
+		return r.Header, true
+	case *pgzip.Reader:
+		return gzip.Header{
+			Comment: r.Comment,
+			Extra:   r.Extra,
+			ModTime: r.ModTime,
+			Name:    r.Name,
+			OS:      r.OS,
+		}, true
+	default:
+		return gzip.Header{}, false
+	}
+}
+
+// XZCheck is the type of integrity check of an xz stream.
+type XZCheck byte
+
+const (
+	XZCheckNone   XZCheck = 0x0
+	XZCheckCRC32  XZCheck = 0x1
+	XZCheckCRC64  XZCheck = 0x4
+	XZCheckSHA256 XZCheck = 0xa
+)
+
+func (c XZCheck) String() string {
+	switch c {
+	case XZCheckNone:
+		return "None"
+	case XZCheckCRC32:
+		return "CRC-32"
+	case XZCheckCRC64:
+		return "CRC-64"
+	case XZCheckSHA256:
+		return "SHA-256"
+	default:
+		return "unknown"
+	}
+}
+
+// XZHeader describes the stream header of an xz file.
+type XZHeader struct {
+	// Flags are the stream flags as stored in the header.
+	Flags uint16
+	// Check is the type of integrity check, which is part of Flags.
+	Check XZCheck
+}
+
+// xzHeaderLen is the length of the stream header of an xz file.
+const xzHeaderLen = 12
+
+// XZHeader returns the header of the first stream of an xz file. If the
+// data is not xz-compressed, ok is false.
+func (d *Decompressor) XZHeader() (hdr XZHeader, ok bool) {
+	if d.xzHeader == nil {
+		return XZHeader{}, false
+	}
+	return *d.xzHeader, true
+}
+
+// parseXZHeader parses the xz stream header in buf, returning nil if it is
+// invalid. The header consists of the magic bytes, the stream flags, and the
+// CRC-32 of the flags.
+func parseXZHeader(buf []byte) *XZHeader {
+	if len(buf) != xzHeaderLen || !bytes.HasPrefix(buf, magicXZ) {
+		return nil
+	}
+	flags := buf[6:8]
+	if crc32.ChecksumIEEE(flags) != binary.LittleEndian.Uint32(buf[8:]) {
+		return nil
+	}
+	return &XZHeader{
+		Flags: binary.BigEndian.Uint16(flags),
+		Check: XZCheck(flags[1] & 0x0f),
+	}
+}
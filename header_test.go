@@ -0,0 +1,70 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzipHeader(z *testing.T) {
+	assert := assert.New(z)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name = "original.txt"
+	zw.ModTime = time.Unix(1400000000, 0)
+	zw.OS = 3
+	zw.Write([]byte("data\n"))
+	assert.Nil(zw.Close())
+	dest := testdest + ".gz"
+	assert.Nil(ioutil.WriteFile(dest, buf.Bytes(), 0644))
+	defer os.Remove(dest)
+
+	for _, opts := range [][]Option{nil, {ParallelGzip(0, 0)}} {
+		d, err := NewDecompressor(dest, opts...)
+		if !assert.Nil(err) {
+			continue
+		}
+		hdr, ok := d.GzipHeader()
+		assert.True(ok)
+		assert.Equal("original.txt", hdr.Name)
+		assert.True(hdr.ModTime.Equal(time.Unix(1400000000, 0)))
+		assert.Equal(byte(3), hdr.OS)
+		_, ok = d.XZHeader()
+		assert.False(ok)
+		assert.Nil(d.Close())
+	}
+}
+
+func TestXZHeader(z *testing.T) {
+	assert := assert.New(z)
+
+	d, err := NewDecompressor("testdata/dir_reader_data.tar.xz")
+	if !assert.Nil(err) {
+		return
+	}
+	defer d.Close()
+	hdr, ok := d.XZHeader()
+	assert.True(ok)
+	assert.Equal(XZCheckCRC64, hdr.Check)
+	assert.Equal(uint16(0x0004), hdr.Flags)
+	assert.Equal("CRC-64", hdr.Check.String())
+	_, ok = d.GzipHeader()
+	assert.False(ok)
+
+	// Reading must still start at the beginning of the stream.
+	data, err := ioutil.ReadAll(d)
+	assert.Nil(err)
+	assert.True(len(data) > 0)
+
+	assert.Nil(parseXZHeader([]byte("not an xz header")))
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// ErrIndexFormat is returned by ReadTarIndex when the index is malformed.
+var ErrIndexFormat = errors.New("malformed tar index")
+
+// TarIndex records where the entries of a tar archive start, so that they
+// can be read repeatedly without scanning the archive each time.
+//
+// A TarIndex is created by scanning the (decompressed) archive once with
+// NewTarIndex, and can be stored alongside the archive with WriteTo and
+// read again with ReadTarIndex. Entries are then read with Open from an
+// io.ReaderAt for the decompressed archive, such as an *os.File for an
+// uncompressed tar archive.
+type TarIndex struct {
+	names   []string
+	offsets map[string]int64
+}
+
+// NewTarIndex reads the tar archive from r and records the offset of each
+// entry. If an entry name occurs more than once, the last one is recorded,
+// as it is the one that is left when extracting the archive.
+func NewTarIndex(r io.Reader) (*TarIndex, error) {
+	ix := &TarIndex{offsets: make(map[string]int64)}
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+	for {
+		// The tar reader reads exactly as much as it needs, so each entry
+		// starts at the block following the data of the previous one.
+		offset := (cr.n + 511) / 512 * 512
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return ix, nil
+		} else if err != nil {
+			return nil, err
+		}
+		ix.add(hdr.Name, offset)
+		if _, err := io.Copy(ioutil.Discard, tr); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// add records that the entry name starts at offset.
+func (ix *TarIndex) add(name string, offset int64) {
+	if _, ok := ix.offsets[name]; !ok {
+		ix.names = append(ix.names, name)
+	}
+	ix.offsets[name] = offset
+}
+
+// Names returns the names of the entries in the index, in archive order.
+func (ix *TarIndex) Names() []string {
+	names := make([]string, len(ix.names))
+	copy(names, ix.names)
+	return names
+}
+
+// Open returns the header and the contents of the entry name, reading
+// them from ra, which must provide the same archive that the index was
+// created from. If the entry is not in the index, a NotFoundError is
+// returned.
+func (ix *TarIndex) Open(ra io.ReaderAt, name string) (*tar.Header, io.Reader, error) {
+	offset, ok := ix.offsets[name]
+	if !ok {
+		return nil, nil, NotFoundError{name}
+	}
+	tr := tar.NewReader(io.NewSectionReader(ra, offset, 1<<63-1-offset))
+	hdr, err := tr.Next()
+	if err == io.EOF {
+		return nil, nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if hdr.Name != name {
+		return nil, nil, fmt.Errorf("tar index does not match archive: found %q instead of %q", hdr.Name, name)
+	}
+	return hdr, tr, nil
+}
+
+// WriteTo writes the index to w in a line-based text format, which can be
+// read with ReadTarIndex.
+func (ix *TarIndex) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range ix.names {
+		fmt.Fprintf(bw, "%d %s\n", ix.offsets[name], strconv.Quote(name))
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ReadTarIndex reads an index written by WriteTo.
+func ReadTarIndex(r io.Reader) (*TarIndex, error) {
+	ix := &TarIndex{offsets: make(map[string]int64)}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.SplitN(s.Text(), " ", 2)
+		if len(fields) != 2 {
+			return nil, ErrIndexFormat
+		}
+		offset, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil || offset < 0 || offset%512 != 0 {
+			return nil, ErrIndexFormat
+		}
+		name, err := strconv.Unquote(fields[1])
+		if err != nil {
+			return nil, ErrIndexFormat
+		}
+		ix.add(name, offset)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
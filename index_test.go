@@ -0,0 +1,71 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarIndex(z *testing.T) {
+	assert := assert.New(z)
+
+	f, err := os.Open("testdata/dir_reader_data.tar")
+	assert.Nil(err)
+	defer f.Close()
+
+	ix, err := NewTarIndex(f)
+	assert.Nil(err)
+	assert.Equal([]string{
+		"dir1/", "dir1/file2", "dir1/file1", "dir2/", "dir2/file3", "dir2/file2", "dir2/file1",
+	}, ix.Names())
+
+	// Entries can be read in any order.
+	for _, name := range []string{"dir2/file3", "dir1/file1", "dir2/file3"} {
+		hdr, r, err := ix.Open(f, name)
+		assert.Nil(err, name)
+		assert.Equal(name, hdr.Name)
+		data, err := ioutil.ReadAll(r)
+		assert.Nil(err, name)
+		assert.Equal(hdr.Size, int64(len(data)), name)
+		assert.True(strings.HasPrefix(string(data), name), name)
+	}
+	_, _, err = ix.Open(f, "dir3/file1")
+	assert.Equal(NotFoundError{"dir3/file1"}, err)
+
+	// The index survives a round trip.
+	var buf bytes.Buffer
+	_, err = ix.WriteTo(&buf)
+	assert.Nil(err)
+	ix2, err := ReadTarIndex(&buf)
+	assert.Nil(err)
+	assert.Equal(ix, ix2)
+
+	_, err = ReadTarIndex(strings.NewReader("100 \"dir1/\"\n"))
+	assert.Equal(ErrIndexFormat, err)
+}
+
+func TestTarIndexCompressed(z *testing.T) {
+	assert := assert.New(z)
+
+	d, err := NewDecompressor("testdata/dir_reader_data.tar.xz")
+	assert.Nil(err)
+	defer d.Close()
+	data, err := ioutil.ReadAll(d)
+	assert.Nil(err)
+
+	ix, err := NewTarIndex(bytes.NewReader(data))
+	assert.Nil(err)
+	_, r, err := ix.Open(bytes.NewReader(data), "dir1/file1")
+	assert.Nil(err)
+	content, err := ioutil.ReadAll(r)
+	assert.Nil(err)
+	assert.Equal("dir1/file1 content\n", string(content))
+}
@@ -0,0 +1,537 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// ErrISO9660 is returned when an ISO9660 image is malformed.
+var ErrISO9660 = errors.New("malformed iso9660 image")
+
+const (
+	isoSectorSize = 2048
+	// isoDescriptorStart is the sector of the first volume descriptor,
+	// following the system area.
+	isoDescriptorStart = 16
+	isoMagic           = "CD001"
+	isoMagicOffset     = isoDescriptorStart*isoSectorSize + 1
+)
+
+// Types of volume descriptors.
+const (
+	isoPrimary       = 1
+	isoSupplementary = 2
+	isoTerminator    = 255
+)
+
+// Flags of directory records.
+const (
+	isoFlagDir         = 1 << 1
+	isoFlagMultiExtent = 1 << 7
+)
+
+// isoRecord is a directory record, together with the Rock Ridge extensions
+// found in its system use area.
+type isoRecord struct {
+	extent uint32
+	size   uint32
+	flags  byte
+	mtime  time.Time
+	name   string
+
+	// Rock Ridge extensions.
+	rrName    string
+	mode      uint32
+	uid, gid  uint32
+	hasPX     bool
+	symlink   string
+	isSymlink bool
+	continued bool
+	dev       uint64
+	hasDev    bool
+	child     uint32 // the extent of a relocated directory
+	hasChild  bool
+	relocated bool
+}
+
+// isoReader reads the directory hierarchy of an ISO9660 image from ra.
+type isoReader struct {
+	ra        io.ReaderAt
+	blockSize int64
+
+	// joliet is true if names are encoded in UCS-2, as on the Joliet
+	// supplementary volume.
+	joliet bool
+	// rockRidge is true if the records contain Rock Ridge extensions, and
+	// skip is the number of bytes to skip in their system use areas.
+	rockRidge bool
+	skip      int
+}
+
+// newISOReader reads the volume descriptors of the image. Rock Ridge
+// extensions of the primary volume are preferred, since they preserve
+// permissions and symlinks, followed by the Joliet volume, which preserves
+// long names, and finally the plain primary volume.
+func newISOReader(ra io.ReaderAt) (*isoReader, *isoRecord, error) {
+	var primary, joliet []byte
+	for sector := int64(isoDescriptorStart); ; sector++ {
+		vd := make([]byte, isoSectorSize)
+		if _, err := ra.ReadAt(vd, sector*isoSectorSize); err != nil {
+			return nil, nil, unexpectedEOF(err)
+		}
+		if string(vd[1:6]) != isoMagic {
+			return nil, nil, ErrISO9660
+		}
+		switch vd[0] {
+		case isoPrimary:
+			if primary == nil {
+				primary = vd
+			}
+		case isoSupplementary:
+			// Joliet is identified by the escape sequences of UCS-2.
+			esc := string(vd[88:91])
+			if esc == "%/@" || esc == "%/C" || esc == "%/E" {
+				joliet = vd
+			}
+		}
+		if vd[0] == isoTerminator {
+			break
+		}
+		if sector > isoDescriptorStart+64 {
+			return nil, nil, ErrISO9660
+		}
+	}
+	if primary == nil {
+		return nil, nil, ErrISO9660
+	}
+
+	ir := &isoReader{ra: ra, blockSize: int64(binary.LittleEndian.Uint16(primary[128:]))}
+	if ir.blockSize != 512 && ir.blockSize != 1024 && ir.blockSize != 2048 {
+		return nil, nil, ErrISO9660
+	}
+	root, err := ir.parseRecord(primary[156:190])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rock Ridge is announced by the SP entry in the first record of the
+	// root directory.
+	dot, err := ir.readDot(root.extent)
+	if err != nil {
+		return nil, nil, err
+	}
+	su := isoSystemUse(dot)
+	if len(su) >= 7 && string(su[:2]) == "SP" && su[4] == 0xbe && su[5] == 0xef {
+		ir.rockRidge, ir.skip = true, int(su[6])
+		return ir, root, nil
+	}
+	if joliet != nil {
+		ir.joliet = true
+		root, err = ir.parseRecord(joliet[156:190])
+		return ir, root, err
+	}
+	return ir, root, nil
+}
+
+// readDir reads the records of the directory rec, without the records of
+// the directory itself and its parent.
+func (ir *isoReader) readDir(rec *isoRecord) ([]*isoRecord, error) {
+	if rec.size > 64<<20 {
+		return nil, ErrISO9660
+	}
+	data := make([]byte, rec.size)
+	if _, err := ir.ra.ReadAt(data, int64(rec.extent)*ir.blockSize); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	var records []*isoRecord
+	for off := 0; off < len(data); {
+		n := int(data[off])
+		if n == 0 {
+			// Records do not cross sector boundaries, and the rest of
+			// the sector is padded with zeros.
+			off = (off/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		if off+n > len(data) {
+			return nil, ErrISO9660
+		}
+		r, err := ir.parseRecord(data[off : off+n])
+		if err != nil {
+			return nil, err
+		}
+		off += n
+		if r.name == "\x00" || r.name == "\x01" {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+// readDot returns the first record of the directory at extent, which is
+// the record of the directory itself.
+func (ir *isoReader) readDot(extent uint32) ([]byte, error) {
+	sector := make([]byte, isoSectorSize)
+	if _, err := ir.ra.ReadAt(sector, int64(extent)*ir.blockSize); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	n := int(sector[0])
+	if n < 34 {
+		return nil, ErrISO9660
+	}
+	return sector[:n], nil
+}
+
+// isoSystemUse returns the system use area of the record.
+func isoSystemUse(rec []byte) []byte {
+	start := 33 + int(rec[32])
+	if rec[32]%2 == 0 {
+		// A padding byte follows names of even length.
+		start++
+	}
+	if start > len(rec) {
+		return nil
+	}
+	return rec[start:]
+}
+
+// parseRecord parses the directory record rec.
+func (ir *isoReader) parseRecord(rec []byte) (*isoRecord, error) {
+	if len(rec) < 34 || int(rec[0]) > len(rec) || 33+int(rec[32]) > int(rec[0]) {
+		return nil, ErrISO9660
+	}
+	rec = rec[:rec[0]]
+	r := &isoRecord{
+		extent: binary.LittleEndian.Uint32(rec[2:]) + uint32(rec[1]),
+		size:   binary.LittleEndian.Uint32(rec[10:]),
+		flags:  rec[25],
+		mtime:  isoTime(rec[18:25]),
+	}
+	name := rec[33 : 33+rec[32]]
+	switch {
+	case len(name) == 1 && name[0] <= 1:
+		r.name = string(name)
+	case ir.joliet:
+		r.name = isoJolietName(name)
+	default:
+		r.name = isoPlainName(string(name))
+	}
+	if ir.rockRidge {
+		if err := ir.parseSystemUse(r, isoSystemUse(rec), 0); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// isoTime parses the recording date of a directory record.
+func isoTime(b []byte) time.Time {
+	zone := time.FixedZone("", int(int8(b[6]))*15*60)
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, zone)
+}
+
+// isoPlainName removes the version number and the trailing dot, which
+// ISO9660 appends to names without an extension.
+func isoPlainName(name string) string {
+	if i := strings.LastIndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// isoJolietName decodes a name in UCS-2.
+func isoJolietName(name []byte) string {
+	u := make([]uint16, len(name)/2)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(name[2*i:])
+	}
+	return isoPlainName(string(utf16.Decode(u)))
+}
+
+// parseSystemUse parses the Rock Ridge entries in the system use area su,
+// following continuation areas up to a fixed depth.
+func (ir *isoReader) parseSystemUse(r *isoRecord, su []byte, depth int) error {
+	if depth > 16 {
+		return ErrISO9660
+	}
+	if ir.skip <= len(su) {
+		su = su[ir.skip:]
+	}
+	le := binary.LittleEndian
+	for len(su) >= 4 {
+		n := int(su[2])
+		if n < 4 || n > len(su) {
+			break
+		}
+		e, data := string(su[:2]), su[4:n]
+		su = su[n:]
+		switch e {
+		case "NM":
+			if len(data) >= 1 && data[0]&0x6 == 0 {
+				r.rrName += string(data[1:])
+			}
+		case "PX":
+			if len(data) >= 32 {
+				r.mode, r.uid, r.gid = le.Uint32(data), le.Uint32(data[16:]), le.Uint32(data[24:])
+				r.hasPX = true
+			}
+		case "PN":
+			if len(data) >= 16 {
+				r.dev = uint64(le.Uint32(data))<<32 | uint64(le.Uint32(data[8:]))
+				r.hasDev = true
+			}
+		case "SL":
+			if len(data) >= 1 {
+				r.appendSymlink(data[1:])
+			}
+		case "TF":
+			if t, ok := isoModTime(data); ok {
+				r.mtime = t
+			}
+		case "CL":
+			if len(data) >= 8 {
+				r.child, r.hasChild = le.Uint32(data), true
+			}
+		case "RE":
+			r.relocated = true
+		case "CE":
+			if len(data) < 24 {
+				return ErrISO9660
+			}
+			block, off, size := le.Uint32(data), le.Uint32(data[8:]), le.Uint32(data[16:])
+			if size > isoSectorSize {
+				return ErrISO9660
+			}
+			cont := make([]byte, size)
+			if _, err := ir.ra.ReadAt(cont, int64(block)*ir.blockSize+int64(off)); err != nil {
+				return unexpectedEOF(err)
+			}
+			// Continuation areas are not preceded by skipped bytes.
+			skip := ir.skip
+			ir.skip = 0
+			err := ir.parseSystemUse(r, cont, depth+1)
+			ir.skip = skip
+			if err != nil {
+				return err
+			}
+		case "ST":
+			return nil
+		}
+	}
+	return nil
+}
+
+// appendSymlink appends the components of an SL entry to the target of
+// the symlink.
+func (r *isoRecord) appendSymlink(data []byte) {
+	r.isSymlink = true
+	for len(data) >= 2 {
+		flags, n := data[0], int(data[1])
+		if 2+n > len(data) {
+			return
+		}
+		var c string
+		switch {
+		case flags&0x2 != 0:
+			c = "."
+		case flags&0x4 != 0:
+			c = ".."
+		case flags&0x8 != 0:
+			c = "/"
+		default:
+			c = string(data[2 : 2+n])
+		}
+		data = data[2+n:]
+
+		switch {
+		case r.continued, r.symlink == "", r.symlink == "/":
+			r.symlink += c
+		default:
+			r.symlink += "/" + c
+		}
+		// A component can be continued in the next one.
+		r.continued = flags&0x1 != 0
+	}
+}
+
+// isoModTime returns the modification time of a TF entry.
+func isoModTime(data []byte) (time.Time, bool) {
+	if len(data) < 1 {
+		return time.Time{}, false
+	}
+	flags := data[0]
+	data = data[1:]
+	size := 7
+	if flags&0x80 != 0 {
+		size = 17
+	}
+	if flags&0x2 == 0 {
+		return time.Time{}, false
+	}
+	if flags&0x1 != 0 {
+		// Skip the creation time, which precedes the modification time.
+		if len(data) < size {
+			return time.Time{}, false
+		}
+		data = data[size:]
+	}
+	if len(data) < size {
+		return time.Time{}, false
+	}
+	if size == 7 {
+		return isoTime(data), true
+	}
+	return isoLongTime(data), true
+}
+
+// isoLongTime parses a date in the 17-byte format of volume descriptors.
+func isoLongTime(b []byte) time.Time {
+	num := func(s []byte) int {
+		n := 0
+		for _, c := range s {
+			n = n*10 + int(c-'0')
+		}
+		return n
+	}
+	zone := time.FixedZone("", int(int8(b[16]))*15*60)
+	return time.Date(num(b[0:4]), time.Month(num(b[4:6])), num(b[6:8]), num(b[8:10]),
+		num(b[10:12]), num(b[12:14]), num(b[14:16])*1e7, zone)
+}
+
+// header returns a tar header describing the record, with the entry name.
+func (r *isoRecord) header(name string) *tar.Header {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		ModTime: r.mtime,
+	}
+	if r.hasPX {
+		hdr.Mode = int64(r.mode & 07777)
+		hdr.Uid, hdr.Gid = int(r.uid), int(r.gid)
+	}
+	switch {
+	case r.flags&isoFlagDir != 0 || r.hasChild:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		if !r.hasPX {
+			hdr.Mode = 0755
+		}
+	case r.isSymlink:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = r.symlink
+	case r.hasPX && r.mode&0170000 == 0060000 && r.hasDev:
+		hdr.Typeflag = tar.TypeBlock
+	case r.hasPX && r.mode&0170000 == 0020000 && r.hasDev:
+		hdr.Typeflag = tar.TypeChar
+	case r.hasPX && r.mode&0170000 == 0010000:
+		hdr.Typeflag = tar.TypeFifo
+	case r.hasPX && r.mode&0170000 == 0140000:
+		return nil
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(r.size)
+	}
+	if hdr.Typeflag == tar.TypeBlock || hdr.Typeflag == tar.TypeChar {
+		hdr.Devmajor, hdr.Devminor = int64(r.dev>>32), int64(r.dev&0xffffffff)
+	}
+	return hdr
+}
+
+// walkISO9660 calls fn for each entry of the ISO9660 image archive, in a
+// depth-first traversal of the file system. Files spanning several extents
+// are joined, and directories relocated by Rock Ridge are found at their
+// original place.
+func walkISO9660(archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ir, root, err := newISOReader(f)
+	if err != nil {
+		return err
+	}
+	return ir.walkDir(root, "", 0, fn)
+}
+
+// walkDir calls fn for all entries of the directory rec, whose entry name
+// is dir, and recurses into its subdirectories.
+func (ir *isoReader) walkDir(rec *isoRecord, dir string, depth int, fn func(hdr *tar.Header, r io.Reader) error) error {
+	if depth > 256 {
+		return ErrISO9660
+	}
+	records, err := ir.readDir(rec)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(records); i++ {
+		r := records[i]
+		if r.relocated {
+			continue
+		}
+		name := r.name
+		if r.rrName != "" {
+			name = r.rrName
+		}
+		if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+			return ErrISO9660
+		}
+
+		// The extents of a file are stored in consecutive records.
+		readers := []io.Reader{io.NewSectionReader(ir.ra, int64(r.extent)*ir.blockSize, int64(r.size))}
+		size := int64(r.size)
+		for r.flags&isoFlagMultiExtent != 0 && i+1 < len(records) {
+			i++
+			r = records[i]
+			readers = append(readers, io.NewSectionReader(ir.ra, int64(r.extent)*ir.blockSize, int64(r.size)))
+			size += int64(r.size)
+		}
+
+		first := records[i-len(readers)+1]
+		hdr := first.header(path.Join(dir, name))
+		if hdr == nil {
+			continue
+		}
+		var body io.Reader = bytes.NewReader(nil)
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = size
+			body = io.MultiReader(readers...)
+		}
+		if err := fn(hdr, body); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			sub := first
+			if first.hasChild {
+				// The directory has been relocated, and its contents are
+				// described by the record of the directory itself.
+				dot, err := ir.readDot(first.child)
+				if err != nil {
+					return err
+				}
+				if sub, err = ir.parseRecord(dot); err != nil {
+					return err
+				}
+			}
+			if err := ir.walkDir(sub, path.Join(dir, name), depth+1, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
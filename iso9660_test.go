@@ -0,0 +1,105 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testiso is an image with Rock Ridge and Joliet extensions, which contains
+// symlinks, a fifo, a file spanning two extents, and a name long enough to
+// be stored in a continuation area.
+const testiso = "testdata/extras.iso"
+
+var testisoLongName = "a file with a rather long name that does not fit into its directory record, " +
+	"so that its Rock Ridge name is stored in a continuation area which follows the data of the image"
+
+func TestISO9660RockRidge(z *testing.T) {
+	assert := assert.New(z)
+
+	entries := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+	err := WalkArchive(testiso, func(hdr *tar.Header, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		entries[hdr.Name], contents[hdr.Name] = hdr, string(data)
+		return err
+	})
+	assert.Nil(err)
+	assert.Len(entries, 8)
+
+	assert.Equal(byte(tar.TypeDir), entries["Sub Dir/"].Typeflag)
+	assert.Equal("target\n", contents["Sub Dir/target.txt"])
+	assert.Equal(int64(0600), entries["Sub Dir/target.txt"].Mode)
+	assert.Equal(1000, entries["Sub Dir/target.txt"].Uid)
+	assert.Equal(100, entries["Sub Dir/target.txt"].Gid)
+	assert.Equal(int64(1400000000), entries["Sub Dir/target.txt"].ModTime.Unix())
+	assert.Equal("hello\n", contents["Grüße.txt"])
+	assert.Equal("long\n", contents[testisoLongName])
+	assert.Equal(strings.Repeat("x", 2048)+strings.Repeat("y", 100), contents["split.bin"])
+	assert.Equal(int64(2148), entries["split.bin"].Size)
+	assert.Equal(byte(tar.TypeSymlink), entries["link"].Typeflag)
+	assert.Equal("Sub Dir/../Sub Dir/target.txt", entries["link"].Linkname)
+	assert.Equal("/usr/share/verylongcomponent", entries["abslink"].Linkname)
+	assert.Equal(byte(tar.TypeFifo), entries["fifo"].Typeflag)
+
+	data, err := ReadFileFromArchive(testiso, "Sub Dir/target.txt")
+	assert.Nil(err)
+	assert.Equal("target\n", string(data))
+}
+
+func TestISO9660Joliet(z *testing.T) {
+	assert := assert.New(z)
+
+	f, err := os.Open(testiso)
+	assert.Nil(err)
+	defer f.Close()
+
+	// Read the supplementary volume, which is only used when the image
+	// has no Rock Ridge extensions.
+	vd := make([]byte, isoSectorSize)
+	_, err = f.ReadAt(vd, (isoDescriptorStart+1)*isoSectorSize)
+	assert.Nil(err)
+	ir := &isoReader{ra: f, blockSize: isoSectorSize, joliet: true}
+	root, err := ir.parseRecord(vd[156:190])
+	assert.Nil(err)
+
+	sizes := make(map[string]int64)
+	assert.Nil(ir.walkDir(root, "", 0, func(hdr *tar.Header, r io.Reader) error {
+		sizes[hdr.Name] = hdr.Size
+		return nil
+	}))
+	assert.Equal(map[string]int64{
+		"Grüße.txt":          6,
+		"Sub Dir/":           0,
+		"Sub Dir/target.txt": 7,
+		testisoLongName[:64]: 5,
+		"abslink":            0,
+		"fifo":               0,
+		"link":               0,
+		"split.bin":          2148,
+	}, sizes)
+}
+
+func TestISO9660Malformed(z *testing.T) {
+	assert := assert.New(z)
+
+	data, err := ioutil.ReadFile(testiso)
+	assert.Nil(err)
+	dest := testdest + ".iso"
+	defer os.Remove(dest)
+
+	// A truncated image must fail without panicking.
+	for _, n := range []int{isoMagicOffset + 100, 40000, 45000} {
+		assert.Nil(ioutil.WriteFile(dest, data[:n], 0644))
+		assert.NotNil(walkISO9660(dest, func(*tar.Header, io.Reader) error { return nil }), n)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io"
+)
+
+// MaxEntries limits the number of entries that an archive may contain;
+// if it contains more, a LimitError is returned.
+func MaxEntries(n int) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.maxEntries = n
+	})
+}
+
+// MaxEntryBytes limits the number of bytes that a single entry of an
+// archive may contain once decompressed; if it contains more, a LimitError
+// is returned.
+func MaxEntryBytes(n int64) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.maxEntryBytes = n
+	})
+}
+
+// MaxTotalBytes limits the number of bytes that may be decompressed in
+// total. For archive operations, this is the sum of the sizes of the
+// entries read; for a Decompressor, it is the size of the decompressed
+// stream. If more is decompressed, a LimitError is returned.
+func MaxTotalBytes(n int64) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.maxTotalBytes = n
+	})
+}
+
+// limiter enforces the limits set in archiveOptions.
+// All methods are safe to call on a nil limiter.
+type limiter struct {
+	opts    *archiveOptions
+	entries int
+	total   int64
+}
+
+// newLimiter returns a limiter if o contains any limits, and nil otherwise.
+func newLimiter(o *archiveOptions) *limiter {
+	if o.maxEntries <= 0 && o.maxEntryBytes <= 0 && o.maxTotalBytes <= 0 {
+		return nil
+	}
+	return &limiter{opts: o}
+}
+
+// entry records that another entry has been found.
+func (l *limiter) entry() error {
+	if l == nil {
+		return nil
+	}
+	l.entries++
+	if max := l.opts.maxEntries; max > 0 && l.entries > max {
+		return LimitError{"MaxEntries", int64(max)}
+	}
+	return nil
+}
+
+// reader returns r, from which the contents of the entry described by hdr
+// are read, wrapped so that reading fails once the limits are exceeded.
+func (l *limiter) reader(hdr *tar.Header, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitReader{r: r, l: l, size: hdr.Size}
+}
+
+// limitReader counts the bytes read from the current entry.
+type limitReader struct {
+	r    io.Reader
+	l    *limiter
+	size int64
+	n    int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	// The size in the header may be a lie, but if it exceeds the limit,
+	// there is no need to read any further.
+	if max := lr.l.opts.maxEntryBytes; max > 0 && lr.size > max {
+		return 0, LimitError{"MaxEntryBytes", max}
+	}
+
+	n, err := lr.r.Read(p)
+	lr.n += int64(n)
+	lr.l.total += int64(n)
+	if max := lr.l.opts.maxEntryBytes; max > 0 && lr.n > max {
+		return n, LimitError{"MaxEntryBytes", max}
+	}
+	if max := lr.l.opts.maxTotalBytes; max > 0 && lr.l.total > max {
+		return n, LimitError{"MaxTotalBytes", max}
+	}
+	return n, err
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompressorLimit(z *testing.T) {
+	assert := assert.New(z)
+
+	c, err := NewCompressor(testdest + ".gz")
+	assert.Nil(err)
+	defer os.Remove(testdest + ".gz")
+	_, err = c.Write(make([]byte, 8<<20))
+	assert.Nil(err)
+	assert.Nil(c.Close())
+
+	d, err := NewDecompressor(testdest+".gz", MaxTotalBytes(1<<20))
+	assert.Nil(err)
+	defer d.Close()
+	data, err := ioutil.ReadAll(d)
+	assert.Equal(LimitError{"MaxTotalBytes", 1 << 20}, err)
+	assert.True(len(data) < 2<<20, "decompression should stop near the limit")
+}
+
+func TestArchiveLimits(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for _, archive := range testarchives {
+		err = ExtractArchive(archive, dir, MaxEntries(3))
+		assert.Equal(LimitError{"MaxEntries", 3}, err, archive)
+
+		err = ExtractArchive(archive, dir, MaxEntryBytes(20))
+		assert.Equal(LimitError{"MaxEntryBytes", 20}, err, archive)
+
+		err = ExtractArchive(archive, dir, MaxTotalBytes(100))
+		assert.Equal(LimitError{"MaxTotalBytes", 100}, err, archive)
+
+		err = ExtractArchive(archive, dir, MaxEntries(7), MaxEntryBytes(64), MaxTotalBytes(213))
+		assert.Nil(err, archive)
+
+		_, err = ReadFileFromArchive(archive, "dir1/file1", MaxEntryBytes(19))
+		assert.Nil(err, "only the entry read counts", archive)
+
+		_, err = TarFS(archive, MaxTotalBytes(200))
+		assert.Equal(LimitError{"MaxTotalBytes", 200}, err, archive)
+	}
+}
+
+func TestArchiveLimitsSymlink(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// The target of a symlink in a zip archive is its contents, which are
+	// not read into memory beyond the length of a path.
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fh := &zip.FileHeader{Name: "link", Method: zip.Deflate}
+	fh.SetMode(os.ModeSymlink | 0777)
+	w, err := zw.CreateHeader(fh)
+	assert.Nil(err)
+	w.Write(bytes.Repeat([]byte("x"), 1<<20))
+	assert.Nil(zw.Close())
+	archive := filepath.Join(dir, "bomb.zip")
+	assert.Nil(ioutil.WriteFile(archive, buf.Bytes(), 0644))
+
+	_, err = ListArchive(archive, MaxEntryBytes(1<<10))
+	assert.EqualError(err, "link: symlink target is longer than 4096 bytes")
+}
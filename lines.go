@@ -0,0 +1,70 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// utf8BOM is the UTF-8 encoding of the byte order mark.
+const utf8BOM = "\xef\xbb\xbf"
+
+// ReadLines returns the lines of the file at path, as with ForEachLine.
+func ReadLines(path string, opts ...LineOption) ([]string, error) {
+	var lines []string
+	err := ForEachLine(path, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}, opts...)
+	return lines, err
+}
+
+// ForEachLine calls fn for each line of the file at path, without the line
+// ending, which may be "\n" or "\r\n". Unlike with bufio.Scanner, lines may
+// be of any length. The last line need not end in a newline, and an empty
+// file has no lines. With StripBOM, a UTF-8 byte order mark at the start of
+// the file is removed.
+//
+// If fn returns an error, no more lines are read and the error is returned.
+func ForEachLine(path string, fn func(line string) error, opts ...LineOption) error {
+	var o lineOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return forEachLine(f, fn, o.stripBOM)
+}
+
+// forEachLine calls fn for each line read from r, as ForEachLine does.
+func forEachLine(r io.Reader, fn func(line string) error, stripBOM bool) error {
+	br := bufio.NewReaderSize(r, bufferSize)
+	for first := true; ; first = false {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if line == "" && err == io.EOF {
+			return nil
+		}
+		if first && stripBOM {
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		if ferr := fn(line); ferr != nil {
+			return ferr
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadLines(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+
+	long := strings.Repeat("x", 1<<20)
+	for _, tc := range []struct {
+		data     string
+		opts     []LineOption
+		expected []string
+	}{
+		{"", nil, nil},
+		{"\n", nil, []string{""}},
+		{"a\nb\n", nil, []string{"a", "b"}},
+		{"a\r\nb\r\n\r\nc", nil, []string{"a", "b", "", "c"}},
+		{"a\rb\n", nil, []string{"a\rb"}},
+		{"\xef\xbb\xbfa\n", nil, []string{"\xef\xbb\xbfa"}},
+		{"\xef\xbb\xbfa\n\xef\xbb\xbfb", []LineOption{StripBOM()}, []string{"a", "\xef\xbb\xbfb"}},
+		{long + "\n" + long, nil, []string{long, long}},
+	} {
+		assert.Nil(ioutil.WriteFile(file, []byte(tc.data), 0644))
+		lines, err := ReadLines(file, tc.opts...)
+		assert.Nil(err)
+		assert.Equal(tc.expected, lines)
+	}
+
+	stop := errors.New("stop")
+	assert.Nil(ioutil.WriteFile(file, []byte("a\nb\nc\n"), 0644))
+	var lines []string
+	err = ForEachLine(file, func(line string) error {
+		lines = append(lines, line)
+		if line == "b" {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(stop, err)
+	assert.Equal([]string{"a", "b"}, lines)
+
+	_, err = ReadLines(filepath.Join(dir, "missing"))
+	assert.True(os.IsNotExist(err))
+}
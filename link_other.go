@@ -0,0 +1,16 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package osutil
+
+import "os"
+
+// hardlinkID reports no hard links, as they are not detected on this
+// platform.
+func hardlinkID(fi os.FileInfo) (id fileID, ok bool) {
+	return fileID{}, false
+}
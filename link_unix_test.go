@@ -0,0 +1,54 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package osutil
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateArchiveHardlinks(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = ExtractArchive("testdata/dir_reader_data.tar", src)
+	assert.Nil(err)
+	err = os.Link(filepath.Join(src, "dir1/file1"), filepath.Join(src, "dir2/link1"))
+	assert.Nil(err)
+
+	archive := filepath.Join(dir, "out.tar")
+	err = CreateArchive(archive, src)
+	assert.Nil(err)
+	entries, err := ListArchive(archive)
+	assert.Nil(err)
+	links := 0
+	for _, e := range entries {
+		if e.Type == tar.TypeLink {
+			links++
+			assert.Equal("dir2/link1", e.Name)
+			assert.Equal("dir1/file1", e.Linkname)
+		}
+	}
+	assert.Equal(1, links)
+
+	dest := filepath.Join(dir, "dest")
+	err = ExtractArchive(archive, dest)
+	assert.Nil(err)
+	same, err := SameFile(filepath.Join(dest, "dir1/file1"), filepath.Join(dest, "dir2/link1"))
+	assert.Nil(err)
+	assert.True(same, "hardlinks should be restored")
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// errWouldBlock is returned by lockFile if the lock is held elsewhere.
+var errWouldBlock = errors.New("lock is held by another process")
+
+// errNotLocked is returned by FileLock.Unlock if the lock is not held.
+var errNotLocked = errors.New("file lock is not held")
+
+// Intervals at which LockContext and RLockContext retry to take a lock.
+const (
+	minLockRetry = 5 * time.Millisecond
+	maxLockRetry = 200 * time.Millisecond
+)
+
+// FileLock is an advisory lock on a file, which can be used to serialize
+// access to shared resources among several processes. It is built on flock
+// on Unix and on LockFileEx on Windows; processes that do not take the lock
+// are not kept from accessing the file. The file is created if it does not
+// exist, and it is not removed after the lock is released, as that would
+// allow two processes to hold locks on different files of the same name.
+//
+// The lock is either exclusive, as taken by Lock, or shared, as taken by
+// RLock. A FileLock can be held only once at a time and is safe for use by
+// several goroutines, but it does not exclude other FileLocks for the same
+// file in the same process on all platforms.
+type FileLock struct {
+	path string
+
+	// mu guards f and locking, which is true while a lock is being taken,
+	// but it is not held while waiting for the lock.
+	mu      sync.Mutex
+	f       *os.File
+	locking bool
+}
+
+// NewFileLock returns an unlocked FileLock for the file at path.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Path returns the path of the locked file.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// Lock takes an exclusive lock, waiting until no other process holds a
+// lock on the file.
+func (l *FileLock) Lock() error {
+	_, err := l.lock(true, true)
+	return err
+}
+
+// RLock takes a shared lock, waiting until no other process holds an
+// exclusive lock on the file.
+func (l *FileLock) RLock() error {
+	_, err := l.lock(false, true)
+	return err
+}
+
+// TryLock takes an exclusive lock if this is possible without waiting, and
+// returns whether it did.
+func (l *FileLock) TryLock() (bool, error) {
+	return l.lock(true, false)
+}
+
+// TryRLock takes a shared lock if this is possible without waiting, and
+// returns whether it did.
+func (l *FileLock) TryRLock() (bool, error) {
+	return l.lock(false, false)
+}
+
+// LockContext is the same as Lock, except that it stops waiting and returns
+// the error of ctx when ctx is done.
+func (l *FileLock) LockContext(ctx context.Context) error {
+	return l.lockContext(ctx, true)
+}
+
+// RLockContext is the same as RLock, except that it stops waiting and
+// returns the error of ctx when ctx is done.
+func (l *FileLock) RLockContext(ctx context.Context) error {
+	return l.lockContext(ctx, false)
+}
+
+// lockContext tries to take the lock until ctx is done. The system calls
+// cannot be interrupted, so the lock is polled in growing intervals.
+func (l *FileLock) lockContext(ctx context.Context, exclusive bool) error {
+	retry := minLockRetry
+	for {
+		if ok, err := l.lock(exclusive, false); ok || err != nil {
+			return err
+		}
+		t := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+		if retry *= 2; retry > maxLockRetry {
+			retry = maxLockRetry
+		}
+	}
+}
+
+// lock opens the file and locks it, if it can do so without waiting or if
+// block is true. While it waits, calls from other goroutines fail as if
+// the lock were held.
+func (l *FileLock) lock(exclusive, block bool) (bool, error) {
+	l.mu.Lock()
+	if l.f != nil || l.locking {
+		l.mu.Unlock()
+		return false, &os.PathError{Op: "lock", Path: l.path, Err: errors.New("file lock is already held")}
+	}
+	l.locking = true
+	l.mu.Unlock()
+
+	f, err := l.lockFile(exclusive, block)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.locking = false
+	if f == nil {
+		return false, err
+	}
+	l.f = f
+	return true, nil
+}
+
+// lockFile opens the file and locks it for lock. If the lock cannot be
+// taken without waiting and block is false, it returns neither a file nor
+// an error.
+func (l *FileLock) lockFile(exclusive, block bool) (*os.File, error) {
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive, block); err != nil {
+		f.Close()
+		if err == errWouldBlock {
+			return nil, nil
+		}
+		return nil, &os.PathError{Op: "lock", Path: l.path, Err: err}
+	}
+	return f, nil
+}
+
+// Unlock releases the lock.
+func (l *FileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return &os.PathError{Op: "unlock", Path: l.path, Err: errNotLocked}
+	}
+	err := unlockFile(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	l.f = nil
+	if err != nil {
+		return &os.PathError{Op: "unlock", Path: l.path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package osutil
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile returns an error, as files cannot be locked on this platform.
+func lockFile(f *os.File, exclusive, block bool) error {
+	return errors.New("file locking is not supported on this platform")
+}
+
+// unlockFile does nothing, as lockFile never locks files.
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileLock(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Locks with flock conflict even within a process, as long as the file
+	// is opened separately.
+	path := filepath.Join(dir, "lock")
+	a, b := NewFileLock(path), NewFileLock(path)
+	assert.Equal(path, a.Path())
+	assert.Nil(a.Lock())
+	assert.NotNil(a.Lock())
+	ok, err := b.TryLock()
+	assert.Nil(err)
+	assert.False(ok)
+	ok, err = b.TryRLock()
+	assert.Nil(err)
+	assert.False(ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, b.LockContext(ctx))
+
+	// A waiting lock is taken once the lock is released.
+	done := make(chan error)
+	go func() {
+		done <- b.LockContext(context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(a.Unlock())
+	assert.Nil(<-done)
+	assert.Nil(b.Unlock())
+	assert.NotNil(b.Unlock())
+
+	// While a blocking Lock waits, other calls on the same FileLock return
+	// at once instead of waiting as well.
+	assert.Nil(a.Lock())
+	go func() {
+		done <- b.Lock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	_, err = b.TryLock()
+	assert.NotNil(err)
+	_, err = b.TryRLock()
+	assert.NotNil(err)
+	assert.True(time.Since(start) < time.Second, "TryLock should not wait")
+	assert.Nil(a.Unlock())
+	assert.Nil(<-done)
+	assert.Nil(b.Unlock())
+
+	// Shared locks only exclude exclusive locks.
+	assert.Nil(a.RLock())
+	ok, err = b.TryRLock()
+	assert.Nil(err)
+	assert.True(ok)
+	c := NewFileLock(path)
+	ok, err = c.TryLock()
+	assert.Nil(err)
+	assert.False(ok)
+	assert.Nil(a.Unlock())
+	assert.Nil(b.Unlock())
+	ok, err = c.TryLock()
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Nil(c.Unlock())
+
+	_, err = NewFileLock(filepath.Join(dir, "missing/lock")).TryLock()
+	assert.NotNil(err)
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteMtree writes a specification of the directory tree at dir to w, in
+// the mtree format that VerifyArchive and VerifyDirManifest understand, as
+// written by `bsdtar --format=mtree`. For each file, its path relative to
+// dir, type, mode, and, depending on its type, its size and SHA-256 digest
+// or the target of the symlink are recorded. Files are listed in lexical
+// order; modification times and owners are not recorded.
+func WriteMtree(w io.Writer, dir string) error {
+	summaries, err := summarizeDir(dir)
+	if err != nil {
+		return err
+	}
+	return writeMtree(w, summaries)
+}
+
+// WriteArchiveMtree is the same as WriteMtree, except that it describes the
+// entries of the (compressed) archive. Archive formats supported are the
+// same as for ReadFileFromArchive.
+func WriteArchiveMtree(w io.Writer, archive string) error {
+	summaries, _, err := summarizeArchive(archive, nil)
+	if err != nil {
+		return err
+	}
+	return writeMtree(w, summaries)
+}
+
+// VerifyDirManifest checks the directory tree at dir against the manifest
+// file, which can be an mtree specification, possibly gzip-compressed, or
+// a sha256sums file, as with VerifyArchiveManifest. Paths in the manifest
+// are relative to dir. If files do not match the manifest, a VerifyError
+// is returned; files that are not listed in the manifest are not checked.
+func VerifyDirManifest(dir, manifest string) error {
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return err
+	}
+	summaries, err := summarizeDir(dir)
+	if err != nil {
+		return err
+	}
+	return verifyManifest(summaries, data)
+}
+
+// summarizeDir returns a summary of each file in the directory tree at dir,
+// indexed by its path relative to dir, with forward slashes.
+func summarizeDir(dir string) (map[string]entrySummary, error) {
+	summaries := make(map[string]entrySummary)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		mode := fi.Mode()
+		s := entrySummary{mode: mode}
+		switch {
+		case mode.IsRegular():
+			s.typ, s.size = tar.TypeReg, fi.Size()
+			sum, err := hashFile(path, sha256.New())
+			if err != nil {
+				return err
+			}
+			copy(s.sum[:], sum)
+		case mode.IsDir():
+			s.typ = tar.TypeDir
+		case mode&os.ModeSymlink != 0:
+			s.typ = tar.TypeSymlink
+			if s.linkname, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case mode&os.ModeNamedPipe != 0:
+			s.typ = tar.TypeFifo
+		case mode&os.ModeCharDevice != 0:
+			s.typ = tar.TypeChar
+		case mode&os.ModeDevice != 0:
+			s.typ = tar.TypeBlock
+		default:
+			// Sockets and other files cannot be described.
+			return nil
+		}
+		summaries[filepath.ToSlash(rel)] = s
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// mtreeTypes contains the mtree names of the entry types.
+var mtreeTypes = map[byte]string{
+	tar.TypeReg:     "file",
+	tar.TypeDir:     "dir",
+	tar.TypeSymlink: "link",
+	tar.TypeFifo:    "fifo",
+	tar.TypeChar:    "char",
+	tar.TypeBlock:   "block",
+}
+
+// writeMtree writes the mtree specification of the summarized entries,
+// sorted by name, to w.
+func writeMtree(w io.Writer, summaries map[string]entrySummary) error {
+	names := make([]string, 0, len(summaries))
+	byName := make(map[string]entrySummary, len(summaries))
+	for name, s := range summaries {
+		name = cleanEntryName(name)
+		if _, ok := mtreeTypes[s.typ]; !ok || name == "" {
+			continue
+		}
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = s
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("#mtree\n")
+	for _, name := range names {
+		s := byName[name]
+		fmt.Fprintf(bw, "./%s type=%s mode=%s", escapeMtree(name), mtreeTypes[s.typ], strconv.FormatUint(uint64(s.mode.Perm()), 8))
+		switch s.typ {
+		case tar.TypeReg:
+			fmt.Fprintf(bw, " size=%d sha256digest=%s", s.size, hex.EncodeToString(s.sum[:]))
+		case tar.TypeSymlink:
+			fmt.Fprintf(bw, " link=%s", escapeMtree(s.linkname))
+		}
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// escapeMtree replaces the characters that cannot appear in mtree paths,
+// such as spaces, with octal escapes, which unescapeMtree reverses.
+func escapeMtree(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '\\' || c == '#' || c == '=' {
+			fmt.Fprintf(&b, "\\%03o", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
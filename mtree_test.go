@@ -0,0 +1,84 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMtree(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	tree := filepath.Join(dir, "tree")
+	assert.Nil(os.MkdirAll(filepath.Join(tree, "bin"), 0755))
+	assert.Nil(ioutil.WriteFile(filepath.Join(tree, "bin/tool"), []byte("#!/bin/sh\n"), 0755))
+	assert.Nil(ioutil.WriteFile(filepath.Join(tree, "with space"), []byte("abc"), 0600))
+	assert.Nil(os.Symlink("tool", filepath.Join(tree, "bin/alias")))
+
+	var buf bytes.Buffer
+	assert.Nil(WriteMtree(&buf, tree))
+	assert.Equal(`#mtree
+./bin type=dir mode=755
+./bin/alias type=link mode=777 link=tool
+./bin/tool type=file mode=755 size=10 sha256digest=`+sha256hex("#!/bin/sh\n")+`
+./with\040space type=file mode=600 size=3 sha256digest=`+sha256hex("abc")+`
+`, buf.String())
+
+	manifest := filepath.Join(dir, "mtree")
+	assert.Nil(ioutil.WriteFile(manifest, buf.Bytes(), 0644))
+	assert.Nil(VerifyDirManifest(tree, manifest))
+
+	assert.Nil(ioutil.WriteFile(filepath.Join(tree, "bin/tool"), []byte("#!/bin/bash\n"), 0755))
+	assert.Nil(os.Remove(filepath.Join(tree, "with space")))
+	assert.Equal(VerifyError{
+		Mismatched: []string{"bin/tool"},
+		Missing:    []string{"with space"},
+	}, VerifyDirManifest(tree, manifest))
+}
+
+func TestWriteArchiveMtree(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "links.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "./bin/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "./bin/tool", Typeflag: tar.TypeReg, Mode: 0755}, "#!/bin/sh\n"},
+		{tar.Header{Name: "./bin/copy", Typeflag: tar.TypeLink, Linkname: "./bin/tool", Mode: 0755}, ""},
+	})
+	assert.Nil(err)
+
+	var buf bytes.Buffer
+	assert.Nil(WriteArchiveMtree(&buf, archive))
+	digest := sha256hex("#!/bin/sh\n")
+	assert.Equal(`#mtree
+./bin type=dir mode=755
+./bin/copy type=file mode=755 size=10 sha256digest=`+digest+`
+./bin/tool type=file mode=755 size=10 sha256digest=`+digest+`
+`, buf.String())
+
+	manifest := filepath.Join(dir, "mtree")
+	assert.Nil(ioutil.WriteFile(manifest, buf.Bytes(), 0644))
+	assert.Nil(VerifyArchiveManifest(archive, manifest))
+
+	// The specification of the archive matches the extracted tree.
+	tree := filepath.Join(dir, "tree")
+	assert.Nil(ExtractArchive(archive, tree))
+	assert.Nil(VerifyDirManifest(tree, manifest))
+}
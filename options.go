@@ -0,0 +1,758 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"os"
+	"time"
+)
+
+// Option configures the behavior of archive operations, such as
+// ExtractArchive. Other operations have option types of their own, such as
+// FileOption for CopyFile; options that configure both, such as
+// PreserveTimes, can be given to either.
+type Option interface {
+	applyArchive(o *archiveOptions)
+}
+
+// archiveOption is an Option that only configures archive operations.
+type archiveOption func(*archiveOptions)
+
+func (f archiveOption) applyArchive(o *archiveOptions) { f(o) }
+
+// archiveOptions contains the settings that can be changed with Option.
+type archiveOptions struct {
+	preserveOptions
+	treeOptions
+
+	unsafePaths bool
+	unsafeLinks bool
+	xattrs      bool
+	sparse      bool
+	keep        bool
+	strip       int
+	determ      bool
+	winNames    bool
+	ignoreCase  bool
+	ignoreDot   bool
+	progress    func(p Progress)
+	filter      func(hdr *tar.Header) bool
+
+	parallelGzip  bool
+	gzipBlockSize int
+	gzipBlocks    int
+	threads       int
+	password      string
+
+	level      int
+	hasLevel   bool
+	windowSize int
+	rsyncable  bool
+	seekFrame  int
+	volumeSize int64
+
+	maxEntries    int
+	maxEntryBytes int64
+	maxTotalBytes int64
+	tolerant      bool
+	workers       int
+}
+
+// newArchiveOptions returns the default options with opts applied.
+func newArchiveOptions(opts []Option) *archiveOptions {
+	o := &archiveOptions{}
+	for _, opt := range opts {
+		opt.applyArchive(o)
+	}
+	return o
+}
+
+// FileOption configures the behavior of operations that copy, move, or
+// write files, such as CopyFile, MoveFile, and WriteFileAtomic.
+type FileOption interface {
+	applyFile(o *fileOptions)
+}
+
+// fileOption is a FileOption that only configures file operations.
+type fileOption func(*fileOptions)
+
+func (f fileOption) applyFile(o *fileOptions) { f(o) }
+
+// fileOptions contains the settings that can be changed with FileOption.
+type fileOptions struct {
+	preserveOptions
+
+	mode         os.FileMode
+	hasMode      bool
+	skipExisting bool
+	collect      bool
+	reflink      ReflinkMode
+	backup       BackupMode
+	backupSuffix string
+}
+
+// newFileOptions returns the default options with opts applied.
+func newFileOptions(opts []FileOption) *fileOptions {
+	o := &fileOptions{}
+	for _, opt := range opts {
+		opt.applyFile(o)
+	}
+	return o
+}
+
+// PreserveOption is an option that configures both archive operations and
+// file operations, such as ExtractArchive and CopyFile.
+type PreserveOption interface {
+	Option
+	FileOption
+}
+
+// preserveOptions contains the settings that can be changed with
+// PreserveOption.
+type preserveOptions struct {
+	perms bool
+	owner bool
+	times bool
+}
+
+// preserveOption is the implementation of PreserveOption.
+type preserveOption func(*preserveOptions)
+
+func (f preserveOption) applyArchive(o *archiveOptions) { f(&o.preserveOptions) }
+func (f preserveOption) applyFile(o *fileOptions)       { f(&o.preserveOptions) }
+
+// WalkOption configures the behavior of Walk and WalkChan.
+type WalkOption interface {
+	applyWalk(o *walkOptions)
+}
+
+// walkOption is a WalkOption that only configures Walk.
+type walkOption func(*walkOptions)
+
+func (f walkOption) applyWalk(o *walkOptions) { f(o) }
+
+// walkOptions contains the settings that can be changed with WalkOption.
+type walkOptions struct {
+	treeOptions
+
+	maxDepth    int
+	hasMaxDepth bool
+	onlyFiles   bool
+	onlyDirs    bool
+	unsorted    bool
+}
+
+// newWalkOptions returns the default options with opts applied.
+func newWalkOptions(opts []WalkOption) *walkOptions {
+	o := &walkOptions{}
+	for _, opt := range opts {
+		opt.applyWalk(o)
+	}
+	return o
+}
+
+// TreeOption is an option that configures both archive operations and
+// Walk, such as CreateArchive and Walk.
+type TreeOption interface {
+	Option
+	WalkOption
+}
+
+// treeOptions contains the settings that can be changed with TreeOption.
+type treeOptions struct {
+	follow  bool
+	include []string
+	exclude []string
+}
+
+// treeOption is the implementation of TreeOption.
+type treeOption func(*treeOptions)
+
+func (f treeOption) applyArchive(o *archiveOptions) { f(&o.treeOptions) }
+func (f treeOption) applyWalk(o *walkOptions)       { f(&o.treeOptions) }
+
+// UsageOption configures the behavior of DiskUsage.
+type UsageOption interface {
+	applyUsage(o *usageOptions)
+}
+
+// usageOptions contains the settings that can be changed with UsageOption.
+type usageOptions struct {
+	workers int
+}
+
+// AllowUnsafePaths lets ExtractArchive write entries whose names are
+// absolute or escape the destination directory through "..". Only use this
+// for archives you trust.
+func AllowUnsafePaths() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.unsafePaths = true
+	})
+}
+
+// AllowUnsafeLinks lets ExtractArchive create symlinks and hardlinks whose
+// targets are absolute or lie outside of the destination directory.
+// Only use this for archives you trust.
+func AllowUnsafeLinks() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.unsafeLinks = true
+	})
+}
+
+// StripComponents lets ExtractArchive remove the first n components from
+// the names of entries, like the --strip-components flag of tar. Entries
+// with no more than n components, such as the top-level directory, are
+// skipped. The targets of hardlinks are stripped likewise, whereas the
+// targets of symlinks are left as they are.
+func StripComponents(n int) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.strip = n
+	})
+}
+
+// Deterministic lets CreateArchive write archives that only depend on the
+// names, contents, and modes of the files, so that identical inputs yield
+// byte-identical archives, as needed for reproducible builds. Owners are
+// set to root, and modification times are set to the time given by the
+// SOURCE_DATE_EPOCH environment variable, or the Unix epoch if it is not
+// set; newer times are clamped to it. Entries are always written in
+// lexical order.
+func Deterministic() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.determ = true
+	})
+}
+
+// SeekableZstd lets NewCompressor and CreateArchive write zstd output in
+// the seekable format, which consists of independent frames that each
+// contain frameSize bytes of the data, followed by a seek table. Such
+// output can be read by any zstd decoder, but it can also be read at any
+// offset with a SeekableZstdReader, at the cost of slightly worse
+// compression. A frameSize of 1 MiB or more is a good choice.
+func SeekableZstd(frameSize int) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.seekFrame = frameSize
+	})
+}
+
+// VolumeSize lets NewCompressor and CreateArchive split their output into
+// volumes of at most n bytes, as with NewVolumeWriter. The volumes of an
+// archive foo.tar.zst are named foo.tar.zst.001, foo.tar.zst.002, and so
+// on. Functions that read archives, such as ExtractArchive, read all
+// volumes when given the name of the first one, except for zip and 7z
+// archives.
+func VolumeSize(n int64) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.volumeSize = n
+	})
+}
+
+// Include lets ExtractArchive, CreateArchive, and Walk only process entries
+// that match at least one of the patterns. Patterns use the syntax of
+// path.Match and are matched against entry names without any leading "./"
+// or trailing slash. A pattern also matches all entries below the
+// directories that it matches, so that "etc" includes "etc/passwd".
+// Include may be given more than once.
+//
+// When extracting, patterns are matched against the names in the archive,
+// before StripComponents is applied. When walking, they are matched against
+// the paths relative to the root, with forward slashes.
+func Include(patterns ...string) TreeOption {
+	return treeOption(func(o *treeOptions) {
+		o.include = append(o.include, patterns...)
+	})
+}
+
+// Exclude lets ExtractArchive, CreateArchive, and Walk skip entries that
+// match any of the patterns, which are interpreted like those of Include.
+// Exclude takes precedence over Include.
+func Exclude(patterns ...string) TreeOption {
+	return treeOption(func(o *treeOptions) {
+		o.exclude = append(o.exclude, patterns...)
+	})
+}
+
+// Filter lets ExtractArchive and CreateArchive only process entries for
+// which fn returns true, in addition to any Include and Exclude patterns.
+func Filter(fn func(hdr *tar.Header) bool) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.filter = fn
+	})
+}
+
+// WindowsSafeNames lets ExtractArchive map entry names with WindowsSafeName
+// on any platform, which is useful when extracting to a file system that
+// is shared with Windows. On Windows, names are always mapped.
+func WindowsSafeNames() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.winNames = true
+	})
+}
+
+// IgnoreCase lets ReadFileFromArchive and ReadFileFromTar match entry names
+// regardless of case, as defined by strings.EqualFold.
+func IgnoreCase() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.ignoreCase = true
+	})
+}
+
+// IgnoreDotSlash lets ReadFileFromArchive and ReadFileFromTar ignore any
+// leading "./" of entry names and of the name looked for, so that
+// "./control" and "control" match each other.
+func IgnoreDotSlash() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.ignoreDot = true
+	})
+}
+
+// PreservePermissions lets ExtractArchive set the modes of extracted files
+// and directories exactly as recorded in the archive, including the setuid,
+// setgid, and sticky bits, and regardless of the umask.
+// It also lets SanitizeHeader keep the setuid and setgid bits, and CopyFile
+// copy the setuid, setgid, and sticky bits.
+func PreservePermissions() PreserveOption {
+	return preserveOption(func(o *preserveOptions) {
+		o.perms = true
+	})
+}
+
+// PreserveOwner lets ExtractArchive set the owner and group of extracted
+// entries to the uid and gid recorded in the archive, and CopyFile those of
+// the copy to the ones of the original. This only has an effect when
+// running as root.
+func PreserveOwner() PreserveOption {
+	return preserveOption(func(o *preserveOptions) {
+		o.owner = true
+	})
+}
+
+// PreserveTimes lets ExtractArchive set the access and modification times of
+// extracted files and directories to those recorded in the archive.
+// It also lets CompressFile and DecompressFile give the files they create
+// the modification time of the original, and CopyFile the access and
+// modification times.
+func PreserveTimes() PreserveOption {
+	return preserveOption(func(o *preserveOptions) {
+		o.times = true
+	})
+}
+
+// Mode lets CopyFile set the permissions of the copy to mode, instead of
+// copying the permissions of the original.
+func Mode(mode os.FileMode) FileOption {
+	return fileOption(func(o *fileOptions) {
+		o.mode = mode
+		o.hasMode = true
+	})
+}
+
+// ReflinkMode determines whether CopyFile clones files, as with Reflink.
+type ReflinkMode int
+
+const (
+	// ReflinkAuto clones files where possible and copies them otherwise.
+	ReflinkAuto ReflinkMode = iota
+
+	// ReflinkAlways clones files and fails where this is not possible.
+	ReflinkAlways
+
+	// ReflinkNever always copies the data of files.
+	ReflinkNever
+)
+
+// Reflink lets CopyFile and CopyDir clone files according to mode, like
+// the --reflink flag of cp. The default is ReflinkAuto.
+func Reflink(mode ReflinkMode) FileOption {
+	return fileOption(func(o *fileOptions) {
+		o.reflink = mode
+	})
+}
+
+// BackupMode determines whether and how files are backed up before they
+// are overwritten, as with Backup.
+type BackupMode int
+
+const (
+	// BackupNone overwrites files without backing them up.
+	BackupNone BackupMode = iota
+
+	// BackupSimple moves a file to its name with the backup suffix appended,
+	// replacing any earlier backup.
+	BackupSimple
+
+	// BackupNumbered moves a file to its name with ".~N~" appended, where N
+	// is one more than the highest number of its existing backups.
+	BackupNumbered
+
+	// BackupExisting makes numbered backups of files that already have
+	// numbered backups and simple backups of the others.
+	BackupExisting
+)
+
+// Backup lets CopyFile, CopyDir, MoveFile, and WriteFileAtomic back up the
+// files that they overwrite according to mode, like the --backup flag of
+// cp. The default is BackupNone.
+func Backup(mode BackupMode) FileOption {
+	return fileOption(func(o *fileOptions) {
+		o.backup = mode
+	})
+}
+
+// BackupSuffix sets the suffix of simple backups made with Backup, which is
+// "~" by default; another common choice is ".bak".
+func BackupSuffix(suffix string) FileOption {
+	return fileOption(func(o *fileOptions) {
+		o.backupSuffix = suffix
+	})
+}
+
+// SkipExisting lets CopyDir leave files that already exist in the
+// destination as they are, instead of overwriting them.
+func SkipExisting() FileOption {
+	return fileOption(func(o *fileOptions) {
+		o.skipExisting = true
+	})
+}
+
+// CollectErrors lets CopyDir continue after errors and report all of them
+// at the end in a CopyError.
+func CollectErrors() FileOption {
+	return fileOption(func(o *fileOptions) {
+		o.collect = true
+	})
+}
+
+// TempOption configures the behavior of TempFile and TempDir.
+type TempOption func(*tempOptions)
+
+// tempOptions contains the settings that can be changed with TempOption.
+type tempOptions struct {
+	removeOnExit bool
+}
+
+// RemoveOnExit lets TempFile and TempDir register the files they create
+// for removal by RemoveTempFiles, which the program must call before it
+// exits.
+func RemoveOnExit() TempOption {
+	return func(o *tempOptions) {
+		o.removeOnExit = true
+	}
+}
+
+// KeepOriginal lets CompressFile and DecompressFile keep the original file,
+// like the -k flag of gzip, instead of removing it.
+func KeepOriginal() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.keep = true
+	})
+}
+
+// PreserveXattrs lets ExtractArchive restore extended attributes, such as
+// file capabilities and security labels, from the SCHILY.xattr PAX records
+// in the archive, and lets CreateArchive store them. Extended attributes
+// are currently only supported on Linux and are ignored elsewhere.
+func PreserveXattrs() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.xattrs = true
+	})
+}
+
+// Sparse lets CreateArchive store files that contain holes as sparse files,
+// so that the holes do not take up space in the archive. Holes are only
+// detected on Linux. Sparse files are always extracted as such by
+// ExtractArchive.
+func Sparse() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.sparse = true
+	})
+}
+
+// FollowSymlinks lets CreateArchive store the files that symlinks point to
+// instead of the symlinks themselves, like the -h flag of tar. Symlinks to
+// directories are stored as directories with the contents of their
+// targets, unless the target contains the symlink, which would lead to a
+// loop; these are stored as symlinks. Broken symlinks result in an error.
+//
+// It also lets Walk descend into symlinks to directories, which are walked
+// as directories, except where this would lead to a loop.
+func FollowSymlinks() TreeOption {
+	return treeOption(func(o *treeOptions) {
+		o.follow = true
+	})
+}
+
+// SymlinkOption configures how SameFile and ChownRecursive treat
+// symlinks.
+type SymlinkOption func(*symlinkOptions)
+
+// symlinkOptions contains the settings that can be changed with
+// SymlinkOption.
+type symlinkOptions struct {
+	noFollow bool
+}
+
+// NoFollowSymlinks lets SameFile compare symlinks themselves instead of
+// their targets, and ChownRecursive change them instead of their targets.
+func NoFollowSymlinks() SymlinkOption {
+	return func(o *symlinkOptions) {
+		o.noFollow = true
+	}
+}
+
+// MaxDepth lets Walk descend at most n levels below the root, which is at
+// depth 0, so that MaxDepth(1) only walks the root and its contents.
+func MaxDepth(n int) WalkOption {
+	return walkOption(func(o *walkOptions) {
+		o.maxDepth = n
+		o.hasMaxDepth = true
+	})
+}
+
+// OnlyFiles lets Walk only call its function for files other than
+// directories, and for errors.
+func OnlyFiles() WalkOption {
+	return walkOption(func(o *walkOptions) {
+		o.onlyFiles = true
+	})
+}
+
+// OnlyDirs lets Walk only call its function for directories, and for
+// errors.
+func OnlyDirs() WalkOption {
+	return walkOption(func(o *walkOptions) {
+		o.onlyDirs = true
+	})
+}
+
+// ReaddirOrder lets Walk visit the contents of directories in the order in
+// which the file system returns them, instead of in lexical order, which
+// is faster for large directories, but not deterministic.
+func ReaddirOrder() WalkOption {
+	return walkOption(func(o *walkOptions) {
+		o.unsorted = true
+	})
+}
+
+// ExpandOption configures the behavior of ExpandPath.
+type ExpandOption func(*expandOptions)
+
+// expandOptions contains the settings that can be changed with
+// ExpandOption.
+type expandOptions struct {
+	strictEnv bool
+}
+
+// StrictEnv lets ExpandPath return an EnvError for references to
+// environment variables that are not set, instead of replacing them with
+// the empty string.
+func StrictEnv() ExpandOption {
+	return func(o *expandOptions) {
+		o.strictEnv = true
+	}
+}
+
+// DirOption configures the behavior of EnsureDir.
+type DirOption func(*dirOptions)
+
+// dirOptions contains the settings that can be changed with DirOption.
+type dirOptions struct {
+	restrict bool
+}
+
+// RestrictPermissions lets EnsureDir remove the permission bits of an
+// existing directory that are not in the permissions it is given.
+func RestrictPermissions() DirOption {
+	return func(o *dirOptions) {
+		o.restrict = true
+	}
+}
+
+// RemoveOption configures the behavior of SafeRemoveAll.
+type RemoveOption func(*removeOptions)
+
+// removeOptions contains the settings that can be changed with
+// RemoveOption.
+type removeOptions struct {
+	minDepth    int
+	hasMinDepth bool
+	allowedRoot string
+	marker      string
+}
+
+// MinRemoveDepth lets SafeRemoveAll refuse to remove paths that are fewer
+// than n directories below the root of the file system, instead of 2, so
+// that MinRemoveDepth(3) refuses "/home/user" but allows "/home/user/tmp".
+func MinRemoveDepth(n int) RemoveOption {
+	return func(o *removeOptions) {
+		o.minDepth = n
+		o.hasMinDepth = true
+	}
+}
+
+// AllowedRoot lets SafeRemoveAll refuse to remove paths that are not
+// inside of the directory root.
+func AllowedRoot(root string) RemoveOption {
+	return func(o *removeOptions) {
+		o.allowedRoot = root
+	}
+}
+
+// RequireMarker lets SafeRemoveAll only remove directories that contain a
+// file with the given name, such as ".cache-dir", which shows that they were
+// created to be removed.
+func RequireMarker(name string) RemoveOption {
+	return func(o *removeOptions) {
+		o.marker = name
+	}
+}
+
+// WatchOption configures the behavior of a Watcher.
+type WatchOption func(*watchOptions)
+
+// watchOptions contains the settings that can be changed with WatchOption.
+type watchOptions struct {
+	debounce time.Duration
+}
+
+// Debounce lets a Watcher wait until there have been no events for a file
+// for the duration d, and then deliver a single event that sums up the
+// changes, instead of each of them.
+func Debounce(d time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.debounce = d
+	}
+}
+
+// LineOption configures the behavior of ReadLines and ForEachLine.
+type LineOption func(*lineOptions)
+
+// lineOptions contains the settings that can be changed with LineOption.
+type lineOptions struct {
+	stripBOM bool
+}
+
+// StripBOM lets ReadLines and ForEachLine remove a UTF-8 byte order mark
+// from the start of the file.
+func StripBOM() LineOption {
+	return func(o *lineOptions) {
+		o.stripBOM = true
+	}
+}
+
+// TailOption configures the behavior of Follow.
+type TailOption func(*tailOptions)
+
+// tailOptions contains the settings that can be changed with TailOption.
+type tailOptions struct {
+	lastLines    int
+	pollInterval time.Duration
+}
+
+// LastLines lets Follow start with the last n lines of the file instead
+// of at its end, like the -n flag of tail.
+func LastLines(n int) TailOption {
+	return func(o *tailOptions) {
+		o.lastLines = n
+	}
+}
+
+// PollInterval lets Follow check for new data every d instead of every
+// quarter of a second.
+func PollInterval(d time.Duration) TailOption {
+	return func(o *tailOptions) {
+		o.pollInterval = d
+	}
+}
+
+// AppendOption configures the behavior of AppendToFile.
+type AppendOption func(*appendOptions)
+
+// appendOptions contains the settings that can be changed with
+// AppendOption.
+type appendOptions struct {
+	lock  bool
+	fsync bool
+}
+
+// ExclusiveLock lets AppendToFile take an exclusive lock on the file, like
+// FileLock, while it writes, so that the data of processes that write to
+// the same file at the same time is not interleaved.
+func ExclusiveLock() AppendOption {
+	return func(o *appendOptions) {
+		o.lock = true
+	}
+}
+
+// Fsync lets AppendToFile sync the file to disk before it returns.
+func Fsync() AppendOption {
+	return func(o *appendOptions) {
+		o.fsync = true
+	}
+}
+
+// ParallelGzip lets gzip-compressed archives be decompressed by a separate
+// goroutine ahead of reading, which is considerably faster for large
+// archives. The stream is decompressed in blocks of blockSize bytes, of
+// which up to blocks are buffered. Zero values select the defaults of
+// 1 MiB and 4 blocks.
+func ParallelGzip(blockSize, blocks int) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.parallelGzip = true
+		o.gzipBlockSize = blockSize
+		o.gzipBlocks = blocks
+	})
+}
+
+// Threads lets NewCompressor and CreateArchive compress with up to n
+// goroutines, if the format supports it; this is the case for gzip, xz,
+// zstd, and lz4. If n is negative, the number of CPUs is used.
+// Multi-threaded compression produces slightly larger output.
+func Threads(n int) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.threads = n
+	})
+}
+
+// Password lets archive operations read encrypted entries of zip archives,
+// which may be encrypted with either ZipCrypto or AES, and encrypted 7z
+// archives. Entries that are not encrypted are read as usual.
+func Password(password string) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.password = password
+	})
+}
+
+// CompressionLevel sets the compression level used by NewCompressor and
+// CreateArchive. Its meaning depends on the format: for gzip and bzip2, it
+// ranges from 1 (fastest) to 9 (best); for xz, it is the preset from 0 to
+// 9, which determines the dictionary size; for zstd, it is the zstd level
+// from 1 to 22, which is mapped to the nearest supported level; and for
+// lz4, it ranges from 1 to 9, with 0 selecting the fast default.
+func CompressionLevel(level int) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.level = level
+		o.hasLevel = true
+	})
+}
+
+// ZstdWindowSize sets the window size used for zstd compression, which
+// must be a power of two between 1 KiB and 512 MiB. Larger windows find
+// more matches, but need more memory for compression and decompression.
+func ZstdWindowSize(n int) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.windowSize = n
+	})
+}
+
+// GzipRsyncable makes gzip compression rsync-friendly, like the --rsyncable
+// flag of gzip, at the cost of slightly larger output. It disables
+// multi-threaded gzip compression.
+func GzipRsyncable() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.rsyncable = true
+	})
+}
@@ -5,15 +5,36 @@
 package osutil
 
 import (
+	"archive/tar"
 	"bytes"
-	"crypto/md5"
+	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 // CopyFile tries to copy src to dst. If dst already exists, it will be
-// overwritten. If it does not exist, it will be created.
-func CopyFile(src, dst string) (err error) {
+// overwritten. If it does not exist, it will be created. If dst is a
+// directory, FileTypeError is returned and nothing is changed, and if src
+// and dst are the same file, nothing is done.
+//
+// The permissions of src are copied to dst, unless Mode is given, which
+// sets them instead. With PreservePermissions, the setuid, setgid, and
+// sticky bits are copied as well. With PreserveTimes, dst gets the access
+// and modification times of src, and with PreserveOwner, which only has
+// an effect when running as root, its owner and group. With Backup, an
+// existing dst is backed up first, and moved back if copying fails.
+//
+// On file systems that support it, such as Btrfs, XFS, and APFS, dst is
+// created as a copy-on-write clone of src, which is instant and shares the
+// data on disk until either file is changed. If this is not possible, the
+// data is copied, unless Reflink says otherwise. On macOS, only files that
+// do not exist yet can be cloned. On Linux, the data is copied by the
+// kernel with copy_file_range or sendfile, without passing through user
+// space.
+func CopyFile(src, dst string, opts ...FileOption) (err error) {
 	// Make sure that both files are regular.
 	if _, err = FileExists(src); err != nil {
 		return
@@ -21,14 +42,40 @@ func CopyFile(src, dst string) (err error) {
 	if _, err = FileExists(dst); err != nil {
 		return
 	}
+	if same, err := SameFile(src, dst); err != nil || same {
+		return err
+	}
+	o := newFileOptions(opts)
 
 	in, err := os.Open(src)
 	if err != nil {
 		return
 	}
 	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return
+	}
+	backup, err := backupFile(dst, o, false)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			restoreBackup(dst, backup)
+		}
+	}()
+	if o.reflink != ReflinkNever {
+		if err = reflink(in, dst); err == nil {
+			return copyMetadata(dst, fi, o)
+		} else if o.reflink == ReflinkAlways {
+			return
+		}
+	}
 
-	out, err := os.Create(dst)
+	// The file is only accessible to its owner until it has been written,
+	// after which copyMetadata gives it its final mode.
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm()&0600)
 	if err != nil {
 		return
 	}
@@ -37,17 +84,194 @@ func CopyFile(src, dst string) (err error) {
 		if err == nil {
 			err = cerr
 		}
+		if err == nil {
+			err = copyMetadata(dst, fi, o)
+		}
 	}()
-	if _, err = io.Copy(out, in); err != nil {
+	if _, err = copyFileData(out, in); err != nil {
 		return
 	}
 	err = out.Sync()
 	return
 }
 
+// copyMetadata gives the file at path the mode and, as requested by the
+// options o, the times and owner described by fi.
+func copyMetadata(path string, fi os.FileInfo, o *fileOptions) error {
+	if o.owner && os.Geteuid() == 0 {
+		// The tar header provides the owner in a portable way.
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+			return err
+		}
+	}
+
+	mode := fi.Mode() & os.ModePerm
+	if o.perms {
+		mode = fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+	if o.hasMode {
+		mode = o.mode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+
+	if o.times {
+		atime := fi.ModTime()
+		if hdr, err := tar.FileInfoHeader(fi, ""); err == nil && !hdr.AccessTime.IsZero() {
+			atime = hdr.AccessTime
+		}
+		return os.Chtimes(path, atime, fi.ModTime())
+	}
+	return nil
+}
+
+// CopyDir recursively copies the directory tree at src to dst, which is
+// created if it does not exist. If dst already exists, the contents of src
+// are merged into it, and existing files are overwritten, unless
+// SkipExisting is given. Regular files are copied with CopyFile, symlinks
+// are recreated with the same targets, and directories get the permissions
+// of the originals; other files, such as devices, are skipped. Files with
+// several hard links are copied once for each link.
+//
+// By default, CopyDir stops at the first error. With CollectErrors, it
+// copies as much as possible instead and returns a CopyError listing the
+// files that could not be copied. The options PreservePermissions,
+// PreserveTimes, and PreserveOwner apply to files and directories as they
+// do for CopyFile, and Mode only to files.
+func CopyDir(src, dst string, opts ...FileOption) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return FileTypeError{src}
+	}
+	if inside, err := isWithin(dst, src); err != nil {
+		return err
+	} else if inside {
+		return &os.PathError{Op: "copy", Path: dst, Err: errors.New("destination is inside the source")}
+	}
+
+	o := newFileOptions(opts)
+	var errs []error
+	fail := func(err error) error {
+		if o.collect {
+			errs = append(errs, err)
+			return nil
+		}
+		return err
+	}
+
+	// Directories get their metadata after their contents are copied,
+	// which might not be possible otherwise.
+	type dir struct {
+		path string
+		fi   os.FileInfo
+	}
+	var dirs []dir
+	err = filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return fail(err)
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return fail(err)
+		}
+		target := filepath.Join(dst, rel)
+		existing, lerr := os.Lstat(target)
+		exists := lerr == nil
+		if exists && o.skipExisting && !fi.IsDir() {
+			return nil
+		}
+
+		switch mode := fi.Mode(); {
+		case mode.IsDir():
+			if !exists || !existing.IsDir() {
+				if err := os.Mkdir(target, 0700); err != nil {
+					if err := fail(err); err != nil {
+						return err
+					}
+					return filepath.SkipDir
+				}
+			}
+			dirs = append(dirs, dir{target, fi})
+		case mode&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err == nil && exists {
+				err = os.Remove(target)
+			}
+			if err == nil {
+				err = os.Symlink(link, target)
+			}
+			if err != nil {
+				return fail(err)
+			}
+		case mode.IsRegular():
+			// CopyFile would write to the target of a symlink.
+			if exists && existing.Mode()&os.ModeSymlink != 0 {
+				if err := os.Remove(target); err != nil {
+					return fail(err)
+				}
+			}
+			if err := CopyFile(path, target, opts...); err != nil {
+				return fail(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	do := *o
+	do.hasMode = false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := copyMetadata(dirs[i].path, dirs[i].fi, &do); err != nil {
+			if err := fail(err); err != nil {
+				return err
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return CopyError{errs}
+	}
+	return nil
+}
+
+// isWithin returns true if path is dir or inside of dir.
+func isWithin(path, dir string) (bool, error) {
+	apath, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	adir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	rel, err := filepath.Rel(adir, apath)
+	if err != nil {
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)), nil
+}
+
 // MoveFile tries to move src to dst. If dst already exists, it will be
 // overwritten.
-func MoveFile(src, dst string) error {
+//
+// The file is renamed if possible. If src and dst are on different file
+// systems, src is copied to a temporary file next to dst instead, with its
+// permissions, times, and, when running as root, owner; the copy is synced
+// to disk and renamed to dst, and only then is src removed. If copying
+// fails, the temporary file is removed and dst is left as it was. If src
+// cannot be removed, the move is rolled back by removing dst, so that src
+// remains the only copy of the file. With Backup, an existing dst is backed
+// up first, and moved back if the move fails.
+func MoveFile(src, dst string, opts ...FileOption) error {
 	// Make sure that both files are regular.
 	if _, err := FileExists(src); err != nil {
 		return err
@@ -55,16 +279,47 @@ func MoveFile(src, dst string) error {
 	if _, err := FileExists(dst); err != nil {
 		return err
 	}
+	backup, err := backupFile(dst, newFileOptions(opts), false)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(src, dst)
+	if isCrossDevice(err) {
+		err = moveFileCopy(src, dst)
+	}
+	if err != nil {
+		restoreBackup(dst, backup)
+	}
+	return err
+}
 
-	err := os.Rename(src, dst)
+// moveFileCopy moves src to dst by copying it, as described for MoveFile.
+func moveFileCopy(src, dst string) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp")
 	if err != nil {
-		err := CopyFile(src, dst)
+		return err
+	}
+	tmpname := tmp.Name()
+	tmp.Close()
+	defer func() {
 		if err != nil {
-			return err
+			os.Remove(tmpname)
 		}
-		return os.Remove(src)
-	}
+	}()
 
+	// CopyFile syncs the copy before it returns.
+	if err = CopyFile(src, tmpname, PreservePermissions(), PreserveTimes(), PreserveOwner()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpname, dst); err != nil {
+		return err
+	}
+	if err = os.Remove(src); err != nil {
+		// Roll back, so that there are not two copies of the file.
+		os.Remove(dst)
+		return err
+	}
 	return nil
 }
 
@@ -104,66 +359,181 @@ func SameContents(src, dst string) (same bool, err error) {
 	if err != nil || !ex {
 		return false, err
 	}
+	return FilesEqual(src, dst)
+}
 
-	same, err = SameFile(src, dst)
-	if err != nil || same {
-		return same, err
-	}
-
-	// TODO: I could make this more efficient, based on the file size.
-	ssum, err := sumFile(src)
+// FilesEqual returns true if the regular files a and b have the same
+// contents. Files of different sizes are not compared, nor are files that
+// are the same, as determined by os.SameFile; otherwise both files are read
+// in chunks until they differ. If either file is a directory, FileTypeError
+// is returned.
+func FilesEqual(a, b string) (bool, error) {
+	fa, fb, err := statFiles(a, b)
 	if err != nil {
 		return false, err
 	}
-	dsum, err := sumFile(dst)
+	if os.SameFile(fa, fb) {
+		return true, nil
+	}
+	if fa.Size() != fb.Size() {
+		return false, nil
+	}
+	return equalContents(a, b)
+}
+
+// FilesEqualQuick returns true if the regular files a and b have the same
+// size and modification time, like the quick check of rsync, without
+// reading them. This is only meaningful if the modification times of the
+// files are preserved when they are copied, as with PreserveTimes. If either
+// file is a directory, FileTypeError is returned.
+func FilesEqualQuick(a, b string) (bool, error) {
+	fa, fb, err := statFiles(a, b)
 	if err != nil {
 		return false, err
 	}
-	return bytes.Compare(ssum, dsum) == 0, nil
+	return fa.Size() == fb.Size() && fa.ModTime().Equal(fb.ModTime()), nil
 }
 
-// sumFile creates an md5sum of a file
-func sumFile(path string) (sum []byte, err error) {
-	h := md5.New()
-	f, err := os.Open(path)
-	if err != nil {
-		return sum, err
+// statFiles returns the file information of a and b, which must not be
+// directories.
+func statFiles(a, b string) (fa, fb os.FileInfo, err error) {
+	if fa, err = os.Stat(a); err != nil {
+		return nil, nil, err
 	}
-	io.Copy(h, f)
-	return h.Sum(nil), nil
+	if fa.IsDir() {
+		return nil, nil, FileTypeError{a}
+	}
+	if fb, err = os.Stat(b); err != nil {
+		return nil, nil, err
+	}
+	if fb.IsDir() {
+		return nil, nil, FileTypeError{b}
+	}
+	return fa, fb, nil
 }
 
-func SameFile(src, dst string) (same bool, err error) {
-	fs, err := os.Stat(src)
+// equalContents returns true if the files a and b have the same contents.
+func equalContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
 	if err != nil {
 		return false, err
 	}
-	if fs.IsDir() {
-		return false, FileTypeError{src}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
 	}
+	defer fb.Close()
 
-	fd, err := os.Stat(dst)
+	bpa, bpb := bufferPool.Get().(*[]byte), bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(bpa)
+	defer bufferPool.Put(bpb)
+	for {
+		na, erra := io.ReadFull(fa, *bpa)
+		nb, errb := io.ReadFull(fb, *bpb)
+		if !bytes.Equal((*bpa)[:na], (*bpb)[:nb]) {
+			return false, nil
+		}
+		aEnd := erra == io.EOF || erra == io.ErrUnexpectedEOF
+		bEnd := errb == io.EOF || errb == io.ErrUnexpectedEOF
+		if erra != nil && !aEnd {
+			return false, erra
+		}
+		if errb != nil && !bEnd {
+			return false, errb
+		}
+		if aEnd || bEnd {
+			// The files might have changed since their sizes were compared.
+			return aEnd && bEnd, nil
+		}
+	}
+}
+
+// SameFile returns same = true if the paths a and b refer to the same file
+// or directory, as determined by their devices and inodes, or their file
+// IDs on Windows, so that hardlinks of a file are the same. Symlinks are
+// followed, so that a symlink is the same as its target, unless
+// NoFollowSymlinks is given, in which case symlinks are compared themselves.
+// If a cannot be found, its error is returned; if b does not exist, same
+// is false.
+func SameFile(a, b string, opts ...SymlinkOption) (same bool, err error) {
+	var o symlinkOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	stat := os.Stat
+	if o.noFollow {
+		stat = os.Lstat
+	}
+	fa, err := stat(a)
+	if err != nil {
+		return false, err
+	}
+	fb, err := stat(b)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return false, nil
 		}
 		return false, err
 	}
-	if fd.IsDir() {
-		return false, FileTypeError{dst}
-	}
-
-	return os.SameFile(fs, fd), nil
+	return os.SameFile(fa, fb), nil
 }
 
 // Exists returns ex = true if the given file exists, regardless whether
 // it is a file or a directory. Normally you will probably want to use the more
 // specific versions: FileExists and DirectoryExists.
+//
+// Symlinks are followed, so that a broken symlink does not exist; use
+// LExists to find out whether there is anything at path at all.
 func Exists(path string) (ex bool, err error) {
 	ex, _, err = exists(path)
 	return ex, err
 }
 
+// ExistsInfo is the same as Exists, but also returns the FileInfo of the
+// file if it exists, so that it need not be stat'ed again.
+func ExistsInfo(path string) (fi os.FileInfo, ex bool, err error) {
+	ex, fi, err = exists(path)
+	return fi, ex, err
+}
+
+// LExists is the same as Exists, except that symlinks are not followed,
+// so that broken symlinks exist as well.
+func LExists(path string) (ex bool, err error) {
+	_, err = os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// IsSymlink returns true if path is a symlink, regardless of whether its
+// target exists. It is not an error if nothing exists at path.
+func IsSymlink(path string) (bool, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return fi.Mode()&os.ModeSymlink != 0, nil
+}
+
+// IsBrokenSymlink returns true if path is a symlink whose target does not
+// exist, which includes symlinks that point to themselves in a loop. It is
+// not an error if nothing exists at path.
+func IsBrokenSymlink(path string) (bool, error) {
+	link, err := IsSymlink(path)
+	if err != nil || !link {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) || isLoop(err) {
+		return true, nil
+	}
+	return false, err
+}
+
 // FileExists returns ex = true if the file exists and is not
 // a directory, and returns err != nil if any other error occured (such as
 // permission denied).
@@ -190,6 +560,29 @@ func DirExists(path string) (ex bool, err error) {
 	return ex, err
 }
 
+// IsEmptyDir returns true if the directory at path contains no entries.
+// At most one entry is read, so that this is cheap even for very large
+// directories. If path is not a directory, FileTypeError is returned.
+func IsEmptyDir(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !fi.IsDir() {
+		return false, FileTypeError{path}
+	}
+	_, err = f.Readdirnames(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
 // exists does the hard work for Exists, FileExists, and DirExists,
 // returning ex = true if the file given by path exists.
 func exists(path string) (ex bool, stat os.FileInfo, err error) {
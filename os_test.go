@@ -5,8 +5,11 @@
 package osutil
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -29,6 +32,87 @@ func TestFileExists(z *testing.T) {
 	assert.False(ex, "expect file not to exist", testdest)
 }
 
+func TestExistsInfo(z *testing.T) {
+	assert := assert.New(z)
+
+	fi, ex, err := ExistsInfo(testfile)
+	assert.Nil(err)
+	assert.True(ex)
+	if assert.NotNil(fi) {
+		assert.Equal("random_a.dat", fi.Name())
+		assert.False(fi.IsDir())
+	}
+
+	fi, ex, err = ExistsInfo(testdest)
+	assert.Nil(err)
+	assert.False(ex)
+	assert.Nil(fi)
+}
+
+func TestIsEmptyDir(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	empty, err := IsEmptyDir(dir)
+	assert.Nil(err)
+	assert.True(empty)
+
+	file := filepath.Join(dir, "file")
+	assert.Nil(ioutil.WriteFile(file, nil, 0644))
+	empty, err = IsEmptyDir(dir)
+	assert.Nil(err)
+	assert.False(empty)
+
+	_, err = IsEmptyDir(file)
+	assert.Equal(FileTypeError{file}, err)
+	_, err = IsEmptyDir(filepath.Join(dir, "missing"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestSymlinkExists(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	join := func(name string) string { return filepath.Join(dir, name) }
+	assert.Nil(ioutil.WriteFile(join("file"), nil, 0644))
+	assert.Nil(os.Symlink("file", join("link")))
+	assert.Nil(os.Symlink("missing", join("broken")))
+	assert.Nil(os.Symlink("loop", join("loop")))
+
+	for _, tc := range []struct {
+		name                       string
+		exists, lexists, link, bad bool
+	}{
+		{"file", true, true, false, false},
+		{"link", true, true, true, false},
+		{"broken", false, true, true, true},
+		{"loop", false, true, true, true},
+		{"missing", false, false, false, false},
+	} {
+		// Exists fails for symlink loops.
+		if tc.name != "loop" {
+			ex, err := Exists(join(tc.name))
+			assert.Nil(err)
+			assert.Equal(tc.exists, ex, tc.name)
+		}
+		ex, err := LExists(join(tc.name))
+		assert.Nil(err)
+		assert.Equal(tc.lexists, ex, tc.name)
+		link, err := IsSymlink(join(tc.name))
+		assert.Nil(err)
+		assert.Equal(tc.link, link, tc.name)
+		bad, err := IsBrokenSymlink(join(tc.name))
+		assert.Nil(err)
+		assert.Equal(tc.bad, bad, tc.name)
+	}
+}
+
 func TestSameFile(z *testing.T) {
 	assert := assert.New(z)
 
@@ -47,6 +131,33 @@ func TestSameFile(z *testing.T) {
 	same, err = SameFile(testfile, testdest)
 	assert.Nil(err)
 	assert.False(same, "different files with same contents not the same", testfile, testdest)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file, link, hardlink := filepath.Join(dir, "file"), filepath.Join(dir, "link"), filepath.Join(dir, "hardlink")
+	assert.Nil(ioutil.WriteFile(file, nil, 0644))
+	assert.Nil(os.Symlink("file", link))
+	assert.Nil(os.Link(file, hardlink))
+	for _, tc := range []struct {
+		a, b     string
+		opts     []SymlinkOption
+		expected bool
+	}{
+		{file, link, nil, true},
+		{file, link, []SymlinkOption{NoFollowSymlinks()}, false},
+		{link, link, []SymlinkOption{NoFollowSymlinks()}, true},
+		{file, hardlink, []SymlinkOption{NoFollowSymlinks()}, true},
+		{dir, filepath.Join(dir, "."), nil, true},
+		{dir, file, nil, false},
+		{file, filepath.Join(dir, "missing"), nil, false},
+	} {
+		same, err := SameFile(tc.a, tc.b, tc.opts...)
+		assert.Nil(err)
+		assert.Equal(tc.expected, same, tc.a+" "+tc.b)
+	}
+	_, err = SameFile(filepath.Join(dir, "missing"), file)
+	assert.True(os.IsNotExist(err))
 }
 
 func TestSameContents(z *testing.T) {
@@ -69,6 +180,63 @@ func TestSameContents(z *testing.T) {
 	assert.True(same, "copied file same contents", testfile, testdest)
 }
 
+func TestFilesEqual(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Files that only differ after the first chunk or in size.
+	data := make([]byte, 2*bufferSize+1)
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+	assert.Nil(ioutil.WriteFile(a, data, 0644))
+	assert.Nil(ioutil.WriteFile(c, data[:len(data)-1], 0644))
+	data[bufferSize+1] = 1
+	assert.Nil(ioutil.WriteFile(b, data, 0644))
+
+	for _, tc := range []struct {
+		a, b  string
+		equal bool
+	}{
+		{a, a, true},
+		{a, b, false},
+		{a, c, false},
+		{c, a, false},
+		{testfile, testother, false},
+	} {
+		equal, err := FilesEqual(tc.a, tc.b)
+		assert.Nil(err)
+		assert.Equal(tc.equal, equal, tc.a+" "+tc.b)
+	}
+	assert.Nil(CopyFile(b, a))
+	equal, err := FilesEqual(a, b)
+	assert.Nil(err)
+	assert.True(equal)
+
+	// The quick check only looks at sizes and modification times.
+	t := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(ioutil.WriteFile(a, data[:len(data)-1], 0644))
+	for _, path := range []string{a, b, c} {
+		assert.Nil(os.Chtimes(path, t, t))
+	}
+	equal, err = FilesEqualQuick(a, c)
+	assert.Nil(err)
+	assert.True(equal)
+	equal, err = FilesEqualQuick(a, b)
+	assert.Nil(err)
+	assert.False(equal)
+	assert.Nil(os.Chtimes(c, t, t.Add(time.Second)))
+	equal, err = FilesEqualQuick(a, c)
+	assert.Nil(err)
+	assert.False(equal)
+
+	_, err = FilesEqual(a, dir)
+	assert.Equal(FileTypeError{dir}, err)
+	_, err = FilesEqualQuick(filepath.Join(dir, "missing"), a)
+	assert.True(os.IsNotExist(err))
+}
+
 func TestFileCopy(z *testing.T) {
 	assert := assert.New(z)
 
@@ -92,6 +260,247 @@ func TestFileCopy(z *testing.T) {
 	assert.False(same, "second copy should overwrite first")
 }
 
+func TestFileCopyMetadata(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	assert.Nil(ioutil.WriteFile(src, []byte("data"), 0600))
+	assert.Nil(os.Chmod(src, 0750))
+	mtime := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.Nil(os.Chtimes(src, mtime, mtime))
+
+	assert.Nil(CopyFile(src, dst, PreserveTimes()))
+	fi, err := os.Stat(dst)
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0750), fi.Mode().Perm(), "the mode should be copied")
+		assert.True(mtime.Equal(fi.ModTime()), "the modification time should be copied")
+	}
+
+	assert.Nil(CopyFile(src, dst, Mode(0604)))
+	fi, err = os.Stat(dst)
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0604), fi.Mode().Perm(), "the mode should be overridden")
+		assert.False(mtime.Equal(fi.ModTime()))
+	}
+
+	// Copying a file onto itself must not truncate it.
+	assert.Nil(CopyFile(src, src))
+	data, err := ioutil.ReadFile(src)
+	assert.Nil(err)
+	assert.Equal("data", string(data))
+
+	assert.Equal(FileTypeError{dir}, CopyFile(src, dir))
+}
+
+func TestFileCopyReflink(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for _, mode := range []ReflinkMode{ReflinkAuto, ReflinkNever} {
+		dst := filepath.Join(dir, "copy")
+		assert.Nil(CopyFile(testfile, dst, Reflink(mode)))
+		same, err := SameContents(testfile, dst)
+		assert.Nil(err)
+		assert.True(same)
+		assert.Nil(os.Remove(dst))
+	}
+
+	// Whether files can be cloned depends on the file system. If they
+	// cannot, an existing dst is left as it was, and a missing one is not
+	// created.
+	dst := filepath.Join(dir, "clone")
+	assert.Nil(ioutil.WriteFile(dst, []byte("old"), 0644))
+	for _, exists := range []bool{true, false} {
+		if err := CopyFile(testfile, dst, Reflink(ReflinkAlways)); err != nil {
+			assert.IsType(&os.PathError{}, err)
+			data, err := ioutil.ReadFile(dst)
+			want := 0
+			if exists {
+				assert.Nil(err)
+				assert.Equal("old", string(data))
+				want = 1
+			} else {
+				assert.True(os.IsNotExist(err))
+			}
+			names, err := readDirNames(dir)
+			assert.Nil(err)
+			assert.Len(names, want, "no temporary files are left behind")
+		} else {
+			same, err := SameContents(testfile, dst)
+			assert.Nil(err)
+			assert.True(same)
+		}
+		os.Remove(dst)
+	}
+}
+
+func TestFileCopyData(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// The file is larger than the buffers used to copy data, and files that
+	// report no size, like those in /proc, must not come out empty.
+	src := filepath.Join(dir, "large")
+	data := make([]byte, 3*bufferSize+17)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	assert.Nil(ioutil.WriteFile(src, data, 0644))
+	for _, path := range []string{src, "/proc/self/status"} {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		dst := filepath.Join(dir, "copy")
+		assert.Nil(CopyFile(path, dst, Reflink(ReflinkNever)))
+		fi, err := os.Stat(dst)
+		assert.Nil(err)
+		assert.NotZero(fi.Size(), path)
+		if path == src {
+			same, err := SameContents(src, dst)
+			assert.Nil(err)
+			assert.True(same)
+		}
+		assert.Nil(os.Remove(dst))
+	}
+}
+
+func BenchmarkCopyFile(b *testing.B) {
+	dir, err := ioutil.TempDir("", "osutil")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	if err := ioutil.WriteFile(src, make([]byte, 16<<20), 0644); err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(16 << 20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := CopyFile(src, dst, Reflink(ReflinkNever)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMoveFile(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Where available, /dev/shm is usually on another file system.
+	other := dir
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		other, err = ioutil.TempDir("/dev/shm", "osutil")
+		assert.Nil(err)
+		defer os.RemoveAll(other)
+	}
+
+	mtime := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	moveFile := func(src, dst string) error { return MoveFile(src, dst) }
+	for _, move := range []func(src, dst string) error{moveFile, moveFileCopy} {
+		src, dst := filepath.Join(dir, "src"), filepath.Join(other, "dst")
+		assert.Nil(CopyFile(testfile, src, Mode(0640)))
+		assert.Nil(os.Chtimes(src, mtime, mtime))
+		assert.Nil(ioutil.WriteFile(dst, []byte("old"), 0644))
+
+		assert.Nil(move(src, dst))
+		_, err := os.Lstat(src)
+		assert.True(os.IsNotExist(err))
+		same, err := SameContents(testfile, dst)
+		assert.Nil(err)
+		assert.True(same)
+		fi, err := os.Stat(dst)
+		assert.Nil(err)
+		assert.Equal(os.FileMode(0640), fi.Mode())
+		assert.True(fi.ModTime().Equal(mtime))
+		names, err := readDirNames(other)
+		assert.Nil(err)
+		assert.Equal([]string{"dst"}, names)
+		assert.Nil(os.Remove(dst))
+	}
+}
+
+func TestCopyDir(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	assert.Nil(ExtractArchive("testdata/dir_reader_data.tar", src))
+	assert.Nil(os.Symlink("file1", filepath.Join(src, "dir1/link")))
+	assert.Nil(os.Chmod(filepath.Join(src, "dir2"), 0500))
+	defer os.Chmod(filepath.Join(src, "dir2"), 0755)
+
+	assert.Nil(CopyDir(src, dst))
+	defer os.Chmod(filepath.Join(dst, "dir2"), 0755)
+	for _, name := range []string{"dir1/file1", "dir2/file3"} {
+		same, err := SameContents(filepath.Join(src, name), filepath.Join(dst, name))
+		assert.Nil(err, name)
+		assert.True(same, name)
+	}
+	target, err := os.Readlink(filepath.Join(dst, "dir1/link"))
+	assert.Nil(err)
+	assert.Equal("file1", target)
+	fi, err := os.Stat(filepath.Join(dst, "dir2"))
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0500), fi.Mode().Perm())
+	}
+
+	// Existing files are overwritten, unless they are to be skipped.
+	changed := filepath.Join(dst, "dir1/file1")
+	assert.Nil(ioutil.WriteFile(changed, []byte("changed"), 0644))
+	assert.Nil(CopyDir(src, dst, SkipExisting()))
+	data, err := ioutil.ReadFile(changed)
+	assert.Nil(err)
+	assert.Equal("changed", string(data))
+	assert.Nil(os.Chmod(filepath.Join(dst, "dir2"), 0755))
+	assert.Nil(CopyDir(src, dst))
+	data, err = ioutil.ReadFile(changed)
+	assert.Nil(err)
+	assert.Equal("dir1/file1 content\n", string(data))
+
+	err = CopyDir(src, filepath.Join(src, "dir1/copy"))
+	assert.NotNil(err, "copying a directory into itself should fail")
+	assert.Equal(FileTypeError{filepath.Join(src, "dir1/file1")}, CopyDir(filepath.Join(src, "dir1/file1"), dst))
+}
+
+func TestCopyDirCollectErrors(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// A directory is in the way of one of the files.
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	assert.Nil(ExtractArchive("testdata/dir_reader_data.tar", src))
+	blocking := filepath.Join(dst, "dir1/file1")
+	assert.Nil(os.MkdirAll(blocking, 0755))
+
+	assert.Equal(FileTypeError{blocking}, CopyDir(src, dst))
+	err = CopyDir(src, dst, CollectErrors())
+	assert.Equal(CopyError{[]error{FileTypeError{blocking}}}, err)
+	ex, err := FileExists(filepath.Join(dst, "dir2/file3"))
+	assert.Nil(err)
+	assert.True(ex, "other files should be copied")
+}
+
 func TestFileCopyLazy(z *testing.T) {
 	assert := assert.New(z)
 
@@ -5,7 +5,11 @@
 package osutil
 
 import (
+	"errors"
+	"os"
+	"os/user"
 	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -14,3 +18,147 @@ import (
 func FileExt(filepath string) string {
 	return strings.ToLower(path.Ext(filepath))[1:]
 }
+
+// ExpandPath expands a leading "~" in p to the home directory of the
+// current user and a leading "~user" to that of the user, as a shell does,
+// and replaces references to environment variables of the form $VAR or
+// ${VAR} with their values. Variables that are not set are replaced with
+// the empty string, unless StrictEnv is given, in which case an EnvError
+// is returned. Variables in the values of variables are not expanded, nor
+// are those in home directories.
+func ExpandPath(p string, opts ...ExpandOption) (string, error) {
+	var o expandOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var home string
+	if strings.HasPrefix(p, "~") {
+		name := p[1:]
+		if i := strings.IndexAny(name, `/`+string(filepath.Separator)); i >= 0 {
+			name = name[:i]
+		}
+		var err error
+		if name == "" {
+			home, err = os.UserHomeDir()
+		} else {
+			var u *user.User
+			if u, err = user.Lookup(name); err == nil {
+				home = u.HomeDir
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		p = p[1+len(name):]
+	}
+
+	var missing []string
+	p = os.Expand(p, func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if o.strictEnv && len(missing) > 0 {
+		return "", EnvError{missing}
+	}
+	return home + p, nil
+}
+
+// errOutsideRoot is returned by ResolveWithin for paths that escape root.
+var errOutsideRoot = errors.New("path escapes root")
+
+// errTooManyLinks is returned by ResolveWithin for symlink loops.
+var errTooManyLinks = errors.New("too many levels of symbolic links")
+
+// maxSymlinks limits how many symlinks ResolveWithin follows for a path.
+const maxSymlinks = 255
+
+// ResolveWithin returns the absolute path that path refers to when all
+// symlinks in it are followed, where path is relative to the directory root
+// or an absolute path within it. Unlike with filepath.EvalSymlinks, an
+// error is returned if the path or the target of any of the symlinks in
+// it escapes root, even if only in between, so that it is safe to use on
+// untrusted trees. Absolute symlink targets are allowed if they are within
+// root. Components of path that do not exist are kept as they are, so that
+// the result can be used to create files.
+//
+// Since the tree can change after ResolveWithin returns, it only protects
+// against trees that are not modified concurrently by untrusted processes.
+func ResolveWithin(root, path string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	outside := &os.PathError{Op: "resolve", Path: path, Err: errOutsideRoot}
+
+	rest := path
+	if filepath.IsAbs(path) {
+		var ok bool
+		if rest, ok = relWithin(path, root, realRoot); !ok {
+			return "", outside
+		}
+	}
+	current, links := realRoot, 0
+	for rest != "" {
+		name := rest
+		rest = ""
+		if i := strings.IndexAny(name, `/`+string(filepath.Separator)); i >= 0 {
+			name, rest = name[:i], name[i+1:]
+		}
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if current == realRoot {
+				return "", outside
+			}
+			current = filepath.Dir(current)
+			continue
+		}
+
+		next := filepath.Join(current, name)
+		fi, err := os.Lstat(next)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			current = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", &os.PathError{Op: "resolve", Path: path, Err: errTooManyLinks}
+		}
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			var ok bool
+			if target, ok = relWithin(target, root, realRoot); !ok {
+				return "", outside
+			}
+			current = realRoot
+		}
+		rest = target + string(filepath.Separator) + rest
+	}
+	return current, nil
+}
+
+// relWithin returns the absolute path relative to root, given both as is
+// and with its symlinks resolved, and returns false if it is outside root.
+func relWithin(path, root, realRoot string) (string, bool) {
+	for _, base := range []string{realRoot, root} {
+		rel, err := filepath.Rel(base, path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return rel, true
+		}
+	}
+	return "", false
+}
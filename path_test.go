@@ -0,0 +1,127 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveWithin(z *testing.T) {
+	assert := assert.New(z)
+
+	tmp, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(tmp)
+	tmp, err = filepath.EvalSymlinks(tmp)
+	assert.Nil(err)
+
+	// The root is reached through a symlink itself.
+	root := filepath.Join(tmp, "root")
+	join := func(name string) string { return filepath.Join(root, name) }
+	assert.Nil(os.MkdirAll(join("dir/sub"), 0755))
+	assert.Nil(ioutil.WriteFile(join("dir/file"), nil, 0644))
+	assert.Nil(os.Symlink("root", filepath.Join(tmp, "rootlink")))
+	for link, target := range map[string]string{
+		"rel":     "dir/file",
+		"up":      "../../dir",
+		"abs":     join("dir"),
+		"absLink": filepath.Join(tmp, "rootlink/dir"),
+		"chain":   "rel",
+		"escape":  "../..",
+		"outside": tmp,
+		"detour":  "../../../root/dir",
+		"loop":    "loop",
+		"missing": "dir/missing",
+	} {
+		dir := root
+		if link == "up" || link == "detour" {
+			dir = join("dir/sub")
+		}
+		assert.Nil(os.Symlink(target, filepath.Join(dir, link)))
+	}
+
+	base := filepath.Join(tmp, "rootlink")
+	for _, tc := range []struct {
+		path, expected string
+	}{
+		{"", root},
+		{".", root},
+		{"dir/file", join("dir/file")},
+		{"rel", join("dir/file")},
+		{"chain", join("dir/file")},
+		{"dir/sub/up/file", join("dir/file")},
+		{"abs/file", join("dir/file")},
+		{"absLink/sub", join("dir/sub")},
+		{"missing", join("dir/missing")},
+		{"new/dir/..", join("new")},
+		{join("rel"), join("dir/file")},
+		{filepath.Join(base, "dir/../rel"), join("dir/file")},
+		{"..", ""},
+		{"dir/../..", ""},
+		{"escape", ""},
+		{"outside", ""},
+		{"dir/sub/detour", ""},
+		{"loop", ""},
+		{tmp, ""},
+	} {
+		resolved, err := ResolveWithin(base, tc.path)
+		if tc.expected == "" {
+			assert.NotNil(err, tc.path)
+			continue
+		}
+		assert.Nil(err, tc.path)
+		assert.Equal(tc.expected, resolved, tc.path)
+	}
+}
+
+func TestExpandPath(z *testing.T) {
+	assert := assert.New(z)
+
+	home, err := os.UserHomeDir()
+	assert.Nil(err)
+	os.Setenv("OSUTIL_DIR", "some/dir")
+	os.Setenv("OSUTIL_REF", "$OSUTIL_DIR")
+	defer os.Unsetenv("OSUTIL_DIR")
+	defer os.Unsetenv("OSUTIL_REF")
+	os.Unsetenv("OSUTIL_MISSING")
+
+	for _, tc := range []struct {
+		path, expected string
+	}{
+		{"~", home},
+		{"~/.config", home + "/.config"},
+		{"a/~/b", "a/~/b"},
+		{"$OSUTIL_DIR/file", "some/dir/file"},
+		{"${OSUTIL_DIR}2/file", "some/dir2/file"},
+		{"~/$OSUTIL_DIR", home + "/some/dir"},
+		{"$OSUTIL_REF", "$OSUTIL_DIR"},
+		{"/x/$OSUTIL_MISSING/y", "/x//y"},
+		{"plain", "plain"},
+	} {
+		expanded, err := ExpandPath(tc.path)
+		assert.Nil(err, tc.path)
+		assert.Equal(tc.expected, expanded, tc.path)
+	}
+
+	_, err = ExpandPath("$OSUTIL_MISSING/${OSUTIL_DIR}/$OSUTIL_MISSING2", StrictEnv())
+	assert.Equal(EnvError{[]string{"OSUTIL_MISSING", "OSUTIL_MISSING2"}}, err)
+	expanded, err := ExpandPath("$OSUTIL_DIR", StrictEnv())
+	assert.Nil(err)
+	assert.Equal("some/dir", expanded)
+
+	if u, err := user.Current(); err == nil {
+		expanded, err := ExpandPath("~" + u.Username + "/file")
+		assert.Nil(err)
+		assert.Equal(u.HomeDir+"/file", expanded)
+	}
+	_, err = ExpandPath("~osutil-no-such-user/file")
+	assert.NotNil(err)
+}
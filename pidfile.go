@@ -0,0 +1,130 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// errMalformedPid is returned when a pidfile does not contain a PID.
+var errMalformedPid = errors.New("pidfile does not contain a PID")
+
+// maxPidFileRetries limits how often WritePidFile tries to replace stale
+// pidfiles that keep reappearing because other processes write them.
+const maxPidFileRetries = 3
+
+// WritePidFile writes the PID of the current process to the pidfile at path,
+// unless it contains the PID of another running process, in which case
+// a PidFileError is returned. Stale pidfiles, as recognized by
+// CheckPidFile, are replaced. The pidfile is created atomically with its
+// contents, so that other processes never see it empty.
+func WritePidFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < maxPidFileRetries; i++ {
+		// Linking fails if the pidfile exists, unlike renaming.
+		err := os.Link(tmp.Name(), path)
+		if !os.IsExist(err) {
+			return err
+		}
+		pid, running, err := CheckPidFile(path)
+		if err != nil {
+			return err
+		}
+		if pid == os.Getpid() {
+			return nil
+		} else if running {
+			return PidFileError{path, pid}
+		}
+	}
+	return &os.PathError{Op: "create", Path: path, Err: os.ErrExist}
+}
+
+// CheckPidFile returns the PID recorded in the pidfile at path and whether
+// the process with this PID is running and runs the same executable as the
+// current process, which is only checked where the executables of other
+// processes can be found, such as on Linux and Windows. If the process is
+// not running, the pidfile is stale and is removed, as are pidfiles that
+// do not contain a PID. If there is no pidfile, pid is 0.
+func CheckPidFile(path string) (pid int, running bool, err error) {
+	pid, err = readPidFile(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	} else if err == errMalformedPid {
+		return 0, false, removeStalePidFile(path)
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	running, err = processRunning(pid)
+	if err != nil {
+		return pid, false, err
+	}
+	if !running {
+		return pid, false, removeStalePidFile(path)
+	}
+	return pid, true, nil
+}
+
+// RemovePidFile removes the pidfile at path if it contains the PID of the
+// current process, and leaves it as it is otherwise. It is not an error if
+// there is no pidfile.
+func RemovePidFile(path string) error {
+	pid, err := readPidFile(path)
+	if os.IsNotExist(err) || err == errMalformedPid {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if pid != os.Getpid() {
+		return nil
+	}
+	return removeStalePidFile(path)
+}
+
+// readPidFile returns the PID recorded in the pidfile at path.
+func readPidFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(data)))
+	if err != nil || pid <= 0 {
+		return 0, errMalformedPid
+	}
+	return pid, nil
+}
+
+// removeStalePidFile removes the pidfile at path, which may have been
+// removed by another process already.
+func removeStalePidFile(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
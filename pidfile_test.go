@@ -0,0 +1,77 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPidFile(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.pid")
+	pid, running, err := CheckPidFile(path)
+	assert.Nil(err)
+	assert.Equal(0, pid)
+	assert.False(running)
+
+	assert.Nil(WritePidFile(path))
+	assert.Nil(WritePidFile(path))
+	pid, running, err = CheckPidFile(path)
+	assert.Nil(err)
+	assert.Equal(os.Getpid(), pid)
+	assert.True(running)
+	assert.Nil(RemovePidFile(path))
+	assert.Nil(RemovePidFile(path))
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+
+	// Pidfiles of processes that have exited, or whose PID is used by
+	// another executable, are stale.
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err == nil {
+		defer cmd.Process.Kill()
+		assert.Nil(ioutil.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644))
+		assert.Nil(RemovePidFile(path))
+		pid, running, err = CheckPidFile(path)
+		assert.Nil(err)
+		assert.Equal(cmd.Process.Pid, pid)
+		assert.False(running)
+		_, err = os.Stat(path)
+		assert.True(os.IsNotExist(err))
+
+		cmd.Process.Kill()
+		cmd.Wait()
+		assert.Nil(ioutil.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)), 0644))
+		assert.Nil(WritePidFile(path))
+		pid, running, err = CheckPidFile(path)
+		assert.Nil(err)
+		assert.Equal(os.Getpid(), pid)
+		assert.True(running)
+	}
+
+	assert.Nil(ioutil.WriteFile(path, []byte("garbage"), 0644))
+	assert.Nil(WritePidFile(path))
+	pid, _, err = CheckPidFile(path)
+	assert.Nil(err)
+	assert.Equal(os.Getpid(), pid)
+
+	names, err := readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"test.pid"}, names)
+
+	assert.Equal("pidfile \"x.pid\" belongs to running process 1", PidFileError{"x.pid", 1}.Error())
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package osutil
+
+import "errors"
+
+// processRunning returns an error, as processes cannot be checked on this
+// platform.
+func processRunning(pid int) (bool, error) {
+	return false, errors.New("checking processes is not supported on this platform")
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// processRunning returns true if the process pid exists and, where this can
+// be found out from /proc, runs the executable of the current process.
+func processRunning(pid int) (bool, error) {
+	if err := unix.Kill(pid, 0); err == unix.ESRCH {
+		return false, nil
+	} else if err != nil && err != unix.EPERM {
+		return false, os.NewSyscallError("kill", err)
+	}
+
+	exe, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/exe")
+	if err != nil {
+		// The executable cannot be found for lack of /proc or permission.
+		return true, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return true, nil
+	}
+	// The executable of a process may have been replaced since it started.
+	exe = strings.TrimSuffix(exe, " (deleted)")
+	if resolved, err := filepath.EvalSymlinks(self); err == nil {
+		self = resolved
+	}
+	return exe == self, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of processes that are still running.
+const stillActive = 259
+
+// processRunning returns true if the process pid is running and, if this
+// can be found out, runs the executable of the current process.
+func processRunning(pid int) (bool, error) {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err == windows.ERROR_INVALID_PARAMETER {
+		return false, nil
+	} else if err == windows.ERROR_ACCESS_DENIED {
+		return true, nil
+	} else if err != nil {
+		return false, os.NewSyscallError("OpenProcess", err)
+	}
+	defer windows.CloseHandle(h)
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false, os.NewSyscallError("GetExitCodeProcess", err)
+	}
+	if code != stillActive {
+		return false, nil
+	}
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &n); err != nil {
+		return true, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return true, nil
+	}
+	return strings.EqualFold(windows.UTF16ToString(buf[:n]), self), nil
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/zip"
+	"io"
+
+	"github.com/bodgit/sevenzip"
+)
+
+// Progress describes how far an archive operation has come.
+type Progress struct {
+	// Entry is the name of the entry currently being processed.
+	Entry string
+
+	// Entries is the number of entries processed so far, including
+	// the current one.
+	Entries int
+
+	// Total is the total number of entries, or -1 if it is not known.
+	// It is only known for zip and 7z archives.
+	Total int
+
+	// Bytes is the number of bytes of file contents processed so far.
+	Bytes int64
+}
+
+// ReportProgress lets ExtractArchive, CreateArchive, and ReadFileFromArchive
+// call fn whenever they start with an entry and whenever they have processed
+// a chunk of its contents. The function fn should return quickly.
+func ReportProgress(fn func(p Progress)) Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.progress = fn
+	})
+}
+
+// progressTracker keeps track of the progress of an operation.
+// All methods are safe to call on a nil tracker.
+type progressTracker struct {
+	fn func(p Progress)
+	p  Progress
+}
+
+// newProgressTracker returns a new tracker if o requests progress reports,
+// and nil otherwise.
+func newProgressTracker(o *archiveOptions) *progressTracker {
+	if o.progress == nil {
+		return nil
+	}
+	return &progressTracker{
+		fn: o.progress,
+		p:  Progress{Total: -1},
+	}
+}
+
+// count records the total number of entries in archive, if it is known.
+func (t *progressTracker) count(archive string) {
+	if t == nil {
+		return
+	}
+	t.p.Total = countEntries(archive)
+}
+
+// entry records the start of entry name.
+func (t *progressTracker) entry(name string) {
+	if t == nil {
+		return
+	}
+	t.p.Entry = name
+	t.p.Entries++
+	t.fn(t.p)
+}
+
+// add records that n bytes have been processed.
+func (t *progressTracker) add(n int64) {
+	if t == nil || n == 0 {
+		return
+	}
+	t.p.Bytes += n
+	t.fn(t.p)
+}
+
+// reader returns r, wrapped so that the bytes read are recorded.
+func (t *progressTracker) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &progressReader{r, t}
+}
+
+// progressReader records the bytes read from r in t.
+type progressReader struct {
+	r io.Reader
+	t *progressTracker
+}
+
+func (pr *progressReader) Read(p []byte) (n int, err error) {
+	n, err = pr.r.Read(p)
+	pr.t.add(int64(n))
+	return n, err
+}
+
+// countEntries returns the number of entries in archive, if this can be
+// determined without reading the whole archive, and -1 otherwise.
+func countEntries(archive string) int {
+	f, err := archiveFormat(archive)
+	if err != nil {
+		return -1
+	}
+	switch f {
+	case FormatZip:
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			return -1
+		}
+		defer zr.Close()
+		return len(zr.File)
+	case Format7z:
+		zr, err := sevenzip.OpenReader(archive)
+		if err != nil {
+			return -1
+		}
+		defer zr.Close()
+		return len(zr.File)
+	default:
+		return -1
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportProgress(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	for _, archive := range testarchives {
+		var last Progress
+		err := ExtractArchive(archive, dir, ReportProgress(func(p Progress) {
+			last = p
+		}))
+		assert.Nil(err, archive)
+		assert.Equal(7, last.Entries, archive)
+		assert.Equal(int64(213), last.Bytes, archive)
+		if ext := filepath.Ext(archive); ext == ".zip" || ext == ".7z" {
+			assert.Equal(7, last.Total, archive)
+		} else {
+			assert.Equal(-1, last.Total, archive)
+		}
+
+		last = Progress{}
+		_, err = ReadFileFromArchive(archive, "dir1/file1", ReportProgress(func(p Progress) {
+			last = p
+		}))
+		assert.Nil(err, archive)
+		assert.Equal("dir1/file1", last.Entry, archive)
+		assert.Equal(int64(19), last.Bytes, archive)
+	}
+
+	var last Progress
+	err = CreateArchive(filepath.Join(dir, "out.tar"), filepath.Join(dir, "dir2"), ReportProgress(func(p Progress) {
+		last = p
+	}))
+	assert.Nil(err)
+	assert.Equal(3, last.Entries)
+	assert.Equal(int64(175), last.Bytes)
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink makes dst a copy-on-write clone of src with fclonefileat, which
+// is supported by APFS. Only files that do not exist yet can be created
+// this way.
+func reflink(src *os.File, dst string) error {
+	if err := unix.Fclonefileat(int(src.Fd()), unix.AT_FDCWD, dst, 0); err != nil {
+		return &os.PathError{Op: "reflink", Path: dst, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package osutil
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink is not supported on this platform.
+func reflink(src *os.File, dst string) error {
+	return &os.PathError{Op: "reflink", Path: dst, Err: errors.New("cloning files is not supported")}
+}
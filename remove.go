@@ -0,0 +1,111 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMinRemoveDepth is the depth below which SafeRemoveAll refuses to
+// remove paths, unless MinRemoveDepth says otherwise.
+const defaultMinRemoveDepth = 2
+
+// SafeRemoveAll is the same as os.RemoveAll, except that it refuses to
+// remove paths that are most likely the result of a mistake, such as an
+// empty variable in "$DIR/", returning UnsafeRemoveError instead. These
+// are the empty path and ".", the root of the file system, the home
+// directory of the current user and the directories that contain it, and
+// paths that are fewer than two directories below the root, such as
+// "/usr". MinRemoveDepth changes this depth, AllowedRoot refuses paths
+// outside of a directory, and RequireMarker refuses directories without a
+// marker file.
+//
+// The checks are made after making path absolute and resolving symlinks in
+// the directories leading to it, so that "link/usr" is refused if link
+// points to "/". As with os.RemoveAll, a symlink at path itself is removed
+// rather than its target, and it is not an error if path does not exist.
+func SafeRemoveAll(path string, opts ...RemoveOption) error {
+	var o removeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if !o.hasMinDepth {
+		o.minDepth = defaultMinRemoveDepth
+	}
+
+	// An empty path would be made absolute as the working directory.
+	if path == "" || filepath.Clean(path) == "." {
+		return UnsafeRemoveError{path, "it is empty or the working directory"}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	real := filepath.Join(dir, filepath.Base(abs))
+	refuse := func(format string, args ...interface{}) error {
+		return UnsafeRemoveError{path, fmt.Sprintf(format, args...)}
+	}
+
+	depth := 0
+	for _, c := range strings.Split(real[len(filepath.VolumeName(real)):], string(filepath.Separator)) {
+		if c != "" {
+			depth++
+		}
+	}
+	if depth == 0 {
+		return refuse("it is the root directory")
+	}
+	if depth < o.minDepth {
+		return refuse("it is fewer than %d directories deep", o.minDepth)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if rhome, err := filepath.EvalSymlinks(home); err == nil {
+			home = rhome
+		}
+		if within, _ := isWithin(home, real); within {
+			return refuse("it contains the home directory")
+		}
+	}
+	if o.allowedRoot != "" {
+		root, err := filepath.EvalSymlinks(o.allowedRoot)
+		if err != nil {
+			return err
+		}
+		within, err := isWithin(real, root)
+		if err != nil {
+			return err
+		}
+		if !within || filepath.Clean(real) == filepath.Clean(root) {
+			return refuse("it is not inside of %q", o.allowedRoot)
+		}
+	}
+
+	fi, err := os.Lstat(real)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if o.marker != "" {
+		if !fi.IsDir() {
+			return refuse("it is not a directory with marker %q", o.marker)
+		}
+		if _, err := os.Lstat(filepath.Join(real, o.marker)); os.IsNotExist(err) {
+			return refuse("it does not contain marker %q", o.marker)
+		} else if err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(real)
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeRemoveAll(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	join := func(name string) string { return filepath.Join(dir, name) }
+
+	assert.Nil(os.MkdirAll(join("a/b"), 0755))
+	assert.Nil(ioutil.WriteFile(join("a/b/file"), nil, 0644))
+	assert.Nil(os.Symlink("/", join("root")))
+
+	// The working directory is deep enough to be removed otherwise.
+	wd, err := os.Getwd()
+	assert.Nil(err)
+	defer os.Chdir(wd)
+	assert.Nil(os.Chdir(join("a/b")))
+	for _, path := range []string{"", ".", "./", "b/.."} {
+		assert.IsType(UnsafeRemoveError{}, SafeRemoveAll(path), path)
+	}
+	ex, err := LExists(join("a/b/file"))
+	assert.Nil(err)
+	assert.True(ex)
+
+	// Only paths that do not exist are used, in case the checks fail.
+	for _, path := range []string{"/", "/osutil-missing", join("root/osutil-missing")} {
+		err := SafeRemoveAll(path)
+		assert.IsType(UnsafeRemoveError{}, err, path)
+	}
+
+	// A stand-in home directory is used for the same reason.
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", join("home/user"))
+	assert.Nil(os.MkdirAll(join("home/user"), 0755))
+	assert.IsType(UnsafeRemoveError{}, SafeRemoveAll(join("home/user")))
+	assert.IsType(UnsafeRemoveError{}, SafeRemoveAll(join("home")))
+	assert.Nil(SafeRemoveAll(join("home/user/x")))
+
+	// The symlink itself may be removed, just not what it points into.
+	assert.Nil(SafeRemoveAll(join("root"), MinRemoveDepth(0)))
+	ex, err = LExists(join("root"))
+	assert.Nil(err)
+	assert.False(ex)
+
+	assert.IsType(UnsafeRemoveError{}, SafeRemoveAll(join("a"), AllowedRoot(join("a"))))
+	assert.IsType(UnsafeRemoveError{}, SafeRemoveAll(join("a"), AllowedRoot(join("a/b"))))
+	assert.IsType(UnsafeRemoveError{}, SafeRemoveAll(join("a"), RequireMarker("file")))
+	assert.Nil(SafeRemoveAll(join("a/b"), AllowedRoot(join("a")), RequireMarker("file")))
+	ex, err = LExists(join("a/b"))
+	assert.Nil(err)
+	assert.False(ex)
+
+	assert.Nil(SafeRemoveAll(join("missing/x")))
+	assert.IsType(UnsafeRemoveError{}, SafeRemoveAll(join("a"), MinRemoveDepth(100)))
+}
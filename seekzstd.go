@@ -0,0 +1,278 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrSeekTable is returned by NewSeekableZstdReader when the data does not
+// end with a valid seek table.
+var ErrSeekTable = errors.New("invalid zstd seek table")
+
+const (
+	// zstdSkippableMagic starts the skippable frame containing the seek
+	// table, and zstdSeekableMagic ends it.
+	zstdSkippableMagic = 0x184d2a5e
+	zstdSeekableMagic  = 0x8f92eab1
+
+	seekTableFooterLen = 9
+	seekEntryLen       = 8
+)
+
+// seekableZstdWriter writes data in the zstd seekable format, which consists
+// of independent frames of a fixed decompressed size, followed by a seek
+// table in a skippable frame. Decoders that do not know the format simply
+// decompress all frames and skip the table.
+type seekableZstdWriter struct {
+	w         io.Writer
+	enc       *zstd.Encoder
+	frameSize int
+	buf       []byte
+	frames    []seekFrame
+}
+
+// seekFrame is an entry in the seek table.
+type seekFrame struct {
+	compSize, size uint32
+}
+
+func newSeekableZstdWriter(w io.Writer, frameSize int, opts ...zstd.EOption) (*seekableZstdWriter, error) {
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &seekableZstdWriter{w: w, enc: enc, frameSize: frameSize}, nil
+}
+
+func (sw *seekableZstdWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := sw.frameSize - len(sw.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		sw.buf = append(sw.buf, p[:m]...)
+		p = p[m:]
+		if len(sw.buf) == sw.frameSize {
+			if err := sw.flushFrame(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flushFrame compresses the buffered data into a frame.
+func (sw *seekableZstdWriter) flushFrame() error {
+	frame := sw.enc.EncodeAll(sw.buf, nil)
+	if _, err := sw.w.Write(frame); err != nil {
+		return err
+	}
+	sw.frames = append(sw.frames, seekFrame{uint32(len(frame)), uint32(len(sw.buf))})
+	sw.buf = sw.buf[:0]
+	return nil
+}
+
+// Close writes the last frame and the seek table.
+func (sw *seekableZstdWriter) Close() error {
+	defer sw.enc.Close()
+	if len(sw.buf) > 0 || len(sw.frames) == 0 {
+		if err := sw.flushFrame(); err != nil {
+			return err
+		}
+	}
+
+	size := len(sw.frames)*seekEntryLen + seekTableFooterLen
+	table := make([]byte, 8, 8+size)
+	binary.LittleEndian.PutUint32(table, zstdSkippableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(size))
+	var b [seekEntryLen]byte
+	for _, f := range sw.frames {
+		binary.LittleEndian.PutUint32(b[:], f.compSize)
+		binary.LittleEndian.PutUint32(b[4:], f.size)
+		table = append(table, b[:]...)
+	}
+	binary.LittleEndian.PutUint32(b[:], uint32(len(sw.frames)))
+	table = append(table, b[:4]...)
+	// The descriptor declares that the entries contain no checksums.
+	table = append(table, 0)
+	binary.LittleEndian.PutUint32(b[:], zstdSeekableMagic)
+	table = append(table, b[:4]...)
+	_, err := sw.w.Write(table)
+	return err
+}
+
+// SeekableZstdReader provides random access to the decompressed contents
+// of data in the zstd seekable format, as written by NewCompressor with
+// SeekableZstd. Only the frames containing the data that is read are
+// decompressed, so that reading from a huge file is fast. Together with a
+// TarIndex, single entries can be read from a huge archive almost
+// instantly.
+//
+// A SeekableZstdReader is an io.ReadSeeker and an io.ReaderAt. It can
+// be used by multiple goroutines with ReadAt, but not with Read and Seek.
+type SeekableZstdReader struct {
+	ra     io.ReaderAt
+	dec    *zstd.Decoder
+	offs   []int64 // the offsets of the frames in ra
+	starts []int64 // the offsets of the frames in the decompressed data
+	size   int64
+	pos    int64
+
+	mu     sync.Mutex
+	cached int
+	data   []byte
+}
+
+// NewSeekableZstdReader reads the seek table at the end of the size bytes
+// of ra. If there is no valid seek table, ErrSeekTable is returned.
+func NewSeekableZstdReader(ra io.ReaderAt, size int64) (*SeekableZstdReader, error) {
+	var footer [seekTableFooterLen]byte
+	if size < 8+seekTableFooterLen {
+		return nil, ErrSeekTable
+	}
+	if _, err := ra.ReadAt(footer[:], size-seekTableFooterLen); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != zstdSeekableMagic {
+		return nil, ErrSeekTable
+	}
+	n := int64(binary.LittleEndian.Uint32(footer[:]))
+	entryLen := int64(seekEntryLen)
+	if footer[4]&0x80 != 0 {
+		// Each entry includes a checksum.
+		entryLen += 4
+	}
+	tableLen := 8 + n*entryLen + seekTableFooterLen
+	if footer[4]&0x7c != 0 || tableLen > size {
+		return nil, ErrSeekTable
+	}
+	table := make([]byte, tableLen)
+	if _, err := ra.ReadAt(table, size-tableLen); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table) != zstdSkippableMagic ||
+		int64(binary.LittleEndian.Uint32(table[4:])) != tableLen-8 {
+		return nil, ErrSeekTable
+	}
+
+	sr := &SeekableZstdReader{ra: ra, cached: -1}
+	var off int64
+	for i := int64(0); i < n; i++ {
+		e := table[8+i*entryLen:]
+		sr.offs = append(sr.offs, off)
+		sr.starts = append(sr.starts, sr.size)
+		off += int64(binary.LittleEndian.Uint32(e))
+		sr.size += int64(binary.LittleEndian.Uint32(e[4:]))
+	}
+	if off != size-tableLen {
+		return nil, ErrSeekTable
+	}
+	sr.offs = append(sr.offs, off)
+	sr.starts = append(sr.starts, sr.size)
+
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	sr.dec = dec
+	return sr, nil
+}
+
+// Size returns the size of the decompressed data.
+func (sr *SeekableZstdReader) Size() int64 {
+	return sr.size
+}
+
+// ReadAt reads len(p) bytes of the decompressed data starting at off.
+func (sr *SeekableZstdReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= sr.size {
+			return n, io.EOF
+		}
+		// Find the last frame starting at or before off.
+		i := sort.Search(len(sr.starts), func(i int) bool { return sr.starts[i] > off }) - 1
+		if err := sr.decode(i); err != nil {
+			return n, err
+		}
+		m := copy(p[n:], sr.data[off-sr.starts[i]:])
+		n += m
+		off += int64(m)
+	}
+	return n, nil
+}
+
+// decode decompresses frame i into sr.data, unless it is already there.
+func (sr *SeekableZstdReader) decode(i int) error {
+	if sr.cached == i {
+		return nil
+	}
+	frame := make([]byte, sr.offs[i+1]-sr.offs[i])
+	if _, err := sr.ra.ReadAt(frame, sr.offs[i]); err != nil {
+		return unexpectedEOF(err)
+	}
+	data, err := sr.dec.DecodeAll(frame, sr.data[:0])
+	if err != nil {
+		sr.cached = -1
+		return err
+	}
+	if int64(len(data)) != sr.starts[i+1]-sr.starts[i] {
+		sr.cached = -1
+		return ErrSeekTable
+	}
+	sr.cached, sr.data = i, data
+	return nil
+}
+
+// Read reads the decompressed data at the current position.
+func (sr *SeekableZstdReader) Read(p []byte) (int, error) {
+	if sr.pos >= sr.size {
+		return 0, io.EOF
+	}
+	n, err := sr.ReadAt(p, sr.pos)
+	sr.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the position for the next Read in the decompressed data.
+func (sr *SeekableZstdReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sr.pos
+	case io.SeekEnd:
+		offset += sr.size
+	default:
+		return sr.pos, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return sr.pos, errors.New("negative position")
+	}
+	sr.pos = offset
+	return offset, nil
+}
+
+// Close releases the resources of the decoder. It does not close ra.
+func (sr *SeekableZstdReader) Close() error {
+	sr.dec.Close()
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeekableZstd(z *testing.T) {
+	assert := assert.New(z)
+
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < 100000; i++ {
+		fmt.Fprintf(&buf, "line %d\n", i)
+	}
+	data := buf.Bytes()
+
+	dest := testdest + ".zst"
+	defer os.Remove(dest)
+	for _, size := range []int{0, len(data)} {
+		compressed := compressBytes(assert, dest, data[:size], SeekableZstd(4096))
+		assert.Nil(ioutil.WriteFile(dest, compressed, 0644))
+
+		sr, err := NewSeekableZstdReader(bytes.NewReader(compressed), int64(len(compressed)))
+		if !assert.Nil(err) {
+			continue
+		}
+		assert.Equal(int64(size), sr.Size())
+		got, err := ioutil.ReadAll(sr)
+		assert.Nil(err)
+		assert.Equal(data[:size], got)
+		sr.Close()
+	}
+
+	compressed, err := ioutil.ReadFile(dest)
+	assert.Nil(err)
+	sr, err := NewSeekableZstdReader(bytes.NewReader(compressed), int64(len(compressed)))
+	assert.Nil(err)
+	defer sr.Close()
+	assert.Equal(int64((len(data)+4095)/4096), int64(len(sr.starts)-1))
+	for _, off := range []int64{50000, 4090, 0, 99990} {
+		p := make([]byte, 20)
+		n, err := sr.ReadAt(p, off)
+		want := data[off:]
+		if len(want) > len(p) {
+			want = want[:len(p)]
+		} else {
+			assert.Equal(io.EOF, err)
+		}
+		assert.Equal(want, p[:n], off)
+	}
+	pos, err := sr.Seek(-8, io.SeekEnd)
+	assert.Nil(err)
+	assert.Equal(int64(len(data)-8), pos)
+	rest, err := ioutil.ReadAll(sr)
+	assert.Nil(err)
+	assert.Equal(data[len(data)-8:], rest)
+
+	plain := compressBytes(assert, dest, data)
+	_, err = NewSeekableZstdReader(bytes.NewReader(plain), int64(len(plain)))
+	assert.Equal(ErrSeekTable, err)
+}
+
+func TestSeekableZstdTarIndex(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = ExtractArchive("testdata/dir_reader_data.tar", src)
+	assert.Nil(err)
+	archive := filepath.Join(dir, "out.tar.zst")
+	err = CreateArchive(archive, src, SeekableZstd(1024))
+	assert.Nil(err)
+
+	f, err := os.Open(archive)
+	assert.Nil(err)
+	defer f.Close()
+	fi, err := f.Stat()
+	assert.Nil(err)
+	sr, err := NewSeekableZstdReader(f, fi.Size())
+	if !assert.Nil(err) {
+		return
+	}
+	defer sr.Close()
+	ix, err := NewTarIndex(sr)
+	assert.Nil(err)
+	_, r, err := ix.Open(sr, "dir2/file3")
+	assert.Nil(err)
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(string(data), "dir2/file3\n"))
+}
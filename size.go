@@ -0,0 +1,281 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// ArchiveSize returns the number of entries and the total size of the
+// contents of the entries of the (compressed) archive, without extracting
+// it, so that the free disk space can be checked beforehand.
+//
+// Where possible, the archive is not decompressed: zip and 7z archives,
+// SquashFS and ISO images are read from their directories, and the headers
+// of uncompressed tar archives are read while skipping the contents. For
+// archives compressed with xz or zstd, and for small gzip files, the size
+// of the decompressed data is recorded by the compression format; in that
+// case, entries is -1, and size is the size of the decompressed archive,
+// which is slightly larger than the contents because of the headers.
+// Other archives are decompressed and their headers are counted.
+func ArchiveSize(archive string, opts ...Option) (entries int, size int64, err error) {
+	o := newArchiveOptions(opts)
+	format, err := archiveFormat(archive)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, ok := volumeBase(archive); !ok {
+		switch format {
+		case FormatTar:
+			return tarSize(archive)
+		case FormatGzip, FormatXZ, FormatZstd:
+			if size, ok := decompressedSize(archive, format); ok {
+				return -1, size, nil
+			}
+		}
+	}
+
+	err = walkArchive(archive, o, func(hdr *tar.Header, r io.Reader) error {
+		entries++
+		if hdr.FileInfo().Mode().IsRegular() {
+			size += hdr.Size
+		}
+		return nil
+	})
+	return entries, size, err
+}
+
+// tarSize returns the number of entries and the total size of their
+// contents of the uncompressed tar archive. Since the archive is read from
+// a file, the tar reader seeks over the contents.
+func tarSize(archive string) (entries int, size int64, err error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, size, nil
+		} else if err != nil {
+			return 0, 0, err
+		}
+		entries++
+		if hdr.FileInfo().Mode().IsRegular() {
+			size += hdr.Size
+		}
+	}
+}
+
+// errUnknownSize is returned when the decompressed size is not recorded.
+var errUnknownSize = errors.New("decompressed size is unknown")
+
+// decompressedSize returns the size of the decompressed contents of the
+// compressed file, if the compression format records it.
+func decompressedSize(file string, format Format) (int64, bool) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+
+	var size int64
+	switch format {
+	case FormatGzip:
+		size, err = gzipSize(f, fi.Size())
+	case FormatXZ:
+		size, err = xzSize(f, fi.Size())
+	case FormatZstd:
+		size, err = zstdSize(f, fi.Size())
+	default:
+		err = errUnknownSize
+	}
+	return size, err == nil
+}
+
+// gzipMaxRatio is the largest possible ratio of decompressed to compressed
+// size of deflate data.
+const gzipMaxRatio = 1032
+
+// gzipSize returns the decompressed size of a gzip file, which is recorded
+// modulo 4 GiB at its end. The size is only unambiguous for files that are
+// so small that they cannot decompress to 4 GiB or more.
+func gzipSize(f io.ReaderAt, n int64) (int64, error) {
+	if n < 18 || n > math.MaxUint32/gzipMaxRatio {
+		return 0, errUnknownSize
+	}
+	var b [4]byte
+	if _, err := f.ReadAt(b[:], n-4); err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint32(b[:])), nil
+}
+
+// xzSize returns the decompressed size of an xz file, summed up from the
+// indexes at the end of each of its streams.
+func xzSize(f io.ReaderAt, n int64) (int64, error) {
+	const headerSize, footerSize = 12, 12
+	var size int64
+	pos := n
+	for pos > 0 {
+		// Streams may be followed by padding in multiples of four bytes.
+		var footer [footerSize]byte
+		if _, err := f.ReadAt(footer[:4], pos-4); err != nil {
+			return 0, err
+		}
+		if bytes.Equal(footer[:4], []byte{0, 0, 0, 0}) {
+			pos -= 4
+			continue
+		}
+
+		if pos < headerSize+footerSize {
+			return 0, errUnknownSize
+		}
+		if _, err := f.ReadAt(footer[:], pos-footerSize); err != nil {
+			return 0, err
+		}
+		if footer[10] != 'Y' || footer[11] != 'Z' {
+			return 0, errUnknownSize
+		}
+		indexSize := (int64(binary.LittleEndian.Uint32(footer[4:8])) + 1) * 4
+		indexPos := pos - footerSize - indexSize
+		if indexPos < headerSize {
+			return 0, errUnknownSize
+		}
+		index := make([]byte, indexSize)
+		if _, err := f.ReadAt(index, indexPos); err != nil {
+			return 0, err
+		}
+
+		// The index consists of an indicator, the number of records, and
+		// the unpadded and uncompressed sizes of each block.
+		if index[0] != 0 {
+			return 0, errUnknownSize
+		}
+		index = index[1:]
+		records, ok := xzVarint(&index)
+		var blocks int64
+		for i := uint64(0); ok && i < records; i++ {
+			var unpadded, uncompressed uint64
+			if unpadded, ok = xzVarint(&index); ok {
+				uncompressed, ok = xzVarint(&index)
+			}
+			blocks += int64(unpadded+3) &^ 3
+			size += int64(uncompressed)
+		}
+		if !ok {
+			return 0, errUnknownSize
+		}
+
+		pos = indexPos - blocks - headerSize
+		if pos < 0 {
+			return 0, errUnknownSize
+		}
+		var header [6]byte
+		if _, err := f.ReadAt(header[:], pos); err != nil {
+			return 0, err
+		}
+		if !bytes.Equal(header[:], magicXZ) {
+			return 0, errUnknownSize
+		}
+	}
+	return size, nil
+}
+
+// xzVarint reads a variable-length integer as used by xz from b.
+func xzVarint(b *[]byte) (uint64, bool) {
+	var v uint64
+	for i := 0; i < 9 && i < len(*b); i++ {
+		c := (*b)[i]
+		v |= uint64(c&0x7f) << (7 * uint(i))
+		if c&0x80 == 0 {
+			*b = (*b)[i+1:]
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// zstdSize returns the decompressed size of a zstd file, summed up from the
+// frame headers, which is only possible if each frame records its size.
+func zstdSize(f io.ReaderAt, n int64) (int64, error) {
+	const zstdMagic, skippableMagic = 0xfd2fb528, 0x184d2a50
+	var size int64
+	var b [14]byte
+	for pos := int64(0); pos < n; {
+		if _, err := f.ReadAt(b[:8], pos); err != nil {
+			return 0, err
+		}
+		magic := binary.LittleEndian.Uint32(b[:4])
+		if magic&^0xf == skippableMagic {
+			pos += 8 + int64(binary.LittleEndian.Uint32(b[4:8]))
+			continue
+		} else if magic != zstdMagic {
+			return 0, errUnknownSize
+		}
+
+		// The frame header descriptor determines which fields follow.
+		fhd := b[4]
+		single := fhd>>5&1 == 1
+		fcsSize := [...]int{0, 2, 4, 8}[fhd>>6]
+		if fcsSize == 0 && single {
+			fcsSize = 1
+		}
+		if fcsSize == 0 {
+			return 0, errUnknownSize
+		}
+		off := [...]int{0, 1, 2, 4}[fhd&3]
+		if !single {
+			off++
+		}
+		if _, err := f.ReadAt(b[:off+fcsSize], pos+5); err != nil {
+			return 0, err
+		}
+		var fcs uint64
+		for i := fcsSize - 1; i >= 0; i-- {
+			fcs = fcs<<8 | uint64(b[off+i])
+		}
+		if fcsSize == 2 {
+			fcs += 256
+		}
+		size += int64(fcs)
+		pos += int64(5 + off + fcsSize)
+
+		// The blocks of the frame have to be skipped one by one.
+		for last := false; !last; {
+			if _, err := f.ReadAt(b[:3], pos); err != nil {
+				return 0, err
+			}
+			h := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+			last = h&1 == 1
+			blockSize := int64(h >> 3)
+			switch h >> 1 & 3 {
+			case 1:
+				// Run-length blocks consist of a single byte.
+				blockSize = 1
+			case 3:
+				return 0, errUnknownSize
+			}
+			pos += 3 + blockSize
+		}
+		if fhd>>2&1 == 1 {
+			pos += 4
+		}
+	}
+	return size, nil
+}
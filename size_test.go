@@ -0,0 +1,61 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveSize(z *testing.T) {
+	assert := assert.New(z)
+
+	// Where the compression format records the decompressed size, it is
+	// the size of the tar archive.
+	recorded := map[string]int64{
+		"testdata/dir_reader_data.tar.gz":  10240,
+		"testdata/dir_reader_data.tar.xz":  10240,
+		"testdata/dir_reader_data.tar.zst": 10240,
+		"testdata/dir_reader_data.cpio.gz": 1536,
+	}
+	for _, archive := range testarchives {
+		entries, size, err := ArchiveSize(archive)
+		assert.Nil(err, archive)
+		if want, ok := recorded[archive]; ok {
+			assert.Equal(-1, entries, archive)
+			assert.Equal(want, size, archive)
+		} else {
+			assert.Equal(7, entries, archive)
+			assert.Equal(int64(213), size, archive)
+		}
+	}
+}
+
+func TestArchiveSizeXZStreams(z *testing.T) {
+	assert := assert.New(z)
+
+	// Concatenated streams, which may be separated by padding, are valid
+	// xz data.
+	data, err := ioutil.ReadFile("testdata/dir_reader_data.tar.xz")
+	assert.Nil(err)
+	data = append(append(append([]byte{}, data...), 0, 0, 0, 0), data...)
+	dest := testdest + ".tar.xz"
+	assert.Nil(ioutil.WriteFile(dest, data, 0644))
+	defer os.Remove(dest)
+
+	entries, size, err := ArchiveSize(dest)
+	assert.Nil(err)
+	assert.Equal(-1, entries)
+	assert.Equal(int64(2*10240), size)
+
+	// Without a valid footer, the size is not known.
+	data[len(data)-2] = 'x'
+	_, err = xzSize(bytes.NewReader(data), int64(len(data)))
+	assert.Equal(errUnknownSize, err)
+}
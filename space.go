@@ -0,0 +1,47 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+// Space describes the size and free space of a file system, as returned
+// by FreeSpace.
+type Space struct {
+	// Total is the size of the file system in bytes.
+	Total uint64
+
+	// Free is the number of free bytes, and Available the number of them
+	// that can be used by unprivileged users, which is smaller if some
+	// space is reserved for root.
+	Free      uint64
+	Available uint64
+
+	// Inodes is the number of inodes of the file system and FreeInodes the
+	// number of them that are free. Both are 0 if the file system has no
+	// fixed number of inodes, or if it is not known, as on Windows.
+	Inodes     uint64
+	FreeInodes uint64
+}
+
+// FreeSpace returns the size and free space of the file system that
+// contains the file at path, as reported by statfs on Unix and by
+// GetDiskFreeSpaceEx on Windows.
+func FreeSpace(path string) (Space, error) {
+	return statSpace(path)
+}
+
+// CheckFreeSpace returns a SpaceError if less than n bytes are available to
+// the current user on the file system that contains the file at path, so
+// that operations like extracting archives can fail early. The space is
+// only checked once, so the operation can still run out of space if other
+// processes use up some of it in the meantime.
+func CheckFreeSpace(path string, n uint64) error {
+	space, err := statSpace(path)
+	if err != nil {
+		return err
+	}
+	if space.Available < n {
+		return SpaceError{Filepath: path, Needed: n, Available: space.Available}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd
+// +build darwin dragonfly freebsd
+
+package osutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// statSpace returns the space of the file system at path with statfs.
+func statSpace(path string) (Space, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return Space{}, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	// The available space and inodes are negative when the space reserved
+	// for root is in use.
+	avail, ffree := int64(st.Bavail), int64(st.Ffree)
+	if avail < 0 {
+		avail = 0
+	}
+	if ffree < 0 {
+		ffree = 0
+	}
+	bsize := uint64(st.Bsize)
+	return Space{
+		Total:      uint64(st.Blocks) * bsize,
+		Free:       uint64(st.Bfree) * bsize,
+		Available:  uint64(avail) * bsize,
+		Inodes:     uint64(st.Files),
+		FreeInodes: uint64(ffree),
+	}, nil
+}
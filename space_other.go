@@ -0,0 +1,19 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!windows
+
+package osutil
+
+import (
+	"errors"
+	"os"
+)
+
+// statSpace returns an error, as the space of file systems cannot be found
+// out on this platform.
+func statSpace(path string) (Space, error) {
+	return Space{}, &os.PathError{Op: "statfs", Path: path, Err: errors.New("not supported on this platform")}
+}
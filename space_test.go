@@ -0,0 +1,31 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreeSpace(z *testing.T) {
+	assert := assert.New(z)
+
+	space, err := FreeSpace("testdata")
+	assert.Nil(err)
+	assert.True(space.Total > 0)
+	assert.True(space.Free <= space.Total)
+	assert.True(space.Available <= space.Free)
+	assert.True(space.FreeInodes <= space.Inodes)
+
+	assert.Nil(CheckFreeSpace("testdata", 0))
+	err = CheckFreeSpace("testdata", space.Total+1)
+	assert.IsType(SpaceError{}, err)
+	assert.Equal("testdata", err.(SpaceError).Filepath)
+
+	_, err = FreeSpace("testdata/missing")
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// statSpace returns the space of the volume at path with
+// GetDiskFreeSpaceEx.
+func statSpace(path string) (Space, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return Space{}, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: path, Err: err}
+	}
+	var s Space
+	if err := windows.GetDiskFreeSpaceEx(p, &s.Available, &s.Total, &s.Free); err != nil {
+		return Space{}, &os.PathError{Op: "GetDiskFreeSpaceEx", Path: path, Err: err}
+	}
+	return s, nil
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sparseBlockSize is the granularity with which WriteSparse looks for
+// blocks of zeros that can become holes.
+const sparseBlockSize = 4096
+
+// sparseRegion is a region of a sparse file that contains data.
+type sparseRegion struct {
+	offset int64
+	length int64
+}
+
+// WriteSparse copies r to f, leaving holes in f instead of writing data
+// which is known to be zero, so that f is a sparse file.
+// If r is a regular file, it is copied in its entirety, and the holes in it
+// are found with SEEK_HOLE and SEEK_DATA where they are supported;
+// otherwise blocks of zeros are skipped.
+// WriteSparse starts writing at the current offset of f and should be
+// given a newly created or truncated file.
+func WriteSparse(f *os.File, r io.Reader) (n int64, err error) {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+
+	if src, ok := r.(*os.File); ok {
+		fi, err := src.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if fi.Mode().IsRegular() {
+			regions, err := dataRegions(src, fi.Size())
+			if err == nil {
+				return writeRegions(f, start, src, regions, fi.Size())
+			}
+		}
+	}
+
+	buf := make([]byte, sparseBlockSize)
+	for {
+		m, rerr := io.ReadFull(r, buf)
+		if m > 0 {
+			if isZero(buf[:m]) {
+				_, err = f.Seek(int64(m), io.SeekCurrent)
+			} else {
+				_, err = f.Write(buf[:m])
+			}
+			if err != nil {
+				return n, err
+			}
+			n += int64(m)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		} else if rerr != nil {
+			return n, rerr
+		}
+	}
+	// Make sure trailing holes are accounted for in the file size.
+	return n, f.Truncate(start + n)
+}
+
+// writeRegions copies the data regions of src to f at offset start.
+func writeRegions(f *os.File, start int64, src *os.File, regions []sparseRegion, size int64) (int64, error) {
+	for _, sr := range regions {
+		if _, err := f.Seek(start+sr.offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.Copy(f, io.NewSectionReader(src, sr.offset, sr.length)); err != nil {
+			return 0, err
+		}
+	}
+	return size, f.Truncate(start + size)
+}
+
+// dataOnly returns true if the regions cover the whole file, i.e., if the
+// file does not have any holes.
+func dataOnly(regions []sparseRegion, size int64) bool {
+	return len(regions) == 1 && regions[0].offset == 0 && regions[0].length == size
+}
+
+// isZero returns true if buf contains only zeros.
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isSparseEntry returns true if the entry was stored as a sparse file.
+func isSparseEntry(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSparseTarEntry writes the header and data regions of the file f to w
+// in the GNU sparse format 1.0, since archive/tar does not support writing
+// sparse files. It must be called when the tar.Writer writing to w has just
+// been flushed, so that the entry starts on a block boundary.
+func writeSparseTarEntry(w io.Writer, hdr *tar.Header, f *os.File, regions []sparseRegion) error {
+	var sparseMap bytes.Buffer
+	fmt.Fprintf(&sparseMap, "%d\n", len(regions))
+	var dataSize int64
+	for _, sr := range regions {
+		fmt.Fprintf(&sparseMap, "%d\n%d\n", sr.offset, sr.length)
+		dataSize += sr.length
+	}
+	padBlock(&sparseMap)
+	storedSize := int64(sparseMap.Len()) + dataSize
+
+	records := map[string]string{
+		"GNU.sparse.major":    "1",
+		"GNU.sparse.minor":    "0",
+		"GNU.sparse.name":     hdr.Name,
+		"GNU.sparse.realsize": strconv.FormatInt(hdr.Size, 10),
+		"size":                strconv.FormatInt(storedSize, 10),
+		"mtime":               strconv.FormatInt(hdr.ModTime.Unix(), 10),
+		"uid":                 strconv.Itoa(hdr.Uid),
+		"gid":                 strconv.Itoa(hdr.Gid),
+		"uname":               hdr.Uname,
+		"gname":               hdr.Gname,
+	}
+	for k, v := range hdr.PAXRecords {
+		records[k] = v
+	}
+	keys := make([]string, 0, len(records))
+	for k, v := range records {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var pax bytes.Buffer
+	for _, k := range keys {
+		pax.WriteString(paxRecord(k, records[k]))
+	}
+
+	dir, file := path.Split(hdr.Name)
+	paxHdr := rawHeader(path.Join(dir, "PaxHeaders.0", file), tar.TypeXHeader, 0644, int64(pax.Len()), hdr)
+	padBlock(&pax)
+	sparseHdr := rawHeader(path.Join(dir, "GNUSparseFile.0", file), tar.TypeReg, hdr.Mode, storedSize, hdr)
+
+	for _, b := range [][]byte{paxHdr, pax.Bytes(), sparseHdr, sparseMap.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	for _, sr := range regions {
+		if _, err := io.Copy(w, io.NewSectionReader(f, sr.offset, sr.length)); err != nil {
+			return err
+		}
+	}
+	if pad := (512 - dataSize%512) % 512; pad > 0 {
+		if _, err := w.Write(make([]byte, pad)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// paxRecord formats a PAX record, whose length includes the length itself.
+func paxRecord(k, v string) string {
+	const padding = 3 // Extra padding for ' ', '=', and '\n'
+	size := len(k) + len(v) + padding
+	size += len(strconv.Itoa(size))
+	record := strconv.Itoa(size) + " " + k + "=" + v + "\n"
+	if len(record) != size {
+		size = len(record)
+		record = strconv.Itoa(size) + " " + k + "=" + v + "\n"
+	}
+	return record
+}
+
+// rawHeader returns a USTAR header block. Values that do not fit are
+// truncated, as they are also recorded in the preceding PAX header.
+func rawHeader(name string, typeflag byte, mode, size int64, hdr *tar.Header) []byte {
+	b := make([]byte, 512)
+	putString := func(field []byte, s string) {
+		copy(field[:len(field)-1], s)
+	}
+	putOctal := func(field []byte, n int64) {
+		s := fmt.Sprintf("%0*o", len(field)-1, n)
+		if n < 0 || len(s) >= len(field) {
+			s = fmt.Sprintf("%0*o", len(field)-1, 0)
+		}
+		copy(field, s)
+	}
+
+	putString(b[0:100], name)
+	putOctal(b[100:108], mode&07777)
+	putOctal(b[108:116], int64(hdr.Uid))
+	putOctal(b[116:124], int64(hdr.Gid))
+	putOctal(b[124:136], size)
+	putOctal(b[136:148], hdr.ModTime.Unix())
+	b[156] = typeflag
+	copy(b[257:265], "ustar\x0000")
+	putString(b[265:297], hdr.Uname)
+	putString(b[297:329], hdr.Gname)
+
+	// The checksum is computed with the checksum field set to spaces.
+	copy(b[148:156], "        ")
+	var sum int64
+	for _, c := range b {
+		sum += int64(c)
+	}
+	copy(b[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	return b
+}
+
+// padBlock pads buf with zeros to a multiple of the tar block size.
+func padBlock(buf *bytes.Buffer) {
+	if pad := (512 - buf.Len()%512) % 512; pad > 0 {
+		buf.Write(make([]byte, pad))
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataRegions returns the regions of the file f of the given size that
+// contain data, as reported by SEEK_DATA and SEEK_HOLE. The file offset
+// of f is changed.
+func dataRegions(f *os.File, size int64) ([]sparseRegion, error) {
+	fd := int(f.Fd())
+	var regions []sparseRegion
+	for off := int64(0); off < size; {
+		data, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if err == unix.ENXIO {
+			// There is no more data after off.
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, err
+		}
+		if hole > size {
+			hole = size
+		}
+		regions = append(regions, sparseRegion{data, hole - data})
+		off = hole
+	}
+	return regions, nil
+}
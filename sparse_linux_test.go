@@ -0,0 +1,66 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// allocated returns the number of bytes allocated on disk for path.
+func allocated(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return fi.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+func TestSparseRoundTrip(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	const size = 16 << 20
+	src := filepath.Join(dir, "src")
+	assert.Nil(os.Mkdir(src, 0755))
+	file := filepath.Join(src, "sparse.img")
+	f, err := os.Create(file)
+	assert.Nil(err)
+	assert.Nil(f.Truncate(size))
+	_, err = f.WriteAt([]byte("hello"), 1<<20)
+	assert.Nil(err)
+	f.Close()
+	if allocated(file) >= size {
+		z.Skip("file system does not support sparse files")
+	}
+
+	archive := filepath.Join(dir, "sparse.tar")
+	err = CreateArchive(archive, src, Sparse())
+	assert.Nil(err)
+	fi, err := os.Stat(archive)
+	assert.Nil(err)
+	assert.True(fi.Size() < 1<<20, "holes should not be stored in the archive")
+
+	dest := filepath.Join(dir, "dest")
+	err = ExtractArchive(archive, dest)
+	assert.Nil(err)
+
+	extracted := filepath.Join(dest, "sparse.img")
+	want, err := ioutil.ReadFile(file)
+	assert.Nil(err)
+	got, err := ioutil.ReadFile(extracted)
+	assert.Nil(err)
+	assert.True(bytes.Equal(want, got), "extracted file should have same contents")
+	assert.True(allocated(extracted) < size, "extracted file should be sparse")
+}
@@ -0,0 +1,18 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package osutil
+
+import (
+	"errors"
+	"os"
+)
+
+// dataRegions is not supported on this platform.
+func dataRegions(f *os.File, size int64) ([]sparseRegion, error) {
+	return nil, errors.New("finding holes in files is not supported")
+}
@@ -0,0 +1,645 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// ErrSquashFS is returned when a SquashFS image is malformed.
+var ErrSquashFS = errors.New("malformed squashfs image")
+
+const (
+	squashfsMagic    = "hsqs"
+	squashfsSuperLen = 96
+
+	// squashfsMetaSize is the size of uncompressed metadata blocks.
+	squashfsMetaSize = 8192
+	// squashfsUncompressed is set in the sizes of uncompressed blocks.
+	squashfsUncompressed = 1 << 24
+	squashfsNoFragment   = 0xffffffff
+)
+
+// Compression algorithms of SquashFS.
+const (
+	squashfsGzip = 1
+	squashfsLZMA = 2
+	squashfsLZO  = 3
+	squashfsXZ   = 4
+	squashfsLZ4  = 5
+	squashfsZstd = 6
+)
+
+// Inode types of SquashFS.
+const (
+	squashfsDir = iota + 1
+	squashfsFile
+	squashfsSymlink
+	squashfsBlockDev
+	squashfsCharDev
+	squashfsFifo
+	squashfsSocket
+	squashfsExtDir
+	squashfsExtFile
+	squashfsExtSymlink
+	squashfsExtBlockDev
+	squashfsExtCharDev
+	squashfsExtFifo
+	squashfsExtSocket
+)
+
+// squashfsSuper contains the fields of the superblock that are needed to
+// read a SquashFS image.
+type squashfsSuper struct {
+	BlockSize  uint32
+	FragCount  uint32
+	Compressor uint16
+	IDCount    uint16
+	RootInode  uint64
+	IDTable    uint64
+	InodeTable uint64
+	DirTable   uint64
+	FragTable  uint64
+}
+
+// squashfsReader reads the contents of a SquashFS image, as created by
+// mksquashfs, from ra.
+type squashfsReader struct {
+	ra    io.ReaderAt
+	super squashfsSuper
+	zstd  *zstd.Decoder
+
+	ids   []uint32
+	frags []squashfsFragment
+}
+
+// squashfsFragment is an entry in the fragment table.
+type squashfsFragment struct {
+	start uint64
+	size  uint32
+}
+
+// squashfsInode contains the parts of an inode that are needed to read
+// the file it describes.
+type squashfsInode struct {
+	typ   uint16
+	mode  uint16
+	uid   uint32
+	gid   uint32
+	mtime uint32
+
+	// For directories.
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+
+	// For regular files.
+	blocksStart uint64
+	size        uint64
+	frag        uint32
+	fragOffset  uint32
+	blocks      []uint32
+
+	// For symlinks and devices.
+	target string
+	dev    uint32
+}
+
+// newSquashfsReader reads the superblock and the tables of the image.
+func newSquashfsReader(ra io.ReaderAt) (*squashfsReader, error) {
+	var buf [squashfsSuperLen]byte
+	if _, err := ra.ReadAt(buf[:], 0); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if string(buf[:4]) != squashfsMagic {
+		return nil, ErrSquashFS
+	}
+	if major := binary.LittleEndian.Uint16(buf[28:]); major != 4 {
+		return nil, fmt.Errorf("unsupported squashfs version %d", major)
+	}
+	le := binary.LittleEndian
+	sr := &squashfsReader{ra: ra, super: squashfsSuper{
+		BlockSize:  le.Uint32(buf[12:]),
+		FragCount:  le.Uint32(buf[16:]),
+		Compressor: le.Uint16(buf[20:]),
+		IDCount:    le.Uint16(buf[26:]),
+		RootInode:  le.Uint64(buf[32:]),
+		IDTable:    le.Uint64(buf[48:]),
+		InodeTable: le.Uint64(buf[64:]),
+		DirTable:   le.Uint64(buf[72:]),
+		FragTable:  le.Uint64(buf[80:]),
+	}}
+	// Block sizes are powers of two from 4 KiB to 1 MiB, and the block log
+	// is their binary logarithm; anything else would let a crafted image
+	// divide by zero or allocate huge buffers.
+	bs, blockLog := sr.super.BlockSize, le.Uint16(buf[22:])
+	if bs < 4<<10 || bs > 1<<20 || bs&(bs-1) != 0 || blockLog > 31 || uint32(1)<<blockLog != bs {
+		return nil, ErrSquashFS
+	}
+	switch sr.super.Compressor {
+	case squashfsGzip, squashfsXZ, squashfsLZ4:
+	case squashfsZstd:
+		var err error
+		if sr.zstd, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported squashfs compression %d", sr.super.Compressor)
+	}
+
+	ids, err := sr.readTable(sr.super.IDTable, int(sr.super.IDCount), 4)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(ids); i += 4 {
+		sr.ids = append(sr.ids, le.Uint32(ids[i:]))
+	}
+	if sr.super.FragCount > 0 && sr.super.FragTable != ^uint64(0) {
+		frags, err := sr.readTable(sr.super.FragTable, int(sr.super.FragCount), 16)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(frags); i += 16 {
+			sr.frags = append(sr.frags, squashfsFragment{le.Uint64(frags[i:]), le.Uint32(frags[i+8:])})
+		}
+	}
+	return sr, nil
+}
+
+// close releases the resources of the decompressor.
+func (sr *squashfsReader) close() {
+	if sr.zstd != nil {
+		sr.zstd.Close()
+	}
+}
+
+// readTable reads a table of n entries of the given size. The table is
+// stored in metadata blocks, which are located by an array of pointers
+// starting at start.
+func (sr *squashfsReader) readTable(start uint64, n, size int) ([]byte, error) {
+	blocks := (n*size + squashfsMetaSize - 1) / squashfsMetaSize
+	ptrs := make([]byte, 8*blocks)
+	if _, err := sr.ra.ReadAt(ptrs, int64(start)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	var table []byte
+	for i := 0; i < blocks; i++ {
+		block, _, err := sr.readMetaBlock(binary.LittleEndian.Uint64(ptrs[8*i:]))
+		if err != nil {
+			return nil, err
+		}
+		table = append(table, block...)
+	}
+	if len(table) < n*size {
+		return nil, ErrSquashFS
+	}
+	return table[:n*size], nil
+}
+
+// readMetaBlock reads the metadata block at pos, returning its contents
+// and the position of the following block.
+func (sr *squashfsReader) readMetaBlock(pos uint64) ([]byte, uint64, error) {
+	var hdr [2]byte
+	if _, err := sr.ra.ReadAt(hdr[:], int64(pos)); err != nil {
+		return nil, 0, unexpectedEOF(err)
+	}
+	n := binary.LittleEndian.Uint16(hdr[:])
+	size := uint32(n & 0x7fff)
+	if n&0x8000 != 0 {
+		// The block is stored uncompressed.
+		size |= squashfsUncompressed
+	}
+	data, err := sr.readBlock(pos+2, size, squashfsMetaSize)
+	return data, pos + 2 + uint64(n&0x7fff), err
+}
+
+// readBlock reads the block at pos, which is stored in size bytes, and
+// decompresses it to at most max bytes.
+func (sr *squashfsReader) readBlock(pos uint64, size uint32, max int) ([]byte, error) {
+	raw := make([]byte, size&^squashfsUncompressed)
+	if _, err := sr.ra.ReadAt(raw, int64(pos)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if size&squashfsUncompressed != 0 {
+		return raw, nil
+	}
+
+	var data []byte
+	var err error
+	switch sr.super.Compressor {
+	case squashfsGzip:
+		var zr io.ReadCloser
+		if zr, err = zlib.NewReader(bytes.NewReader(raw)); err == nil {
+			data, err = ioutil.ReadAll(io.LimitReader(zr, int64(max)))
+			zr.Close()
+		}
+	case squashfsXZ:
+		var zr *xz.Reader
+		if zr, err = xz.NewReader(bytes.NewReader(raw)); err == nil {
+			data, err = ioutil.ReadAll(io.LimitReader(zr, int64(max)))
+		}
+	case squashfsLZ4:
+		data = make([]byte, max)
+		var n int
+		n, err = lz4.UncompressBlock(raw, data)
+		data = data[:n]
+	case squashfsZstd:
+		data, err = sr.zstd.DecodeAll(raw, nil)
+		if len(data) > max {
+			err = ErrSquashFS
+		}
+	}
+	return data, err
+}
+
+// metaReader reads a stream of data stored in consecutive metadata blocks.
+type metaReader struct {
+	sr   *squashfsReader
+	next uint64
+	buf  []byte
+}
+
+// newMetaReader returns a reader for the metadata starting at offset in
+// the block at pos.
+func (sr *squashfsReader) newMetaReader(pos uint64, offset int) (*metaReader, error) {
+	mr := &metaReader{sr: sr, next: pos}
+	if err := mr.fill(); err != nil {
+		return nil, err
+	}
+	if offset > len(mr.buf) {
+		return nil, ErrSquashFS
+	}
+	mr.buf = mr.buf[offset:]
+	return mr, nil
+}
+
+func (mr *metaReader) fill() error {
+	block, next, err := mr.sr.readMetaBlock(mr.next)
+	if err != nil {
+		return err
+	}
+	mr.buf, mr.next = block, next
+	return nil
+}
+
+func (mr *metaReader) Read(p []byte) (int, error) {
+	for len(mr.buf) == 0 {
+		if err := mr.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, mr.buf)
+	mr.buf = mr.buf[n:]
+	return n, nil
+}
+
+// readInode reads the inode with the reference ref, which consists of the
+// position of its metadata block within the inode table and its offset
+// within the block.
+func (sr *squashfsReader) readInode(ref uint64) (*squashfsInode, error) {
+	mr, err := sr.newMetaReader(sr.super.InodeTable+ref>>16, int(ref&0xffff))
+	if err != nil {
+		return nil, err
+	}
+	read := func(v interface{}) error {
+		return binary.Read(mr, binary.LittleEndian, v)
+	}
+
+	var hdr struct {
+		Type, Mode, UID, GID uint16
+		Mtime, Number        uint32
+	}
+	if err := read(&hdr); err != nil {
+		return nil, err
+	}
+	if int(hdr.UID) >= len(sr.ids) || int(hdr.GID) >= len(sr.ids) {
+		return nil, ErrSquashFS
+	}
+	in := &squashfsInode{
+		typ:   hdr.Type,
+		mode:  hdr.Mode,
+		uid:   sr.ids[hdr.UID],
+		gid:   sr.ids[hdr.GID],
+		mtime: hdr.Mtime,
+	}
+
+	switch hdr.Type {
+	case squashfsDir:
+		var d struct {
+			Block, Links uint32
+			Size, Offset uint16
+			Parent       uint32
+		}
+		err = read(&d)
+		in.dirBlock, in.dirOffset, in.dirSize = d.Block, d.Offset, uint32(d.Size)
+	case squashfsExtDir:
+		var d struct {
+			Links, Size, Block, Parent uint32
+			Indexes, Offset            uint16
+			Xattr                      uint32
+		}
+		err = read(&d)
+		in.dirBlock, in.dirOffset, in.dirSize = d.Block, d.Offset, d.Size
+	case squashfsFile:
+		var f struct {
+			Start, Frag, Offset, Size uint32
+		}
+		err = read(&f)
+		in.blocksStart, in.frag, in.fragOffset, in.size = uint64(f.Start), f.Frag, f.Offset, uint64(f.Size)
+	case squashfsExtFile:
+		var f struct {
+			Start, Size, Sparse        uint64
+			Links, Frag, Offset, Xattr uint32
+		}
+		err = read(&f)
+		in.blocksStart, in.frag, in.fragOffset, in.size = f.Start, f.Frag, f.Offset, f.Size
+	case squashfsSymlink, squashfsExtSymlink:
+		var s struct {
+			Links, Size uint32
+		}
+		if err = read(&s); err == nil {
+			if s.Size > 4096 {
+				return nil, ErrSquashFS
+			}
+			target := make([]byte, s.Size)
+			_, err = io.ReadFull(mr, target)
+			in.target = string(target)
+		}
+	case squashfsBlockDev, squashfsCharDev, squashfsExtBlockDev, squashfsExtCharDev:
+		var d struct {
+			Links, Dev uint32
+		}
+		err = read(&d)
+		in.dev = d.Dev
+	case squashfsFifo, squashfsSocket, squashfsExtFifo, squashfsExtSocket:
+	default:
+		return nil, ErrSquashFS
+	}
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	if hdr.Type == squashfsFile || hdr.Type == squashfsExtFile {
+		bs := uint64(sr.super.BlockSize)
+		n := in.size / bs
+		if in.frag == squashfsNoFragment && in.size%bs != 0 {
+			n++
+		}
+		if n > in.size/512+1 {
+			return nil, ErrSquashFS
+		}
+		in.blocks = make([]uint32, n)
+		if err := read(in.blocks); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	return in, nil
+}
+
+// squashfsDirEntry is an entry of a directory listing.
+type squashfsDirEntry struct {
+	name  string
+	inode uint64
+}
+
+// readDir reads the entries of the directory described by in.
+func (sr *squashfsReader) readDir(in *squashfsInode) ([]squashfsDirEntry, error) {
+	// The stored size includes three bytes for the implicit . and .. entries.
+	if in.dirSize <= 3 {
+		return nil, nil
+	}
+	mr, err := sr.newMetaReader(sr.super.DirTable+uint64(in.dirBlock), int(in.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+	r := io.LimitReader(mr, int64(in.dirSize-3))
+
+	var entries []squashfsDirEntry
+	for {
+		var hdr struct {
+			Count, Start, Number uint32
+		}
+		if err := binary.Read(r, binary.LittleEndian, &hdr); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if hdr.Count >= 256 {
+			return nil, ErrSquashFS
+		}
+		for i := uint32(0); i <= hdr.Count; i++ {
+			var e struct {
+				Offset uint16
+				Number int16
+				Type   uint16
+				Size   uint16
+			}
+			if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			name := make([]byte, int(e.Size)+1)
+			if _, err := io.ReadFull(r, name); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			entries = append(entries, squashfsDirEntry{
+				name:  string(name),
+				inode: uint64(hdr.Start)<<16 | uint64(e.Offset),
+			})
+		}
+	}
+}
+
+// fileReader returns a reader for the contents of the regular file in.
+func (sr *squashfsReader) fileReader(in *squashfsInode) io.Reader {
+	return &squashfsFileReader{sr: sr, in: in, pos: in.blocksStart}
+}
+
+// squashfsFileReader reads the contents of a regular file block by block.
+type squashfsFileReader struct {
+	sr    *squashfsReader
+	in    *squashfsInode
+	pos   uint64 // the position of the next block in the image
+	block int    // the index of the next block
+	buf   []byte
+	read  uint64 // the bytes that have been decompressed
+	err   error
+}
+
+func (fr *squashfsFileReader) Read(p []byte) (int, error) {
+	for len(fr.buf) == 0 {
+		if fr.err != nil {
+			return 0, fr.err
+		}
+		fr.buf, fr.err = fr.next()
+		if fr.err == nil && len(fr.buf) == 0 {
+			fr.err = io.EOF
+		}
+	}
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[n:]
+	return n, nil
+}
+
+// next returns the next block of the file, or the tail end that is stored
+// in a fragment.
+func (fr *squashfsFileReader) next() ([]byte, error) {
+	in, bs := fr.in, uint64(fr.sr.super.BlockSize)
+	remaining := in.size - fr.read
+	if remaining == 0 {
+		return nil, io.EOF
+	}
+	want := bs
+	if remaining < want {
+		want = remaining
+	}
+
+	var data []byte
+	if fr.block < len(in.blocks) {
+		size := in.blocks[fr.block]
+		fr.block++
+		if size&^squashfsUncompressed == 0 {
+			// A sparse block consists of zeros.
+			data = make([]byte, want)
+		} else {
+			var err error
+			if data, err = fr.sr.readBlock(fr.pos, size, int(bs)); err != nil {
+				return nil, err
+			}
+			fr.pos += uint64(size &^ squashfsUncompressed)
+		}
+	} else {
+		if in.frag == squashfsNoFragment || int(in.frag) >= len(fr.sr.frags) {
+			return nil, ErrSquashFS
+		}
+		f := fr.sr.frags[in.frag]
+		block, err := fr.sr.readBlock(f.start, f.size, int(bs))
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(block)) < uint64(in.fragOffset)+want {
+			return nil, ErrSquashFS
+		}
+		data = block[in.fragOffset : uint64(in.fragOffset)+want]
+	}
+	if uint64(len(data)) < want {
+		return nil, ErrSquashFS
+	}
+	data = data[:want]
+	fr.read += want
+	return data, nil
+}
+
+// header returns a tar header describing the inode, with the entry name.
+func (in *squashfsInode) header(name string) *tar.Header {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(in.mode & 07777),
+		Uid:     int(in.uid),
+		Gid:     int(in.gid),
+		ModTime: time.Unix(int64(in.mtime), 0),
+	}
+	switch in.typ {
+	case squashfsDir, squashfsExtDir:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case squashfsFile, squashfsExtFile:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(in.size)
+	case squashfsSymlink, squashfsExtSymlink:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = in.target
+	case squashfsBlockDev, squashfsExtBlockDev, squashfsCharDev, squashfsExtCharDev:
+		hdr.Typeflag = tar.TypeChar
+		if in.typ == squashfsBlockDev || in.typ == squashfsExtBlockDev {
+			hdr.Typeflag = tar.TypeBlock
+		}
+		// Devices are encoded like the new Linux dev_t.
+		hdr.Devmajor = int64(in.dev >> 8 & 0xfff)
+		hdr.Devminor = int64(in.dev&0xff | in.dev>>12&0xfff00)
+	case squashfsFifo, squashfsExtFifo:
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		return nil
+	}
+	return hdr
+}
+
+// walkSquashFS calls fn for each entry of the SquashFS image archive, in a
+// depth-first traversal of the file system. Sockets are skipped.
+func walkSquashFS(archive string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sr, err := newSquashfsReader(f)
+	if err != nil {
+		return err
+	}
+	defer sr.close()
+
+	root, err := sr.readInode(sr.super.RootInode)
+	if err != nil {
+		return err
+	}
+	if root.typ != squashfsDir && root.typ != squashfsExtDir {
+		return ErrSquashFS
+	}
+	return sr.walkDir(root, "", 0, fn)
+}
+
+// walkDir calls fn for all entries of the directory in, whose entry name is
+// dir, and recurses into its subdirectories.
+func (sr *squashfsReader) walkDir(in *squashfsInode, dir string, depth int, fn func(hdr *tar.Header, r io.Reader) error) error {
+	if depth > 256 {
+		return ErrSquashFS
+	}
+	entries, err := sr.readDir(in)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.name == "." || e.name == ".." || path.Base(e.name) != e.name {
+			return ErrSquashFS
+		}
+		child, err := sr.readInode(e.inode)
+		if err != nil {
+			return err
+		}
+		hdr := child.header(path.Join(dir, e.name))
+		if hdr == nil {
+			continue
+		}
+
+		var r io.Reader = bytes.NewReader(nil)
+		if hdr.Typeflag == tar.TypeReg {
+			r = sr.fileReader(child)
+		}
+		if err := fn(hdr, r); err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			if err := sr.walkDir(child, path.Join(dir, e.name), depth+1, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// testsquashfs is an xz-compressed image with a block size of 4096, which
+// contains files spanning several blocks, a sparse file, a symlink, and a
+// fifo.
+const testsquashfs = "testdata/blocks.sqsh"
+
+func TestSquashFSEntries(z *testing.T) {
+	assert := assert.New(z)
+
+	var large bytes.Buffer
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&large, "line %d\n", i)
+	}
+
+	entries := make(map[string]*tar.Header)
+	contents := make(map[string][]byte)
+	err := WalkArchive(testsquashfs, func(hdr *tar.Header, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		entries[hdr.Name], contents[hdr.Name] = hdr, data
+		return err
+	})
+	assert.Nil(err)
+	assert.Len(entries, 6)
+
+	assert.Equal(byte(tar.TypeDir), entries["sub/"].Typeflag)
+	assert.Equal(int64(0755), entries["sub/"].Mode)
+	assert.Equal(large.Bytes(), contents["sub/large"])
+	assert.Equal(int64(large.Len()), entries["sub/large"].Size)
+	assert.Equal(append(make([]byte, 16384), "end\n"...), contents["sparse"])
+	assert.Equal("small\n", string(contents["small"]))
+	assert.Equal(int64(0600), entries["small"].Mode)
+	assert.Equal(byte(tar.TypeSymlink), entries["link"].Typeflag)
+	assert.Equal("sub/large", entries["link"].Linkname)
+	assert.Equal(byte(tar.TypeFifo), entries["fifo"].Typeflag)
+	assert.Equal(int64(1400000000), entries["small"].ModTime.Unix())
+}
+
+func TestSquashFSExtract(z *testing.T) {
+	assert := assert.New(z)
+
+	dest, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dest)
+
+	assert.Nil(ExtractArchive(testsquashfs, dest))
+	data, err := ioutil.ReadFile(filepath.Join(dest, "link"))
+	assert.Nil(err)
+	assert.Equal("line 0\n", string(data[:7]))
+	fi, err := os.Stat(filepath.Join(dest, "sparse"))
+	if assert.Nil(err) {
+		assert.Equal(int64(16388), fi.Size())
+	}
+}
+
+func TestSquashFSMalformed(z *testing.T) {
+	assert := assert.New(z)
+
+	data, err := ioutil.ReadFile(testsquashfs)
+	assert.Nil(err)
+	defer os.Remove(testdest)
+
+	// A truncated image must fail without panicking.
+	for _, n := range []int{4, 100, 1000} {
+		assert.Nil(ioutil.WriteFile(testdest, data[:n], 0644))
+		assert.NotNil(walkSquashFS(testdest, func(*tar.Header, io.Reader) error { return nil }), n)
+	}
+
+	// So must an image with an invalid block size or block log.
+	for _, c := range []struct {
+		blockSize uint32
+		blockLog  uint16
+	}{{0, 0}, {1 << 31, 31}, {5000, 12}, {1 << 12, 13}, {1 << 21, 21}} {
+		bad := append([]byte(nil), data...)
+		binary.LittleEndian.PutUint32(bad[12:], c.blockSize)
+		binary.LittleEndian.PutUint16(bad[22:], c.blockLog)
+		assert.Nil(ioutil.WriteFile(testdest, bad, 0644))
+		err := walkSquashFS(testdest, func(*tar.Header, io.Reader) error { return nil })
+		assert.Equal(ErrSquashFS, err, c.blockSize)
+	}
+}
+
+func TestSquashFSBlocks(z *testing.T) {
+	assert := assert.New(z)
+
+	data := bytes.Repeat([]byte("squashfs block\n"), 500)
+
+	zenc, err := zstd.NewWriter(nil)
+	assert.Nil(err)
+	zdata := zenc.EncodeAll(data, nil)
+	zenc.Close()
+	ldata := make([]byte, lz4.CompressBlockBound(len(data)))
+	n, err := lz4.CompressBlock(data, ldata, nil)
+	assert.Nil(err)
+	ldata = ldata[:n]
+
+	for compressor, block := range map[uint16][]byte{squashfsZstd: zdata, squashfsLZ4: ldata} {
+		sr := &squashfsReader{ra: bytes.NewReader(block), super: squashfsSuper{Compressor: compressor}}
+		if compressor == squashfsZstd {
+			sr.zstd, err = zstd.NewReader(nil)
+			assert.Nil(err)
+		}
+		out, err := sr.readBlock(0, uint32(len(block)), 8192)
+		assert.Nil(err, compressor)
+		assert.Equal(data, out, compressor)
+		sr.close()
+	}
+}
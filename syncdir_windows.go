@@ -0,0 +1,11 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+// syncDir does nothing, as directories cannot be synced on Windows, where
+// renames are persisted by the file system itself.
+func syncDir(dir string) error {
+	return nil
+}
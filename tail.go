@@ -0,0 +1,237 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is how often Follow checks for new data, unless
+// PollInterval says otherwise.
+const defaultPollInterval = 250 * time.Millisecond
+
+// TailReader reads the data that is appended to a file, like tail -F. It
+// is returned by Follow.
+type TailReader struct {
+	path     string
+	ctx      context.Context
+	interval time.Duration
+	closed   chan struct{}
+	once     sync.Once
+
+	mu     sync.Mutex
+	f      *os.File
+	offset int64 // of f
+}
+
+// Follow opens the file at path and returns a TailReader that reads from
+// its end, or from the start of its last lines with LastLines, and then
+// waits for more data to be appended. The file is checked for new data
+// every quarter of a second, unless PollInterval says otherwise.
+//
+// If the file is truncated, reading starts again from its start. If it is
+// rotated, that is, renamed and replaced by a new file at path, the rest of
+// the old file is read and then the new file from its start. Reading stops
+// when ctx is done or Close is called.
+func Follow(ctx context.Context, path string, opts ...TailOption) (*TailReader, error) {
+	var o tailOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.pollInterval <= 0 {
+		o.pollInterval = defaultPollInterval
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	offset, err := tailOffset(f, fi.Size(), o.lastLines)
+	if err == nil {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &TailReader{
+		path:     path,
+		ctx:      ctx,
+		interval: o.pollInterval,
+		closed:   make(chan struct{}),
+		f:        f,
+		offset:   offset,
+	}, nil
+}
+
+// Read reads data that was appended to the file, waiting until there is
+// some. When ctx is done, it returns the error of ctx, and after Close,
+// io.EOF.
+func (t *TailReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-t.closed:
+			return 0, io.EOF
+		default:
+		}
+		n, changed, err := t.read(p)
+		if err != nil {
+			// The file may have been closed by Close while it was read.
+			select {
+			case <-t.closed:
+				return n, io.EOF
+			default:
+			}
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+		if changed {
+			continue
+		}
+		if timer == nil {
+			timer = time.NewTimer(t.interval)
+		} else {
+			timer.Reset(t.interval)
+		}
+		select {
+		case <-t.ctx.Done():
+			return 0, t.ctx.Err()
+		case <-t.closed:
+			return 0, io.EOF
+		case <-timer.C:
+		}
+	}
+}
+
+// read reads from the current file, and if there is nothing to read,
+// checks whether the file was truncated or rotated, returning changed =
+// true if so.
+func (t *TailReader) read(p []byte) (n int, changed bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, err = t.f.Read(p)
+	t.offset += int64(n)
+	if n > 0 || err != io.EOF {
+		return n, false, err
+	}
+
+	cur, err := t.f.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+	fi, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		// The file was rotated, but not replaced yet.
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	if !os.SameFile(cur, fi) {
+		f, err := os.Open(t.path)
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		} else if err != nil {
+			return 0, false, err
+		}
+		t.f.Close()
+		t.f, t.offset = f, 0
+		return 0, true, nil
+	}
+	if cur.Size() < t.offset {
+		if _, err := t.f.Seek(0, io.SeekStart); err != nil {
+			return 0, false, err
+		}
+		t.offset = 0
+		return 0, true, nil
+	}
+	return 0, false, nil
+}
+
+// Close stops reading and closes the file.
+func (t *TailReader) Close() error {
+	var err error
+	t.once.Do(func() {
+		close(t.closed)
+		t.mu.Lock()
+		err = t.f.Close()
+		t.mu.Unlock()
+	})
+	return err
+}
+
+// TailLines returns the last n lines of the file at path, without their
+// line endings, as with ReadLines. The file is read backwards from its end
+// in blocks, so that only the data of these lines and a little more is
+// read, however large the file is.
+func TailLines(path string, n int) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := tailOffset(f, fi.Size(), n)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	err = forEachLine(io.NewSectionReader(f, offset, fi.Size()-offset), func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}, false)
+	return lines, err
+}
+
+// tailOffset returns the offset of the start of the last n lines of r,
+// which is size bytes long, reading backwards in blocks. A newline at the
+// end does not start another line.
+func tailOffset(r io.ReaderAt, size int64, n int) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+	buf := make([]byte, bufferSize)
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		b := buf[:end-start]
+		if _, err := r.ReadAt(b, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(b) - 1; i >= 0; i-- {
+			if b[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			if n--; n == 0 {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailOffset(z *testing.T) {
+	assert := assert.New(z)
+
+	long := strings.Repeat("x", 3*bufferSize/2)
+	for _, tc := range []struct {
+		data     string
+		n        int
+		expected string
+	}{
+		{"", 3, ""},
+		{"a\nb\nc\n", 0, ""},
+		{"a\nb\nc\n", 1, "c\n"},
+		{"a\nb\nc\n", 2, "b\nc\n"},
+		{"a\nb\nc", 2, "b\nc"},
+		{"a\nb\nc\n", 5, "a\nb\nc\n"},
+		{"\n\n\n", 2, "\n\n"},
+		{"a\n" + long + "\n" + long + "\n", 2, long + "\n" + long + "\n"},
+	} {
+		r := strings.NewReader(tc.data)
+		offset, err := tailOffset(r, r.Size(), tc.n)
+		assert.Nil(err)
+		assert.Equal(tc.expected, tc.data[offset:], tc.data)
+	}
+}
+
+func TestTailLines(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log")
+
+	var data strings.Builder
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&data, "line %d\r\n", i)
+	}
+	assert.Nil(ioutil.WriteFile(file, []byte(data.String()), 0644))
+	lines, err := TailLines(file, 3)
+	assert.Nil(err)
+	assert.Equal([]string{"line 99997", "line 99998", "line 99999"}, lines)
+
+	assert.Nil(ioutil.WriteFile(file, []byte("a\nb"), 0644))
+	lines, err = TailLines(file, 10)
+	assert.Nil(err)
+	assert.Equal([]string{"a", "b"}, lines)
+	lines, err = TailLines(file, 0)
+	assert.Nil(err)
+	assert.Empty(lines)
+
+	_, err = TailLines(filepath.Join(dir, "missing"), 1)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestFollow(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "log")
+	assert.Nil(ioutil.WriteFile(file, []byte("one\ntwo\nthree\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t, err := Follow(ctx, file, LastLines(2), PollInterval(10*time.Millisecond))
+	assert.Nil(err)
+	defer t.Close()
+	lines := make(chan string)
+	go func() {
+		s := bufio.NewScanner(t)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		close(lines)
+	}()
+	expect := func(line string) {
+		select {
+		case got := <-lines:
+			assert.Equal(line, got)
+		case <-time.After(time.Second):
+			z.Errorf("expected line %q", line)
+		}
+	}
+	appendLine := func(path, line string) {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		assert.Nil(err)
+		f.WriteString(line + "\n")
+		f.Close()
+	}
+
+	expect("two")
+	expect("three")
+	appendLine(file, "four")
+	expect("four")
+
+	// Truncated files are read from the start.
+	assert.Nil(ioutil.WriteFile(file, []byte("a\n"), 0644))
+	expect("a")
+
+	// Rotated files are read to the end before the new file.
+	assert.Nil(os.Rename(file, file+".1"))
+	appendLine(file+".1", "b")
+	time.Sleep(50 * time.Millisecond)
+	appendLine(file, "c")
+	expect("b")
+	expect("c")
+
+	cancel()
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case _, ok := <-lines:
+			done = !ok
+		case <-timeout:
+			z.Fatal("reading did not stop")
+		}
+	}
+	n, err := t.Read(make([]byte, 1))
+	assert.Equal(0, n)
+	assert.Equal(context.Canceled, err)
+	assert.Nil(t.Close())
+	_, err = t.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+
+	// Closing while reading ends the read with io.EOF.
+	assert.Nil(ioutil.WriteFile(file, []byte(strings.Repeat("x\n", 1<<16)), 0644))
+	t, err = Follow(context.Background(), file, LastLines(1<<16))
+	assert.Nil(err)
+	result := make(chan error)
+	go func() {
+		_, err := io.Copy(ioutil.Discard, t)
+		result <- err
+	}()
+	assert.Nil(t.Close())
+	select {
+	case err := <-result:
+		assert.Nil(err)
+	case <-time.After(time.Second):
+		z.Fatal("reading did not stop")
+	}
+
+	_, err = Follow(context.Background(), filepath.Join(dir, "missing"))
+	assert.True(os.IsNotExist(err))
+}
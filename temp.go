@@ -0,0 +1,107 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// tempFiles contains the temporary files and directories registered with
+// RemoveOnExit that have not been removed yet.
+var tempFiles = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: make(map[string]bool)}
+
+// TempFile creates a temporary file like ioutil.TempFile and returns it
+// together with a function that closes and removes it, which may be called
+// more than once. With RemoveOnExit, the file is also removed by
+// RemoveTempFiles, unless it was removed before.
+func TempFile(dir, pattern string, opts ...TempOption) (f *os.File, cleanup func(), err error) {
+	f, err = ioutil.TempFile(dir, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := newTempCleanup(f.Name(), opts)
+	return f, func() {
+		f.Close()
+		remove()
+	}, nil
+}
+
+// TempDir creates a temporary directory like ioutil.TempDir and returns
+// its name together with a function that removes it and all of its
+// contents, which may be called more than once. With RemoveOnExit, the
+// directory is also removed by RemoveTempFiles, unless it was removed
+// before.
+func TempDir(dir, pattern string, opts ...TempOption) (name string, cleanup func(), err error) {
+	name, err = ioutil.TempDir(dir, pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	return name, newTempCleanup(name, opts), nil
+}
+
+// WithTempDir creates a temporary directory like ioutil.TempDir, calls fn
+// with its name, and removes it with all of its contents afterwards, even
+// if fn panics. The error of fn is returned, or otherwise any error that
+// occurs while removing the directory.
+func WithTempDir(dir, pattern string, fn func(dir string) error) (err error) {
+	name, err := ioutil.TempDir(dir, pattern)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if rerr := os.RemoveAll(name); err == nil {
+			err = rerr
+		}
+	}()
+	return fn(name)
+}
+
+// newTempCleanup returns a function that removes path, which it registers
+// with RemoveOnExit if opts request this.
+func newTempCleanup(path string, opts []TempOption) func() {
+	var o tempOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.removeOnExit {
+		registerTemp(path)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.RemoveAll(path)
+			tempFiles.Lock()
+			delete(tempFiles.paths, path)
+			tempFiles.Unlock()
+		})
+	}
+}
+
+// registerTemp registers path for removal by RemoveTempFiles.
+func registerTemp(path string) {
+	tempFiles.Lock()
+	tempFiles.paths[path] = true
+	tempFiles.Unlock()
+}
+
+// RemoveTempFiles removes all temporary files and directories created with
+// RemoveOnExit that have not been removed yet. As Go programs have no exit
+// hooks, RemoveTempFiles should be called before the program exits
+// normally, for example by deferring it in main. Nor are the files removed
+// when the program is interrupted or terminated by a signal; programs that
+// want this should call RemoveTempFiles from their own signal handler.
+func RemoveTempFiles() {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	for path := range tempFiles.paths {
+		os.RemoveAll(path)
+		delete(tempFiles.paths, path)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTempFile(z *testing.T) {
+	assert := assert.New(z)
+
+	f, cleanup, err := TempFile("", "osutil")
+	assert.Nil(err)
+	_, err = f.Write([]byte("data"))
+	assert.Nil(err)
+	cleanup()
+	cleanup()
+	_, err = os.Stat(f.Name())
+	assert.True(os.IsNotExist(err))
+
+	dir, cleanup, err := TempDir("", "osutil")
+	assert.Nil(err)
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+	cleanup()
+	_, err = os.Stat(dir)
+	assert.True(os.IsNotExist(err))
+
+	// Registered files are removed by RemoveTempFiles, unless they were
+	// already cleaned up.
+	f, _, err = TempFile("", "osutil", RemoveOnExit())
+	assert.Nil(err)
+	f.Close()
+	dir, cleanup, err = TempDir("", "osutil", RemoveOnExit())
+	assert.Nil(err)
+	cleanup()
+	assert.Nil(os.Mkdir(dir, 0755))
+	defer os.Remove(dir)
+	RemoveTempFiles()
+	_, err = os.Stat(f.Name())
+	assert.True(os.IsNotExist(err))
+	ex, err := DirExists(dir)
+	assert.Nil(err)
+	assert.True(ex)
+}
+
+func TestWithTempDir(z *testing.T) {
+	assert := assert.New(z)
+
+	var dir string
+	errFail := errors.New("fail")
+	err := WithTempDir("", "osutil", func(name string) error {
+		dir = name
+		assert.Nil(ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644))
+		return errFail
+	})
+	assert.Equal(errFail, err)
+	_, err = os.Stat(dir)
+	assert.True(os.IsNotExist(err))
+
+	assert.Panics(func() {
+		WithTempDir("", "osutil", func(name string) error {
+			dir = name
+			panic("fail")
+		})
+	})
+	_, err = os.Stat(dir)
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Tolerant lets ExtractArchive, ReadFileFromArchive, and ListArchive keep
+// reading the entries of a damaged or truncated tar archive, compressed or
+// not, as far as possible. Corrupt headers are skipped by searching for the
+// next valid header, and reading stops where the archive is truncated.
+// The entries that can be recovered are processed as usual, and a
+// DamagedError describing the first damage is returned at the end. The
+// entry at which an archive is truncated may be incomplete.
+func Tolerant() Option {
+	return archiveOption(func(o *archiveOptions) {
+		o.tolerant = true
+	})
+}
+
+const tarBlockSize = 512
+
+// walkTarTolerant calls fn for each entry of the tar stream r that can be
+// recovered, as described by Tolerant.
+func walkTarTolerant(archive string, r io.Reader, fn func(hdr *tar.Header, r io.Reader) error) error {
+	cr := &countingReader{r: r}
+	tr := tar.NewReader(cr)
+
+	var damage error
+	found := func(off int64, err error) {
+		if damage == nil {
+			damage = DamagedError{archive, off, err}
+		}
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if !errors.Is(err, tar.ErrHeader) {
+				// The stream itself is truncated or corrupt, so nothing
+				// after this point can be recovered.
+				found(cr.n, err)
+				break
+			}
+			// The invalid header has been read completely.
+			found(cr.n-tarBlockSize, err)
+			block, err := nextTarHeader(cr)
+			if err != nil {
+				break
+			}
+			tr = tar.NewReader(io.MultiReader(bytes.NewReader(block), cr))
+			continue
+		}
+
+		er := &errorReader{r: tr}
+		if err := fn(hdr, er); err != nil {
+			if er.err != nil && errors.Is(err, er.err) {
+				found(cr.n, er.err)
+				break
+			}
+			if err == StopWalk && damage != nil {
+				return damage
+			}
+			return err
+		}
+	}
+	return damage
+}
+
+// nextTarHeader reads blocks from r until it finds one that is a valid tar
+// header, and returns it.
+func nextTarHeader(r io.Reader) ([]byte, error) {
+	block := make([]byte, tarBlockSize)
+	for {
+		if _, err := io.ReadFull(r, block); err != nil {
+			return nil, err
+		}
+		if isTarHeader(block) {
+			return block, nil
+		}
+	}
+}
+
+// isTarHeader returns true if the block has the checksum of a tar header.
+func isTarHeader(block []byte) bool {
+	field := strings.Trim(string(block[148:156]), " \x00")
+	want, err := strconv.ParseInt(field, 8, 64)
+	if err != nil || block[0] == 0 {
+		return false
+	}
+	// The checksum is computed with the checksum field set to spaces.
+	// Some old implementations used signed bytes.
+	var unsigned, signed int64
+	for i, b := range block {
+		if i >= 148 && i < 156 {
+			b = ' '
+		}
+		unsigned += int64(b)
+		signed += int64(int8(b))
+	}
+	return want == unsigned || want == signed
+}
+
+// errorReader records the first error other than io.EOF returned by r.
+type errorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (er *errorReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	if err != nil && err != io.EOF && er.err == nil {
+		er.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// damagedArchive writes an archive in the format containing the files a, b,
+// and c, after letting damage modify its contents, and returns its name.
+func damagedArchive(z *testing.T, format Format, damage func([]byte) []byte) string {
+	ab, err := NewArchiveBuilder(format)
+	assert.Nil(z, err)
+	for _, name := range []string{"a", "b", "c"} {
+		assert.Nil(z, ab.AddFile(name, []byte(name+" contents\n"), 0644))
+	}
+	data, err := ab.Bytes()
+	assert.Nil(z, err)
+
+	dest := testdest + ".tar"
+	if format == FormatGzip {
+		dest += ".gz"
+	}
+	assert.Nil(z, ioutil.WriteFile(dest, damage(data), 0644))
+	return dest
+}
+
+func entryNames(entries []ArchiveEntry) []string {
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestTolerantCorruptHeader(z *testing.T) {
+	assert := assert.New(z)
+
+	// The header of b follows the header and the data block of a.
+	archive := damagedArchive(z, FormatTar, func(data []byte) []byte {
+		data[2*tarBlockSize] = 'x'
+		return data
+	})
+	defer os.Remove(archive)
+
+	_, err := ListArchive(archive)
+	assert.NotNil(err)
+
+	entries, err := ListArchive(archive, Tolerant())
+	assert.Equal([]string{"a", "c"}, entryNames(entries))
+	if assert.IsType(DamagedError{}, err) {
+		assert.Equal(int64(2*tarBlockSize), err.(DamagedError).Offset)
+	}
+
+	data, err := ReadFileFromArchive(archive, "c", Tolerant())
+	assert.IsType(DamagedError{}, err)
+	assert.Equal("c contents\n", string(data))
+}
+
+func TestTolerantTruncated(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, format := range []Format{FormatTar, FormatGzip} {
+		archive := damagedArchive(z, format, func(data []byte) []byte {
+			if format == FormatGzip {
+				return data[:len(data)-20]
+			}
+			// Cut the archive in the middle of the data of c.
+			return data[:5*tarBlockSize+4]
+		})
+
+		entries, err := ListArchive(archive, Tolerant())
+		assert.IsType(DamagedError{}, err, format)
+		assert.Contains(entryNames(entries), "b", format)
+
+		dir, err := ioutil.TempDir("", "osutil")
+		assert.Nil(err)
+		err = ExtractArchive(archive, dir, Tolerant())
+		assert.IsType(DamagedError{}, err, format)
+		data, err := ioutil.ReadFile(filepath.Join(dir, "b"))
+		assert.Nil(err, format)
+		assert.Equal("b contents\n", string(data), format)
+
+		os.RemoveAll(dir)
+		os.Remove(archive)
+	}
+}
+
+func TestTolerantIntact(z *testing.T) {
+	assert := assert.New(z)
+
+	for _, archive := range testarchives {
+		entries, err := ListArchive(archive, Tolerant())
+		assert.Nil(err, archive)
+		assert.Len(entries, 7, archive)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"time"
+)
+
+// Touch sets the access and modification times of the file at path to the
+// current time, creating it as an empty file if it does not exist, like
+// touch(1).
+func Touch(path string) error {
+	return TouchTime(path, time.Now())
+}
+
+// TouchTime is the same as Touch, except that the times are set to t.
+func TouchTime(path string, t time.Time) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		// Directories and files that cannot be written can still be
+		// touched by their owner.
+		if _, serr := os.Stat(path); serr != nil {
+			return err
+		}
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, t, t)
+}
+
+// TouchExisting is the same as TouchTime, except that nothing is done if
+// the file does not exist, like touch -c.
+func TouchExisting(path string, t time.Time) error {
+	err := os.Chtimes(path, t, t)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTouch(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	before := time.Now().Add(-time.Second)
+	assert.Nil(Touch(path))
+	fi, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(int64(0), fi.Size())
+	assert.True(fi.ModTime().After(before))
+
+	// Existing contents are kept.
+	t := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(ioutil.WriteFile(path, []byte("data"), 0644))
+	assert.Nil(TouchTime(path, t))
+	fi, err = os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(int64(4), fi.Size())
+	assert.True(fi.ModTime().Equal(t))
+
+	assert.Nil(TouchTime(dir, t))
+	fi, err = os.Stat(dir)
+	assert.Nil(err)
+	assert.True(fi.ModTime().Equal(t))
+
+	missing := filepath.Join(dir, "missing")
+	assert.Nil(TouchExisting(missing, t))
+	_, err = os.Stat(missing)
+	assert.True(os.IsNotExist(err))
+	assert.Nil(TouchExisting(path, t.Add(time.Hour)))
+	fi, err = os.Stat(path)
+	assert.Nil(err)
+	assert.True(fi.ModTime().Equal(t.Add(time.Hour)))
+
+	assert.NotNil(Touch(filepath.Join(dir, "missing/file")))
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Trash moves the file or directory at path to the trash of the desktop,
+// from where the user can restore it, instead of removing it. It returns
+// the name of the file in the trash, if this is known.
+//
+// On Linux and the BSDs, the freedesktop.org trash specification is
+// followed: files are moved to the trash in the home directory of the user,
+// or, if they are on another file system, to the trash in the top directory
+// of that file system. On macOS, files are moved to ~/.Trash, which is only
+// possible for files on the same file system as the home directory. On
+// Windows, files are moved to the Recycle Bin, and the returned name is
+// empty. Other platforms are not supported.
+func Trash(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return "", err
+	}
+	return trashFile(abs)
+}
+
+// RestoreTrash moves the file with the name trashed, as returned by Trash,
+// back to where it was before it was trashed, and returns this path. If a
+// file exists there now, an error is returned and nothing is changed.
+//
+// This is only supported for the freedesktop.org trash, which records
+// where trashed files came from.
+func RestoreTrash(trashed string) (string, error) {
+	abs, err := filepath.Abs(trashed)
+	if err != nil {
+		return "", err
+	}
+	return restoreFile(abs)
+}
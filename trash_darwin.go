@@ -0,0 +1,53 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// trashFile moves path to ~/.Trash, under a name that is not taken yet.
+func trashFile(path string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".Trash")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = strings.TrimSuffix(base, ext) + " " + strconv.Itoa(i) + ext
+		}
+		dst := filepath.Join(dir, name)
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		if err := os.Rename(path, dst); err != nil {
+			return "", err
+		}
+		return dst, nil
+	}
+}
+
+// restoreFile returns an error, as ~/.Trash does not record where trashed
+// files came from in a documented way.
+func restoreFile(trashed string) (string, error) {
+	return "", &os.PathError{Op: "restore", Path: trashed, Err: errors.New("restoring from the trash is not supported on macOS")}
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package osutil
+
+import (
+	"errors"
+	"os"
+)
+
+// errTrashUnsupported is returned by Trash and RestoreTrash on this
+// platform.
+var errTrashUnsupported = errors.New("the trash is not supported on this platform")
+
+// trashFile returns an error, as there is no trash on this platform.
+func trashFile(path string) (string, error) {
+	return "", &os.PathError{Op: "trash", Path: path, Err: errTrashUnsupported}
+}
+
+// restoreFile returns an error, as there is no trash on this platform.
+func restoreFile(trashed string) (string, error) {
+	return "", &os.PathError{Op: "restore", Path: trashed, Err: errTrashUnsupported}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(z *testing.T) {
+	if runtime.GOOS != "linux" {
+		z.Skip("the freedesktop.org trash is only tested on Linux")
+	}
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+	os.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	trash := filepath.Join(dir, "data/Trash")
+
+	file := filepath.Join(dir, "some file")
+	assert.Nil(ioutil.WriteFile(file, []byte("first"), 0644))
+	trashed, err := Trash(file)
+	assert.Nil(err)
+	assert.Equal(filepath.Join(trash, "files/some file"), trashed)
+	ex, err := LExists(file)
+	assert.Nil(err)
+	assert.False(ex)
+
+	info, err := ioutil.ReadFile(filepath.Join(trash, "info/some file.trashinfo"))
+	assert.Nil(err)
+	lines := strings.Split(string(info), "\n")
+	assert.Equal("[Trash Info]", lines[0])
+	assert.Equal("Path="+strings.Replace(file, " ", "%20", -1), lines[1])
+	assert.True(strings.HasPrefix(lines[2], "DeletionDate="))
+
+	// A second file with the same name gets another name in the trash.
+	assert.Nil(ioutil.WriteFile(file, []byte("second"), 0644))
+	trashed2, err := Trash(file)
+	assert.Nil(err)
+	assert.Equal(filepath.Join(trash, "files/some file.2"), trashed2)
+
+	restored, err := RestoreTrash(trashed)
+	assert.Nil(err)
+	assert.Equal(file, restored)
+	data, err := ioutil.ReadFile(file)
+	assert.Nil(err)
+	assert.Equal("first", string(data))
+	ex, err = LExists(filepath.Join(trash, "info/some file.trashinfo"))
+	assert.Nil(err)
+	assert.False(ex)
+
+	_, err = RestoreTrash(trashed2)
+	assert.True(os.IsExist(err))
+	_, err = Trash(filepath.Join(dir, "missing"))
+	assert.True(os.IsNotExist(err))
+	_, err = RestoreTrash(file)
+	assert.NotNil(err)
+}
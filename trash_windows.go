@@ -0,0 +1,69 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procSHFileOperationW = windows.NewLazySystemDLL("shell32.dll").NewProc("SHFileOperationW")
+
+// Values for shFileOpStruct.
+const (
+	foDelete          = 0x3
+	fofSilent         = 0x4
+	fofNoConfirmation = 0x10
+	fofAllowUndo      = 0x40
+	fofNoErrorUI      = 0x400
+)
+
+// shFileOpStruct is SHFILEOPSTRUCTW. On 32-bit Windows, the fields after
+// fFlags are packed without padding, which does not matter here, as they
+// are all zero and not read.
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+// trashFile moves path to the Recycle Bin with SHFileOperation, which
+// does not tell where it went.
+func trashFile(path string) (string, error) {
+	from, err := windows.UTF16FromString(path)
+	if err != nil {
+		return "", err
+	}
+	// The list of files is terminated by an empty string.
+	from = append(from, 0)
+	op := shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofSilent | fofNoConfirmation | fofAllowUndo | fofNoErrorUI,
+	}
+	r, _, _ := procSHFileOperationW.Call(uintptr(unsafe.Pointer(&op)))
+	if r != 0 {
+		return "", &os.PathError{Op: "SHFileOperation", Path: path, Err: syscall.Errno(r)}
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return "", &os.PathError{Op: "SHFileOperation", Path: path, Err: errors.New("operation aborted")}
+	}
+	return "", nil
+}
+
+// restoreFile returns an error, as files cannot be restored from the
+// Recycle Bin without the shell.
+func restoreFile(trashed string) (string, error) {
+	return "", &os.PathError{Op: "restore", Path: trashed, Err: errors.New("restoring from the Recycle Bin is not supported")}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build aix || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix dragonfly freebsd linux netbsd openbsd solaris
+
+package osutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// trashFile moves path to the home trash, if it is on the same file system,
+// or to the trash in the top directory of its file system otherwise.
+func trashFile(path string) (string, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	home, err := homeTrash()
+	if err != nil {
+		return "", err
+	}
+	if sameDevice(fi, home) {
+		return trashInto(home, path, path)
+	}
+
+	top := mountTop(path, fi)
+	dir, err := topdirTrash(top)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(top, path)
+	if err != nil {
+		return "", err
+	}
+	return trashInto(dir, path, rel)
+}
+
+// homeTrash returns the home trash directory, creating it if necessary.
+func homeTrash() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if !filepath.IsAbs(data) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	dir := filepath.Join(data, "Trash")
+	if err := makeTrash(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// topdirTrash returns the trash directory of the current user in the top
+// directory top of a file system, creating it if necessary. This is either
+// $top/.Trash/$uid, if the administrator created $top/.Trash with the
+// sticky bit, or $top/.Trash-$uid.
+func topdirTrash(top string) (string, error) {
+	uid := strconv.Itoa(os.Getuid())
+	admin := filepath.Join(top, ".Trash")
+	if fi, err := os.Lstat(admin); err == nil && fi.IsDir() && fi.Mode()&os.ModeSticky != 0 {
+		dir := filepath.Join(admin, uid)
+		if err := makeTrash(dir); err == nil {
+			return dir, nil
+		}
+	}
+	dir := filepath.Join(top, ".Trash-"+uid)
+	if err := makeTrash(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// makeTrash creates the files and info directories of the trash dir.
+func makeTrash(dir string) error {
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return FileTypeError{dir}
+	}
+	return nil
+}
+
+// trashInto moves path into the trash dir and records that it came from
+// orig, which is either absolute or relative to the top directory.
+func trashInto(dir, path, orig string) (string, error) {
+	base := filepath.Base(path)
+	date := time.Now().Format("2006-01-02T15:04:05")
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n", (&url.URL{Path: orig}).EscapedPath(), date)
+
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = base + "." + strconv.Itoa(i)
+		}
+		// The info file is created first to reserve the name.
+		infoPath := filepath.Join(dir, "info", name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		dst := filepath.Join(dir, "files", name)
+		if _, err := os.Lstat(dst); err == nil {
+			f.Close()
+			os.Remove(infoPath)
+			continue
+		}
+		_, err = f.WriteString(info)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(path, dst)
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			return "", err
+		}
+		return dst, nil
+	}
+}
+
+// restoreFile moves trashed back to where its info file says it came from.
+func restoreFile(trashed string) (string, error) {
+	files := filepath.Dir(trashed)
+	dir := filepath.Dir(files)
+	if filepath.Base(files) != "files" {
+		return "", &os.PathError{Op: "restore", Path: trashed, Err: errors.New("not in a trash directory")}
+	}
+	infoPath := filepath.Join(dir, "info", filepath.Base(trashed)+".trashinfo")
+	orig, err := readTrashInfo(infoPath)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(orig) {
+		top := filepath.Dir(dir)
+		if filepath.Base(top) == ".Trash" {
+			top = filepath.Dir(top)
+		}
+		orig = filepath.Join(top, orig)
+	}
+
+	if _, err := os.Lstat(orig); err == nil {
+		return "", &os.PathError{Op: "restore", Path: orig, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := EnsureParentDir(orig); err != nil {
+		return "", err
+	}
+	if err := os.Rename(trashed, orig); err != nil {
+		return "", err
+	}
+	os.Remove(infoPath)
+	return orig, nil
+}
+
+// readTrashInfo returns the original path recorded in the info file.
+func readTrashInfo(infoPath string) (string, error) {
+	f, err := os.Open(infoPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	header := false
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "[") {
+			header = line == "[Trash Info]"
+		} else if header && strings.HasPrefix(line, "Path=") {
+			return url.PathUnescape(strings.TrimPrefix(line, "Path="))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", FormatError{infoPath}
+}
+
+// mountTop returns the top directory of the file system that path, with
+// the FileInfo fi, is on.
+func mountTop(path string, fi os.FileInfo) string {
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		if !sameDevice(fi, parent) {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// sameDevice returns true if the file with the FileInfo fi is on the same
+// file system as the file at path.
+func sameDevice(fi os.FileInfo, path string) bool {
+	pfi, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	a, aok := fi.Sys().(*syscall.Stat_t)
+	b, bok := pfi.Sys().(*syscall.Stat_t)
+	return aok && bok && uint64(a.Dev) == uint64(b.Dev)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// ChmodRecursive sets the permissions of all files in the tree at root to
+// fileMode and those of all directories, including root, to dirMode, like
+// chmod -R, as in the common case of 0755 for directories and 0644 for
+// files. Symlinks are skipped, as changing their modes would change those of
+// their targets, which might be outside of the tree.
+func ChmodRecursive(root string, fileMode, dirMode os.FileMode) error {
+	return ChmodRecursiveFunc(root, func(fi os.FileInfo) os.FileMode {
+		if fi.IsDir() {
+			return dirMode
+		}
+		return fileMode
+	})
+}
+
+// ChmodRecursiveFunc is the same as ChmodRecursive, except that the mode of
+// each file and directory is the one returned by fn for it. The mode may
+// contain the setuid, setgid, and sticky bits.
+//
+// Directories whose new modes do not let their owner list them are only
+// changed after their contents.
+func ChmodRecursiveFunc(root string, fn func(fi os.FileInfo) os.FileMode) error {
+	type dir struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dir
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		mode := fn(fi)
+		if fi.IsDir() && mode&0500 != 0500 {
+			dirs = append(dirs, dir{path, mode})
+			return nil
+		}
+		return os.Chmod(path, mode)
+	})
+	if err != nil {
+		return err
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChownRecursive sets the owner and group of all files and directories in
+// the tree at root, including root, to uid and gid, like chown -R; a uid
+// or gid of -1 leaves it as it is. Symlinks are followed, so that their
+// targets are changed, which might be outside of the tree; with
+// NoFollowSymlinks, the symlinks themselves are changed instead. Either
+// way, the walk does not descend into symlinked directories.
+//
+// Errors do not stop the walk: if some files cannot be changed, a TreeError
+// is returned after all others have been changed.
+func ChownRecursive(root string, uid, gid int, opts ...SymlinkOption) error {
+	var o symlinkOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var errs []error
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err == nil {
+			if fi.Mode()&os.ModeSymlink != 0 && o.noFollow {
+				err = os.Lchown(path, uid, gid)
+			} else {
+				err = os.Chown(path, uid, gid)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return TreeError{errs}
+	}
+	return nil
+}
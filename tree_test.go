@@ -0,0 +1,105 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChmodRecursive(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	join := func(name string) string { return filepath.Join(dir, name) }
+	mode := func(name string) os.FileMode {
+		fi, err := os.Lstat(join(name))
+		assert.Nil(err)
+		return fi.Mode() & (os.ModePerm | os.ModeSetgid)
+	}
+	assert.Nil(ExtractArchive("testdata/dir_reader_data.tar", join("tree")))
+	assert.Nil(ioutil.WriteFile(join("outside"), nil, 0600))
+	assert.Nil(os.Symlink("../../outside", join("tree/dir1/link")))
+
+	assert.Nil(ChmodRecursive(join("tree"), 0640, 0750))
+	assert.Equal(os.FileMode(0750), mode("tree"))
+	assert.Equal(os.FileMode(0750), mode("tree/dir1"))
+	assert.Equal(os.FileMode(0640), mode("tree/dir1/file1"))
+	assert.Equal(os.FileMode(0600), mode("outside"))
+
+	// Directories that cannot be listed anymore are changed last.
+	assert.Nil(ChmodRecursiveFunc(join("tree"), func(fi os.FileInfo) os.FileMode {
+		if fi.IsDir() && fi.Name() == "dir1" {
+			return 0
+		} else if fi.IsDir() {
+			return 0755 | os.ModeSetgid
+		}
+		return 0644
+	}))
+	assert.Equal(os.FileMode(0), mode("tree/dir1"))
+	assert.Nil(os.Chmod(join("tree/dir1"), 0755))
+	assert.Equal(os.FileMode(0755)|os.ModeSetgid, mode("tree"))
+	assert.Equal(os.FileMode(0644), mode("tree/dir1/file1"))
+
+	assert.NotNil(ChmodRecursive(join("missing"), 0644, 0755))
+}
+
+func TestChownRecursive(z *testing.T) {
+	assert := assert.New(z)
+	if os.Geteuid() != 0 {
+		z.Skip("changing owners requires root")
+	}
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	join := func(name string) string { return filepath.Join(dir, name) }
+	owner := func(name string) (int, int) {
+		fi, err := os.Lstat(join(name))
+		assert.Nil(err)
+		hdr, err := tar.FileInfoHeader(fi, "")
+		assert.Nil(err)
+		return hdr.Uid, hdr.Gid
+	}
+	assert.Nil(ExtractArchive("testdata/dir_reader_data.tar", join("tree")))
+	assert.Nil(ioutil.WriteFile(join("outside"), nil, 0644))
+	assert.Nil(os.Symlink("../../outside", join("tree/dir1/link")))
+
+	assert.Nil(ChownRecursive(join("tree"), 1234, 5678))
+	for _, name := range []string{"tree", "tree/dir1", "tree/dir2/file3", "outside"} {
+		uid, gid := owner(name)
+		assert.Equal(1234, uid, name)
+		assert.Equal(5678, gid, name)
+	}
+
+	// With NoFollowSymlinks, symlinks change themselves, and with a gid
+	// of -1, the groups are left as they are.
+	_, linkgid := owner("tree/dir1/link")
+	assert.Nil(ChownRecursive(join("tree"), 4321, -1, NoFollowSymlinks()))
+	uid, gid := owner("tree/dir1/link")
+	assert.Equal(4321, uid)
+	assert.Equal(linkgid, gid)
+	_, gid = owner("tree/dir1")
+	assert.Equal(5678, gid)
+	uid, _ = owner("outside")
+	assert.Equal(1234, uid)
+
+	// Errors are collected, and the other files are still changed.
+	assert.Nil(os.Symlink("missing", join("tree/broken")))
+	err = ChownRecursive(join("tree"), 1111, 1111)
+	assert.IsType(TreeError{}, err)
+	assert.Len(err.(TreeError).Errors, 1)
+	uid, _ = owner("tree/dir2/file1")
+	assert.Equal(1111, uid)
+}
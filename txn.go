@@ -0,0 +1,238 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// errTxnDone is returned when a Transaction is used after Commit or
+// Rollback.
+var errTxnDone = errors.New("transaction already committed or rolled back")
+
+// errDirNotEmpty is returned when a Transaction would replace or remove a
+// directory that is not empty.
+var errDirNotEmpty = errors.New("directory not empty")
+
+// Transaction stages writes, renames, and removals of several files, which
+// are only carried out when Commit is called, so that related files, such
+// as those of a configuration, are updated together.
+//
+// The data of staged writes is written to temporary files right away, so
+// that most errors occur before any file is changed. Commit then applies
+// the changes in the order they were staged, keeping the files that they
+// replace, and restores these if a change fails. This is best-effort: if
+// the system crashes during Commit, some of the changes may have been
+// applied and others not, and leftover files whose names start with the
+// name of a changed file and end in ".old" plus a random suffix may remain.
+type Transaction struct {
+	ops  []txnOp
+	done bool
+}
+
+// txnOp is an operation staged in a Transaction.
+type txnOp struct {
+	file *AtomicFile // data to write to dst, if any
+	src  string      // file to rename to dst, if any
+	dst  string      // file that is changed
+}
+
+// NewTransaction returns an empty Transaction.
+func NewTransaction() *Transaction {
+	return &Transaction{}
+}
+
+// WriteFile stages writing data to the file at path, as with
+// WriteFileAtomic.
+func (t *Transaction) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if t.done {
+		return &os.PathError{Op: "write", Path: path, Err: errTxnDone}
+	}
+	a, err := CreateAtomic(path, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := a.Write(data); err != nil {
+		a.Abort()
+		return err
+	}
+	t.ops = append(t.ops, txnOp{file: a, dst: path})
+	return nil
+}
+
+// Rename stages renaming src to dst, as with os.Rename.
+func (t *Transaction) Rename(src, dst string) error {
+	if t.done {
+		return &os.LinkError{Op: "rename", Old: src, New: dst, Err: errTxnDone}
+	}
+	t.ops = append(t.ops, txnOp{src: src, dst: dst})
+	return nil
+}
+
+// Remove stages removing the file or empty directory at path. It is not an
+// error if path does not exist when the transaction is committed, but it is
+// if path is a directory that is not empty, now or then.
+func (t *Transaction) Remove(path string) error {
+	if t.done {
+		return &os.PathError{Op: "remove", Path: path, Err: errTxnDone}
+	}
+	if err := checkNotEmptyDir("remove", path); err != nil {
+		return err
+	}
+	t.ops = append(t.ops, txnOp{dst: path})
+	return nil
+}
+
+// Commit carries out the staged changes. If one of them fails, the changes
+// already carried out are undone, the temporary files are removed, and the
+// error is returned.
+func (t *Transaction) Commit() error {
+	if t.done {
+		return errTxnDone
+	}
+	t.done = true
+	for i, op := range t.ops {
+		if op.file == nil {
+			continue
+		}
+		if err := op.file.finish(); err != nil {
+			for _, op := range t.ops[i:] {
+				if op.file != nil {
+					op.file.f.Close()
+				}
+			}
+			t.removeTemp()
+			return err
+		}
+	}
+
+	// The files replaced by each change are kept under backup names until
+	// all changes have been carried out.
+	backups := make([]string, 0, len(t.ops))
+	for _, op := range t.ops {
+		backup, err := t.apply(op)
+		if err != nil {
+			for i := len(backups) - 1; i >= 0; i-- {
+				t.undo(t.ops[i], backups[i])
+			}
+			t.removeTemp()
+			return err
+		}
+		backups = append(backups, backup)
+	}
+
+	var err error
+	dirs := make(map[string]bool)
+	for i, op := range t.ops {
+		if backups[i] != "" {
+			if rerr := os.Remove(backups[i]); err == nil {
+				err = rerr
+			}
+		}
+		dirs[filepath.Dir(op.dst)] = true
+		if op.src != "" {
+			dirs[filepath.Dir(op.src)] = true
+		}
+	}
+	for dir := range dirs {
+		if serr := syncDir(dir); err == nil {
+			err = serr
+		}
+	}
+	return err
+}
+
+// apply carries out op and returns the name that the file it replaced was
+// moved to, if any. A directory that is not empty is not replaced, since
+// its backup could not be removed again.
+func (t *Transaction) apply(op txnOp) (backup string, err error) {
+	opName := "rename"
+	if op.file == nil && op.src == "" {
+		opName = "remove"
+	}
+	if err := checkNotEmptyDir(opName, op.dst); err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(op.dst); err == nil {
+		tmp, err := ioutil.TempFile(filepath.Dir(op.dst), "."+filepath.Base(op.dst)+".old")
+		if err != nil {
+			return "", err
+		}
+		backup = tmp.Name()
+		tmp.Close()
+		os.Remove(backup)
+		if err := os.Rename(op.dst, backup); err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	switch {
+	case op.file != nil:
+		err = os.Rename(op.file.f.Name(), op.dst)
+	case op.src != "":
+		err = os.Rename(op.src, op.dst)
+	}
+	if err != nil && backup != "" {
+		os.Rename(backup, op.dst)
+	}
+	return backup, err
+}
+
+// undo reverts op, which was carried out by apply with the result backup.
+func (t *Transaction) undo(op txnOp, backup string) {
+	switch {
+	case op.file != nil:
+		os.Remove(op.dst)
+	case op.src != "":
+		os.Rename(op.dst, op.src)
+	}
+	if backup != "" {
+		os.Rename(backup, op.dst)
+	}
+}
+
+// Rollback discards the staged changes and removes their temporary files.
+// Calling Rollback after Commit has no effect, so that it can be deferred.
+func (t *Transaction) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	for _, op := range t.ops {
+		if op.file != nil {
+			op.file.f.Close()
+		}
+	}
+	t.removeTemp()
+	return nil
+}
+
+// removeTemp removes any temporary files of staged writes that remain.
+func (t *Transaction) removeTemp() {
+	for _, op := range t.ops {
+		if op.file != nil {
+			os.Remove(op.file.f.Name())
+		}
+	}
+}
+
+// checkNotEmptyDir returns errDirNotEmpty for op if path is a directory
+// that is not empty.
+func checkNotEmptyDir(op, path string) error {
+	fi, err := os.Lstat(path)
+	if err != nil || !fi.IsDir() {
+		return nil
+	}
+	empty, err := IsEmptyDir(path)
+	if err == nil && !empty {
+		err = &os.PathError{Op: op, Path: path, Err: errDirNotEmpty}
+	}
+	return err
+}
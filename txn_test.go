@@ -0,0 +1,97 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransaction(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	join := func(name string) string { return filepath.Join(dir, name) }
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(join(name))
+		if err != nil {
+			return "<" + err.Error() + ">"
+		}
+		return string(data)
+	}
+	assert.Nil(ioutil.WriteFile(join("a.conf"), []byte("old a"), 0644))
+	assert.Nil(ioutil.WriteFile(join("b.conf"), []byte("old b"), 0644))
+	assert.Nil(ioutil.WriteFile(join("c.conf"), []byte("old c"), 0644))
+
+	t := NewTransaction()
+	assert.Nil(t.WriteFile(join("a.conf"), []byte("new a"), 0644))
+	assert.Nil(t.WriteFile(join("new.conf"), []byte("new"), 0600))
+	assert.Nil(t.Rename(join("b.conf"), join("d.conf")))
+	assert.Nil(t.Remove(join("c.conf")))
+	assert.Nil(t.Remove(join("missing.conf")))
+	assert.Equal("old a", read("a.conf"))
+	assert.Nil(t.Commit())
+	assert.Equal(errTxnDone, t.Commit())
+	assert.NotNil(t.WriteFile(join("a.conf"), nil, 0644))
+	assert.Nil(t.Rollback())
+
+	assert.Equal("new a", read("a.conf"))
+	assert.Equal("new", read("new.conf"))
+	assert.Equal("old b", read("d.conf"))
+	names, err := readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"a.conf", "d.conf", "new.conf"}, names)
+
+	// A failing change undoes those before it.
+	t = NewTransaction()
+	assert.Nil(t.WriteFile(join("a.conf"), []byte("newer a"), 0644))
+	assert.Nil(t.Remove(join("new.conf")))
+	assert.Nil(t.Rename(join("d.conf"), join("e.conf")))
+	assert.Nil(t.Rename(join("missing.conf"), join("f.conf")))
+	assert.NotNil(t.Commit())
+	assert.Equal("new a", read("a.conf"))
+	assert.Equal("new", read("new.conf"))
+	assert.Equal("old b", read("d.conf"))
+	names, err = readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"a.conf", "d.conf", "new.conf"}, names)
+
+	// Directories that are not empty are neither removed nor replaced, so
+	// that no backups of them are left behind.
+	assert.Nil(os.MkdirAll(join("dir/sub"), 0755))
+	t = NewTransaction()
+	assert.Equal(errDirNotEmpty, t.Remove(join("dir")).(*os.PathError).Err)
+	assert.Nil(t.Remove(join("dir/sub")))
+	assert.Nil(t.Commit())
+	t = NewTransaction()
+	assert.Nil(t.WriteFile(join("a.conf"), []byte("newer a"), 0644))
+	assert.Nil(t.Remove(join("dir")))
+	assert.Nil(ioutil.WriteFile(join("dir/file"), nil, 0644))
+	err = t.Commit()
+	assert.Equal(errDirNotEmpty, err.(*os.PathError).Err)
+	assert.Equal("new a", read("a.conf"))
+	assert.Equal("", read("dir/file"))
+	assert.Nil(os.RemoveAll(join("dir")))
+	names, err = readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"a.conf", "d.conf", "new.conf"}, names)
+
+	// Rollback removes the staged data.
+	t = NewTransaction()
+	assert.Nil(t.WriteFile(join("a.conf"), []byte("discarded"), 0644))
+	assert.Nil(t.Rollback())
+	assert.Equal(errTxnDone, t.Commit())
+	assert.Equal("new a", read("a.conf"))
+	names, err = readDirNames(dir)
+	assert.Nil(err)
+	assert.Equal([]string{"a.conf", "d.conf", "new.conf"}, names)
+}
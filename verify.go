@@ -0,0 +1,309 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// manifestNames are the names of entries that VerifyArchive recognizes as
+// embedded manifests, in order of preference.
+var manifestNames = []string{".MTREE", "sha256sums", "SHA256SUMS"}
+
+// VerifyArchive checks the entries of the (compressed) archive against the
+// checksum manifest embedded in it, such as the .MTREE file of a pacman
+// package or a sha256sums file. If the archive contains no such manifest,
+// a NotFoundError is returned. If entries do not match the manifest, a
+// VerifyError is returned.
+//
+// Entries that are not listed in the manifest are not checked, and entry
+// names are compared without any leading "./".
+func VerifyArchive(archive string) error {
+	summaries, manifests, err := summarizeArchive(archive, func(name string) bool {
+		for _, m := range manifestNames {
+			if cleanEntryName(name) == m {
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range manifestNames {
+		for name, data := range manifests {
+			if cleanEntryName(name) == m {
+				return verifyManifest(summaries, data)
+			}
+		}
+	}
+	return NotFoundError{manifestNames[0]}
+}
+
+// VerifyArchiveManifest is the same as VerifyArchive, except that the
+// manifest is read from the file manifest instead of from the archive.
+// Manifests in the mtree format may be gzip-compressed.
+func VerifyArchiveManifest(archive, manifest string) error {
+	data, err := ioutil.ReadFile(manifest)
+	if err != nil {
+		return err
+	}
+	summaries, _, err := summarizeArchive(archive, nil)
+	if err != nil {
+		return err
+	}
+	return verifyManifest(summaries, data)
+}
+
+// manifestEntry is what a manifest records about one entry. Fields that
+// are not recorded are empty.
+type manifestEntry struct {
+	name     string
+	typ      string
+	size     string
+	mode     string
+	linkname string
+	sha256   string
+}
+
+// verifyManifest compares the summaries of the archive entries with the
+// manifest in data.
+func verifyManifest(summaries map[string]entrySummary, data []byte) error {
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			return err
+		}
+	}
+
+	var entries []manifestEntry
+	var err error
+	if bytes.HasPrefix(data, []byte("#mtree")) {
+		entries, err = parseMtree(bytes.NewReader(data))
+	} else {
+		entries, err = parseSha256sums(bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]entrySummary, len(summaries))
+	for name, s := range summaries {
+		byName[cleanEntryName(name)] = s
+	}
+	var verr VerifyError
+	for _, e := range entries {
+		s, ok := byName[e.name]
+		if !ok {
+			verr.Missing = append(verr.Missing, e.name)
+		} else if !e.matches(s) {
+			verr.Mismatched = append(verr.Mismatched, e.name)
+		}
+	}
+	if len(verr.Missing) == 0 && len(verr.Mismatched) == 0 {
+		return nil
+	}
+	sort.Strings(verr.Missing)
+	sort.Strings(verr.Mismatched)
+	return verr
+}
+
+// matches returns true if the entry summarized by s matches e.
+func (e manifestEntry) matches(s entrySummary) bool {
+	switch e.typ {
+	case "":
+	case "file":
+		if !s.mode.IsRegular() {
+			return false
+		}
+	case "dir":
+		if !s.mode.IsDir() {
+			return false
+		}
+	case "link":
+		if s.mode&os.ModeSymlink == 0 || (e.linkname != "" && e.linkname != s.linkname) {
+			return false
+		}
+	default:
+		// Other types are not checked.
+	}
+	if e.size != "" && s.mode.IsRegular() && e.size != strconv.FormatInt(s.size, 10) {
+		return false
+	}
+	if e.mode != "" {
+		mode, err := strconv.ParseUint(e.mode, 8, 32)
+		if err != nil || os.FileMode(mode)&os.ModePerm != s.mode.Perm() {
+			return false
+		}
+	}
+	if e.sha256 != "" {
+		if !s.mode.IsRegular() || !strings.EqualFold(e.sha256, hex.EncodeToString(s.sum[:])) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseSha256sums parses the output of sha256sum, as described for
+// parseChecksumLine.
+func parseSha256sums(r io.Reader) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sum, name, err := parseChecksumLine(line)
+		if err != nil {
+			return nil, err
+		}
+		if len(sum) != hex.EncodedLen(sha256.Size) {
+			return nil, ManifestError{"invalid sha256sums line: " + line}
+		}
+		entries = append(entries, manifestEntry{
+			name:   cleanEntryName(name),
+			typ:    "file",
+			sha256: sum,
+		})
+	}
+	return entries, s.Err()
+}
+
+// parseMtree parses a manifest in the mtree format, as written by bsdtar
+// and used by pacman. Only the keywords type, size, mode, link, and
+// sha256digest are interpreted.
+func parseMtree(r io.Reader) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	defaults := make(map[string]string)
+	s := bufio.NewScanner(r)
+	var line string
+	for s.Scan() {
+		// Lines ending with a backslash are continued on the next line.
+		t := s.Text()
+		if strings.HasSuffix(t, "\\") {
+			line += strings.TrimSuffix(t, "\\") + " "
+			continue
+		}
+		line += t
+		fields := strings.Fields(line)
+		line = ""
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "/set":
+			for k, v := range mtreeKeywords(fields[1:]) {
+				defaults[k] = v
+			}
+			continue
+		case "/unset":
+			for _, k := range fields[1:] {
+				if k == "all" {
+					defaults = make(map[string]string)
+				}
+				delete(defaults, k)
+			}
+			continue
+		case "..":
+			// Relative paths are not supported; pacman only uses full paths.
+			continue
+		}
+
+		name, err := unescapeMtree(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if name = cleanEntryName(name); name == "" {
+			// The root directory is not an entry of the archive.
+			continue
+		}
+		kw := make(map[string]string, len(defaults))
+		for k, v := range defaults {
+			kw[k] = v
+		}
+		for k, v := range mtreeKeywords(fields[1:]) {
+			kw[k] = v
+		}
+		link, err := unescapeMtree(kw["link"])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, manifestEntry{
+			name:     name,
+			typ:      kw["type"],
+			size:     kw["size"],
+			mode:     kw["mode"],
+			linkname: link,
+			sha256:   kw["sha256digest"],
+		})
+	}
+	return entries, s.Err()
+}
+
+// mtreeKeywords parses the keyword=value fields of an mtree line.
+func mtreeKeywords(fields []string) map[string]string {
+	kw := make(map[string]string, len(fields))
+	for _, f := range fields {
+		i := strings.IndexByte(f, '=')
+		if i < 0 {
+			kw[f] = ""
+			continue
+		}
+		k, v := f[:i], f[i+1:]
+		// Some implementations use a different name for the digest.
+		if k == "sha256" {
+			k = "sha256digest"
+		}
+		kw[k] = v
+	}
+	return kw
+}
+
+// unescapeMtree replaces the octal escapes of mtree, such as \040 for
+// a space, with the characters they stand for.
+func unescapeMtree(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+4 > len(s) {
+			return "", ManifestError{"invalid escape in mtree path: " + s}
+		}
+		c, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+		if err != nil {
+			return "", ManifestError{"invalid escape in mtree path: " + s}
+		}
+		b.WriteByte(byte(c))
+		i += 3
+	}
+	return b.String(), nil
+}
+
+// cleanEntryName returns the entry name without any leading "./" or "/"
+// and without a trailing slash.
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sha256hex(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+func TestVerifyArchive(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// This is what a pacman package looks like.
+	mtree := fmt.Sprintf(`#mtree
+/set type=file uid=0 gid=0 mode=644
+./.PKGINFO time=1401722760.0 size=4 sha256digest=%s
+. time=1401722760.0 mode=755 type=dir
+./usr time=1401722760.0 mode=755 type=dir
+./usr/bin time=1401722760.0 mode=755 type=dir
+./usr/bin/hello time=1401722760.0 mode=755 size=6 \
+    sha256digest=%s
+./usr/bin/hi time=1401722760.0 mode=777 type=link link=hello
+./usr/share/with\040space time=1401722760.0 size=3 sha256digest=%s
+`, sha256hex("info"), sha256hex("hello\n"), sha256hex("abc"))
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(mtree))
+	zw.Close()
+
+	entries := []testEntry{
+		{tar.Header{Name: ".PKGINFO", Typeflag: tar.TypeReg, Mode: 0644}, "info"},
+		{tar.Header{Name: ".MTREE", Typeflag: tar.TypeReg, Mode: 0644}, gz.String()},
+		{tar.Header{Name: "usr/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "usr/bin/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "usr/bin/hello", Typeflag: tar.TypeReg, Mode: 0755}, "hello\n"},
+		{tar.Header{Name: "usr/bin/hi", Typeflag: tar.TypeSymlink, Linkname: "hello", Mode: 0777}, ""},
+		{tar.Header{Name: "usr/share/with space", Typeflag: tar.TypeReg, Mode: 0644}, "abc"},
+	}
+	pkg := filepath.Join(dir, "hello-1.0-1-any.pkg.tar")
+	assert.Nil(writeTestTar(pkg, entries))
+	assert.Nil(VerifyArchive(pkg))
+
+	// Tamper with the package.
+	entries[4].body = "HELLO\n"
+	entries[6] = testEntry{tar.Header{Name: "usr/share/without", Typeflag: tar.TypeReg, Mode: 0644}, "abc"}
+	assert.Nil(writeTestTar(pkg, entries))
+	assert.Equal(VerifyError{
+		Mismatched: []string{"usr/bin/hello"},
+		Missing:    []string{"usr/share/with space"},
+	}, VerifyArchive(pkg))
+
+	assert.Equal(NotFoundError{".MTREE"}, VerifyArchive("testdata/dir_reader_data.tar"))
+}
+
+func TestVerifyArchiveManifest(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	sums := filepath.Join(dir, "sha256sums")
+	content := sha256hex("dir1/file1 content\n") + "  ./dir1/file1\n" +
+		sha256hex("dir1/file2 content\n") + " *dir1/file2\n"
+	assert.Nil(ioutil.WriteFile(sums, []byte(content), 0644))
+	for _, archive := range testarchives {
+		assert.Nil(VerifyArchiveManifest(archive, sums), archive)
+	}
+
+	content += sha256hex("wrong") + "  dir2/file1\n"
+	assert.Nil(ioutil.WriteFile(sums, []byte(content), 0644))
+	assert.Equal(VerifyError{Mismatched: []string{"dir2/file1"}},
+		VerifyArchiveManifest(testarchives[0], sums))
+
+	assert.Nil(ioutil.WriteFile(sums, []byte("not a checksum\n"), 0644))
+	_, ok := VerifyArchiveManifest(testarchives[0], sums).(ManifestError)
+	assert.True(ok)
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// volumeName returns the name of the i-th volume of base, counting from 1.
+func volumeName(base string, i int) string {
+	return fmt.Sprintf("%s.%03d", base, i)
+}
+
+// volumeBase returns the name without the suffix of the first volume,
+// ".001", if name has this suffix.
+func volumeBase(name string) (base string, ok bool) {
+	if !strings.HasSuffix(name, ".001") {
+		return name, false
+	}
+	return strings.TrimSuffix(name, ".001"), true
+}
+
+// VolumeWriter writes data split into volumes of a fixed size, which are
+// named after a base name followed by a three-digit sequence number, such
+// as foo.tar.zst.001, foo.tar.zst.002, and so on. This is useful when the
+// storage imposes a limit on the size of files. The volumes can be read
+// back as one stream with OpenVolumes.
+type VolumeWriter struct {
+	base string
+	size int64
+
+	f *os.File
+	n int   // the number of the current volume
+	w int64 // the bytes written to the current volume
+}
+
+// NewVolumeWriter creates the first volume of base, with volumes being at
+// most size bytes large. Volumes of base that remain from an earlier,
+// longer sequence are removed when the VolumeWriter is closed.
+func NewVolumeWriter(base string, size int64) (*VolumeWriter, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid volume size %d", size)
+	}
+	vw := &VolumeWriter{base: base, size: size}
+	if err := vw.next(); err != nil {
+		return nil, err
+	}
+	return vw, nil
+}
+
+// next closes the current volume and creates the next one.
+func (vw *VolumeWriter) next() error {
+	if vw.f != nil {
+		if err := vw.f.Close(); err != nil {
+			return err
+		}
+	}
+	vw.n++
+	f, err := os.Create(volumeName(vw.base, vw.n))
+	if err != nil {
+		vw.f = nil
+		return err
+	}
+	vw.f, vw.w = f, 0
+	return nil
+}
+
+// Write writes p to the volumes, starting a new volume whenever the current
+// one is full.
+func (vw *VolumeWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if vw.w == vw.size {
+			if err := vw.next(); err != nil {
+				return n, err
+			}
+		}
+		chunk := p
+		if int64(len(chunk)) > vw.size-vw.w {
+			chunk = chunk[:vw.size-vw.w]
+		}
+		m, err := vw.f.Write(chunk)
+		n += m
+		vw.w += int64(m)
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close closes the last volume and removes any stale volumes following it.
+func (vw *VolumeWriter) Close() error {
+	if vw.f == nil {
+		return nil
+	}
+	err := vw.f.Close()
+	vw.f = nil
+	for i := vw.n + 1; ; i++ {
+		if rerr := os.Remove(volumeName(vw.base, i)); rerr != nil {
+			break
+		}
+	}
+	return err
+}
+
+// Volumes returns the names of the volumes that have been written.
+func (vw *VolumeWriter) Volumes() []string {
+	names := make([]string, vw.n)
+	for i := range names {
+		names[i] = volumeName(vw.base, i+1)
+	}
+	return names
+}
+
+// removeVolumes removes all volumes of base.
+func removeVolumes(base string) {
+	for i := 1; ; i++ {
+		if err := os.Remove(volumeName(base, i)); err != nil {
+			return
+		}
+	}
+}
+
+// isVolumeOf returns true if the file at path is a volume of base. Both
+// paths must be absolute.
+func isVolumeOf(path, base string) bool {
+	if filepath.Dir(path) != filepath.Dir(base) || !strings.HasPrefix(path, base+".") {
+		return false
+	}
+	suffix := strings.TrimPrefix(path, base+".")
+	if len(suffix) < 3 {
+		return false
+	}
+	for _, c := range suffix {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// VolumeReader reads a sequence of volumes, as written by VolumeWriter, as
+// one stream.
+type VolumeReader struct {
+	base string
+	f    *os.File
+	n    int
+}
+
+// OpenVolumes opens the sequence of volumes whose first volume is named
+// first, which must end in ".001". The volumes are read in order until the
+// next volume does not exist.
+func OpenVolumes(first string) (*VolumeReader, error) {
+	base, ok := volumeBase(first)
+	if !ok {
+		return nil, fmt.Errorf("%q is not the first volume of a sequence", first)
+	}
+	f, err := os.Open(first)
+	if err != nil {
+		return nil, err
+	}
+	return &VolumeReader{base: base, f: f, n: 1}, nil
+}
+
+// Read reads from the current volume, continuing with the next volume at
+// its end.
+func (vr *VolumeReader) Read(p []byte) (int, error) {
+	for vr.f != nil {
+		n, err := vr.f.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if err := vr.next(); err != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, io.EOF
+}
+
+// next closes the current volume and opens the next one, if it exists.
+func (vr *VolumeReader) next() error {
+	if err := vr.f.Close(); err != nil {
+		return err
+	}
+	vr.f = nil
+	f, err := os.Open(volumeName(vr.base, vr.n+1))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	vr.f = f
+	vr.n++
+	return nil
+}
+
+// Close closes the current volume.
+func (vr *VolumeReader) Close() error {
+	if vr.f == nil {
+		return nil
+	}
+	err := vr.f.Close()
+	vr.f = nil
+	return err
+}
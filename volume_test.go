@@ -0,0 +1,104 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumes(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "data.bin")
+	data := bytes.Repeat([]byte("0123456789"), 25)
+	for _, size := range []int64{7, 10, 250, 1000} {
+		vw, err := NewVolumeWriter(base, size)
+		assert.Nil(err)
+		_, err = vw.Write(data[:13])
+		assert.Nil(err)
+		_, err = vw.Write(data[13:])
+		assert.Nil(err)
+		assert.Nil(vw.Close())
+
+		want := (int64(len(data)) + size - 1) / size
+		assert.Len(vw.Volumes(), int(want), size)
+		for _, name := range vw.Volumes() {
+			fi, err := os.Stat(name)
+			assert.Nil(err)
+			assert.True(fi.Size() <= size, name)
+		}
+		// Stale volumes of the previous sequence must have been removed.
+		ex, err := FileExists(volumeName(base, int(want)+1))
+		assert.Nil(err)
+		assert.False(ex, size)
+
+		vr, err := OpenVolumes(base + ".001")
+		assert.Nil(err)
+		got, err := ioutil.ReadAll(vr)
+		assert.Nil(err)
+		assert.Nil(vr.Close())
+		assert.Equal(data, got, size)
+	}
+
+	_, err = OpenVolumes(base)
+	assert.NotNil(err)
+	_, err = NewVolumeWriter(base, 0)
+	assert.NotNil(err)
+}
+
+func TestCreateArchiveVolumes(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	err = ExtractArchive("testdata/dir_reader_data.tar", src)
+	assert.Nil(err)
+
+	for _, ext := range []string{".tar", ".tar.zst"} {
+		// The archive is created inside the source directory, so that its
+		// volumes must not be archived themselves.
+		archive := filepath.Join(src, "out"+ext)
+		err = CreateArchive(archive, src, VolumeSize(100))
+		assert.Nil(err, ext)
+		ex, err := FileExists(archive + ".002")
+		assert.Nil(err)
+		assert.True(ex, ext)
+
+		data, err := ReadFileFromArchive(archive+".001", "dir2/file3")
+		assert.Nil(err, ext)
+		assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data), ext)
+
+		entries, err := ListArchive(archive + ".001")
+		assert.Nil(err, ext)
+		for _, e := range entries {
+			assert.NotContains(e.Name, "out", ext)
+		}
+
+		// Without the extension, the format is detected from the contents.
+		assert.Nil(os.Rename(archive+".001", filepath.Join(src, "unknown.001")))
+		for i := 2; ; i++ {
+			if os.Rename(volumeName(archive, i), volumeName(filepath.Join(src, "unknown"), i)) != nil {
+				break
+			}
+		}
+		data, err = ReadFileFromArchive(filepath.Join(src, "unknown.001"), "dir1/file1")
+		assert.Nil(err, ext)
+		assert.Equal("dir1/file1 content\n", string(data), ext)
+		removeVolumes(filepath.Join(src, "unknown"))
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Walk walks the tree at root like filepath.Walk, calling fn for each file
+// and directory in it, including root, but the walk can be changed with
+// the following options:
+//
+//   - MaxDepth limits how deep the walk descends.
+//   - FollowSymlinks follows symlinks, except those that lead to a loop,
+//     for which fn is called with the information of the symlink itself.
+//     Broken symlinks are reported as symlinks as well.
+//   - Include and Exclude select files and directories by their paths
+//     relative to root. The contents of excluded directories are skipped,
+//     whereas the directories of included files are walked even if they
+//     are not included themselves.
+//   - OnlyFiles and OnlyDirs only call fn for files or for directories.
+//   - ReaddirOrder visits files in the order of the file system.
+//
+// As with filepath.Walk, fn may return filepath.SkipDir to skip the
+// directory it is called for, or the rest of the directory that contains
+// the file it is called for, and errors from reading directories are
+// passed to fn.
+func Walk(root string, fn filepath.WalkFunc, opts ...WalkOption) error {
+	o := newWalkOptions(opts)
+	if err := o.checkPatterns(); err != nil {
+		return err
+	}
+	w := &walker{o: o, fn: fn}
+	fi, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = w.walk(root, ".", fi, 0)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// WalkEntry is a file or error found by WalkChan.
+type WalkEntry struct {
+	Path string
+	Info os.FileInfo
+	Err  error
+}
+
+// WalkChan is the same as Walk, except that it sends the files and errors
+// that Walk would call its function for to the returned channel, which is
+// closed when the walk is finished. To stop the walk early, ctx must be
+// cancelled, as the walk waits for the entries to be received otherwise.
+func WalkChan(ctx context.Context, root string, opts ...WalkOption) <-chan WalkEntry {
+	c := make(chan WalkEntry)
+	go func() {
+		defer close(c)
+		err := Walk(root, func(path string, fi os.FileInfo, err error) error {
+			select {
+			case c <- WalkEntry{path, fi, err}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+		if err != nil && err != ctx.Err() {
+			select {
+			case c <- WalkEntry{Path: root, Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return c
+}
+
+// walker contains the state of Walk.
+type walker struct {
+	o  *walkOptions
+	fn filepath.WalkFunc
+
+	// ancestors contains the directories that are being walked, which
+	// symlinks must not lead to.
+	ancestors []os.FileInfo
+}
+
+// walk walks the file at path, which is name relative to the root and is
+// described by fi, as obtained with os.Lstat.
+func (w *walker) walk(path, name string, fi os.FileInfo, depth int) error {
+	if name != "." {
+		if matchAny(w.o.exclude, name) {
+			return nil
+		}
+	}
+	if fi.Mode()&os.ModeSymlink != 0 && w.o.follow {
+		if sfi, err := os.Stat(path); err == nil && !(sfi.IsDir() && w.isAncestor(sfi)) {
+			fi = sfi
+		}
+	}
+
+	if w.visible(name, fi) {
+		if err := w.fn(path, fi, nil); err == filepath.SkipDir && fi.IsDir() {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	if !fi.IsDir() || (w.o.hasMaxDepth && depth >= w.o.maxDepth) {
+		return nil
+	}
+
+	names, err := w.readDir(path)
+	if err != nil {
+		if err := w.fn(path, fi, err); err != nil && err != filepath.SkipDir {
+			return err
+		}
+		return nil
+	}
+	w.ancestors = append(w.ancestors, fi)
+	defer func() { w.ancestors = w.ancestors[:len(w.ancestors)-1] }()
+	for _, n := range names {
+		p := filepath.Join(path, n)
+		rel := n
+		if name != "." {
+			rel = name + "/" + n
+		}
+		cfi, err := os.Lstat(p)
+		if err != nil {
+			err = w.fn(p, nil, err)
+		} else {
+			err = w.walk(p, rel, cfi, depth+1)
+		}
+		// Only files and errors let the rest of the directory be skipped.
+		if err == filepath.SkipDir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visible returns true if fn is called for the file name described by fi.
+func (w *walker) visible(name string, fi os.FileInfo) bool {
+	if w.o.onlyFiles && fi.IsDir() || w.o.onlyDirs && !fi.IsDir() {
+		return false
+	}
+	return name == "." || len(w.o.include) == 0 || matchAny(w.o.include, name)
+}
+
+// isAncestor returns true if the directory described by fi is being walked.
+func (w *walker) isAncestor(fi os.FileInfo) bool {
+	for _, a := range w.ancestors {
+		if os.SameFile(a, fi) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDir returns the names of the files in dir, sorted unless ReaddirOrder
+// is given.
+func (w *walker) readDir(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !w.o.unsorted {
+		sort.Strings(names)
+	}
+	return names, nil
+}
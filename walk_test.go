@@ -0,0 +1,108 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalk(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(ExtractArchive("testdata/dir_reader_data.tar", dir))
+	assert.Nil(os.Symlink("../dir2", filepath.Join(dir, "dir1/link")))
+	assert.Nil(os.Symlink("..", filepath.Join(dir, "dir2/loop")))
+	assert.Nil(os.Symlink("missing", filepath.Join(dir, "broken")))
+
+	walk := func(opts ...WalkOption) []string {
+		var names []string
+		err := Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			assert.Nil(err)
+			rel, err := filepath.Rel(dir, path)
+			assert.Nil(err)
+			rel = filepath.ToSlash(rel)
+			if fi.IsDir() {
+				rel += "/"
+			}
+			names = append(names, rel)
+			if rel == "dir1/file1" {
+				return filepath.SkipDir
+			}
+			return nil
+		}, opts...)
+		assert.Nil(err)
+		return names
+	}
+
+	assert.Equal([]string{
+		"./", "broken", "dir1/", "dir1/file1",
+		"dir2/", "dir2/file1", "dir2/file2", "dir2/file3", "dir2/loop",
+	}, walk())
+	assert.Equal([]string{
+		"./", "broken", "dir1/", "dir1/file1",
+		"dir2/", "dir2/file1", "dir2/file2", "dir2/file3", "dir2/loop",
+	}, walk(FollowSymlinks()))
+	assert.Equal([]string{"./", "broken", "dir1/", "dir2/"}, walk(MaxDepth(1)))
+	assert.Equal([]string{"./", "dir1/", "dir2/"}, walk(OnlyDirs()))
+	assert.Equal([]string{"broken", "dir1/file1", "dir2/file1", "dir2/file2", "dir2/file3", "dir2/loop"}, walk(OnlyFiles()))
+	assert.Equal([]string{"./", "dir1/", "dir1/file1", "dir2/", "dir2/file2"}, walk(Exclude("broken", "dir2/file[13]", "*/loop")))
+	assert.Equal([]string{"./", "dir2/", "dir2/file1", "dir2/file2", "dir2/file3", "dir2/loop"}, walk(Include("dir2")))
+
+	// Without the skip, symlinks are followed unless they lead to a loop.
+	assert.Nil(os.Remove(filepath.Join(dir, "dir1/file1")))
+	assert.Equal([]string{
+		"./", "broken", "dir1/", "dir1/file2",
+		"dir1/link/", "dir1/link/file1", "dir1/link/file2", "dir1/link/file3", "dir1/link/loop",
+		"dir2/", "dir2/file1", "dir2/file2", "dir2/file3", "dir2/loop",
+	}, walk(FollowSymlinks()))
+
+	names := walk(ReaddirOrder())
+	sort.Strings(names)
+	assert.Equal(walk(), names)
+
+	var errs int
+	assert.Nil(Walk(filepath.Join(dir, "missing"), func(path string, fi os.FileInfo, err error) error {
+		assert.True(os.IsNotExist(err))
+		errs++
+		return nil
+	}))
+	assert.Equal(1, errs)
+	assert.NotNil(Walk(dir, nil, Include("[")))
+}
+
+func TestWalkChan(z *testing.T) {
+	assert := assert.New(z)
+
+	var names []string
+	for e := range WalkChan(context.Background(), "testdata", OnlyDirs()) {
+		assert.Nil(e.Err)
+		assert.True(e.Info.IsDir())
+		names = append(names, e.Path)
+	}
+	assert.Contains(names, "testdata")
+
+	// A cancelled walk stops before all entries have been received.
+	ctx, cancel := context.WithCancel(context.Background())
+	c := WalkChan(ctx, "testdata")
+	<-c
+	cancel()
+	for range c {
+	}
+
+	for e := range WalkChan(context.Background(), "testdata", Exclude("[")) {
+		assert.NotNil(e.Err)
+	}
+}
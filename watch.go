@@ -0,0 +1,453 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WatchOp is the kind of change that an Event reports.
+type WatchOp int
+
+const (
+	// WatchCreate reports that a file was created or moved into a watched
+	// directory.
+	WatchCreate WatchOp = iota + 1
+
+	// WatchWrite reports that the contents of a file were changed.
+	WatchWrite
+
+	// WatchRemove reports that a file was removed.
+	WatchRemove
+
+	// WatchRename reports that a file was renamed or moved away; if it was
+	// moved within a watched directory, WatchCreate reports its new name.
+	WatchRename
+
+	// WatchChmod reports that the permissions or other metadata of a file
+	// were changed.
+	WatchChmod
+)
+
+func (op WatchOp) String() string {
+	switch op {
+	case WatchCreate:
+		return "create"
+	case WatchWrite:
+		return "write"
+	case WatchRemove:
+		return "remove"
+	case WatchRename:
+		return "rename"
+	case WatchChmod:
+		return "chmod"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change to the file Name, which is the path given to the
+// Watcher, joined with the name of the file for changes in a directory.
+type Event struct {
+	Name string
+	Op   WatchOp
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s %q", e.Op, e.Name)
+}
+
+// watchBackend is the part of a Watcher that is specific to a platform.
+// It watches files and the entries of directories, but not subdirectories,
+// and reports changes to the functions it was created with.
+type watchBackend interface {
+	add(path string, dir bool) error
+	remove(path string) error
+	close() error
+}
+
+// Watcher watches files and directories for changes, which it delivers as
+// Events. It uses inotify on Linux, kqueue on macOS and the BSDs, and
+// ReadDirectoryChangesW on Windows; other platforms are not supported.
+//
+// Events that are the same as one that has not been received yet are
+// dropped, so that a file that is written to many times while the receiver
+// is busy results in one event instead of many. Events must be received
+// from Events, or else the Watcher stops watching once its queue is full;
+// errors, such as events being lost by the system, are delivered on
+// Errors, but need not be received.
+//
+// With Debounce, the events for a file are held back until there are no
+// more for a while, and then summed up in a single event, so that saving a
+// file in an editor, which may rename, create, write, and chmod it, results
+// in one event. This is WatchCreate if the first event was WatchCreate,
+// WatchChmod if all events were WatchChmod, and WatchWrite otherwise, if
+// the file exists at the end; if it does not exist, the event is the last
+// of WatchRemove and WatchRename, or there is none if the file was only
+// created during the burst, such as a temporary file.
+type Watcher struct {
+	backend watchBackend
+	cancel  context.CancelFunc
+	stopped chan struct{}
+	raw     chan Event
+	errs    chan error
+	done    <-chan struct{}
+	events  chan Event
+	errors  chan error
+	err     error // from closing the backend
+
+	debounce time.Duration
+
+	mu    sync.Mutex
+	trees map[string]bool // directories watched recursively
+}
+
+// NewWatcher returns a Watcher that watches nothing yet. It stops watching
+// and closes its channels when ctx is done or Close is called. The only
+// option is Debounce.
+func NewWatcher(ctx context.Context, opts ...WatchOption) (*Watcher, error) {
+	var o watchOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watcher{
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+		raw:     make(chan Event),
+		errs:    make(chan error),
+		done:    ctx.Done(),
+		events:  make(chan Event),
+		errors:  make(chan error),
+		trees:   make(map[string]bool),
+
+		debounce: o.debounce,
+	}
+	b, err := newWatchBackend(w.emit, w.fail)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	w.backend = b
+	go w.run()
+	return w, nil
+}
+
+// Events returns the channel on which changes are delivered.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Errors returns the channel on which errors are delivered.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Add watches the file or directory at path. For a directory, changes to
+// the directory itself and to the files in it are reported, but not
+// changes within its subdirectories.
+func (w *Watcher) Add(path string) error {
+	path = filepath.Clean(path)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return w.backend.add(path, fi.IsDir())
+}
+
+// AddRecursive watches the directory tree at root, including directories
+// that are created in it later; files that are already in a new directory
+// when it is first watched are reported as created. Symlinks to
+// directories are not followed.
+func (w *Watcher) AddRecursive(root string) error {
+	root = filepath.Clean(root)
+	if _, err := DirExists(root); err != nil {
+		return err
+	}
+	return w.addTree(root, nil)
+}
+
+// addTree watches the directories of the tree at root, calling found, if
+// it is not nil, for every file except root.
+func (w *Watcher) addTree(root string, found func(path string)) error {
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if path != root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if found != nil && path != root {
+			found(path)
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		if err := w.backend.add(path, true); err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.trees[path] = true
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// Remove stops watching path, and if it was added with AddRecursive, all
+// directories below it.
+func (w *Watcher) Remove(path string) error {
+	path = filepath.Clean(path)
+	w.mu.Lock()
+	var below []string
+	if w.trees[path] {
+		for dir := range w.trees {
+			if within, _ := isWithin(dir, path); within {
+				below = append(below, dir)
+				delete(w.trees, dir)
+			}
+		}
+	}
+	w.mu.Unlock()
+
+	err := w.backend.remove(path)
+	for _, dir := range below {
+		if dir != path {
+			w.backend.remove(dir)
+		}
+	}
+	return err
+}
+
+// Close stops watching and closes the channels of the Watcher.
+func (w *Watcher) Close() error {
+	w.cancel()
+	<-w.stopped
+	return w.err
+}
+
+// emit passes an event from the backend to run.
+func (w *Watcher) emit(ev Event) {
+	select {
+	case w.raw <- ev:
+	case <-w.done:
+	}
+}
+
+// fail passes an error from the backend to run.
+func (w *Watcher) fail(err error) {
+	select {
+	case w.errs <- err:
+	case <-w.done:
+	}
+}
+
+// maxWatchQueue is the number of events that are queued for the receiver
+// before the Watcher stops reading events from the system, and the number
+// of errors that are queued before further errors are dropped.
+const maxWatchQueue = 4096
+
+// run queues the events of the backend until they are received, dropping
+// duplicates, and watches new directories in trees.
+func (w *Watcher) run() {
+	defer close(w.stopped)
+	defer close(w.errors)
+	defer close(w.events)
+	defer func() { w.err = w.backend.close() }()
+
+	var queue []Event
+	var errs []error
+	pending := make(map[Event]bool)
+	push := func(ev Event) {
+		if !pending[ev] {
+			pending[ev] = true
+			queue = append(queue, ev)
+		}
+	}
+	pushErr := func(err error) {
+		if len(errs) < maxWatchQueue {
+			errs = append(errs, err)
+		}
+	}
+	d := newDebouncer(w.debounce, push)
+	defer d.stop()
+	receive := push
+	if w.debounce > 0 {
+		receive = d.add
+	}
+	for {
+		var out chan Event
+		var next Event
+		if len(queue) > 0 {
+			out, next = w.events, queue[0]
+		}
+		var errOut chan error
+		var nextErr error
+		if len(errs) > 0 {
+			errOut, nextErr = w.errors, errs[0]
+		}
+		raw := w.raw
+		if len(queue) >= maxWatchQueue {
+			raw = nil
+		}
+
+		select {
+		case ev := <-raw:
+			receive(ev)
+			w.update(ev, receive, pushErr)
+		case <-d.timer():
+			d.settle()
+		case err := <-w.errs:
+			pushErr(err)
+		case out <- next:
+			delete(pending, next)
+			queue = queue[1:]
+		case errOut <- nextErr:
+			errs = errs[1:]
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// update keeps the trees in step with the event ev, pushing events for the
+// contents of new directories.
+func (w *Watcher) update(ev Event, push func(Event), fail func(error)) {
+	w.mu.Lock()
+	inTree := w.trees[filepath.Dir(ev.Name)]
+	if ev.Op == WatchRemove || ev.Op == WatchRename {
+		delete(w.trees, ev.Name)
+	}
+	w.mu.Unlock()
+	if !inTree || ev.Op != WatchCreate {
+		return
+	}
+	if fi, err := os.Lstat(ev.Name); err != nil || !fi.IsDir() {
+		return
+	}
+	err := w.addTree(ev.Name, func(path string) {
+		push(Event{path, WatchCreate})
+	})
+	if err != nil && !os.IsNotExist(err) {
+		fail(err)
+	}
+}
+
+// burst is the events for a file that a debouncer has held back.
+type burst struct {
+	first, last WatchOp
+	onlyChmod   bool
+	deadline    time.Time
+}
+
+// debouncer holds back the events for each file until there were none for
+// a while, and then passes a single event on to push.
+type debouncer struct {
+	quiet  time.Duration
+	push   func(Event)
+	bursts map[string]*burst
+	t      *time.Timer
+	active bool
+}
+
+// newDebouncer returns a debouncer that waits for quiet periods of d.
+func newDebouncer(d time.Duration, push func(Event)) *debouncer {
+	return &debouncer{quiet: d, push: push, bursts: make(map[string]*burst)}
+}
+
+// add holds back ev.
+func (d *debouncer) add(ev Event) {
+	b := d.bursts[ev.Name]
+	if b == nil {
+		b = &burst{first: ev.Op, onlyChmod: true}
+		d.bursts[ev.Name] = b
+	}
+	b.last = ev.Op
+	b.onlyChmod = b.onlyChmod && ev.Op == WatchChmod
+	b.deadline = time.Now().Add(d.quiet)
+	if !d.active {
+		d.reset(d.quiet)
+	}
+}
+
+// timer returns the channel on which settle must be called, which is nil
+// if there are no events held back.
+func (d *debouncer) timer() <-chan time.Time {
+	if !d.active {
+		return nil
+	}
+	return d.t.C
+}
+
+// reset lets the timer fire after dur.
+func (d *debouncer) reset(dur time.Duration) {
+	if d.t == nil {
+		d.t = time.NewTimer(dur)
+	} else {
+		d.t.Reset(dur)
+	}
+	d.active = true
+}
+
+// settle passes on the events for the files whose quiet periods are over,
+// in the order of their names, and waits for the next one.
+func (d *debouncer) settle() {
+	d.active = false
+	now := time.Now()
+	var names []string
+	var next time.Time
+	for name, b := range d.bursts {
+		if !b.deadline.After(now) {
+			names = append(names, name)
+		} else if next.IsZero() || b.deadline.Before(next) {
+			next = b.deadline
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if op := d.bursts[name].op(name); op != 0 {
+			d.push(Event{name, op})
+		}
+		delete(d.bursts, name)
+	}
+	if !next.IsZero() {
+		d.reset(next.Sub(now))
+	}
+}
+
+// op returns the operation that sums up the burst for the file name, or 0
+// if there is none.
+func (b *burst) op(name string) WatchOp {
+	if _, err := os.Lstat(name); err != nil {
+		switch {
+		case b.first == WatchCreate:
+			return 0
+		case b.last == WatchRename:
+			return WatchRename
+		default:
+			return WatchRemove
+		}
+	}
+	switch {
+	case b.first == WatchCreate:
+		return WatchCreate
+	case b.onlyChmod:
+		return WatchChmod
+	default:
+		return WatchWrite
+	}
+}
+
+// stop stops the timer.
+func (d *debouncer) stop() {
+	if d.t != nil {
+		d.t.Stop()
+	}
+}
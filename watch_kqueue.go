@@ -0,0 +1,249 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// kqueueFlags selects the vnode events that are reported.
+const kqueueFlags = unix.NOTE_DELETE | unix.NOTE_WRITE | unix.NOTE_EXTEND |
+	unix.NOTE_ATTRIB | unix.NOTE_RENAME
+
+// kqueueBackend watches files with kqueue. As kqueue only reports that a
+// directory changed, the entries of watched directories are remembered and
+// compared with the new entries, and regular files in them are watched as
+// well, so that writes to them are reported.
+type kqueueBackend struct {
+	kq   int
+	wake [2]int // pipe that stops read
+	emit func(Event)
+	fail func(error)
+
+	mu      sync.Mutex
+	watches map[string]*kqueueWatch
+	byFD    map[int]*kqueueWatch
+}
+
+// kqueueWatch is a file that is open to be watched.
+type kqueueWatch struct {
+	path     string
+	fd       int
+	dir      bool
+	explicit bool            // added, not only as an entry of a directory
+	entries  map[string]bool // names in a directory
+}
+
+// newWatchBackend returns a kqueue, whose events are read until the
+// pipe that is registered with it becomes readable.
+func newWatchBackend(emit func(Event), fail func(error)) (watchBackend, error) {
+	kq, err := unix.Kqueue()
+	if err != nil {
+		return nil, os.NewSyscallError("kqueue", err)
+	}
+	unix.CloseOnExec(kq)
+	b := &kqueueBackend{
+		kq:      kq,
+		emit:    emit,
+		fail:    fail,
+		watches: make(map[string]*kqueueWatch),
+		byFD:    make(map[int]*kqueueWatch),
+	}
+	if err := unix.Pipe(b.wake[:]); err != nil {
+		unix.Close(kq)
+		return nil, os.NewSyscallError("pipe", err)
+	}
+	unix.CloseOnExec(b.wake[0])
+	unix.CloseOnExec(b.wake[1])
+	var kev unix.Kevent_t
+	unix.SetKevent(&kev, b.wake[0], unix.EVFILT_READ, unix.EV_ADD)
+	if _, err := unix.Kevent(kq, []unix.Kevent_t{kev}, nil, nil); err != nil {
+		unix.Close(kq)
+		unix.Close(b.wake[0])
+		unix.Close(b.wake[1])
+		return nil, os.NewSyscallError("kevent", err)
+	}
+	go b.read()
+	return b, nil
+}
+
+func (b *kqueueBackend) add(path string, dir bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w := b.watches[path]
+	if w == nil {
+		var err error
+		if w, err = b.watch(path, dir); err != nil {
+			return err
+		}
+	}
+	w.explicit = true
+	if dir && w.entries == nil {
+		w.entries = make(map[string]bool)
+		b.rescan(w)
+	}
+	return nil
+}
+
+// watch opens path and registers it with the kqueue.
+func (b *kqueueBackend) watch(path string, dir bool) (*kqueueWatch, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	var kev unix.Kevent_t
+	unix.SetKevent(&kev, fd, unix.EVFILT_VNODE, unix.EV_ADD|unix.EV_CLEAR)
+	kev.Fflags = kqueueFlags
+	if _, err := unix.Kevent(b.kq, []unix.Kevent_t{kev}, nil, nil); err != nil {
+		unix.Close(fd)
+		return nil, &os.PathError{Op: "kevent", Path: path, Err: err}
+	}
+	w := &kqueueWatch{path: path, fd: fd, dir: dir}
+	b.watches[path] = w
+	b.byFD[fd] = w
+	return w, nil
+}
+
+// unwatch closes w, and the files watched as entries of w, and removes w
+// from the entries of its directory.
+func (b *kqueueBackend) unwatch(w *kqueueWatch) {
+	unix.Close(w.fd)
+	delete(b.watches, w.path)
+	delete(b.byFD, w.fd)
+	for name := range w.entries {
+		if e := b.watches[filepath.Join(w.path, name)]; e != nil && !e.explicit {
+			b.unwatch(e)
+		}
+	}
+	if parent := b.watches[filepath.Dir(w.path)]; parent != nil && parent != w {
+		delete(parent.entries, filepath.Base(w.path))
+	}
+}
+
+func (b *kqueueBackend) remove(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w := b.watches[path]
+	if w == nil {
+		return nil
+	}
+	// Files in watched directories are still watched as entries.
+	if parent := b.watches[filepath.Dir(path)]; parent != nil && parent.entries[filepath.Base(path)] && !w.dir {
+		w.explicit = false
+		return nil
+	}
+	b.unwatch(w)
+	return nil
+}
+
+func (b *kqueueBackend) close() error {
+	b.mu.Lock()
+	for _, w := range b.watches {
+		unix.Close(w.fd)
+	}
+	b.watches = make(map[string]*kqueueWatch)
+	b.byFD = make(map[int]*kqueueWatch)
+	b.mu.Unlock()
+	unix.Write(b.wake[1], []byte{0})
+	return unix.Close(b.wake[1])
+}
+
+// read reads kqueue events until close is called.
+func (b *kqueueBackend) read() {
+	defer unix.Close(b.kq)
+	defer unix.Close(b.wake[0])
+	kevs := make([]unix.Kevent_t, 64)
+	for {
+		n, err := unix.Kevent(b.kq, nil, kevs, nil)
+		if err == unix.EINTR {
+			continue
+		} else if err != nil {
+			b.fail(os.NewSyscallError("kevent", err))
+			return
+		}
+		var events []Event
+		b.mu.Lock()
+		for _, kev := range kevs[:n] {
+			if int(kev.Ident) == b.wake[0] {
+				b.mu.Unlock()
+				return
+			}
+			if w := b.byFD[int(kev.Ident)]; w != nil {
+				events = append(events, b.events(w, uint32(kev.Fflags))...)
+			}
+		}
+		b.mu.Unlock()
+		for _, ev := range events {
+			b.emit(ev)
+		}
+	}
+}
+
+// events translates the vnode event flags of w into Events.
+func (b *kqueueBackend) events(w *kqueueWatch, flags uint32) []Event {
+	var events []Event
+	if flags&unix.NOTE_ATTRIB != 0 {
+		events = append(events, Event{w.path, WatchChmod})
+	}
+	if flags&(unix.NOTE_WRITE|unix.NOTE_EXTEND) != 0 {
+		if w.dir {
+			events = append(events, b.rescan(w)...)
+		} else {
+			events = append(events, Event{w.path, WatchWrite})
+		}
+	}
+	if flags&unix.NOTE_RENAME != 0 {
+		events = append(events, Event{w.path, WatchRename})
+	}
+	if flags&unix.NOTE_DELETE != 0 {
+		events = append(events, Event{w.path, WatchRemove})
+	}
+	if flags&(unix.NOTE_RENAME|unix.NOTE_DELETE) != 0 {
+		b.unwatch(w)
+	}
+	return events
+}
+
+// rescan compares the entries of the directory w with those it had before,
+// returning events for the differences, and watches new regular files.
+// Files that are watched themselves report their own removal.
+func (b *kqueueBackend) rescan(w *kqueueWatch) []Event {
+	names, err := readDirNames(w.path)
+	if err != nil {
+		return nil
+	}
+	var events []Event
+	current := make(map[string]bool, len(names))
+	for _, name := range names {
+		current[name] = true
+		if w.entries[name] {
+			continue
+		}
+		path := filepath.Join(w.path, name)
+		w.entries[name] = true
+		events = append(events, Event{path, WatchCreate})
+		if fi, err := os.Lstat(path); err == nil && fi.Mode().IsRegular() && b.watches[path] == nil {
+			b.watch(path, false)
+		}
+	}
+	for name := range w.entries {
+		if current[name] {
+			continue
+		}
+		delete(w.entries, name)
+		path := filepath.Join(w.path, name)
+		if b.watches[path] == nil {
+			events = append(events, Event{path, WatchRemove})
+		}
+	}
+	return events
+}
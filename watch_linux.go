@@ -0,0 +1,149 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects the inotify events that are reported.
+const inotifyMask = unix.IN_CREATE | unix.IN_MOVED_TO | unix.IN_MODIFY |
+	unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_MOVED_FROM |
+	unix.IN_MOVE_SELF | unix.IN_ATTRIB
+
+// inotifyBackend watches files with inotify.
+type inotifyBackend struct {
+	fd   int
+	f    *os.File
+	emit func(Event)
+	fail func(error)
+
+	mu    sync.Mutex
+	paths map[int]string // watch descriptors to paths
+	wds   map[string]int
+}
+
+// newWatchBackend returns an inotify instance, whose events are read by
+// the runtime poller, so that closing it stops reading.
+func newWatchBackend(emit func(Event), fail func(error)) (watchBackend, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	b := &inotifyBackend{
+		fd:    fd,
+		f:     os.NewFile(uintptr(fd), "inotify"),
+		emit:  emit,
+		fail:  fail,
+		paths: make(map[int]string),
+		wds:   make(map[string]int),
+	}
+	go b.read()
+	return b, nil
+}
+
+func (b *inotifyBackend) add(path string, dir bool) error {
+	wd, err := unix.InotifyAddWatch(b.fd, path, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+	}
+	b.mu.Lock()
+	b.paths[wd] = path
+	b.wds[path] = wd
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *inotifyBackend) remove(path string) error {
+	b.mu.Lock()
+	wd, ok := b.wds[path]
+	if ok {
+		delete(b.wds, path)
+		delete(b.paths, wd)
+	}
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if _, err := unix.InotifyRmWatch(b.fd, uint32(wd)); err != nil && err != unix.EINVAL {
+		return &os.PathError{Op: "inotify_rm_watch", Path: path, Err: err}
+	}
+	return nil
+}
+
+func (b *inotifyBackend) close() error {
+	return b.f.Close()
+}
+
+// read reads inotify events until the instance is closed.
+func (b *inotifyBackend) read() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := b.f.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		} else if err != nil {
+			b.fail(err)
+			return
+		}
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + unix.SizeofInotifyEvent
+			off = start + int(raw.Len)
+			name := string(bytes.TrimRight(buf[start:off], "\x00"))
+			for _, ev := range b.events(int(raw.Wd), raw.Mask, name) {
+				b.emit(ev)
+			}
+		}
+	}
+}
+
+// events translates an inotify event into zero or more Events.
+func (b *inotifyBackend) events(wd int, mask uint32, name string) []Event {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		b.fail(errors.New("inotify event queue overflowed, events were lost"))
+		return nil
+	}
+	b.mu.Lock()
+	path, ok := b.paths[wd]
+	if mask&unix.IN_IGNORED != 0 && ok {
+		delete(b.paths, wd)
+		if b.wds[path] == wd {
+			delete(b.wds, path)
+		}
+	}
+	b.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	if name != "" {
+		path = filepath.Join(path, name)
+	}
+
+	var events []Event
+	if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		events = append(events, Event{path, WatchCreate})
+	}
+	if mask&unix.IN_MODIFY != 0 {
+		events = append(events, Event{path, WatchWrite})
+	}
+	if mask&unix.IN_ATTRIB != 0 {
+		events = append(events, Event{path, WatchChmod})
+	}
+	if mask&(unix.IN_MOVED_FROM|unix.IN_MOVE_SELF) != 0 {
+		events = append(events, Event{path, WatchRename})
+	}
+	if mask&(unix.IN_DELETE|unix.IN_DELETE_SELF) != 0 {
+		events = append(events, Event{path, WatchRemove})
+	}
+	return events
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package osutil
+
+import "errors"
+
+// newWatchBackend returns an error, as files cannot be watched on this
+// platform.
+func newWatchBackend(emit func(Event), fail func(error)) (watchBackend, error) {
+	return nil, errors.New("watching files is not supported on this platform")
+}
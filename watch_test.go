@@ -0,0 +1,197 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitEvent receives events from w until one is the same as ev, returning
+// false if none is within d.
+func waitEvent(w *Watcher, ev Event, d time.Duration) bool {
+	timeout := time.After(d)
+	for {
+		select {
+		case got, ok := <-w.Events():
+			if !ok {
+				return false
+			}
+			if got == ev {
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+func TestWatcher(z *testing.T) {
+	if runtime.GOOS != "linux" {
+		z.Skip("watching files is only tested on Linux")
+	}
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	join := func(name string) string { return filepath.Join(dir, name) }
+
+	w, err := NewWatcher(context.Background())
+	assert.Nil(err)
+	defer w.Close()
+	assert.Nil(w.Add(dir))
+
+	assert.Nil(ioutil.WriteFile(join("file"), []byte("data"), 0644))
+	assert.True(waitEvent(w, Event{join("file"), WatchCreate}, time.Second))
+	assert.True(waitEvent(w, Event{join("file"), WatchWrite}, time.Second))
+	assert.Nil(os.Chmod(join("file"), 0600))
+	assert.True(waitEvent(w, Event{join("file"), WatchChmod}, time.Second))
+	assert.Nil(os.Rename(join("file"), join("moved")))
+	assert.True(waitEvent(w, Event{join("file"), WatchRename}, time.Second))
+	assert.True(waitEvent(w, Event{join("moved"), WatchCreate}, time.Second))
+	assert.Nil(os.Remove(join("moved")))
+	assert.True(waitEvent(w, Event{join("moved"), WatchRemove}, time.Second))
+
+	// Changes in subdirectories are not reported without AddRecursive.
+	assert.Nil(os.Mkdir(join("sub"), 0755))
+	assert.True(waitEvent(w, Event{join("sub"), WatchCreate}, time.Second))
+	assert.Nil(ioutil.WriteFile(join("sub/file"), nil, 0644))
+	assert.False(waitEvent(w, Event{join("sub/file"), WatchCreate}, 100*time.Millisecond))
+
+	assert.Nil(w.Remove(dir))
+	assert.Nil(ioutil.WriteFile(join("other"), nil, 0644))
+	assert.False(waitEvent(w, Event{join("other"), WatchCreate}, 100*time.Millisecond))
+}
+
+func TestWatcherRecursive(z *testing.T) {
+	if runtime.GOOS != "linux" {
+		z.Skip("watching files is only tested on Linux")
+	}
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	join := func(name string) string { return filepath.Join(dir, name) }
+	assert.Nil(os.MkdirAll(join("a/b"), 0755))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := NewWatcher(ctx)
+	assert.Nil(err)
+	assert.Nil(w.AddRecursive(dir))
+
+	assert.Nil(ioutil.WriteFile(join("a/b/file"), nil, 0644))
+	assert.True(waitEvent(w, Event{join("a/b/file"), WatchCreate}, time.Second))
+
+	// New directories are watched, and their contents are reported.
+	assert.Nil(os.MkdirAll(join("c/d/e"), 0755))
+	assert.True(waitEvent(w, Event{join("c"), WatchCreate}, time.Second))
+	assert.Nil(ioutil.WriteFile(join("c/d/e/file"), nil, 0644))
+	assert.True(waitEvent(w, Event{join("c/d/e/file"), WatchCreate}, time.Second))
+
+	// The channels are closed when the context is done.
+	cancel()
+	timeout := time.After(time.Second)
+	for closed := false; !closed; {
+		select {
+		case _, ok := <-w.Events():
+			closed = !ok
+		case <-timeout:
+			z.Fatal("events were not closed")
+		}
+	}
+	_, ok := <-w.Errors()
+	assert.False(ok)
+	assert.Nil(w.Close())
+}
+
+func TestWatcherCoalesce(z *testing.T) {
+	if runtime.GOOS != "linux" {
+		z.Skip("watching files is only tested on Linux")
+	}
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	assert.Nil(ioutil.WriteFile(file, nil, 0644))
+
+	w, err := NewWatcher(context.Background())
+	assert.Nil(err)
+	defer w.Close()
+	assert.Nil(w.Add(file))
+
+	// The writes are queued while nothing is received.
+	f, err := os.OpenFile(file, os.O_WRONLY, 0)
+	assert.Nil(err)
+	for i := 0; i < 100; i++ {
+		f.Write([]byte("x"))
+	}
+	f.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	writes := 0
+	for done := false; !done; {
+		select {
+		case ev := <-w.Events():
+			if ev.Op == WatchWrite {
+				writes++
+			}
+		case <-time.After(100 * time.Millisecond):
+			done = true
+		}
+	}
+	assert.Equal(1, writes)
+}
+
+func TestWatcherDebounce(z *testing.T) {
+	if runtime.GOOS != "linux" {
+		z.Skip("watching files is only tested on Linux")
+	}
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	join := func(name string) string { return filepath.Join(dir, name) }
+	assert.Nil(ioutil.WriteFile(join("config"), []byte("old"), 0644))
+
+	w, err := NewWatcher(context.Background(), Debounce(50*time.Millisecond))
+	assert.Nil(err)
+	defer w.Close()
+	assert.Nil(w.Add(dir))
+
+	// Save the file like an editor, whose temporary and backup files only
+	// exist for a moment.
+	assert.Nil(ioutil.WriteFile(join("4913"), nil, 0644))
+	assert.Nil(os.Remove(join("4913")))
+	assert.Nil(os.Rename(join("config"), join("config~")))
+	assert.Nil(ioutil.WriteFile(join("config"), []byte("new"), 0600))
+	assert.Nil(os.Chmod(join("config"), 0644))
+	assert.Nil(os.Remove(join("config~")))
+
+	var events []Event
+	for done := false; !done; {
+		select {
+		case ev := <-w.Events():
+			events = append(events, ev)
+		case <-time.After(300 * time.Millisecond):
+			done = true
+		}
+	}
+	assert.Equal([]Event{{join("config"), WatchWrite}}, events)
+
+	assert.Nil(os.Chmod(join("config"), 0600))
+	assert.True(waitEvent(w, Event{join("config"), WatchChmod}, time.Second))
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// winWatchMask selects the changes that ReadDirectoryChangesW reports.
+const winWatchMask = windows.FILE_NOTIFY_CHANGE_FILE_NAME | windows.FILE_NOTIFY_CHANGE_DIR_NAME |
+	windows.FILE_NOTIFY_CHANGE_ATTRIBUTES | windows.FILE_NOTIFY_CHANGE_SIZE |
+	windows.FILE_NOTIFY_CHANGE_LAST_WRITE | windows.FILE_NOTIFY_CHANGE_CREATION
+
+// errWatchOverflow is reported when changes were lost.
+var errWatchOverflow = errors.New("too many changes to report, events were lost")
+
+// winBackend watches directories with ReadDirectoryChangesW, each in its
+// own goroutine. Files are watched through their directories, whose
+// changes are filtered by name.
+type winBackend struct {
+	emit func(Event)
+	fail func(error)
+
+	mu   sync.Mutex
+	dirs map[string]*winDir
+}
+
+// winDir is a directory that is watched.
+type winDir struct {
+	path  string
+	h     windows.Handle
+	stop  windows.Handle // event that stops read
+	ov    *windows.Overlapped
+	all   bool            // watched itself, not only for files in it
+	files map[string]bool // names of files that are watched
+}
+
+// newWatchBackend returns a backend that watches nothing yet.
+func newWatchBackend(emit func(Event), fail func(error)) (watchBackend, error) {
+	return &winBackend{emit: emit, fail: fail, dirs: make(map[string]*winDir)}, nil
+}
+
+func (b *winBackend) add(path string, dir bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if dir {
+		d, err := b.dir(path)
+		if err != nil {
+			return err
+		}
+		d.all = true
+		return nil
+	}
+	d, err := b.dir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	d.files[filepath.Base(path)] = true
+	return nil
+}
+
+// dir returns the winDir for path, opening it if necessary.
+func (b *winBackend) dir(path string) (*winDir, error) {
+	if d := b.dirs[path]; d != nil {
+		return d, nil
+	}
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(p, windows.FILE_LIST_DIRECTORY,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "CreateFile", Path: path, Err: err}
+	}
+	stop, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, os.NewSyscallError("CreateEvent", err)
+	}
+	done, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		windows.CloseHandle(h)
+		windows.CloseHandle(stop)
+		return nil, os.NewSyscallError("CreateEvent", err)
+	}
+	// The Overlapped is allocated on the heap, as the system writes to it
+	// after ReadDirectoryChanges returns.
+	d := &winDir{
+		path:  path,
+		h:     h,
+		stop:  stop,
+		ov:    &windows.Overlapped{HEvent: done},
+		files: make(map[string]bool),
+	}
+	b.dirs[path] = d
+	go b.read(d)
+	return d, nil
+}
+
+func (b *winBackend) remove(path string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if d := b.dirs[path]; d != nil && d.all {
+		d.all = false
+		if len(d.files) == 0 {
+			b.stop(d)
+		}
+		return nil
+	}
+	if d := b.dirs[filepath.Dir(path)]; d != nil {
+		delete(d.files, filepath.Base(path))
+		if !d.all && len(d.files) == 0 {
+			b.stop(d)
+		}
+	}
+	return nil
+}
+
+// stop lets the goroutine that reads the changes of d stop.
+func (b *winBackend) stop(d *winDir) {
+	delete(b.dirs, d.path)
+	windows.SetEvent(d.stop)
+}
+
+func (b *winBackend) close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, d := range b.dirs {
+		b.stop(d)
+	}
+	return nil
+}
+
+// read reads the changes of d until it is stopped.
+func (b *winBackend) read(d *winDir) {
+	defer windows.CloseHandle(d.h)
+	defer windows.CloseHandle(d.stop)
+	defer windows.CloseHandle(d.ov.HEvent)
+	fail := func(err error) {
+		b.mu.Lock()
+		stopped := b.dirs[d.path] != d
+		if !stopped {
+			delete(b.dirs, d.path)
+		}
+		b.mu.Unlock()
+		if !stopped {
+			b.fail(err)
+		}
+	}
+
+	// The buffer is made of DWORDs, as the records in it must be aligned.
+	buf := make([]uint32, 16*1024)
+	for {
+		var n uint32
+		err := windows.ReadDirectoryChanges(d.h, (*byte)(unsafe.Pointer(&buf[0])), uint32(len(buf)*4), false, winWatchMask, nil, d.ov, 0)
+		if err != nil && err != windows.ERROR_IO_PENDING {
+			fail(&os.PathError{Op: "ReadDirectoryChanges", Path: d.path, Err: err})
+			return
+		}
+		i, err := windows.WaitForMultipleObjects([]windows.Handle{d.ov.HEvent, d.stop}, false, windows.INFINITE)
+		if err != nil {
+			windows.CancelIoEx(d.h, d.ov)
+			windows.GetOverlappedResult(d.h, d.ov, &n, true)
+			fail(os.NewSyscallError("WaitForMultipleObjects", err))
+			return
+		}
+		if i == windows.WAIT_OBJECT_0+1 {
+			windows.CancelIoEx(d.h, d.ov)
+			windows.GetOverlappedResult(d.h, d.ov, &n, true)
+			return
+		}
+		windows.ResetEvent(d.ov.HEvent)
+		err = windows.GetOverlappedResult(d.h, d.ov, &n, false)
+		if err == windows.ERROR_NOTIFY_ENUM_DIR {
+			b.fail(errWatchOverflow)
+			continue
+		} else if err != nil {
+			fail(&os.PathError{Op: "ReadDirectoryChanges", Path: d.path, Err: err})
+			return
+		}
+		if n == 0 {
+			b.fail(errWatchOverflow)
+			continue
+		}
+		for _, ev := range b.events(d, (*[1 << 30]byte)(unsafe.Pointer(&buf[0]))[:n:n]) {
+			b.emit(ev)
+		}
+	}
+}
+
+// events translates the FILE_NOTIFY_INFORMATION records in buf into
+// Events, skipping files in d that are not watched.
+func (b *winBackend) events(d *winDir, buf []byte) []Event {
+	var events []Event
+	for off := 0; off < len(buf); {
+		raw := (*windows.FileNotifyInformation)(unsafe.Pointer(&buf[off]))
+		size := int(raw.FileNameLength / 2)
+		name := string(utf16.Decode((*[1 << 29]uint16)(unsafe.Pointer(&raw.FileName))[:size:size]))
+
+		b.mu.Lock()
+		watched := d.all || d.files[name]
+		b.mu.Unlock()
+		if watched {
+			path := filepath.Join(d.path, name)
+			switch raw.Action {
+			case windows.FILE_ACTION_ADDED, windows.FILE_ACTION_RENAMED_NEW_NAME:
+				events = append(events, Event{path, WatchCreate})
+			case windows.FILE_ACTION_REMOVED:
+				events = append(events, Event{path, WatchRemove})
+			case windows.FILE_ACTION_MODIFIED:
+				events = append(events, Event{path, WatchWrite})
+			case windows.FILE_ACTION_RENAMED_OLD_NAME:
+				events = append(events, Event{path, WatchRename})
+			}
+		}
+		if raw.NextEntryOffset == 0 {
+			break
+		}
+		off += int(raw.NextEntryOffset)
+	}
+	return events
+}
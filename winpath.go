@@ -0,0 +1,61 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"strings"
+)
+
+// windowsReserved contains the device names that cannot be used as file
+// names on Windows, regardless of case and extension.
+var windowsReserved = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// WindowsSafeName maps the entry name, which uses forward slashes, to a
+// name that is valid on Windows. In each component, the characters
+// <>:"|?*\ and control characters are replaced by an underscore, trailing
+// dots and spaces are removed, and reserved device names such as CON or
+// nul.txt are prefixed with an underscore. Names that are already valid
+// are returned as they are.
+//
+// ExtractArchive applies this mapping on Windows, and on other systems
+// with WindowsSafeNames.
+func WindowsSafeName(name string) string {
+	components := strings.Split(name, "/")
+	for i, c := range components {
+		if c == "" || c == "." || c == ".." {
+			continue
+		}
+		components[i] = windowsSafeComponent(c)
+	}
+	return strings.Join(components, "/")
+}
+
+// windowsSafeComponent maps a single component of a name for WindowsSafeName.
+func windowsSafeComponent(c string) string {
+	c = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"|?*\`, r) {
+			return '_'
+		}
+		return r
+	}, c)
+	c = strings.TrimRight(c, ". ")
+	if c == "" {
+		return "_"
+	}
+	base := c
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReserved[strings.ToUpper(strings.TrimRight(base, " "))] {
+		return "_" + c
+	}
+	return c
+}
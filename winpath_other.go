@@ -0,0 +1,17 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package osutil
+
+// windowsPaths is true if entry names must be mapped with WindowsSafeName.
+const windowsPaths = false
+
+// longPath returns path, as there is no limit on the length of paths on
+// this platform that could be avoided.
+func longPath(path string) string {
+	return path
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowsSafeName(z *testing.T) {
+	assert := assert.New(z)
+
+	for name, want := range map[string]string{
+		"dir/file.txt":          "dir/file.txt",
+		"dir/":                  "dir/",
+		"a:b/c?d*e":             "a_b/c_d_e",
+		"CON":                   "_CON",
+		"docs/nul.txt":          "docs/_nul.txt",
+		"com1.tar.gz":           "_com1.tar.gz",
+		"console":               "console",
+		"trailing. /dots...":    "trailing/dots",
+		"...":                   "_",
+		"back\\slash\x01":       "back_slash_",
+		"./relative/../name":    "./relative/../name",
+		"<tag>|\"quoted\"/lpt9": "_tag___quoted_/_lpt9",
+	} {
+		assert.Equal(want, WindowsSafeName(name), name)
+	}
+}
+
+func TestExtractArchiveWindowsSafeNames(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	archive := filepath.Join(dir, "win.tar")
+	err = writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "aux/", Typeflag: tar.TypeDir, Mode: 0755}, ""},
+		{tar.Header{Name: "aux/12:00.log", Typeflag: tar.TypeReg, Mode: 0644}, "log"},
+		{tar.Header{Name: "aux/link", Typeflag: tar.TypeLink, Linkname: "aux/12:00.log"}, ""},
+	})
+	assert.Nil(err)
+
+	dest := filepath.Join(dir, "out")
+	err = ExtractArchive(archive, dest, WindowsSafeNames())
+	assert.Nil(err)
+	data, err := ioutil.ReadFile(filepath.Join(dest, "_aux/12_00.log"))
+	assert.Nil(err)
+	assert.Equal("log", string(data))
+	same, err := SameFile(filepath.Join(dest, "_aux/12_00.log"), filepath.Join(dest, "_aux/link"))
+	assert.Nil(err)
+	assert.True(same)
+}
@@ -0,0 +1,29 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// windowsPaths is true if entry names must be mapped with WindowsSafeName.
+const windowsPaths = true
+
+// maxPath is the length from which paths need the long-path prefix.
+const maxPath = 260
+
+// longPath returns path with the \\?\ prefix if it is too long for the
+// usual Windows API, so that it can be longer than MAX_PATH.
+func longPath(path string) string {
+	if len(path) < maxPath || strings.HasPrefix(path, `\\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"sync"
+)
+
+// Workers lets ExtractArchive write regular files with n goroutines, while
+// the archive is decoded by another one. This helps when writing files
+// dominates the extraction, as on network file systems. Files are read
+// into memory before they are written, except large ones, which are
+// written directly.
+//
+// Entries are still extracted in archive order where it matters:
+// directories are created before their contents, and entries that replace
+// or link to a file wait until it has been written.
+//
+// It also lets DiskUsage read directories with n goroutines.
+func Workers(n int) WorkersOption {
+	return workersOption(n)
+}
+
+// WorkersOption is an option that configures both ExtractArchive and
+// DiskUsage.
+type WorkersOption interface {
+	Option
+	UsageOption
+}
+
+// workersOption is the implementation of WorkersOption.
+type workersOption int
+
+func (n workersOption) applyArchive(o *archiveOptions) { o.workers = int(n) }
+func (n workersOption) applyUsage(o *usageOptions)     { o.workers = int(n) }
+
+// writerPool writes the files of an extractor concurrently.
+// All methods are safe to call on a nil writerPool.
+type writerPool struct {
+	x    *extractor
+	jobs chan writeJob
+	wg   sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+	// pending contains the targets that are being written, together with
+	// a channel that is closed once they have been.
+	pending map[string]chan struct{}
+}
+
+// writeJob is a file that is written by a worker of a writerPool.
+type writeJob struct {
+	target string
+	mode   os.FileMode
+	data   []byte
+	hdr    *tar.Header
+	done   chan struct{}
+}
+
+// newWriterPool returns a writerPool with n workers if n is larger than 1,
+// and nil otherwise.
+func newWriterPool(x *extractor, n int) *writerPool {
+	if n <= 1 {
+		return nil
+	}
+	p := &writerPool{
+		x:       x,
+		jobs:    make(chan writeJob, n),
+		pending: make(map[string]chan struct{}),
+	}
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// work writes the files it receives until the pool is closed.
+func (p *writerPool) work() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		err := prepareTarget(j.target)
+		if err == nil {
+			err = writeFile(j.target, j.mode, bytes.NewReader(j.data), isSparseEntry(j.hdr))
+		}
+		if err == nil {
+			err = p.x.restore(j.target, j.hdr)
+		}
+
+		p.mu.Lock()
+		if err != nil && p.err == nil {
+			p.err = err
+		}
+		if p.pending[j.target] == j.done {
+			delete(p.pending, j.target)
+		}
+		p.mu.Unlock()
+		close(j.done)
+	}
+}
+
+// accepts returns true if the pool writes files of the given size.
+func (p *writerPool) accepts(size int64) bool {
+	return p != nil && size <= maxPrealloc
+}
+
+// submit lets a worker write data to target. The caller must have waited
+// for any earlier file with the same target.
+func (p *writerPool) submit(target string, mode os.FileMode, data []byte, hdr *tar.Header) {
+	done := make(chan struct{})
+	p.mu.Lock()
+	p.pending[target] = done
+	p.mu.Unlock()
+	p.jobs <- writeJob{target, mode, data, hdr, done}
+}
+
+// wait waits until the file at target, if it is being written, has been.
+func (p *writerPool) wait(target string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	done := p.pending[target]
+	p.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// error returns the first error that a worker encountered.
+func (p *writerPool) error() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// close waits until all files have been written and stops the workers.
+func (p *writerPool) close() error {
+	if p == nil {
+		return nil
+	}
+	close(p.jobs)
+	p.wg.Wait()
+	return p.err
+}
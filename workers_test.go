@@ -0,0 +1,90 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractArchiveWorkers(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	mtime := time.Unix(1400000000, 0)
+	entries := []testEntry{
+		{tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0555, ModTime: mtime}, ""},
+	}
+	for i := 0; i < 50; i++ {
+		entries = append(entries, testEntry{
+			tar.Header{Name: fmt.Sprintf("d/file%d", i), Typeflag: tar.TypeReg, Mode: 0600, ModTime: mtime},
+			fmt.Sprintf("contents %d", i),
+		})
+	}
+	entries = append(entries,
+		// Later entries replace earlier ones, and links need their targets.
+		testEntry{tar.Header{Name: "d/file7", Typeflag: tar.TypeReg, Mode: 0644, ModTime: mtime}, "replaced"},
+		testEntry{tar.Header{Name: "d/hard", Typeflag: tar.TypeLink, Linkname: "d/file7"}, ""},
+		testEntry{tar.Header{Name: "d/file3", Typeflag: tar.TypeSymlink, Linkname: "file7"}, ""},
+	)
+	archive := filepath.Join(dir, "workers.tar")
+	assert.Nil(writeTestTar(archive, entries))
+
+	dest := filepath.Join(dir, "out")
+	err = ExtractArchive(archive, dest, Workers(4), PreservePermissions(), PreserveTimes())
+	assert.Nil(err)
+	defer os.Chmod(filepath.Join(dest, "d"), 0755)
+
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(dest, fmt.Sprintf("d/file%d", i))
+		data, err := ioutil.ReadFile(name)
+		assert.Nil(err)
+		switch i {
+		case 3, 7:
+			assert.Equal("replaced", string(data))
+		default:
+			assert.Equal(fmt.Sprintf("contents %d", i), string(data))
+			fi, err := os.Stat(name)
+			if assert.Nil(err) {
+				assert.Equal(os.FileMode(0600), fi.Mode())
+				assert.True(fi.ModTime().Equal(mtime))
+			}
+		}
+	}
+	same, err := SameFile(filepath.Join(dest, "d/file7"), filepath.Join(dest, "d/hard"))
+	assert.Nil(err)
+	assert.True(same)
+	fi, err := os.Stat(filepath.Join(dest, "d"))
+	if assert.Nil(err) {
+		assert.Equal(os.FileMode(0555)|os.ModeDir, fi.Mode())
+	}
+}
+
+func TestExtractArchiveWorkersError(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// The file f cannot be a directory as well, whichever is written first.
+	archive := filepath.Join(dir, "conflict.tar")
+	assert.Nil(writeTestTar(archive, []testEntry{
+		{tar.Header{Name: "f", Typeflag: tar.TypeReg, Mode: 0644}, "file"},
+		{tar.Header{Name: "f/g", Typeflag: tar.TypeReg, Mode: 0644}, "file"},
+	}))
+	err = ExtractArchive(archive, filepath.Join(dir, "out"), Workers(2))
+	assert.NotNil(err)
+}
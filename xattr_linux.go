@@ -0,0 +1,54 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the extended attributes of the file at path, without
+// following symlinks. If the file system does not support extended
+// attributes, nil is returned.
+func readXattrs(path string) (map[string]string, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err == unix.ENOTSUP {
+		return nil, nil
+	} else if err != nil || size == 0 {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	size, err = unix.Llistxattr(path, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := make(map[string]string)
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		size, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		val := make([]byte, size)
+		size, err = unix.Lgetxattr(path, name, val)
+		if err != nil {
+			return nil, err
+		}
+		xattrs[name] = string(val[:size])
+	}
+	return xattrs, nil
+}
+
+// writeXattrs sets the extended attributes of the file at path, without
+// following symlinks.
+func writeXattrs(path string, xattrs map[string]string) error {
+	for name, val := range xattrs {
+		if err := unix.Lsetxattr(path, name, []byte(val), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
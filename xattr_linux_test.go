@@ -0,0 +1,43 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestXattrRoundTrip(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	assert.Nil(os.Mkdir(src, 0755))
+	file := filepath.Join(src, "file")
+	assert.Nil(ioutil.WriteFile(file, []byte("data"), 0644))
+	if err := unix.Lsetxattr(file, "user.osutil", []byte("value"), 0); err != nil {
+		z.Skip("extended attributes not supported:", err)
+	}
+
+	archive := filepath.Join(dir, "xattr.tar")
+	err = CreateArchive(archive, src, PreserveXattrs())
+	assert.Nil(err)
+
+	dest := filepath.Join(dir, "dest")
+	err = ExtractArchive(archive, dest, PreserveXattrs())
+	assert.Nil(err)
+
+	xattrs, err := readXattrs(filepath.Join(dest, "file"))
+	assert.Nil(err)
+	assert.Equal("value", xattrs["user.osutil"])
+}
@@ -0,0 +1,20 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package osutil
+
+// readXattrs returns no extended attributes, as they are not supported
+// on this platform.
+func readXattrs(path string) (map[string]string, error) {
+	return nil, nil
+}
+
+// writeXattrs ignores the extended attributes, as they are not supported
+// on this platform.
+func writeXattrs(path string, xattrs map[string]string) error {
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+// OpenFileFromZip opens the file in the zip archive for streaming. Unlike
+// ReadFileFromArchive, only the central directory and the entry itself are
+// read, and the contents are not loaded into memory, which makes this
+// suitable for reading single files from very large archives. Archives
+// with the Zip64 extensions, which are needed for archives and entries
+// of 4 GiB or more and for more than 65535 entries, are supported. The
+// returned reader must be closed, which also closes the archive.
+//
+// Options supported are Password, IgnoreCase, and IgnoreDotSlash.
+func OpenFileFromZip(archive, file string, opts ...Option) (io.ReadCloser, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rc, err := OpenZipEntry(f, fi.Size(), file, opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &zipEntryReader{rc, f}, nil
+}
+
+// OpenZipEntry is the same as OpenFileFromZip, except that the zip archive
+// of the given size is read from r, which must remain valid until the
+// returned reader is closed.
+func OpenZipEntry(r io.ReaderAt, size int64, file string, opts ...Option) (io.ReadCloser, error) {
+	o := newArchiveOptions(opts)
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range zr.File {
+		if !o.matchName(f.Name, file) {
+			continue
+		}
+		if f.Flags&zipFlagEncrypted != 0 {
+			return openEncryptedZipFile(r, f, o.password)
+		}
+		return f.Open()
+	}
+	return nil, NotFoundError{file}
+}
+
+// zipEntryReader reads an entry of a zip archive and closes the archive
+// together with the entry.
+type zipEntryReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+func (zr *zipEntryReader) Close() error {
+	err := zr.ReadCloser.Close()
+	if cerr := zr.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
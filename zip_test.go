@@ -0,0 +1,211 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenFileFromZip(z *testing.T) {
+	assert := assert.New(z)
+
+	rc, err := OpenFileFromZip("testdata/dir_reader_data.zip", "DIR2/FILE1", IgnoreCase())
+	if assert.Nil(err) {
+		data, err := ioutil.ReadAll(rc)
+		assert.Nil(err)
+		assert.Equal("dir2/file1\nApart from the header which is written in each file,\n", string(data))
+		assert.Nil(rc.Close())
+	}
+
+	_, err = OpenFileFromZip("testdata/dir_reader_data.zip", "missing")
+	assert.Equal(NotFoundError{"missing"}, err)
+	_, err = OpenFileFromZip("testdata/dir_reader_data.tar", "dir2/file1")
+	assert.NotNil(err)
+}
+
+func TestOpenZipEntry(z *testing.T) {
+	assert := assert.New(z)
+
+	archive, err := ioutil.ReadFile("testdata/dir_reader_data.encrypted.zip")
+	assert.Nil(err)
+	rc, err := OpenZipEntry(bytes.NewReader(archive), int64(len(archive)), "dir2/file3", Password("secret"))
+	if assert.Nil(err) {
+		data, err := ioutil.ReadAll(rc)
+		assert.Nil(err)
+		assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data))
+		assert.Nil(rc.Close())
+	}
+
+	_, err = OpenZipEntry(bytes.NewReader(archive), int64(len(archive)), "dir2/file3")
+	assert.Equal(PasswordError{"dir2/file3"}, err)
+}
+
+// sparseBuffer is a file in memory in which blocks of zeros take up no
+// space, so that archives larger than 4 GiB can be tested.
+type sparseBuffer struct {
+	blocks map[int64][]byte
+	size   int64
+}
+
+const sparseBufferBlockSize = 64 << 10
+
+var zeroBlock = make([]byte, sparseBufferBlockSize)
+
+func (sb *sparseBuffer) Write(p []byte) (int, error) {
+	if sb.blocks == nil {
+		sb.blocks = make(map[int64][]byte)
+	}
+	n := len(p)
+	for len(p) > 0 {
+		i, off := sb.size/sparseBufferBlockSize, sb.size%sparseBufferBlockSize
+		m := int(sparseBufferBlockSize - off)
+		if m > len(p) {
+			m = len(p)
+		}
+		block, ok := sb.blocks[i]
+		if !ok && !bytes.Equal(p[:m], zeroBlock[:m]) {
+			block = make([]byte, sparseBufferBlockSize)
+			sb.blocks[i] = block
+		}
+		if block != nil {
+			copy(block[off:], p[:m])
+		}
+		sb.size += int64(m)
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (sb *sparseBuffer) ReadAt(p []byte, pos int64) (int, error) {
+	n := 0
+	for len(p) > 0 && pos < sb.size {
+		i, off := pos/sparseBufferBlockSize, pos%sparseBufferBlockSize
+		m := int(sparseBufferBlockSize - off)
+		if m > len(p) {
+			m = len(p)
+		}
+		if rest := sb.size - pos; int64(m) > rest {
+			m = int(rest)
+		}
+		if block, ok := sb.blocks[i]; ok {
+			copy(p[:m], block[off:])
+		} else {
+			copy(p[:m], zeroBlock)
+		}
+		n += m
+		pos += int64(m)
+		p = p[m:]
+	}
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// zeroReader reads an endless stream of zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestZip64LargeEntry(z *testing.T) {
+	assert := assert.New(z)
+
+	// The entry is just larger than the 4 GiB limit of classic zip archives.
+	const size = 1<<32 + 1
+	var sb sparseBuffer
+	zw := zip.NewWriter(&sb)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "big", Method: zip.Store})
+	assert.Nil(err)
+	_, err = io.CopyN(w, zeroReader{}, size-3)
+	assert.Nil(err)
+	_, err = w.Write([]byte("end"))
+	assert.Nil(err)
+	w, err = zw.Create("small")
+	assert.Nil(err)
+	_, err = w.Write([]byte("small"))
+	assert.Nil(err)
+	assert.Nil(zw.Close())
+	assert.True(sb.size > size)
+
+	rc, err := OpenZipEntry(&sb, sb.size, "big")
+	if assert.Nil(err) {
+		tail := make([]byte, 3)
+		n, err := io.Copy(ioutil.Discard, io.LimitReader(rc, size-3))
+		assert.Nil(err)
+		assert.Equal(int64(size-3), n)
+		_, err = io.ReadFull(rc, tail)
+		assert.Nil(err)
+		assert.Equal("end", string(tail))
+		_, err = rc.Read(tail)
+		assert.Equal(io.EOF, err, "the checksum should match")
+		assert.Nil(rc.Close())
+	}
+
+	// The entry after the large one has an offset beyond 4 GiB.
+	rc, err = OpenZipEntry(&sb, sb.size, "small")
+	if assert.Nil(err) {
+		data, err := ioutil.ReadAll(rc)
+		assert.Nil(err)
+		assert.Equal("small", string(data))
+		assert.Nil(rc.Close())
+	}
+}
+
+func TestZip64ManyEntries(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	// Classic zip archives are limited to 65535 entries.
+	const n = 1<<16 + 1
+	ab, err := NewArchiveBuilder(FormatGzip)
+	assert.Nil(err)
+	for i := 0; i < n; i++ {
+		assert.Nil(ab.AddFile(fmt.Sprintf("dir/%05d", i), []byte(strconv.Itoa(i)), 0644))
+	}
+	src := filepath.Join(dir, "many.tar.gz")
+	f, err := os.Create(src)
+	assert.Nil(err)
+	_, err = ab.WriteTo(f)
+	assert.Nil(err)
+	assert.Nil(f.Close())
+
+	zipfile := filepath.Join(dir, "many.zip")
+	assert.Nil(ConvertArchive(src, zipfile))
+	entries, err := ListArchive(zipfile)
+	assert.Nil(err)
+	assert.Len(entries, n)
+
+	rc, err := OpenFileFromZip(zipfile, fmt.Sprintf("dir/%05d", n-1))
+	if assert.Nil(err) {
+		data, err := ioutil.ReadAll(rc)
+		assert.Nil(err)
+		assert.Equal(strconv.Itoa(n-1), string(data))
+		assert.Nil(rc.Close())
+	}
+
+	tarfile := filepath.Join(dir, "many.tar")
+	assert.Nil(ConvertArchive(zipfile, tarfile))
+	count, _, err := ArchiveSize(tarfile)
+	assert.Nil(err)
+	assert.Equal(n, count)
+}
@@ -0,0 +1,359 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// zipFlagEncrypted is set in the flags of encrypted zip files.
+	zipFlagEncrypted = 0x1
+	// zipFlagDataDescriptor is set when the CRC-32 follows the data.
+	zipFlagDataDescriptor = 0x8
+
+	// zipMethodAES is the method of files encrypted with WinZip AES, and
+	// zipExtraAES the ID of the extra field that describes the encryption.
+	zipMethodAES = 99
+	zipExtraAES  = 0x9901
+)
+
+// openEncryptedZipFile returns a reader for the decrypted and decompressed
+// contents of the zip file f, which is contained in the archive ra.
+func openEncryptedZipFile(ra io.ReaderAt, f *zip.File, password string) (io.ReadCloser, error) {
+	if password == "" {
+		return nil, PasswordError{f.Name}
+	}
+	offset, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	raw := io.NewSectionReader(ra, offset, int64(f.CompressedSize64))
+
+	var r io.Reader
+	var ar *aesReader
+	method, checkCRC := f.Method, true
+	if method == zipMethodAES {
+		var aesMethod uint16
+		var version int
+		ar, aesMethod, version, err = newAESReader(raw, f, password)
+		r, method = ar, aesMethod
+		// Version 2 does not store the CRC-32, as the HMAC protects the data.
+		checkCRC = version == 1
+	} else {
+		r, err = newZipCryptoReader(raw, f, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rc io.ReadCloser
+	switch method {
+	case zip.Store:
+		rc = ioutil.NopCloser(r)
+	case zip.Deflate:
+		rc = flate.NewReader(r)
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+	if ar != nil {
+		rc = &aesCheckReader{rc, ar}
+	}
+	if !checkCRC {
+		return rc, nil
+	}
+	return &crcReader{rc: rc, hash: crc32.NewIEEE(), want: f.CRC32}, nil
+}
+
+// errReader is a reader that always fails with err.
+type errReader struct {
+	err error
+}
+
+func (er errReader) Read(p []byte) (int, error) {
+	return 0, er.err
+}
+
+// crcReader verifies the CRC-32 of the data read from rc at EOF.
+type crcReader struct {
+	rc   io.ReadCloser
+	hash hash.Hash32
+	want uint32
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.rc.Read(p)
+	cr.hash.Write(p[:n])
+	if err == io.EOF && cr.hash.Sum32() != cr.want {
+		err = zip.ErrChecksum
+	}
+	return n, err
+}
+
+func (cr *crcReader) Close() error {
+	return cr.rc.Close()
+}
+
+// newZipCryptoReader returns a reader for the data of f decrypted with the
+// traditional PKWARE encryption, also known as ZipCrypto.
+func newZipCryptoReader(r io.Reader, f *zip.File, password string) (io.Reader, error) {
+	zc := newZipCrypto([]byte(password))
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	zc.decrypt(header[:])
+
+	// The last byte of the header allows checking the password. Depending on
+	// whether the CRC-32 is known beforehand, it is the high byte of either
+	// the CRC-32 or the modification time.
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&zipFlagDataDescriptor != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[11] != check {
+		return nil, PasswordError{f.Name}
+	}
+	return &zipCryptoReader{r, zc}, nil
+}
+
+// zipCrypto contains the keys of the traditional PKWARE encryption.
+type zipCrypto struct {
+	keys [3]uint32
+}
+
+func newZipCrypto(password []byte) *zipCrypto {
+	zc := &zipCrypto{[3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for _, b := range password {
+		zc.update(b)
+	}
+	return zc
+}
+
+func (zc *zipCrypto) update(b byte) {
+	zc.keys[0] = crc32Update(zc.keys[0], b)
+	zc.keys[1] += zc.keys[0] & 0xff
+	zc.keys[1] = zc.keys[1]*134775813 + 1
+	zc.keys[2] = crc32Update(zc.keys[2], byte(zc.keys[1]>>24))
+}
+
+func (zc *zipCrypto) decrypt(buf []byte) {
+	for i, c := range buf {
+		t := uint16(zc.keys[2] | 2)
+		c ^= byte((uint32(t) * uint32(t^1)) >> 8)
+		zc.update(c)
+		buf[i] = c
+	}
+}
+
+// crc32Update adds the byte b to the CRC-32 crc, without the final
+// inversion that crc32.Update performs.
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+// zipCryptoReader decrypts the data read from r.
+type zipCryptoReader struct {
+	r  io.Reader
+	zc *zipCrypto
+}
+
+func (zr *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := zr.r.Read(p)
+	zr.zc.decrypt(p[:n])
+	return n, err
+}
+
+// newAESReader returns a reader for the data of f decrypted with WinZip AES,
+// together with the actual compression method and the version of the
+// encryption format.
+func newAESReader(r *io.SectionReader, f *zip.File, password string) (*aesReader, uint16, int, error) {
+	version, strength, method, ok := parseAESExtra(f.Extra)
+	if !ok || strength < 1 || strength > 3 {
+		return nil, 0, 0, zip.ErrFormat
+	}
+	keyLen := 8 + 8*strength
+	saltLen := keyLen / 2
+	const verifierLen, macLen = 2, 10
+	dataLen := r.Size() - int64(saltLen+verifierLen+macLen)
+	if dataLen < 0 {
+		return nil, 0, 0, zip.ErrFormat
+	}
+
+	header := make([]byte, saltLen+verifierLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, 0, err
+	}
+	keys := pbkdf2SHA1([]byte(password), header[:saltLen], 1000, 2*keyLen+verifierLen)
+	if subtle.ConstantTimeCompare(keys[2*keyLen:], header[saltLen:]) != 1 {
+		return nil, 0, 0, PasswordError{f.Name}
+	}
+	block, err := aes.NewCipher(keys[:keyLen])
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	ar := &aesReader{
+		r:         io.NewSectionReader(r, int64(len(header)), dataLen),
+		block:     block,
+		mac:       hmac.New(sha1.New, keys[keyLen:2*keyLen]),
+		code:      io.NewSectionReader(r, int64(len(header))+dataLen, macLen),
+		remaining: dataLen,
+		pos:       aes.BlockSize,
+	}
+	return ar, method, version, nil
+}
+
+// parseAESExtra returns the contents of the WinZip AES extra field.
+func parseAESExtra(extra []byte) (version, strength int, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		if id == zipExtraAES && size >= 7 {
+			field := extra[:size]
+			return int(binary.LittleEndian.Uint16(field)), int(field[4]), binary.LittleEndian.Uint16(field[5:]), true
+		}
+		extra = extra[size:]
+	}
+	return 0, 0, 0, false
+}
+
+// aesReader decrypts the data read from r with AES in the counter mode of
+// WinZip, which uses a little-endian counter starting at 1, and checks the
+// authentication code as soon as all remaining bytes have been read.
+type aesReader struct {
+	r     io.Reader
+	block cipher.Block
+	mac   hash.Hash
+	code  io.Reader
+
+	remaining int64
+	checked   bool
+	err       error // of the check
+
+	counter   [aes.BlockSize]byte
+	keystream [aes.BlockSize]byte
+	pos       int
+}
+
+func (ar *aesReader) Read(p []byte) (int, error) {
+	if ar.checked {
+		if ar.err != nil {
+			return 0, ar.err
+		}
+		return 0, io.EOF
+	}
+	n, err := ar.r.Read(p)
+	ar.remaining -= int64(n)
+	ar.mac.Write(p[:n])
+	for i := range p[:n] {
+		if ar.pos == aes.BlockSize {
+			for j := range ar.counter {
+				ar.counter[j]++
+				if ar.counter[j] != 0 {
+					break
+				}
+			}
+			ar.block.Encrypt(ar.keystream[:], ar.counter[:])
+			ar.pos = 0
+		}
+		p[i] ^= ar.keystream[ar.pos]
+		ar.pos++
+	}
+	if ar.remaining <= 0 || err == io.EOF {
+		if cerr := ar.check(); cerr != nil {
+			return n, cerr
+		}
+		err = io.EOF
+	}
+	return n, err
+}
+
+// check compares the authentication code with that of the data read, once.
+func (ar *aesReader) check() error {
+	if ar.checked {
+		return ar.err
+	}
+	ar.checked = true
+	code, err := ioutil.ReadAll(ar.code)
+	if err == nil && !hmac.Equal(code, ar.mac.Sum(nil)[:len(code)]) {
+		err = zip.ErrChecksum
+	}
+	ar.err = err
+	return err
+}
+
+// verify reads the rest of the data, which a decompressor may have left
+// unread, and returns the result of checking the authentication code.
+func (ar *aesReader) verify() error {
+	if _, err := io.Copy(ioutil.Discard, ar); err != nil {
+		return err
+	}
+	return ar.check()
+}
+
+// aesCheckReader reads from rc, which decompresses the data of ar, and
+// verifies the authentication code of ar once rc is at EOF, since rc might
+// stop at the end of its stream without reading ar to the end, or read it
+// ahead and ignore the error.
+type aesCheckReader struct {
+	rc io.ReadCloser
+	ar *aesReader
+}
+
+func (cr *aesCheckReader) Read(p []byte) (int, error) {
+	n, err := cr.rc.Read(p)
+	if err == io.EOF {
+		if verr := cr.ar.verify(); verr != nil {
+			err = verr
+		}
+	}
+	return n, err
+}
+
+func (cr *aesCheckReader) Close() error {
+	return cr.rc.Close()
+}
+
+// pbkdf2SHA1 derives a key of keyLen bytes from password and salt with
+// PBKDF2, using HMAC-SHA1 as the pseudorandom function.
+func pbkdf2SHA1(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], block)
+		prf.Write(b[:])
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iter; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2015, Ben Morgan. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package osutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordZipCrypto(z *testing.T) {
+	assert := assert.New(z)
+
+	const archive = "testdata/dir_reader_data.encrypted.zip"
+	data, err := ReadFileFromArchive(archive, "dir2/file3", Password("secret"))
+	assert.Nil(err)
+	assert.Equal("dir2/file3\nthis sentence should span three files.\n", string(data))
+
+	files, err := ReadFilesFromArchive(archive, "dir1/")
+	assert.Nil(err, "unencrypted entries do not need a password")
+	assert.Contains(files, "dir1/")
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	assert.Nil(ExtractArchive(archive, dir, Password("secret")))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "dir2/file1"))
+	assert.Nil(err)
+	assert.Equal("dir2/file1\nApart from the header which is written in each file,\n", string(data))
+
+	_, err = ReadFileFromArchive(archive, "dir2/file3")
+	assert.Equal(PasswordError{"dir2/file3"}, err)
+	_, err = ReadFileFromArchive(archive, "dir2/file3", Password("wrong"))
+	assert.Equal(PasswordError{"dir2/file3"}, err)
+
+	// Listing does not require the password.
+	entries, err := ListArchive(archive)
+	assert.Nil(err)
+	assert.Len(entries, 7)
+}
+
+func TestPasswordAES(z *testing.T) {
+	assert := assert.New(z)
+
+	const archive = "testdata/hello-aes.zip"
+	data, err := ReadFileFromArchive(archive, "hello.txt", Password("golang"))
+	assert.Nil(err)
+	assert.Equal("Hello World\r\n", string(data))
+
+	_, err = ReadFileFromArchive(archive, "hello.txt", Password("wrong"))
+	assert.Equal(PasswordError{"hello.txt"}, err)
+}
+
+// aesZip returns a zip archive with the single file name, which contains
+// data deflated and encrypted with AES-128 in the AE-2 format, the default
+// of WinZip and 7-Zip. If tamper is true, its authentication code is wrong.
+func aesZip(assert *assert.Assertions, name, password string, data []byte, tamper bool) []byte {
+	var deflated bytes.Buffer
+	fw, err := flate.NewWriter(&deflated, flate.DefaultCompression)
+	assert.Nil(err)
+	fw.Write(data)
+	assert.Nil(fw.Close())
+
+	const keyLen = 16
+	salt := []byte("saltsalt")
+	keys := pbkdf2SHA1([]byte(password), salt, 1000, 2*keyLen+2)
+	block, err := aes.NewCipher(keys[:keyLen])
+	assert.Nil(err)
+	ciphertext := deflated.Bytes()
+	var counter, keystream [aes.BlockSize]byte
+	for i := range ciphertext {
+		if i%aes.BlockSize == 0 {
+			for j := range counter {
+				if counter[j]++; counter[j] != 0 {
+					break
+				}
+			}
+			block.Encrypt(keystream[:], counter[:])
+		}
+		ciphertext[i] ^= keystream[i%aes.BlockSize]
+	}
+	mac := hmac.New(sha1.New, keys[keyLen:2*keyLen])
+	mac.Write(ciphertext)
+	code := mac.Sum(nil)[:10]
+	if tamper {
+		code[0] ^= 1
+	}
+
+	raw := append(append(append(salt, keys[2*keyLen:]...), ciphertext...), code...)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Flags:              zipFlagEncrypted,
+		Method:             zipMethodAES,
+		Extra:              []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', 1, byte(zip.Deflate), 0},
+		CompressedSize64:   uint64(len(raw)),
+		UncompressedSize64: uint64(len(data)),
+	})
+	assert.Nil(err)
+	w.Write(raw)
+	assert.Nil(zw.Close())
+	return buf.Bytes()
+}
+
+func TestPasswordAESDeflate(z *testing.T) {
+	assert := assert.New(z)
+
+	dir, err := ioutil.TempDir("", "osutil")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+
+	content := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog.\n", 1000))
+	for _, tamper := range []bool{false, true} {
+		archive := filepath.Join(dir, "secret.zip")
+		assert.Nil(ioutil.WriteFile(archive, aesZip(assert, "secret.txt", "golang", content, tamper), 0644))
+		data, err := ReadFileFromArchive(archive, "secret.txt", Password("golang"))
+		if tamper {
+			assert.Equal(zip.ErrChecksum, err)
+		} else {
+			assert.Nil(err)
+			assert.Equal(content, data)
+		}
+		rc, err := OpenFileFromZip(archive, "secret.txt", Password("golang"))
+		assert.Nil(err)
+		_, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if tamper {
+			assert.Equal(zip.ErrChecksum, err)
+		} else {
+			assert.Nil(err)
+		}
+	}
+}
+
+func TestPBKDF2(z *testing.T) {
+	assert := assert.New(z)
+
+	// Test vector from RFC 6070.
+	key := pbkdf2SHA1([]byte("password"), []byte("salt"), 4096, 20)
+	assert.Equal("4b007901b765489abead49d926f721d065a429c1", hex.EncodeToString(key))
+}